@@ -1,19 +1,28 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sikozonpc/ecom/service/cart"
+	"github.com/sikozonpc/ecom/service/catalog"
+	"github.com/sikozonpc/ecom/service/learningpath"
+	"github.com/sikozonpc/ecom/service/notification"
 	"github.com/sikozonpc/ecom/service/order"
 	"github.com/sikozonpc/ecom/service/page"
+	"github.com/sikozonpc/ecom/service/qa"
 	"github.com/sikozonpc/ecom/service/rating"
+	"github.com/sikozonpc/ecom/service/recommendation"
 	"github.com/sikozonpc/ecom/service/search"
 	"github.com/sikozonpc/ecom/service/student"
 	"github.com/sikozonpc/ecom/service/teacher"
+	"github.com/sikozonpc/ecom/service/transcode"
 	"github.com/sikozonpc/ecom/service/user"
 	"github.com/sikozonpc/ecom/types"
 	// "github.com/sikozonpc/ecom/docs"
@@ -40,21 +49,43 @@ func (s *APIServer) Start() error {
 
 
 
+	// Opening the search backend, which the course builder and profile
+	// edits keep in sync
+	searchBackend, err := search.NewBackend(os.Getenv("SEARCH_BACKEND"), s.db, os.Getenv("SEARCH_INDEX_PATH"))
+	if err != nil {
+		return err
+	}
+	rebuildCtx, stopRebuild := context.WithCancel(context.Background())
+	defer stopRebuild()
+	go search.RebuildEvery(rebuildCtx, searchBackend, searchRebuildInterval())
+	go search.FollowRebuildRequests(rebuildCtx, s.db, searchBackend, rebuildRequestPoll)
+
 	// Registering user routes
 	techStore := teacher.NewStore(s.db)
 	userStore := user.NewStore(s.db) 
-	userHandler := user.NewHandler(userStore, s.db, techStore)
+	userHandler := user.NewHandler(userStore, s.db, techStore, searchBackend)
 	userHandler.AuthRoutes(subrouter)
 
+	// Starting the video transcoding pipeline
+	teacherStore := teacher.NewStore(s.db)
+	transcoder := transcode.NewFFmpegTranscoder(os.Getenv("FFMPEG_PATH"), os.Getenv("FFPROBE_PATH"))
+	pipeline := transcode.NewPipeline(transcoder, teacherStore, os.Getenv("MEDIA_ROOT"), os.Getenv("UPLOAD_ROOT"), transcodeWorkers())
+	if err := pipeline.Start(context.Background()); err != nil {
+		return err
+	}
+	defer pipeline.Stop()
 
 	// Registering teacher routes
-	teacherStore := teacher.NewStore(s.db)
-	teacherHandler := teacher.NewHandler(teacherStore, userStore)
+	teacherHandler := teacher.NewHandler(teacherStore, userStore, pipeline, searchBackend)
 	teacherHandler.TeachRoutes(subrouter)
 
 	// Registering the search routes
 	searchStore := search.NewStore(s.db)
-	searchHandler := search.NewHandler(searchStore)
+	searchLog := search.NewSearchLog(searchStore, searchLogQueue)
+	searchLogCtx, stopSearchLog := context.WithCancel(context.Background())
+	defer stopSearchLog()
+	go searchLog.Run(searchLogCtx)
+	searchHandler := search.NewHandler(searchBackend, searchStore, searchLog, userStore)
 	searchHandler.SearchRoutes(subrouter)
 
 	// Registering the cart routes
@@ -72,21 +103,136 @@ func (s *APIServer) Start() error {
 	studentHandler := student.NewHandler(studentStore, userStore)
 	studentHandler.StudentRoutes(subrouter)
 
-	// Registering the rating routes
+	// Registering the rating routes, prompting students to review courses
+	// in the background once they may
 	ratingStore := rating.NewStore(s.db)
-	ratingHandler := rating.NewHandler(ratingStore, userStore)
+	rules := reviewRules()
+	promptCtx, stopPrompt := context.WithCancel(context.Background())
+	defer stopPrompt()
+	go rating.PromptEvery(promptCtx, ratingStore, rules, reviewPromptInterval())
+	ratingHandler := rating.NewHandler(ratingStore, userStore, rules, searchBackend)
 	ratingHandler.RatingRoutes(subrouter)
 
+	// Registering the notification routes
+	notificationHandler := notification.NewHandler(notification.NewStore(s.db), userStore)
+	notificationHandler.NotificationRoutes(subrouter)
+
+	// Registering the course Q&A routes
+	qaHandler := qa.NewHandler(qa.NewStore(s.db), userStore)
+	qaHandler.QARoutes(subrouter)
+
+	// Recomputing recommendations in the background
+	recommendationStore := recommendation.NewStore(s.db)
+	recommendCtx, stopRecommend := context.WithCancel(context.Background())
+	defer stopRecommend()
+	go recommendation.RecomputeEvery(recommendCtx, recommendationStore, recommendationInterval(), os.Getenv("RECOMMENDATIONS_DETERMINISTIC") == "true")
+
+	// Registering the recommendation routes
+	recommendationHandler := recommendation.NewHandler(recommendationStore, userStore)
+	recommendationHandler.RecommendationRoutes(subrouter)
+
 	// Registering the page routes
 	pageStore := page.NewStore(s.db)
-	pageHandler := page.NewHandler(pageStore, userStore, teacherStore, ratingStore)
+	pageHandler := page.NewHandler(pageStore, userStore, teacherStore, ratingStore, recommendationStore)
 	pageHandler.PageRoutes(subrouter)
 
+	// Registering the catalog feeds, whose aggregates refresh in the background
+	catalogStore := catalog.NewStore(s.db)
+	catalogCtx, stopCatalog := context.WithCancel(context.Background())
+	defer stopCatalog()
+	go catalog.RefreshEvery(catalogCtx, catalogStore, catalogRefreshInterval())
+	catalogHandler := catalog.NewHandler(catalogStore, userStore)
+	catalogHandler.CatalogRoutes(subrouter)
+
+	// Registering the learning path routes
+	pathStore := learningpath.NewStore(s.db)
+	pathHandler := learningpath.NewHandler(pathStore, userStore)
+	pathHandler.LearningPathRoutes(subrouter)
+
 	log.Println("Starting On ", s.addr)
 	return http.ListenAndServe(s.addr, router)
 }
 
 
+func transcodeWorkers() int {
+	workers, err := strconv.Atoi(os.Getenv("TRANSCODE_WORKERS"))
+	if err != nil || workers < 1 {
+		return 2
+	}
+	return workers
+}
+
+
+// searchRebuildInterval reads how often the search backend is rebuilt from
+// SEARCH_LEXICON_REFRESH, e.g. "15m". This refreshes the "did you mean" word
+// list and the ratings and enrollments held by the embedded index.
+func searchRebuildInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("SEARCH_LEXICON_REFRESH"))
+	if err != nil || interval <= 0 {
+		return 10 * time.Minute
+	}
+	return interval
+}
+
+
+// searchLogQueue is how many searches can wait to be logged before new ones
+// are dropped.
+const searchLogQueue = 1000
+
+
+// rebuildRequestPoll is how often the API checks whether the search CLI
+// asked for a rebuild.
+const rebuildRequestPoll = 30 * time.Second
+
+
+// recommendationInterval reads how often recommendations are recomputed
+// from RECOMMENDATIONS_REFRESH, e.g. "6h".
+func recommendationInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("RECOMMENDATIONS_REFRESH"))
+	if err != nil || interval <= 0 {
+		return time.Hour
+	}
+	return interval
+}
+
+
+// catalogRefreshInterval reads how often the catalog feed aggregates are
+// refreshed from CATALOG_REFRESH, e.g. "5m".
+func catalogRefreshInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("CATALOG_REFRESH"))
+	if err != nil || interval <= 0 {
+		return 15 * time.Minute
+	}
+	return interval
+}
+
+
+// reviewRules reads when students may review a course: once they completed
+// REVIEW_MIN_PROGRESS percent of it, or were enrolled for REVIEW_MIN_ENROLLED,
+// e.g. "168h". Either can be set to 0 to turn it off.
+func reviewRules() types.ReviewRules {
+	rules := types.ReviewRules{MinProgress: 20, MinEnrolledFor: 7 * 24 * time.Hour}
+	if progress, err := strconv.ParseFloat(os.Getenv("REVIEW_MIN_PROGRESS"), 64); err == nil && progress >= 0 && progress <= 100 {
+		rules.MinProgress = progress
+	}
+	if enrolled, err := time.ParseDuration(os.Getenv("REVIEW_MIN_ENROLLED")); err == nil && enrolled >= 0 {
+		rules.MinEnrolledFor = enrolled
+	}
+	return rules
+}
+
+
+// reviewPromptInterval reads how often students who may now review a course
+// are prompted to from REVIEW_PROMPT_REFRESH, e.g. "30m".
+func reviewPromptInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("REVIEW_PROMPT_REFRESH"))
+	if err != nil || interval <= 0 {
+		return 15 * time.Minute
+	}
+	return interval
+}
+
+
 func LoggingMiddiware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
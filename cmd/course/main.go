@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/sikozonpc/ecom/db"
+	"github.com/sikozonpc/ecom/service/archive"
+	"github.com/sikozonpc/ecom/service/teacher"
+)
+
+// Exports and imports courses between environments:
+//
+//	go run cmd/course/main.go export -course 12 -out course.zip -manifest imscc
+//	go run cmd/course/main.go import -teacher 3 -in course.zip -slug-conflict fail
+//
+// Imported videos are queued for transcoding and picked up the next time the
+// API starts.
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("usage: course <export|import> [flags]")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	cfg := db.PostgresConfig{
+		Host:     os.Getenv("DB_HOST"),
+		Port:     os.Getenv("DB_PORT"),
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PASSWORD"),
+		DBName:   os.Getenv("DB_NAME"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+	}
+
+	conn, err := db.NewPostgresStorage(cfg)
+	if err != nil {
+		log.Fatalf("Could not connect to PostgreSQL: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Ping(); err != nil {
+		log.Fatalf("Could not ping PostgreSQL: %v", err)
+	}
+
+	store := teacher.NewStore(conn)
+
+	switch cmd := os.Args[1]; cmd {
+	case "export":
+		exportCourse(store, os.Args[2:])
+	case "import":
+		importCourse(store, os.Args[2:])
+	default:
+		log.Fatalf("Unknown command: %s", cmd)
+	}
+}
+
+
+func exportCourse(store *teacher.Store, args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	courseID := flags.Int("course", 0, "ID of the course to export")
+	out := flags.String("out", "", "output file (defaults to <slug>.<format>)")
+	formatName := flags.String("format", "zip", "archive format: zip or json")
+	manifestName := flags.String("manifest", "", "LMS manifest to include in zip archives: imscc or scorm")
+	flags.Parse(args)
+
+	if *courseID == 0 {
+		log.Fatal("-course is required")
+	}
+	format, err := archive.ParseFormat(*formatName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifest, err := archive.ParseManifest(*manifestName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exported, err := store.ExportCourse(*courseID)
+	if err != nil {
+		log.Fatalf("Could not export course: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := archive.Write(&buf, exported, format, manifest); err != nil {
+		log.Fatalf("Could not write archive: %v", err)
+	}
+
+	path := *out
+	if path == "" {
+		path = archive.Filename(exported, format)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		log.Fatalf("Could not write %s: %v", path, err)
+	}
+
+	log.Printf("Exported course %d to %s (%d sections, %d media references)", *courseID, path, len(exported.Sections), len(exported.Media))
+}
+
+
+func importCourse(store *teacher.Store, args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	teacherID := flags.Int("teacher", 0, "ID of the teacher who will own the course")
+	in := flags.String("in", "", "archive to import")
+	categoryID := flags.Int("category", 0, "put the course in this category instead of the archived one")
+	slugs := flags.String("slug-conflict", "rename", "when the slug is taken: rename or fail")
+	categories := flags.String("category-conflict", "match", "when the archived category is missing: match fails, create adds it")
+	flags.Parse(args)
+
+	if *teacherID == 0 || *in == "" {
+		log.Fatal("-teacher and -in are required")
+	}
+
+	opts, err := archive.ParseImportOptions(*teacherID, *categoryID, *slugs, *categories)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatalf("Could not read %s: %v", *in, err)
+	}
+
+	imported, err := archive.Read(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	course, jobs, err := store.ImportCourse(imported, opts)
+	if err != nil {
+		log.Fatalf("Could not import course: %v", err)
+	}
+
+	log.Printf("Imported %q as course %d (%s); %d videos queued for transcoding", course.Name, course.ID, course.Slug, len(jobs))
+}
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_videos_status;
+
+ALTER TABLE videos
+    DROP CONSTRAINT IF EXISTS video_status_check,
+    DROP COLUMN IF EXISTS transcode_error,
+    DROP COLUMN IF EXISTS duration,
+    DROP COLUMN IF EXISTS thumbnail,
+    DROP COLUMN IF EXISTS hls_playlist,
+    DROP COLUMN IF EXISTS status;
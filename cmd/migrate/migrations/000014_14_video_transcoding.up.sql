@@ -0,0 +1,9 @@
+ALTER TABLE videos
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    ADD COLUMN hls_playlist VARCHAR(255),
+    ADD COLUMN thumbnail VARCHAR(255),
+    ADD COLUMN duration INT NOT NULL DEFAULT 0,
+    ADD COLUMN transcode_error TEXT,
+    ADD CONSTRAINT video_status_check CHECK (status IN ('queued', 'processing', 'ready', 'failed'));
+
+CREATE INDEX idx_videos_status ON videos (status);
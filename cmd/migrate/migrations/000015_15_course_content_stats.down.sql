@@ -0,0 +1,5 @@
+ALTER TABLE courses
+    DROP COLUMN IF EXISTS content_updated_at,
+    DROP COLUMN IF EXISTS lecture_count,
+    DROP COLUMN IF EXISTS section_count,
+    DROP COLUMN IF EXISTS total_duration;
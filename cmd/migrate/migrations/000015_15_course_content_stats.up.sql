@@ -0,0 +1,15 @@
+ALTER TABLE courses
+    ADD COLUMN total_duration INT NOT NULL DEFAULT 0,
+    ADD COLUMN section_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN lecture_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN content_updated_at TIMESTAMPTZ DEFAULT NOW();
+
+UPDATE courses c SET
+    section_count = (SELECT COUNT(*) FROM sections s WHERE s.course_id = c.id),
+    lecture_count = (SELECT COUNT(*) FROM videos v JOIN sections s ON v.section_id = s.id WHERE s.course_id = c.id),
+    total_duration = (SELECT COALESCE(SUM(v.duration), 0) FROM videos v JOIN sections s ON v.section_id = s.id WHERE s.course_id = c.id),
+    content_updated_at = GREATEST(
+        c.modified_at,
+        (SELECT MAX(s.modified_at) FROM sections s WHERE s.course_id = c.id),
+        (SELECT MAX(v.modified_at) FROM videos v JOIN sections s ON v.section_id = s.id WHERE s.course_id = c.id)
+    );
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_courses_status;
+
+ALTER TABLE courses
+    DROP CONSTRAINT IF EXISTS course_status_check,
+    DROP COLUMN IF EXISTS published_at,
+    DROP COLUMN IF EXISTS reviewed_by,
+    DROP COLUMN IF EXISTS reviewed_at,
+    DROP COLUMN IF EXISTS submitted_at,
+    DROP COLUMN IF EXISTS rejection_reason,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,13 @@
+ALTER TABLE courses
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'draft',
+    ADD COLUMN rejection_reason TEXT,
+    ADD COLUMN submitted_at TIMESTAMPTZ,
+    ADD COLUMN reviewed_at TIMESTAMPTZ,
+    ADD COLUMN reviewed_by INT REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN published_at TIMESTAMPTZ,
+    ADD CONSTRAINT course_status_check CHECK (status IN ('draft', 'submitted', 'approved', 'rejected', 'published', 'archived'));
+
+-- Courses created before the review workflow existed were already live
+UPDATE courses SET status = 'published', published_at = created_at;
+
+CREATE INDEX idx_courses_status ON courses (status);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_videos_detached_course;
+
+DELETE FROM videos WHERE detached_course_id IS NOT NULL;
+ALTER TABLE videos DROP COLUMN IF EXISTS detached_course_id;
+
+DROP TABLE IF EXISTS course_revisions;
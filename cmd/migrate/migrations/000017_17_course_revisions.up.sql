@@ -0,0 +1,24 @@
+CREATE TABLE course_revisions (
+    id SERIAL PRIMARY KEY,
+    course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    number INT,
+    status VARCHAR(20) NOT NULL,
+    author_id INT REFERENCES teachers(id) ON DELETE SET NULL,
+    message TEXT,
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    published_at TIMESTAMPTZ,
+    CONSTRAINT revision_status_check CHECK (status IN ('draft', 'published')),
+    CONSTRAINT revision_number_check CHECK ((status = 'draft') = (number IS NULL))
+);
+
+CREATE UNIQUE INDEX idx_course_revisions_number ON course_revisions (course_id, number);
+CREATE UNIQUE INDEX idx_course_revisions_draft ON course_revisions (course_id) WHERE status = 'draft';
+
+-- Publishing a revision that drops a video detaches it from its section
+-- instead of deleting it, so lecture progress and questions about it survive
+-- and rolling back to a revision that has it brings it back.
+ALTER TABLE videos ALTER COLUMN section_id DROP NOT NULL;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS detached_course_id INT REFERENCES courses(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_videos_detached_course ON videos (detached_course_id) WHERE detached_course_id IS NOT NULL;
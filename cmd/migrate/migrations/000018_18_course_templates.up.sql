@@ -0,0 +1,9 @@
+CREATE TABLE course_templates (
+    id SERIAL PRIMARY KEY,
+    course_id INT NOT NULL UNIQUE REFERENCES courses(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    modified_at TIMESTAMPTZ DEFAULT NOW()
+);
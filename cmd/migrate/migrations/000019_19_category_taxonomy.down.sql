@@ -0,0 +1,7 @@
+-- Merged duplicates and teacher ownership are not restored
+DROP INDEX IF EXISTS idx_categories_parent;
+DROP INDEX IF EXISTS idx_categories_sibling_name;
+
+ALTER TABLE categories
+    DROP CONSTRAINT IF EXISTS category_parent_check,
+    DROP COLUMN IF EXISTS parent_id;
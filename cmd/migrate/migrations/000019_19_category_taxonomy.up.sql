@@ -0,0 +1,21 @@
+ALTER TABLE categories
+    ADD COLUMN parent_id INT REFERENCES categories(id) ON DELETE RESTRICT,
+    ADD CONSTRAINT category_parent_check CHECK (parent_id <> id);
+
+-- Categories become global: fold the per-teacher copies of each name into
+-- the oldest one and repoint their courses before dropping the rest
+CREATE TEMP TABLE category_merge AS
+SELECT c.id AS old_id, k.id AS new_id
+FROM categories c
+JOIN (SELECT LOWER(TRIM(name)) AS key, MIN(id) AS id FROM categories GROUP BY LOWER(TRIM(name))) k
+    ON LOWER(TRIM(c.name)) = k.key
+WHERE c.id <> k.id;
+
+UPDATE courses SET category_id = m.new_id FROM category_merge m WHERE courses.category_id = m.old_id;
+DELETE FROM categories WHERE id IN (SELECT old_id FROM category_merge);
+DROP TABLE category_merge;
+
+UPDATE categories SET teacher_id = NULL;
+
+CREATE UNIQUE INDEX idx_categories_sibling_name ON categories (COALESCE(parent_id, 0), LOWER(name));
+CREATE INDEX idx_categories_parent ON categories (parent_id);
@@ -0,0 +1,20 @@
+CREATE TABLE tags (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL,
+    slug VARCHAR(100) UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_tags_name ON tags (LOWER(name));
+CREATE INDEX idx_tags_name_prefix ON tags (LOWER(name) text_pattern_ops);
+
+-- kind records how a course uses the tag: a topic it covers or a skill it teaches
+CREATE TABLE course_tags (
+    course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    tag_id INT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    kind VARCHAR(10) NOT NULL DEFAULT 'topic',
+    PRIMARY KEY (course_id, tag_id),
+    CONSTRAINT course_tag_kind_check CHECK (kind IN ('topic', 'skill'))
+);
+
+CREATE INDEX idx_course_tags_tag ON course_tags (tag_id);
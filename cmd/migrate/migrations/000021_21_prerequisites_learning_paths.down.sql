@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS lecture_progress;
+DROP TABLE IF EXISTS learning_path_courses;
+DROP TABLE IF EXISTS learning_paths;
+DROP TABLE IF EXISTS course_prerequisites;
+
+ALTER TABLE courses
+    DROP CONSTRAINT IF EXISTS course_prerequisite_policy_check,
+    DROP COLUMN IF EXISTS prerequisite_policy;
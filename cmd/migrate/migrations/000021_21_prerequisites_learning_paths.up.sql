@@ -0,0 +1,40 @@
+-- warn lets students buy a course without its prerequisites, block refuses
+ALTER TABLE courses
+    ADD COLUMN prerequisite_policy VARCHAR(10) NOT NULL DEFAULT 'warn',
+    ADD CONSTRAINT course_prerequisite_policy_check CHECK (prerequisite_policy IN ('warn', 'block'));
+
+CREATE TABLE course_prerequisites (
+    course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    prerequisite_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    PRIMARY KEY (course_id, prerequisite_id),
+    CONSTRAINT course_prerequisite_self_check CHECK (course_id <> prerequisite_id)
+);
+
+CREATE INDEX idx_course_prerequisites_prerequisite ON course_prerequisites (prerequisite_id);
+
+CREATE TABLE learning_paths (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    slug VARCHAR(300) UNIQUE NOT NULL,
+    description TEXT,
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    modified_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE learning_path_courses (
+    path_id INT NOT NULL REFERENCES learning_paths(id) ON DELETE CASCADE,
+    course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    PRIMARY KEY (path_id, course_id)
+);
+
+CREATE INDEX idx_learning_path_courses_course ON learning_path_courses (course_id);
+
+-- one row per lecture a student has finished
+CREATE TABLE lecture_progress (
+    student_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    completed_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (student_id, video_id)
+);
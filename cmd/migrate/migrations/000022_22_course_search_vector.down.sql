@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS course_tags_search_vector_refresh ON course_tags;
+DROP TRIGGER IF EXISTS users_search_vector_refresh ON users;
+DROP TRIGGER IF EXISTS categories_search_vector_refresh ON categories;
+DROP TRIGGER IF EXISTS courses_search_vector_update ON courses;
+
+DROP FUNCTION IF EXISTS refresh_course_search_vectors();
+DROP FUNCTION IF EXISTS courses_search_vector_trigger();
+DROP FUNCTION IF EXISTS course_search_vector(INT, TEXT, TEXT, INT, INT);
+
+DROP INDEX IF EXISTS idx_courses_search_vector;
+ALTER TABLE courses DROP COLUMN IF EXISTS search_vector;
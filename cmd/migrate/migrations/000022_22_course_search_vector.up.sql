@@ -0,0 +1,65 @@
+-- Full-text document for the catalog search. Weights: A course name,
+-- B category, tags and teacher name, C description. The configuration must
+-- match searchConfig in service/search.
+ALTER TABLE courses ADD COLUMN search_vector TSVECTOR;
+
+CREATE OR REPLACE FUNCTION course_search_vector(p_course_id INT, p_name TEXT, p_description TEXT, p_category_id INT, p_teacher_id INT)
+RETURNS TSVECTOR AS $$
+    SELECT
+        setweight(to_tsvector('english', COALESCE(p_name, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE((SELECT name FROM categories WHERE id = p_category_id), '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE((
+            SELECT string_agg(t.name, ' ') FROM course_tags ct JOIN tags t ON ct.tag_id = t.id
+            WHERE ct.course_id = p_course_id), '')), 'B') ||
+        setweight(to_tsvector('simple', COALESCE((
+            SELECT u.first_name || ' ' || u.last_name FROM teachers t JOIN users u ON t.user_id = u.id
+            WHERE t.id = p_teacher_id), '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(p_description, '')), 'C')
+$$ LANGUAGE SQL STABLE;
+
+CREATE OR REPLACE FUNCTION courses_search_vector_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector := course_search_vector(NEW.id, NEW.name, NEW.description, NEW.category_id, NEW.teacher_id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER courses_search_vector_update
+    BEFORE INSERT OR UPDATE OF name, description, category_id, teacher_id ON courses
+    FOR EACH ROW EXECUTE FUNCTION courses_search_vector_trigger();
+
+-- Renaming a category, a teacher or retagging a course changes the document
+-- of courses that only reference them
+CREATE OR REPLACE FUNCTION refresh_course_search_vectors() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_TABLE_NAME = 'categories' THEN
+        UPDATE courses c SET search_vector = course_search_vector(c.id, c.name, c.description, c.category_id, c.teacher_id)
+        WHERE c.category_id = NEW.id;
+    ELSIF TG_TABLE_NAME = 'users' THEN
+        UPDATE courses c SET search_vector = course_search_vector(c.id, c.name, c.description, c.category_id, c.teacher_id)
+        FROM teachers t WHERE c.teacher_id = t.id AND t.user_id = NEW.id;
+    ELSIF TG_TABLE_NAME = 'course_tags' THEN
+        UPDATE courses c SET search_vector = course_search_vector(c.id, c.name, c.description, c.category_id, c.teacher_id)
+        WHERE c.id = COALESCE(NEW.course_id, OLD.course_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER categories_search_vector_refresh
+    AFTER UPDATE OF name ON categories
+    FOR EACH ROW WHEN (OLD.name IS DISTINCT FROM NEW.name)
+    EXECUTE FUNCTION refresh_course_search_vectors();
+
+CREATE TRIGGER users_search_vector_refresh
+    AFTER UPDATE OF first_name, last_name ON users
+    FOR EACH ROW WHEN (OLD.first_name IS DISTINCT FROM NEW.first_name OR OLD.last_name IS DISTINCT FROM NEW.last_name)
+    EXECUTE FUNCTION refresh_course_search_vectors();
+
+CREATE TRIGGER course_tags_search_vector_refresh
+    AFTER INSERT OR DELETE ON course_tags
+    FOR EACH ROW EXECUTE FUNCTION refresh_course_search_vectors();
+
+UPDATE courses c SET search_vector = course_search_vector(c.id, c.name, c.description, c.category_id, c.teacher_id);
+
+CREATE INDEX idx_courses_search_vector ON courses USING GIN (search_vector);
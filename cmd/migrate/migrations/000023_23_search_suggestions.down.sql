@@ -0,0 +1,6 @@
+DROP MATERIALIZED VIEW IF EXISTS search_lexicon;
+
+DROP INDEX IF EXISTS idx_users_full_name_trgm;
+DROP INDEX IF EXISTS idx_tags_name_trgm;
+DROP INDEX IF EXISTS idx_categories_name_trgm;
+DROP INDEX IF EXISTS idx_courses_name_trgm;
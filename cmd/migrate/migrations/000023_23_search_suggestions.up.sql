@@ -0,0 +1,29 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- trigram indexes back the typo tolerant completions of /search/suggest
+CREATE INDEX idx_courses_name_trgm ON courses USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_categories_name_trgm ON categories USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_tags_name_trgm ON tags USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_users_full_name_trgm ON users USING GIN ((first_name || ' ' || last_name) gin_trgm_ops);
+
+-- Every word appearing in the published catalog, unstemmed, with the number
+-- of courses using it. "Did you mean" corrections are picked from here. The
+-- API refreshes it periodically.
+CREATE MATERIALIZED VIEW search_lexicon AS
+SELECT word, ndoc
+FROM ts_stat($lexicon$
+    SELECT to_tsvector('simple',
+        c.name || ' ' || COALESCE(c.description, '') || ' ' || COALESCE(cat.name, '') || ' ' ||
+        u.first_name || ' ' || u.last_name || ' ' ||
+        COALESCE((SELECT string_agg(t.name, ' ') FROM course_tags ct JOIN tags t ON ct.tag_id = t.id
+                  WHERE ct.course_id = c.id), ''))
+    FROM courses c
+    JOIN teachers te ON c.teacher_id = te.id
+    JOIN users u ON te.user_id = u.id
+    LEFT JOIN categories cat ON c.category_id = cat.id
+    WHERE c.status = 'published'
+$lexicon$)
+WHERE length(word) >= 3 AND word !~ '^[0-9]+$';
+
+CREATE UNIQUE INDEX idx_search_lexicon_word ON search_lexicon (word);
+CREATE INDEX idx_search_lexicon_word_trgm ON search_lexicon USING GIN (word gin_trgm_ops);
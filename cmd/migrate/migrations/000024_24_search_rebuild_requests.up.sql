@@ -0,0 +1,6 @@
+-- Rebuilds asked for by the search CLI. Every API process polls the latest
+-- id and rebuilds its own embedded index when it changes.
+CREATE TABLE IF NOT EXISTS search_rebuild_requests (
+    id SERIAL PRIMARY KEY,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,32 @@
+-- One row per /search request. normalized_query is the lowercased term with
+-- whitespace collapsed, which the reports group by. Clicks name their search by
+-- token rather than the sequential id, so ids cannot be guessed.
+CREATE TABLE IF NOT EXISTS search_queries (
+    id SERIAL PRIMARY KEY,
+    query TEXT NOT NULL,
+    normalized_query TEXT NOT NULL,
+    filters JSONB NOT NULL DEFAULT '{}',
+    sort VARCHAR(20) NOT NULL,
+    page INT NOT NULL DEFAULT 1,
+    result_count INT NOT NULL,
+    latency_ms REAL NOT NULL,
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_search_queries_created_at ON search_queries (created_at);
+CREATE INDEX idx_search_queries_normalized ON search_queries (normalized_query, created_at);
+
+-- A result opened from a search. position is 1-based across pages.
+CREATE TABLE IF NOT EXISTS search_clicks (
+    id SERIAL PRIMARY KEY,
+    search_id INT NOT NULL REFERENCES search_queries(id) ON DELETE CASCADE,
+    course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    position INT NOT NULL CHECK (position > 0),
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (search_id, course_id)
+);
+
+CREATE INDEX idx_search_clicks_course ON search_clicks (course_id);
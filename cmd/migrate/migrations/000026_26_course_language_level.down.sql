@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_courses_level;
+DROP INDEX IF EXISTS idx_courses_language;
+
+ALTER TABLE courses
+    DROP CONSTRAINT IF EXISTS course_level_check,
+    DROP COLUMN IF EXISTS level,
+    DROP COLUMN IF EXISTS language;
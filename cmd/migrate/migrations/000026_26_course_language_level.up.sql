@@ -0,0 +1,8 @@
+-- language is a lowercase BCP 47 tag such as "en" or "pt-br"
+ALTER TABLE courses
+    ADD COLUMN language VARCHAR(10) NOT NULL DEFAULT 'en',
+    ADD COLUMN level VARCHAR(20) NOT NULL DEFAULT 'all_levels',
+    ADD CONSTRAINT course_level_check CHECK (level IN ('beginner', 'intermediate', 'advanced', 'all_levels'));
+
+CREATE INDEX idx_courses_language ON courses (language);
+CREATE INDEX idx_courses_level ON courses (level);
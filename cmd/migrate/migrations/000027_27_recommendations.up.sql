@@ -0,0 +1,17 @@
+-- Precomputed recommendations, replaced wholesale by every recompute.
+-- kind 'student' holds a student's personal picks (subject_id is the
+-- student), 'also_bought' the courses taken together with a course
+-- (subject_id is the course) and 'popular' the fallback for students
+-- without history (subject_id is 0).
+CREATE TABLE IF NOT EXISTS recommendations (
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('student', 'also_bought', 'popular')),
+    subject_id INT NOT NULL DEFAULT 0,
+    course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    score REAL NOT NULL,
+    position INT NOT NULL,
+    reason VARCHAR(30) NOT NULL,
+    computed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (kind, subject_id, course_id)
+);
+
+CREATE INDEX idx_recommendations_subject ON recommendations (kind, subject_id, position);
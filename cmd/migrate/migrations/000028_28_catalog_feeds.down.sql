@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS featured_courses;
+DROP MATERIALIZED VIEW IF EXISTS course_feed_stats;
+DROP MATERIALIZED VIEW IF EXISTS course_enrollment_daily;
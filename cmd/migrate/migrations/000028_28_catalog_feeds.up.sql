@@ -0,0 +1,37 @@
+-- Enrollments per course and day over the last 90 days. The trending feed
+-- totals any window up to that from here instead of scanning enrollments.
+CREATE MATERIALIZED VIEW IF NOT EXISTS course_enrollment_daily AS
+SELECT e.course_id, e.enrolled_at::date AS day, COUNT(*) AS enrollments
+FROM enrollments e
+WHERE e.course_id IS NOT NULL AND e.enrolled_at >= CURRENT_DATE - 90
+GROUP BY e.course_id, e.enrolled_at::date;
+
+-- The unique index lets the view be refreshed concurrently
+CREATE UNIQUE INDEX idx_course_enrollment_daily ON course_enrollment_daily (course_id, day);
+CREATE INDEX idx_course_enrollment_daily_day ON course_enrollment_daily (day);
+
+-- Lifetime totals per course for the bestseller, new and top rated feeds.
+-- sales counts courses sold in completed orders.
+CREATE MATERIALIZED VIEW IF NOT EXISTS course_feed_stats AS
+SELECT c.id AS course_id,
+       COALESCE(e.enrollments, 0) AS enrollments,
+       COALESCE(s.sales, 0) AS sales,
+       COALESCE(r.rating, 0)::float8 AS rating,
+       COALESCE(r.ratings, 0) AS ratings
+FROM courses c
+LEFT JOIN (SELECT course_id, COUNT(*) AS enrollments FROM enrollments GROUP BY course_id) e ON e.course_id = c.id
+LEFT JOIN (SELECT oi.course_id, COUNT(*) AS sales
+           FROM order_items oi JOIN orders o ON o.id = oi.order_id
+           WHERE o.status = 'completed'
+           GROUP BY oi.course_id) s ON s.course_id = c.id
+LEFT JOIN (SELECT course_id, AVG(rating) AS rating, COUNT(*) AS ratings FROM ratings GROUP BY course_id) r ON r.course_id = c.id;
+
+CREATE UNIQUE INDEX idx_course_feed_stats ON course_feed_stats (course_id);
+
+-- Courses picked by admins for the homepage, in display order.
+CREATE TABLE IF NOT EXISTS featured_courses (
+    course_id INT PRIMARY KEY REFERENCES courses(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    featured_by INT REFERENCES users(id) ON DELETE SET NULL,
+    featured_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,29 @@
+DROP MATERIALIZED VIEW IF EXISTS course_feed_stats;
+
+CREATE MATERIALIZED VIEW course_feed_stats AS
+SELECT c.id AS course_id,
+       COALESCE(e.enrollments, 0) AS enrollments,
+       COALESCE(s.sales, 0) AS sales,
+       COALESCE(r.rating, 0)::float8 AS rating,
+       COALESCE(r.ratings, 0) AS ratings
+FROM courses c
+LEFT JOIN (SELECT course_id, COUNT(*) AS enrollments FROM enrollments GROUP BY course_id) e ON e.course_id = c.id
+LEFT JOIN (SELECT oi.course_id, COUNT(*) AS sales
+           FROM order_items oi JOIN orders o ON o.id = oi.order_id
+           WHERE o.status = 'completed'
+           GROUP BY oi.course_id) s ON s.course_id = c.id
+LEFT JOIN (SELECT course_id, AVG(rating) AS rating, COUNT(*) AS ratings FROM ratings GROUP BY course_id) r ON r.course_id = c.id;
+
+CREATE UNIQUE INDEX idx_course_feed_stats ON course_feed_stats (course_id);
+
+DROP TABLE IF EXISTS review_moderation_log;
+DROP TABLE IF EXISTS review_reports;
+
+DROP INDEX IF EXISTS idx_ratings_course_status;
+
+ALTER TABLE ratings
+    DROP CONSTRAINT IF EXISTS rating_status_check,
+    DROP COLUMN IF EXISTS moderated_at,
+    DROP COLUMN IF EXISTS moderated_by,
+    DROP COLUMN IF EXISTS moderation_reason,
+    DROP COLUMN IF EXISTS status;
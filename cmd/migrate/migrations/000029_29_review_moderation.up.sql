@@ -0,0 +1,60 @@
+-- Reviews caught by the filter or reported too often wait as 'pending'
+-- until an admin approves them; 'hidden' ones were taken down. Only
+-- 'published' ratings are shown and counted.
+ALTER TABLE ratings
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'published',
+    ADD COLUMN moderation_reason TEXT,
+    ADD COLUMN moderated_by INT REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN moderated_at TIMESTAMPTZ,
+    ADD CONSTRAINT rating_status_check CHECK (status IN ('published', 'pending', 'hidden'));
+
+CREATE INDEX idx_ratings_course_status ON ratings (course_id, status);
+
+-- A user flagging a review. resolved_at is set once an admin acts on it.
+CREATE TABLE IF NOT EXISTS review_reports (
+    id SERIAL PRIMARY KEY,
+    rating_id INT NOT NULL REFERENCES ratings(id) ON DELETE CASCADE,
+    reporter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('spam', 'offensive', 'off_topic', 'other')),
+    details TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMPTZ,
+    UNIQUE (rating_id, reporter_id)
+);
+
+CREATE INDEX idx_review_reports_open ON review_reports (rating_id) WHERE resolved_at IS NULL;
+
+-- Every moderation action. rating_id is kept after a delete, so it has no
+-- foreign key.
+CREATE TABLE IF NOT EXISTS review_moderation_log (
+    id SERIAL PRIMARY KEY,
+    rating_id INT NOT NULL,
+    course_id INT REFERENCES courses(id) ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('filter', 'report', 'approve', 'hide', 'delete')),
+    reason TEXT NOT NULL DEFAULT '',
+    moderator_id INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_review_moderation_log_rating ON review_moderation_log (rating_id);
+
+-- The catalog feeds only count published ratings too
+DROP MATERIALIZED VIEW IF EXISTS course_feed_stats;
+
+CREATE MATERIALIZED VIEW course_feed_stats AS
+SELECT c.id AS course_id,
+       COALESCE(e.enrollments, 0) AS enrollments,
+       COALESCE(s.sales, 0) AS sales,
+       COALESCE(r.rating, 0)::float8 AS rating,
+       COALESCE(r.ratings, 0) AS ratings
+FROM courses c
+LEFT JOIN (SELECT course_id, COUNT(*) AS enrollments FROM enrollments GROUP BY course_id) e ON e.course_id = c.id
+LEFT JOIN (SELECT oi.course_id, COUNT(*) AS sales
+           FROM order_items oi JOIN orders o ON o.id = oi.order_id
+           WHERE o.status = 'completed'
+           GROUP BY oi.course_id) s ON s.course_id = c.id
+LEFT JOIN (SELECT course_id, AVG(rating) AS rating, COUNT(*) AS ratings
+           FROM ratings WHERE status = 'published'
+           GROUP BY course_id) r ON r.course_id = c.id;
+
+CREATE UNIQUE INDEX idx_course_feed_stats ON course_feed_stats (course_id);
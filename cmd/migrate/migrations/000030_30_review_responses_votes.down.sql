@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_ratings_course_helpful;
+
+ALTER TABLE ratings
+    DROP COLUMN IF EXISTS unhelpful_votes,
+    DROP COLUMN IF EXISTS helpful_votes;
+
+DROP TABLE IF EXISTS review_votes;
+DROP TABLE IF EXISTS review_responses;
@@ -0,0 +1,25 @@
+-- The course's teacher can answer a review once, publicly. Editing the
+-- response replaces it.
+CREATE TABLE IF NOT EXISTS review_responses (
+    rating_id INT PRIMARY KEY REFERENCES ratings(id) ON DELETE CASCADE,
+    teacher_id INT NOT NULL REFERENCES teachers(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One helpful/unhelpful vote per user and review. Users may change their
+-- vote; the totals on ratings are kept in step with this table.
+CREATE TABLE IF NOT EXISTS review_votes (
+    rating_id INT NOT NULL REFERENCES ratings(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    helpful BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (rating_id, user_id)
+);
+
+ALTER TABLE ratings
+    ADD COLUMN helpful_votes INT NOT NULL DEFAULT 0,
+    ADD COLUMN unhelpful_votes INT NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_ratings_course_helpful ON ratings (course_id, helpful_votes DESC, created_at DESC, id DESC);
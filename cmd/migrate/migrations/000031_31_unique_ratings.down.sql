@@ -0,0 +1,3 @@
+ALTER TABLE ratings
+    DROP CONSTRAINT IF EXISTS ratings_student_course_key,
+    DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,11 @@
+-- A student rates a course once; rating it again replaces the rating.
+-- Duplicates from before keep only the student's latest rating.
+DELETE FROM ratings r
+USING ratings newer
+WHERE r.student_id = newer.student_id
+  AND r.course_id = newer.course_id
+  AND (r.created_at, r.id) < (newer.created_at, newer.id);
+
+ALTER TABLE ratings
+    ADD COLUMN updated_at TIMESTAMPTZ,
+    ADD CONSTRAINT ratings_student_course_key UNIQUE (student_id, course_id);
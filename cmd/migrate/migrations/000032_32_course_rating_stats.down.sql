@@ -0,0 +1,27 @@
+DROP MATERIALIZED VIEW IF EXISTS course_feed_stats;
+
+CREATE MATERIALIZED VIEW course_feed_stats AS
+SELECT c.id AS course_id,
+       COALESCE(e.enrollments, 0) AS enrollments,
+       COALESCE(s.sales, 0) AS sales,
+       COALESCE(r.rating, 0)::float8 AS rating,
+       COALESCE(r.ratings, 0) AS ratings
+FROM courses c
+LEFT JOIN (SELECT course_id, COUNT(*) AS enrollments FROM enrollments GROUP BY course_id) e ON e.course_id = c.id
+LEFT JOIN (SELECT oi.course_id, COUNT(*) AS sales
+           FROM order_items oi JOIN orders o ON o.id = oi.order_id
+           WHERE o.status = 'completed'
+           GROUP BY oi.course_id) s ON s.course_id = c.id
+LEFT JOIN (SELECT course_id, AVG(rating) AS rating, COUNT(*) AS ratings
+           FROM ratings WHERE status = 'published'
+           GROUP BY course_id) r ON r.course_id = c.id;
+
+CREATE UNIQUE INDEX idx_course_feed_stats ON course_feed_stats (course_id);
+
+DROP INDEX IF EXISTS idx_courses_rating_average;
+
+ALTER TABLE courses
+    DROP COLUMN IF EXISTS rating_histogram,
+    DROP COLUMN IF EXISTS review_count,
+    DROP COLUMN IF EXISTS rating_count,
+    DROP COLUMN IF EXISTS rating_average;
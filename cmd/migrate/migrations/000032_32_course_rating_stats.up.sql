@@ -0,0 +1,40 @@
+-- Rating aggregates kept on the course so listings do not have to query
+-- the ratings of every course. Only published ratings count. The
+-- histogram counts ratings rounded to 1 to 5 stars.
+ALTER TABLE courses
+    ADD COLUMN rating_average DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN rating_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN review_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN rating_histogram INT[] NOT NULL DEFAULT '{0,0,0,0,0}';
+
+UPDATE courses c SET (rating_average, rating_count, review_count, rating_histogram) = (
+    SELECT COALESCE(AVG(r.rating), 0)::float8,
+           COUNT(*),
+           COUNT(CASE WHEN r.review IS NOT NULL AND r.review <> '' THEN 1 END),
+           ARRAY[COUNT(*) FILTER (WHERE r.rating < 1.5),
+                 COUNT(*) FILTER (WHERE r.rating >= 1.5 AND r.rating < 2.5),
+                 COUNT(*) FILTER (WHERE r.rating >= 2.5 AND r.rating < 3.5),
+                 COUNT(*) FILTER (WHERE r.rating >= 3.5 AND r.rating < 4.5),
+                 COUNT(*) FILTER (WHERE r.rating >= 4.5)]::int[]
+    FROM ratings r
+    WHERE r.course_id = c.id AND r.status = 'published'
+);
+
+CREATE INDEX idx_courses_rating_average ON courses (rating_average DESC);
+
+-- The catalog feeds read ratings from these columns now, so the feed
+-- stats keep enrollments and sales only
+DROP MATERIALIZED VIEW IF EXISTS course_feed_stats;
+
+CREATE MATERIALIZED VIEW course_feed_stats AS
+SELECT c.id AS course_id,
+       COALESCE(e.enrollments, 0) AS enrollments,
+       COALESCE(s.sales, 0) AS sales
+FROM courses c
+LEFT JOIN (SELECT course_id, COUNT(*) AS enrollments FROM enrollments GROUP BY course_id) e ON e.course_id = c.id
+LEFT JOIN (SELECT oi.course_id, COUNT(*) AS sales
+           FROM order_items oi JOIN orders o ON o.id = oi.order_id
+           WHERE o.status = 'completed'
+           GROUP BY oi.course_id) s ON s.course_id = c.id;
+
+CREATE UNIQUE INDEX idx_course_feed_stats ON course_feed_stats (course_id);
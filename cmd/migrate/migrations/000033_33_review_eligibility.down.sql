@@ -0,0 +1,3 @@
+ALTER TABLE ratings DROP COLUMN IF EXISTS reviewer_progress;
+
+DROP TABLE IF EXISTS notifications;
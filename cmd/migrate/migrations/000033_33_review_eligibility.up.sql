@@ -0,0 +1,22 @@
+-- In-app notifications. link points the client at what the notification
+-- is about.
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(30) NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    link TEXT NOT NULL DEFAULT '',
+    course_id INT REFERENCES courses(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    read_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_notifications_user ON notifications (user_id, created_at DESC, id DESC);
+
+-- A student is asked to review a course once
+CREATE UNIQUE INDEX idx_notifications_review_prompt ON notifications (user_id, course_id) WHERE kind = 'review_prompt';
+
+-- How much of the course, in percent, the reviewer had completed when they
+-- last saved their rating. Unknown for ratings from before.
+ALTER TABLE ratings ADD COLUMN reviewer_progress REAL;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS answer_votes;
+DROP TABLE IF EXISTS question_votes;
+DROP TABLE IF EXISTS question_answers;
+DROP TABLE IF EXISTS course_questions;
@@ -0,0 +1,51 @@
+-- Course Q&A. A question belongs to a course and optionally to one of its
+-- lectures; answers can reply to other answers. Only enrolled students and
+-- the course's teacher take part.
+CREATE TABLE IF NOT EXISTS course_questions (
+    id SERIAL PRIMARY KEY,
+    course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    video_id INT REFERENCES videos(id) ON DELETE SET NULL,
+    author_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(200) NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    upvotes INT NOT NULL DEFAULT 0,
+    answer_count INT NOT NULL DEFAULT 0,
+    answered_by_instructor BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Searched with the same configuration as searchConfig in service/search
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', body), 'B')
+    ) STORED
+);
+
+CREATE INDEX idx_course_questions_course ON course_questions (course_id, created_at DESC, id DESC);
+CREATE INDEX idx_course_questions_video ON course_questions (video_id) WHERE video_id IS NOT NULL;
+CREATE INDEX idx_course_questions_search ON course_questions USING GIN (search_vector);
+
+CREATE TABLE IF NOT EXISTS question_answers (
+    id SERIAL PRIMARY KEY,
+    question_id INT NOT NULL REFERENCES course_questions(id) ON DELETE CASCADE,
+    parent_id INT REFERENCES question_answers(id) ON DELETE CASCADE,
+    author_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    by_instructor BOOLEAN NOT NULL DEFAULT FALSE,
+    upvotes INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_question_answers_question ON question_answers (question_id, created_at, id);
+
+-- One upvote per user on each question and answer
+CREATE TABLE IF NOT EXISTS question_votes (
+    question_id INT NOT NULL REFERENCES course_questions(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (question_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS answer_votes (
+    answer_id INT NOT NULL REFERENCES question_answers(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (answer_id, user_id)
+);
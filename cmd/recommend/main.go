@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/sikozonpc/ecom/db"
+	"github.com/sikozonpc/ecom/service/recommendation"
+)
+
+// Recomputes recommendations outside the API:
+//
+//	go run cmd/recommend/main.go recompute
+//	go run cmd/recommend/main.go recompute -deterministic
+//
+// Deterministic mode defaults to RECOMMENDATIONS_DETERMINISTIC, the same
+// setting the API reads; with it the same data always gives the same
+// recommendations, so runs can be compared. A recompute already running in
+// the API makes this one fail rather than wait.
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("usage: recommend <recompute> [flags]")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	cfg := db.PostgresConfig{
+		Host:     os.Getenv("DB_HOST"),
+		Port:     os.Getenv("DB_PORT"),
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PASSWORD"),
+		DBName:   os.Getenv("DB_NAME"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+	}
+
+	conn, err := db.NewPostgresStorage(cfg)
+	if err != nil {
+		log.Fatalf("Could not connect to PostgreSQL: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Ping(); err != nil {
+		log.Fatalf("Could not ping PostgreSQL: %v", err)
+	}
+
+	switch cmd := os.Args[1]; cmd {
+	case "recompute":
+		flags := flag.NewFlagSet("recompute", flag.ExitOnError)
+		deterministic := flags.Bool("deterministic", os.Getenv("RECOMMENDATIONS_DETERMINISTIC") == "true", "no random variety between runs")
+		flags.Parse(os.Args[2:])
+
+		store := recommendation.NewStore(conn)
+		count, err := store.Recompute(recommendation.DefaultOptions(*deterministic))
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Stored %d recommendations", count)
+	default:
+		log.Fatalf("Unknown command: %s", cmd)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/sikozonpc/ecom/db"
+	"github.com/sikozonpc/ecom/service/search"
+)
+
+// Maintains the search backend outside the API:
+//
+//	go run cmd/search/main.go rebuild
+//	go run cmd/search/main.go rebuild -backend embedded -index search.idx
+//
+// The backend and index path default to SEARCH_BACKEND and
+// SEARCH_INDEX_PATH, the same settings the API reads. Running API servers
+// pick up the rebuild request within a minute and rebuild their own index.
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("usage: search <rebuild> [flags]")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	cfg := db.PostgresConfig{
+		Host:     os.Getenv("DB_HOST"),
+		Port:     os.Getenv("DB_PORT"),
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PASSWORD"),
+		DBName:   os.Getenv("DB_NAME"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+	}
+
+	conn, err := db.NewPostgresStorage(cfg)
+	if err != nil {
+		log.Fatalf("Could not connect to PostgreSQL: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Ping(); err != nil {
+		log.Fatalf("Could not ping PostgreSQL: %v", err)
+	}
+
+	switch cmd := os.Args[1]; cmd {
+	case "rebuild":
+		flags := flag.NewFlagSet("rebuild", flag.ExitOnError)
+		kind := flags.String("backend", os.Getenv("SEARCH_BACKEND"), "search backend: postgres or embedded")
+		path := flags.String("index", os.Getenv("SEARCH_INDEX_PATH"), "file the embedded index is saved to")
+		flags.Parse(os.Args[2:])
+
+		// Opening an embedded index may load a stale file first; Rebuild
+		// below replaces it either way.
+		backend, err := search.NewBackend(*kind, conn, *path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		count, err := backend.Rebuild()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Search index rebuilt with %d courses", count)
+
+		// Running APIs keep their own index and would overwrite this one
+		if err := search.RequestRebuild(conn); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Asked running API servers to rebuild their search index")
+	default:
+		log.Fatalf("Unknown command: %s", cmd)
+	}
+}
@@ -0,0 +1,229 @@
+// Package archive reads and writes the portable course archive used to move
+// courses between environments. An archive is either a bare JSON document or
+// a ZIP file holding that document as course.json, optionally next to an
+// imsmanifest.xml for LMSs that understand IMS Common Cartridge or SCORM.
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+)
+
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatZIP  Format = "zip"
+)
+
+const (
+	courseFile   = "course.json"
+	manifestFile = "imsmanifest.xml"
+)
+
+// maxCourseSize caps course.json once decompressed, so a small ZIP cannot
+// expand into more than an import can hold in memory.
+const maxCourseSize = 32 << 20
+
+// maxTags and maxTagLength match the limits on tags a teacher enters.
+const (
+	maxTags      = 20
+	maxTagLength = 50
+)
+
+// ParseFormat validates a format name, defaulting to ZIP.
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case "", FormatZIP:
+		return FormatZIP, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("unknown archive format: %s", name)
+}
+
+// Write encodes a course archive in the given format. manifest is only used
+// for ZIP archives; pass ManifestNone to leave it out.
+func Write(w io.Writer, course *types.CourseArchive, format Format, manifest Manifest) error {
+	if format == FormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(course)
+	}
+
+	zw := zip.NewWriter(w)
+
+	file, err := zw.Create(courseFile)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(course); err != nil {
+		return fmt.Errorf("could not encode course: %v", err)
+	}
+
+	if manifest != ManifestNone {
+		data, err := BuildManifest(course, manifest)
+		if err != nil {
+			return err
+		}
+		file, err := zw.Create(manifestFile)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// Read decodes an archive, detecting whether it is JSON or ZIP.
+func Read(data []byte) (*types.CourseArchive, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("could not open zip archive: %v", err)
+		}
+
+		var entry *zip.File
+		for _, f := range zr.File {
+			if f.Name == courseFile {
+				entry = f
+				break
+			}
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("archive has no %s", courseFile)
+		}
+		if entry.UncompressedSize64 > maxCourseSize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", courseFile, maxCourseSize)
+		}
+
+		file, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("could not open %s: %v", courseFile, err)
+		}
+		defer file.Close()
+
+		// The declared size can lie, so the read is capped as well
+		data, err = io.ReadAll(io.LimitReader(file, maxCourseSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %v", courseFile, err)
+		}
+		if len(data) > maxCourseSize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", courseFile, maxCourseSize)
+		}
+	}
+
+	var course types.CourseArchive
+	if err := json.Unmarshal(data, &course); err != nil {
+		return nil, fmt.Errorf("could not decode course archive: %v", err)
+	}
+
+	if course.Version < 1 || course.Version > types.CourseArchiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d (supported up to %d)", course.Version, types.CourseArchiveVersion)
+	}
+	if course.Course.Name == "" {
+		return nil, fmt.Errorf("archive has no course name")
+	}
+	if err := validate(&course); err != nil {
+		return nil, err
+	}
+
+	return &course, nil
+}
+
+// validate applies the rules the course builder applies to the same fields,
+// so an archive cannot bring in values a teacher could not enter.
+func validate(course *types.CourseArchive) error {
+	if err := utils.Validate.Var(course.Course.Language, "omitempty,max=10,bcp47_language_tag"); err != nil {
+		return fmt.Errorf("invalid course language %q", course.Course.Language)
+	}
+	if err := utils.Validate.Var(string(course.Course.Level), "omitempty,oneof=beginner intermediate advanced all_levels"); err != nil {
+		return fmt.Errorf("invalid course level %q", course.Course.Level)
+	}
+	if course.Course.Price < 0 {
+		return fmt.Errorf("invalid course price %v", course.Course.Price)
+	}
+	if course.Course.IntroVideo != "" {
+		if err := utils.ValidateVideoFile(course.Course.IntroVideo); err != nil {
+			return fmt.Errorf("intro video: %v", err)
+		}
+	}
+	if course.Course.Image != "" {
+		if err := utils.ValidateVideoFile(course.Course.Image); err != nil {
+			return fmt.Errorf("image: %v", err)
+		}
+	}
+
+	if len(course.Course.Tags) > maxTags {
+		return fmt.Errorf("a course can have at most %d tags", maxTags)
+	}
+	for _, tag := range course.Course.Tags {
+		if err := utils.Validate.Var(tag.Name, fmt.Sprintf("required,max=%d", maxTagLength)); err != nil {
+			return fmt.Errorf("invalid tag %q: tags need a name of at most %d characters", tag.Name, maxTagLength)
+		}
+	}
+
+	for _, section := range course.Sections {
+		if section.Title == "" {
+			return fmt.Errorf("every section needs a title")
+		}
+		for _, video := range section.Videos {
+			if video.Title == "" {
+				return fmt.Errorf("every video in section %q needs a title", section.Title)
+			}
+			if err := utils.ValidateVideoFile(video.VideoFile); err != nil {
+				return fmt.Errorf("video %q: %v", video.Title, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Filename suggests a file name for an exported course.
+func Filename(course *types.CourseArchive, format Format) string {
+	name := course.Course.Slug
+	if name == "" {
+		name = "course"
+	}
+	return name + "." + string(format)
+}
+
+// ParseImportOptions validates the conflict strategies for an import,
+// defaulting to renaming slugs and matching categories by name.
+func ParseImportOptions(teacherID, categoryID int, slugs, categories string) (types.ImportOptions, error) {
+	opts := types.ImportOptions{
+		TeacherID:  teacherID,
+		CategoryID: categoryID,
+		Slugs:      types.SlugConflictRename,
+		Categories: types.CategoryConflictMatch,
+	}
+
+	switch types.SlugConflict(slugs) {
+	case "":
+	case types.SlugConflictRename, types.SlugConflictFail:
+		opts.Slugs = types.SlugConflict(slugs)
+	default:
+		return opts, fmt.Errorf("unknown slug conflict strategy: %s", slugs)
+	}
+
+	switch types.CategoryConflict(categories) {
+	case "":
+	case types.CategoryConflictMatch, types.CategoryConflictCreate:
+		opts.Categories = types.CategoryConflict(categories)
+	default:
+		return opts, fmt.Errorf("unknown category conflict strategy: %s", categories)
+	}
+
+	return opts, nil
+}
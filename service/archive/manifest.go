@@ -0,0 +1,179 @@
+package archive
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/sikozonpc/ecom/types"
+)
+
+// Manifest selects the LMS manifest written next to course.json in a ZIP
+// archive. The manifest only lists the course structure and references the
+// media; it does not package a playable SCO.
+type Manifest string
+
+const (
+	ManifestNone  Manifest = ""
+	ManifestIMSCC Manifest = "imscc"
+	ManifestSCORM Manifest = "scorm"
+)
+
+// ParseManifest validates a manifest name; an empty name means none.
+func ParseManifest(name string) (Manifest, error) {
+	switch Manifest(name) {
+	case ManifestNone, ManifestIMSCC, ManifestSCORM:
+		return Manifest(name), nil
+	}
+	return "", fmt.Errorf("unknown manifest type: %s", name)
+}
+
+type manifestXML struct {
+	XMLName       xml.Name         `xml:"manifest"`
+	Identifier    string           `xml:"identifier,attr"`
+	Version       string           `xml:"version,attr,omitempty"`
+	Namespaces    []xml.Attr       `xml:",attr"`
+	Metadata      metadataXML      `xml:"metadata"`
+	Organizations organizationsXML `xml:"organizations"`
+	Resources     []resourceXML    `xml:"resources>resource"`
+}
+
+type metadataXML struct {
+	Schema        string  `xml:"schema"`
+	SchemaVersion string  `xml:"schemaversion"`
+	LOM           *lomXML `xml:"lomimscc:lom,omitempty"`
+}
+
+type lomXML struct {
+	Title       string `xml:"lomimscc:general>lomimscc:title>lomimscc:string"`
+	Description string `xml:"lomimscc:general>lomimscc:description>lomimscc:string,omitempty"`
+}
+
+type organizationsXML struct {
+	Default      string          `xml:"default,attr,omitempty"`
+	Organization organizationXML `xml:"organization"`
+}
+
+type organizationXML struct {
+	Identifier string    `xml:"identifier,attr"`
+	Structure  string    `xml:"structure,attr,omitempty"`
+	Title      string    `xml:"title,omitempty"`
+	Items      []itemXML `xml:"item"`
+}
+
+type itemXML struct {
+	Identifier    string    `xml:"identifier,attr"`
+	IdentifierRef string    `xml:"identifierref,attr,omitempty"`
+	Title         string    `xml:"title"`
+	Items         []itemXML `xml:"item"`
+}
+
+type resourceXML struct {
+	Identifier string    `xml:"identifier,attr"`
+	Type       string    `xml:"type,attr"`
+	ScormType  string    `xml:"adlcp:scormtype,attr,omitempty"`
+	Href       string    `xml:"href,attr"`
+	Files      []fileXML `xml:"file"`
+}
+
+type fileXML struct {
+	Href string `xml:"href,attr"`
+}
+
+// BuildManifest renders an imsmanifest.xml describing the course: one item
+// per section holding one item per video, each video pointing at a
+// webcontent resource for its file.
+func BuildManifest(course *types.CourseArchive, kind Manifest) ([]byte, error) {
+	var items []itemXML
+	var resources []resourceXML
+
+	for i, section := range course.Sections {
+		sectionItem := itemXML{
+			Identifier: fmt.Sprintf("SECTION_%d", i+1),
+			Title:      section.Title,
+		}
+		for j, video := range section.Videos {
+			resourceID := fmt.Sprintf("RES_%d_%d", i+1, j+1)
+			sectionItem.Items = append(sectionItem.Items, itemXML{
+				Identifier:    fmt.Sprintf("ITEM_%d_%d", i+1, j+1),
+				IdentifierRef: resourceID,
+				Title:         video.Title,
+			})
+
+			resource := resourceXML{
+				Identifier: resourceID,
+				Type:       "webcontent",
+				Href:       video.VideoFile,
+				Files:      []fileXML{{Href: video.VideoFile}},
+			}
+			if kind == ManifestSCORM {
+				resource.ScormType = "asset"
+			}
+			resources = append(resources, resource)
+		}
+		items = append(items, sectionItem)
+	}
+
+	manifest := manifestXML{
+		Identifier: "MANIFEST_" + identifier(course.Course.Slug),
+		Resources:  resources,
+	}
+
+	switch kind {
+	case ManifestIMSCC:
+		manifest.Namespaces = []xml.Attr{
+			{Name: xml.Name{Local: "xmlns"}, Value: "http://www.imsglobal.org/xsd/imsccv1p1/imscp_v1p1"},
+			{Name: xml.Name{Local: "xmlns:lomimscc"}, Value: "http://ltsc.ieee.org/xsd/imsccv1p1/LOM/manifest"},
+		}
+		manifest.Metadata = metadataXML{
+			Schema:        "IMS Common Cartridge",
+			SchemaVersion: "1.1.0",
+			LOM:           &lomXML{Title: course.Course.Name, Description: course.Course.Description},
+		}
+		// Common Cartridge wraps the outline in a single root item
+		manifest.Organizations.Organization = organizationXML{
+			Identifier: "ORG_1",
+			Structure:  "rooted-hierarchy",
+			Items:      []itemXML{{Identifier: "ROOT", Title: course.Course.Name, Items: items}},
+		}
+	case ManifestSCORM:
+		manifest.Version = "1.2"
+		manifest.Namespaces = []xml.Attr{
+			{Name: xml.Name{Local: "xmlns"}, Value: "http://www.imsproject.org/xsd/imscp_rootv1p1p2"},
+			{Name: xml.Name{Local: "xmlns:adlcp"}, Value: "http://www.adlnet.org/xsd/adlcp_rootv1p2"},
+		}
+		manifest.Metadata = metadataXML{Schema: "ADL SCORM", SchemaVersion: "1.2"}
+		manifest.Organizations = organizationsXML{
+			Default: "ORG_1",
+			Organization: organizationXML{
+				Identifier: "ORG_1",
+				Title:      course.Course.Name,
+				Items:      items,
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unknown manifest type: %s", kind)
+	}
+
+	data, err := xml.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not encode manifest: %v", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// identifier turns a slug into a valid XML ID fragment.
+func identifier(slug string) string {
+	out := make([]rune, 0, len(slug))
+	for _, r := range slug {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			out = append(out, r)
+		default:
+			out = append(out, '_')
+		}
+	}
+	if len(out) == 0 {
+		return "COURSE"
+	}
+	return string(out)
+}
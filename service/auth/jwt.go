@@ -248,4 +248,14 @@ func GetUserIDFromContext(ctx context.Context) int {
 	}
 
 	return userID
-}
\ No newline at end of file
+}
+
+func GetUserRoleFromContext(ctx context.Context) types.UserRole {
+	role, ok := ctx.Value(RoleKey).(types.UserRole)
+
+	if !ok {
+		return -1
+	}
+
+	return role
+}
@@ -1,6 +1,7 @@
 package cart
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -10,6 +11,7 @@ import (
 	"github.com/sikozonpc/ecom/service/auth"
 	"github.com/sikozonpc/ecom/types"
 	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
 )
 
 type Handler struct {
@@ -47,8 +49,18 @@ func (h *Handler) cartHandler(writer http.ResponseWriter, request *http.Request)
         return
     }
 
-	cartItems, err := h.cart.GetCartItemsByUserID(userID)
+	params, err := pagination.FromRequest(request, "cart", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	cartItems, err := h.cart.GetCartPage(userID, params)
 	if err!= nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
         utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to get cart: %v", err))
         return
     }
@@ -85,6 +97,24 @@ func (h *Handler) addToCartHandler(writer http.ResponseWriter, request *http.Req
         return
     }
 
+	policy, missing, err := h.cart.GetMissingPrerequisites(userID, payload.CourseID)
+	if err != nil {
+		if errors.Is(err, ErrCourseNotFound) {
+			utils.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to check prerequisites: %v", err))
+		return
+	}
+	if len(missing) > 0 && policy == types.PrerequisiteBlock {
+		response := map[string]interface{}{
+			"err":                   "complete the prerequisites of this course before buying it",
+			"missing_prerequisites": missing,
+		}
+		utils.WriteJSON(writer, http.StatusConflict, response)
+		return
+	}
+
 	cartItem := types.Cart{
 		UserID: userID,
         CourseID: payload.CourseID,
@@ -98,9 +128,13 @@ func (h *Handler) addToCartHandler(writer http.ResponseWriter, request *http.Req
         return
 	}
 
-	response := map[string]string{
+	response := map[string]interface{}{
 		"message": "course added to cart successfully",
 	}
+	if len(missing) > 0 {
+		response["warning"] = "you have not taken the prerequisites of this course yet"
+		response["missing_prerequisites"] = missing
+	}
 	utils.WriteJSON(writer, http.StatusOK, response)
 }
 
@@ -2,11 +2,16 @@ package cart
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils/pagination"
 )
 
+var ErrCourseNotFound = errors.New("course not found")
+
 type Store struct {
 	db *sql.DB
 }
@@ -29,6 +34,44 @@ func (s *Store) CheckIfCourseInCart(userID, courseID int) (bool, error) {
 
 
 
+// GetMissingPrerequisites lists the published prerequisites of a course the
+// user is not enrolled in, along with the course's prerequisite policy.
+func (s *Store) GetMissingPrerequisites(userID, courseID int) (types.PrerequisitePolicy, []types.CoursePrerequisite, error) {
+	var policy types.PrerequisitePolicy
+	err := s.db.QueryRow(`SELECT prerequisite_policy FROM courses WHERE id = $1`, courseID).Scan(&policy)
+	if err == sql.ErrNoRows {
+		return "", nil, ErrCourseNotFound
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("could not fetch prerequisite policy: %v", err)
+	}
+
+	query := `
+	SELECT c.id, c.name, c.slug
+	FROM course_prerequisites cp
+	JOIN courses c ON cp.prerequisite_id = c.id
+	WHERE cp.course_id = $1 AND c.status = 'published'
+	  AND NOT EXISTS (SELECT 1 FROM enrollments e WHERE e.course_id = c.id AND e.student_id = $2)
+	ORDER BY c.name, c.id
+	`
+	rows, err := s.db.Query(query, courseID, userID)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not check prerequisites: %v", err)
+	}
+	defer rows.Close()
+
+	var missing []types.CoursePrerequisite
+	for rows.Next() {
+		var prerequisite types.CoursePrerequisite
+		if err := rows.Scan(&prerequisite.ID, &prerequisite.Name, &prerequisite.Slug); err != nil {
+			return "", nil, fmt.Errorf("could not scan prerequisite row: %v", err)
+		}
+		missing = append(missing, prerequisite)
+	}
+	return policy, missing, rows.Err()
+}
+
+
 func (s *Store) AddToCart(cart *types.Cart) error {
 	query := `
     INSERT INTO cart (user_id, course_id, created_at, modified_at)
@@ -84,6 +127,50 @@ func (s *Store) GetCartItemsByUserID(userID int) ([]types.Cart, error) {
 	return cartItems, nil
 }
 
+// cartKeyset lists cart items newest first.
+var cartKeyset = pagination.Keyset{Columns: []string{"c.created_at", "c.id"}, Desc: true}
+
+func cartKey(item types.Cart) []interface{} {
+	return []interface{}{item.CreatedAt.Format(time.RFC3339Nano), item.ID}
+}
+
+
+// GetCartPage returns one page of the cart for display. Checkout reads the
+// whole cart with GetCartItemsByUserID.
+func (s *Store) GetCartPage(userID int, params pagination.Params) (pagination.Page[types.Cart], error) {
+	var page pagination.Page[types.Cart]
+
+	cursor, args, err := cartKeyset.Where(params, []interface{}{userID})
+	if err != nil {
+		return page, err
+	}
+	order, args := cartKeyset.OrderBy(params, args)
+
+	rows, err := s.db.Query(`
+	SELECT c.id, c.user_id, c.course_id, courses.name, c.created_at, c.modified_at
+	FROM cart AS c
+	JOIN courses ON c.course_id = courses.id
+	WHERE c.user_id = $1`+cursor+order, args...)
+	if err != nil {
+		return page, fmt.Errorf("could not fetch cart items: %v", err)
+	}
+	defer rows.Close()
+
+	items := []types.Cart{}
+	for rows.Next() {
+		var item types.Cart
+		if err := rows.Scan(&item.ID, &item.UserID, &item.CourseID, &item.CourseName, &item.CreatedAt, &item.ModifiedAt); err != nil {
+			return page, fmt.Errorf("could not scan cart item row: %v", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("error during rows iteration: %v", err)
+	}
+
+	return pagination.NewPage(items, params, cartKey), nil
+}
+
 func (o *Store) DeleteCartItems(userID int) error {
     query := "DELETE FROM cart WHERE user_id = $1"
     _, err := o.db.Exec(query, userID)
@@ -0,0 +1,261 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sikozonpc/ecom/service/auth"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+)
+
+type Handler struct {
+	catalog types.CatalogStore
+	store   types.UserStore
+}
+
+
+func NewHandler(catalog types.CatalogStore, store types.UserStore) *Handler {
+	return &Handler{
+		catalog: catalog,
+		store:   store,
+	}
+}
+
+
+func (h *Handler) CatalogRoutes(router *mux.Router) {
+	adminOnly := []types.UserRole{types.ADMIN}
+
+	router.HandleFunc("/catalog/home", h.homeHandle).Methods(http.MethodGet)
+	router.HandleFunc("/catalog/trending", h.trendingHandle).Methods(http.MethodGet)
+	router.HandleFunc("/catalog/bestsellers", h.bestsellersHandle).Methods(http.MethodGet)
+	router.HandleFunc("/catalog/bestsellers/{category_id:[0-9]+}", h.categoryBestsellersHandle).Methods(http.MethodGet)
+	router.HandleFunc("/catalog/new", h.newReleasesHandle).Methods(http.MethodGet)
+	router.HandleFunc("/catalog/top_rated", h.topRatedHandle).Methods(http.MethodGet)
+	router.HandleFunc("/catalog/featured", h.featuredHandle).Methods(http.MethodGet)
+
+	router.HandleFunc("/admin/catalog/featured", auth.WithJWTAuth(h.setFeaturedHandle, h.store, adminOnly)).Methods(http.MethodPut)
+}
+
+
+const (
+	defaultFeedLimit = 10
+	maxFeedLimit     = 50
+
+	// Windows the trending and new release feeds look back over by
+	// default; trending can look back as far as course_enrollment_daily keeps
+	defaultTrendingDays = 7
+	maxTrendingDays     = 90
+	defaultNewDays      = 30
+
+	// Ratings a course needs before it can be listed as top rated
+	minTopRatedRatings = 5
+)
+
+
+// intParam reads an integer query parameter between min and max, falling
+// back to def when it is missing.
+func intParam(request *http.Request, name string, def, min, max int) (int, error) {
+	value := request.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("invalid %s parameter, expected %d to %d", name, min, max)
+	}
+	return n, nil
+}
+
+
+func (h *Handler) homeHandle(writer http.ResponseWriter, request *http.Request) {
+	featured, err := h.catalog.GetFeatured(defaultFeedLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	trending, err := h.catalog.GetTrending(defaultTrendingDays, defaultFeedLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	newReleases, err := h.catalog.GetNewReleases(defaultNewDays, 0, defaultFeedLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	topRated, err := h.catalog.GetTopRated(minTopRatedRatings, defaultFeedLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, map[string]interface{}{
+		"featured":  featured,
+		"trending":  trending,
+		"new":       newReleases,
+		"top_rated": topRated,
+	})
+}
+
+
+func (h *Handler) trendingHandle(writer http.ResponseWriter, request *http.Request) {
+	days, err := intParam(request, "days", defaultTrendingDays, 1, maxTrendingDays)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := intParam(request, "limit", defaultFeedLimit, 1, maxFeedLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	courses, err := h.catalog.GetTrending(days, limit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, courses)
+}
+
+
+func (h *Handler) bestsellersHandle(writer http.ResponseWriter, request *http.Request) {
+	limit, err := intParam(request, "limit", 5, 1, maxFeedLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	categories, err := h.catalog.GetBestsellersByCategory(limit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, categories)
+}
+
+
+func (h *Handler) categoryBestsellersHandle(writer http.ResponseWriter, request *http.Request) {
+	categoryID, err := strconv.Atoi(mux.Vars(request)["category_id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid category ID"))
+		return
+	}
+	limit, err := intParam(request, "limit", defaultFeedLimit, 1, maxFeedLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	courses, err := h.catalog.GetBestsellers(categoryID, limit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, courses)
+}
+
+
+func (h *Handler) newReleasesHandle(writer http.ResponseWriter, request *http.Request) {
+	days, err := intParam(request, "days", defaultNewDays, 1, 365)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := intParam(request, "limit", defaultFeedLimit, 1, maxFeedLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	var minRating float64
+	if value := request.URL.Query().Get("min_rating"); value != "" {
+		minRating, err = strconv.ParseFloat(value, 64)
+		if err != nil || minRating < 0 || minRating > 5 {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid min_rating parameter"))
+			return
+		}
+	}
+
+	courses, err := h.catalog.GetNewReleases(days, minRating, limit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, courses)
+}
+
+
+func (h *Handler) topRatedHandle(writer http.ResponseWriter, request *http.Request) {
+	limit, err := intParam(request, "limit", defaultFeedLimit, 1, maxFeedLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	courses, err := h.catalog.GetTopRated(minTopRatedRatings, limit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, courses)
+}
+
+
+func (h *Handler) featuredHandle(writer http.ResponseWriter, request *http.Request) {
+	limit, err := intParam(request, "limit", defaultFeedLimit, 1, maxFeedLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	courses, err := h.catalog.GetFeatured(limit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, courses)
+}
+
+
+func (h *Handler) setFeaturedHandle(writer http.ResponseWriter, request *http.Request) {
+	var payload types.SetFeaturedPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.catalog.SetFeatured(payload.CourseIDs, auth.GetUserIDFromContext(request.Context())); err != nil {
+		if errors.Is(err, ErrInvalidFeaturedCourse) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	courses, err := h.catalog.GetFeatured(maxFeedLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, map[string]interface{}{
+		"message":  "Featured courses updated successfully",
+		"featured": courses,
+	})
+}
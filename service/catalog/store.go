@@ -0,0 +1,303 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sikozonpc/ecom/types"
+)
+
+var ErrInvalidFeaturedCourse = errors.New("invalid featured course")
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+
+// RefreshStats rebuilds the aggregates behind the feeds. Concurrent
+// refreshes keep the old rows readable while the new ones are computed.
+func (s *Store) RefreshStats() error {
+	for _, view := range []string{"course_enrollment_daily", "course_feed_stats"} {
+		if _, err := s.db.Exec(`REFRESH MATERIALIZED VIEW CONCURRENTLY ` + view); err != nil {
+			return fmt.Errorf("could not refresh %s: %v", view, err)
+		}
+	}
+	return nil
+}
+
+
+// RefreshEvery refreshes the feed aggregates on a fixed interval until ctx
+// is cancelled. Failures are logged and retried on the next tick.
+func RefreshEvery(ctx context.Context, store types.CatalogStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := store.RefreshStats(); err != nil {
+				log.Println(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+
+// feedColumns are scanned by scanFeedCourses; queries may append columns
+// of their own after them. Ratings come from the aggregates kept on the
+// course, which are current, rather than from the periodic feed stats.
+const feedColumns = `c.id, c.name, c.slug, COALESCE(c.image, ''), c.price, c.category_id,
+	u.first_name || ' ' || u.last_name,
+	c.rating_average, c.rating_count, COALESCE(fs.enrollments, 0), COALESCE(fs.sales, 0),
+	COALESCE(c.published_at, c.created_at)`
+
+const feedJoins = `FROM courses c
+	JOIN teachers t ON c.teacher_id = t.id
+	JOIN users u ON t.user_id = u.id
+	LEFT JOIN course_feed_stats fs ON fs.course_id = c.id`
+
+// scanFeedCourses reads rows of feedColumns followed by extra columns,
+// which are scanned into the destinations extra returns for each course.
+func scanFeedCourses(rows *sql.Rows, extra func(course *types.FeedCourse) []interface{}) ([]types.FeedCourse, error) {
+	defer rows.Close()
+
+	courses := []types.FeedCourse{}
+	for rows.Next() {
+		var course types.FeedCourse
+		dest := []interface{}{
+			&course.ID,
+			&course.Name,
+			&course.Slug,
+			&course.Image,
+			&course.Price,
+			&course.CategoryID,
+			&course.Instructor,
+			&course.Rating,
+			&course.RatingCount,
+			&course.EnrollmentCount,
+			&course.SalesCount,
+			&course.PublishedAt,
+		}
+		if extra != nil {
+			dest = append(dest, extra(&course)...)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		courses = append(courses, course)
+	}
+	return courses, rows.Err()
+}
+
+
+// GetTrending lists the courses gaining students fastest: the most
+// enrollments over the last days days.
+func (s *Store) GetTrending(days int, limit int) ([]types.FeedCourse, error) {
+	rows, err := s.db.Query(`SELECT `+feedColumns+`, tr.recent
+		`+feedJoins+`
+		JOIN (SELECT course_id, SUM(enrollments) AS recent
+		      FROM course_enrollment_daily
+		      WHERE day > CURRENT_DATE - $1::int
+		      GROUP BY course_id) tr ON tr.course_id = c.id
+		WHERE c.status = 'published'
+		ORDER BY tr.recent DESC, COALESCE(fs.enrollments, 0) DESC, c.id
+		LIMIT $2`, days, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch trending courses: %v", err)
+	}
+
+	courses, err := scanFeedCourses(rows, func(course *types.FeedCourse) []interface{} {
+		return []interface{}{&course.RecentEnrollments}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range courses {
+		courses[i].EnrollmentsPerDay = float64(courses[i].RecentEnrollments) / float64(days)
+	}
+	return courses, nil
+}
+
+
+// GetBestsellers lists the best selling courses of a category and its
+// subcategories.
+func (s *Store) GetBestsellers(categoryID int, limit int) ([]types.FeedCourse, error) {
+	rows, err := s.db.Query(`SELECT `+feedColumns+`
+		`+feedJoins+`
+		WHERE c.status = 'published' AND COALESCE(fs.sales, 0) > 0
+		AND c.category_id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM categories WHERE id = $1
+				UNION
+				SELECT child.id FROM categories child JOIN tree ON child.parent_id = tree.id
+			)
+			SELECT id FROM tree)
+		ORDER BY fs.sales DESC, fs.enrollments DESC, c.id
+		LIMIT $2`, categoryID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch bestsellers: %v", err)
+	}
+	return scanFeedCourses(rows, nil)
+}
+
+
+// GetBestsellersByCategory lists the perCategory best selling courses of
+// every category that sold any, categories in name order.
+func (s *Store) GetBestsellersByCategory(perCategory int) ([]types.CategoryBestsellers, error) {
+	rows, err := s.db.Query(`SELECT * FROM (
+			SELECT `+feedColumns+`, cat.name AS category_name, cat.slug AS category_slug,
+			       ROW_NUMBER() OVER (PARTITION BY c.category_id ORDER BY fs.sales DESC, fs.enrollments DESC, c.id) AS position
+			`+feedJoins+`
+			JOIN categories cat ON cat.id = c.category_id
+			WHERE c.status = 'published' AND COALESCE(fs.sales, 0) > 0
+		) ranked
+		WHERE position <= $1
+		ORDER BY category_name, category_id, position`, perCategory)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch bestsellers: %v", err)
+	}
+
+	type category struct {
+		name, slug string
+		position   int
+	}
+	var categories []*category
+	courses, err := scanFeedCourses(rows, func(course *types.FeedCourse) []interface{} {
+		c := &category{}
+		categories = append(categories, c)
+		return []interface{}{&c.name, &c.slug, &c.position}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows arrive grouped by category
+	groups := []types.CategoryBestsellers{}
+	for i, course := range courses {
+		if len(groups) == 0 || groups[len(groups)-1].CategoryID != course.CategoryID {
+			groups = append(groups, types.CategoryBestsellers{
+				CategoryID:   course.CategoryID,
+				CategoryName: categories[i].name,
+				CategorySlug: categories[i].slug,
+			})
+		}
+		group := &groups[len(groups)-1]
+		group.Courses = append(group.Courses, course)
+	}
+	return groups, nil
+}
+
+
+// GetNewReleases lists the courses published within the last days days,
+// newest first, optionally only those rated minRating or better.
+func (s *Store) GetNewReleases(days int, minRating float64, limit int) ([]types.FeedCourse, error) {
+	rows, err := s.db.Query(`SELECT `+feedColumns+`
+		`+feedJoins+`
+		WHERE c.status = 'published'
+		AND COALESCE(c.published_at, c.created_at) > NOW() - make_interval(days => $1)
+		AND c.rating_average >= $2
+		ORDER BY COALESCE(c.published_at, c.created_at) DESC, c.id DESC
+		LIMIT $3`, days, minRating, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch new releases: %v", err)
+	}
+	return scanFeedCourses(rows, nil)
+}
+
+
+// GetTopRated lists the best rated courses among those with at least
+// minRatings ratings, so one five star review does not top the list.
+// Courses rank by their Bayesian average, which weighs in the site wide
+// average so a course with many good ratings beats one with a few.
+func (s *Store) GetTopRated(minRatings int, limit int) ([]types.FeedCourse, error) {
+	rows, err := s.db.Query(`SELECT `+feedColumns+`
+		`+feedJoins+`
+		CROSS JOIN (SELECT COALESCE(SUM(rating_average * rating_count) / NULLIF(SUM(rating_count), 0), 0) AS mean FROM courses) prior
+		WHERE c.status = 'published' AND c.rating_count >= $1
+		ORDER BY ($3 * prior.mean + c.rating_average * c.rating_count) / ($3 + c.rating_count) DESC, c.rating_count DESC, c.id
+		LIMIT $2`, minRatings, limit, types.RatingPriorWeight)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch top rated courses: %v", err)
+	}
+	return scanFeedCourses(rows, nil)
+}
+
+
+// GetFeatured lists the courses admins featured, in their order. Courses
+// unpublished since are skipped.
+func (s *Store) GetFeatured(limit int) ([]types.FeedCourse, error) {
+	rows, err := s.db.Query(`SELECT `+feedColumns+`
+		`+feedJoins+`
+		JOIN featured_courses f ON f.course_id = c.id
+		WHERE c.status = 'published'
+		ORDER BY f.position
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch featured courses: %v", err)
+	}
+	return scanFeedCourses(rows, nil)
+}
+
+
+// SetFeatured replaces the featured courses with courseIDs, in that order.
+// Every course must be published and listed once.
+func (s *Store) SetFeatured(courseIDs []int, adminID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM courses WHERE id = ANY($1) AND status = 'published'`, pq.Array(courseIDs))
+	if err != nil {
+		return fmt.Errorf("could not check featured courses: %v", err)
+	}
+	published := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		published[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	seen := make(map[int]bool, len(courseIDs))
+	for _, id := range courseIDs {
+		if !published[id] {
+			return fmt.Errorf("%w: course %d does not exist or is not published", ErrInvalidFeaturedCourse, id)
+		}
+		if seen[id] {
+			return fmt.Errorf("%w: course %d is listed more than once", ErrInvalidFeaturedCourse, id)
+		}
+		seen[id] = true
+	}
+
+	if _, err := tx.Exec(`DELETE FROM featured_courses`); err != nil {
+		return fmt.Errorf("could not clear featured courses: %v", err)
+	}
+	for i, id := range courseIDs {
+		_, err := tx.Exec(`INSERT INTO featured_courses (course_id, position, featured_by) VALUES ($1, $2, NULLIF($3, 0))`,
+			id, i+1, adminID)
+		if err != nil {
+			return fmt.Errorf("could not feature course: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
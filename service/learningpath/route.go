@@ -0,0 +1,222 @@
+package learningpath
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sikozonpc/ecom/service/auth"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+type Handler struct {
+	path  types.LearningPathStore
+	store types.UserStore
+}
+
+
+func NewHandler(path types.LearningPathStore, store types.UserStore) *Handler {
+	return &Handler{
+		path:  path,
+		store: store,
+	}
+}
+
+
+func (h *Handler) LearningPathRoutes(router *mux.Router) {
+	adminOnly := []types.UserRole{types.ADMIN}
+
+	router.HandleFunc("/learning_paths", h.getPathsHandle).Methods(http.MethodGet)
+	router.HandleFunc("/learning_paths/{slug}", h.getPathHandle).Methods(http.MethodGet)
+
+	router.HandleFunc("/admin/learning_paths", auth.WithJWTAuth(h.getPathsHandle, h.store, adminOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/learning_paths", auth.WithJWTAuth(h.createPathHandle, h.store, adminOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/learning_paths/{id}", auth.WithJWTAuth(h.editPathHandle, h.store, adminOnly)).Methods(http.MethodPatch)
+	router.HandleFunc("/admin/learning_paths/{id}", auth.WithJWTAuth(h.deletePathHandle, h.store, adminOnly)).Methods(http.MethodDelete)
+	router.HandleFunc("/admin/learning_paths/{id}/courses", auth.WithJWTAuth(h.setPathCoursesHandle, h.store, adminOnly)).Methods(http.MethodPut)
+}
+
+
+// writePathError maps learning path errors onto HTTP statuses.
+func writePathError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrPathNotFound):
+		utils.WriteError(writer, http.StatusNotFound, err)
+	case errors.Is(err, ErrInvalidPathCourse):
+		utils.WriteError(writer, http.StatusBadRequest, err)
+	default:
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+	}
+}
+
+
+func (h *Handler) getPathsHandle(writer http.ResponseWriter, request *http.Request) {
+	params, err := pagination.FromRequest(request, "learning_paths", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	paths, err := h.path.GetPaths(params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, paths)
+}
+
+
+func (h *Handler) getPathHandle(writer http.ResponseWriter, request *http.Request) {
+	path, err := h.path.GetPathBySlug(mux.Vars(request)["slug"])
+	if err != nil {
+		writePathError(writer, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, path)
+}
+
+
+func (h *Handler) getPathFromRequest(writer http.ResponseWriter, request *http.Request) *types.LearningPath {
+	vars := mux.Vars(request)
+	pathID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid learning path ID: %s", vars["id"]))
+		return nil
+	}
+
+	path, err := h.path.GetPathByID(pathID)
+	if err != nil {
+		writePathError(writer, err)
+		return nil
+	}
+	return path
+}
+
+
+func (h *Handler) createPathHandle(writer http.ResponseWriter, request *http.Request) {
+	var payload types.CreateLearningPathPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	path := &types.LearningPath{
+		Title:       payload.Title,
+		Description: payload.Description,
+		CreatedBy:   auth.GetUserIDFromContext(request.Context()),
+	}
+	for _, courseID := range payload.CourseIDs {
+		path.Courses = append(path.Courses, types.LearningPathCourse{CourseID: courseID})
+	}
+
+	if err := h.path.CreatePath(path); err != nil {
+		writePathError(writer, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Learning path created successfully",
+		"path":    path,
+	}
+
+	utils.WriteJSON(writer, http.StatusCreated, response)
+}
+
+
+func (h *Handler) editPathHandle(writer http.ResponseWriter, request *http.Request) {
+	path := h.getPathFromRequest(writer, request)
+	if path == nil {
+		return
+	}
+
+	var payload types.UpdateLearningPathPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	path.Title = payload.Title
+	path.Description = payload.Description
+
+	if err := h.path.UpdatePath(path); err != nil {
+		writePathError(writer, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Learning path updated successfully",
+		"path":    path,
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+func (h *Handler) deletePathHandle(writer http.ResponseWriter, request *http.Request) {
+	path := h.getPathFromRequest(writer, request)
+	if path == nil {
+		return
+	}
+
+	if err := h.path.DeletePath(path.ID); err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]string{"message": "Learning path deleted successfully"}
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+func (h *Handler) setPathCoursesHandle(writer http.ResponseWriter, request *http.Request) {
+	path := h.getPathFromRequest(writer, request)
+	if path == nil {
+		return
+	}
+
+	var payload types.SetPathCoursesPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.path.SetPathCourses(path.ID, payload.CourseIDs); err != nil {
+		writePathError(writer, err)
+		return
+	}
+
+	path, err := h.path.GetPathByID(path.ID)
+	if err != nil {
+		writePathError(writer, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Learning path courses updated successfully",
+		"path":    path,
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
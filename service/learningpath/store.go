@@ -0,0 +1,283 @@
+package learningpath
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+var ErrPathNotFound = errors.New("learning path not found")
+var ErrInvalidPathCourse = errors.New("invalid learning path course")
+
+type Store struct {
+	db *sql.DB
+}
+
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+
+const pathColumns = `p.id, p.title, p.slug, COALESCE(p.description, ''), COALESCE(p.created_by, 0), p.created_at, p.modified_at`
+
+func scanPath(row interface{ Scan(...interface{}) error }) (*types.LearningPath, error) {
+	var path types.LearningPath
+	err := row.Scan(
+		&path.ID,
+		&path.Title,
+		&path.Slug,
+		&path.Description,
+		&path.CreatedBy,
+		&path.CreatedAt,
+		&path.ModifiedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &path, nil
+}
+
+
+// CreatePath inserts a path and its courses in one transaction.
+func (s *Store) CreatePath(path *types.LearningPath) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(`SELECT nextval(pg_get_serial_sequence('learning_paths', 'id'))`).Scan(&path.ID); err != nil {
+		return fmt.Errorf("could not reserve path ID: %v", err)
+	}
+	path.Slug = utils.Slugify(path.Title, path.ID)
+
+	var createdBy interface{}
+	if path.CreatedBy != 0 {
+		createdBy = path.CreatedBy
+	}
+
+	err = tx.QueryRow(`INSERT INTO learning_paths (id, title, slug, description, created_by, created_at, modified_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING created_at, modified_at`,
+		path.ID, path.Title, path.Slug, path.Description, createdBy).Scan(&path.CreatedAt, &path.ModifiedAt)
+	if err != nil {
+		return fmt.Errorf("could not create learning path: %v", err)
+	}
+
+	var courseIDs []int
+	for _, course := range path.Courses {
+		courseIDs = append(courseIDs, course.CourseID)
+	}
+	if err := setPathCourses(tx, path.ID, courseIDs); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	path.Courses, err = pathCourses(s.db, path.ID)
+	return err
+}
+
+
+// pathKeyset lists learning paths by title.
+var pathKeyset = pagination.Keyset{Columns: []string{"p.title", "p.id"}}
+
+func pathKey(path types.LearningPath) []interface{} {
+	return []interface{}{path.Title, path.ID}
+}
+
+
+func (s *Store) GetPaths(params pagination.Params) (pagination.Page[types.LearningPath], error) {
+	var page pagination.Page[types.LearningPath]
+
+	cursor, args, err := pathKeyset.Where(params, nil)
+	if err != nil {
+		return page, err
+	}
+	order, args := pathKeyset.OrderBy(params, args)
+
+	rows, err := s.db.Query(`SELECT `+pathColumns+` FROM learning_paths p WHERE TRUE`+cursor+order, args...)
+	if err != nil {
+		return page, fmt.Errorf("could not fetch learning paths: %v", err)
+	}
+	defer rows.Close()
+
+	paths := []types.LearningPath{}
+	for rows.Next() {
+		path, err := scanPath(rows)
+		if err != nil {
+			return page, err
+		}
+		paths = append(paths, *path)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	page = pagination.NewPage(paths, params, pathKey)
+	for i := range page.Data {
+		page.Data[i].Courses, err = pathCourses(s.db, page.Data[i].ID)
+		if err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+
+func (s *Store) GetPathByID(id int) (*types.LearningPath, error) {
+	return s.getPath(`SELECT `+pathColumns+` FROM learning_paths p WHERE p.id = $1`, id)
+}
+
+
+func (s *Store) GetPathBySlug(slug string) (*types.LearningPath, error) {
+	return s.getPath(`SELECT `+pathColumns+` FROM learning_paths p WHERE p.slug = $1`, slug)
+}
+
+
+func (s *Store) getPath(query string, arg interface{}) (*types.LearningPath, error) {
+	path, err := scanPath(s.db.QueryRow(query, arg))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPathNotFound
+		}
+		return nil, fmt.Errorf("could not fetch learning path: %v", err)
+	}
+
+	path.Courses, err = pathCourses(s.db, path.ID)
+	if err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+
+func (s *Store) UpdatePath(path *types.LearningPath) error {
+	path.Slug = utils.Slugify(path.Title, path.ID)
+	err := s.db.QueryRow(`UPDATE learning_paths SET title = $1, slug = $2, description = $3, modified_at = NOW()
+		WHERE id = $4 RETURNING modified_at`,
+		path.Title, path.Slug, path.Description, path.ID).Scan(&path.ModifiedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPathNotFound
+		}
+		return fmt.Errorf("could not update learning path: %v", err)
+	}
+	return nil
+}
+
+
+func (s *Store) DeletePath(id int) error {
+	_, err := s.db.Exec(`DELETE FROM learning_paths WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("could not delete learning path: %v", err)
+	}
+	return nil
+}
+
+
+// SetPathCourses replaces the courses of a path with courseIDs, in order.
+func (s *Store) SetPathCourses(pathID int, courseIDs []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := setPathCourses(tx, pathID, courseIDs); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE learning_paths SET modified_at = NOW() WHERE id = $1`, pathID); err != nil {
+		return fmt.Errorf("could not update learning path: %v", err)
+	}
+	return tx.Commit()
+}
+
+
+// setPathCourses checks that every course is published and listed once, then
+// rewrites the path's course list with positions starting at 1.
+func setPathCourses(tx *sql.Tx, pathID int, courseIDs []int) error {
+	rows, err := tx.Query(`SELECT id FROM courses WHERE id = ANY($1) AND status = 'published'`, pq.Array(courseIDs))
+	if err != nil {
+		return fmt.Errorf("could not check path courses: %v", err)
+	}
+	published := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		published[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	seen := make(map[int]bool, len(courseIDs))
+	for _, id := range courseIDs {
+		if !published[id] {
+			return fmt.Errorf("%w: course %d does not exist or is not published", ErrInvalidPathCourse, id)
+		}
+		if seen[id] {
+			return fmt.Errorf("%w: course %d is listed more than once", ErrInvalidPathCourse, id)
+		}
+		seen[id] = true
+	}
+
+	if _, err := tx.Exec(`DELETE FROM learning_path_courses WHERE path_id = $1`, pathID); err != nil {
+		return fmt.Errorf("could not clear path courses: %v", err)
+	}
+	for i, id := range courseIDs {
+		_, err := tx.Exec(`INSERT INTO learning_path_courses (path_id, course_id, position) VALUES ($1, $2, $3)`,
+			pathID, id, i+1)
+		if err != nil {
+			return fmt.Errorf("could not add course to path: %v", err)
+		}
+	}
+	return nil
+}
+
+
+// pathCourses lists the published courses of a path in path order.
+func pathCourses(db *sql.DB, pathID int) ([]types.LearningPathCourse, error) {
+	rows, err := db.Query(`SELECT lpc.position, c.id, c.name, c.slug, COALESCE(c.image, ''), c.price,
+			c.lecture_count, c.total_duration
+		FROM learning_path_courses lpc
+		JOIN courses c ON lpc.course_id = c.id
+		WHERE lpc.path_id = $1 AND c.status = 'published'
+		ORDER BY lpc.position`, pathID)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch path courses: %v", err)
+	}
+	defer rows.Close()
+
+	courses := []types.LearningPathCourse{}
+	for rows.Next() {
+		var course types.LearningPathCourse
+		err := rows.Scan(
+			&course.Position,
+			&course.CourseID,
+			&course.Name,
+			&course.Slug,
+			&course.Image,
+			&course.Price,
+			&course.LectureCount,
+			&course.TotalDuration,
+		)
+		if err != nil {
+			return nil, err
+		}
+		courses = append(courses, course)
+	}
+	return courses, rows.Err()
+}
@@ -0,0 +1,104 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sikozonpc/ecom/service/auth"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+type Handler struct {
+	notification types.NotificationStore
+	store        types.UserStore
+}
+
+
+func NewHandler(notification types.NotificationStore, store types.UserStore) *Handler {
+	return &Handler{
+		notification: notification,
+		store:        store,
+	}
+}
+
+
+func (h *Handler) NotificationRoutes(router *mux.Router) {
+	allRoles := []types.UserRole{types.TEACHER, types.STUDENT, types.ADMIN}
+
+	router.HandleFunc("/notifications", auth.WithJWTAuth(h.notificationsHandle, h.store, allRoles)).Methods(http.MethodGet)
+	router.HandleFunc("/notifications/read", auth.WithJWTAuth(h.readAllHandle, h.store, allRoles)).Methods(http.MethodPost)
+	router.HandleFunc("/notifications/{id:[0-9]+}/read", auth.WithJWTAuth(h.readHandle, h.store, allRoles)).Methods(http.MethodPost)
+}
+
+
+func (h *Handler) notificationsHandle(writer http.ResponseWriter, request *http.Request) {
+	userID := auth.GetUserIDFromContext(request.Context())
+	unreadOnly := request.URL.Query().Get("unread") == "true"
+
+	scope := "notifications"
+	if unreadOnly {
+		scope = "notifications:unread"
+	}
+	params, err := pagination.FromRequest(request, scope, pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	notifications, err := h.notification.GetNotifications(userID, unreadOnly, params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	unread, err := h.notification.CountUnread(userID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, map[string]interface{}{
+		"data":        notifications.Data,
+		"next_cursor": notifications.NextCursor,
+		"prev_cursor": notifications.PrevCursor,
+		"unread":      unread,
+	})
+}
+
+
+func (h *Handler) readHandle(writer http.ResponseWriter, request *http.Request) {
+	notificationID, err := strconv.Atoi(mux.Vars(request)["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid notification ID"))
+		return
+	}
+
+	if err := h.notification.MarkRead(auth.GetUserIDFromContext(request.Context()), notificationID); err != nil {
+		if errors.Is(err, ErrNotificationNotFound) {
+			utils.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, map[string]string{"message": "notification marked read"})
+}
+
+
+func (h *Handler) readAllHandle(writer http.ResponseWriter, request *http.Request) {
+	if err := h.notification.MarkAllRead(auth.GetUserIDFromContext(request.Context())); err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, map[string]string{"message": "all notifications marked read"})
+}
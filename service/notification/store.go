@@ -0,0 +1,106 @@
+package notification
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+
+// notificationKeyset lists the newest notifications first.
+var notificationKeyset = pagination.Keyset{Columns: []string{"created_at", "id"}, Desc: true}
+
+func notificationKey(notification types.Notification) []interface{} {
+	return []interface{}{notification.CreatedAt, notification.ID}
+}
+
+
+// GetNotifications lists a user's notifications, newest first, optionally
+// only the unread ones.
+func (s *Store) GetNotifications(userID int, unreadOnly bool, params pagination.Params) (pagination.Page[types.Notification], error) {
+	var page pagination.Page[types.Notification]
+
+	cursor, args, err := notificationKeyset.Where(params, []interface{}{userID, unreadOnly})
+	if err != nil {
+		return page, err
+	}
+	order, args := notificationKeyset.OrderBy(params, args)
+
+	rows, err := s.db.Query(`SELECT id, user_id, kind, title, body, link, course_id, created_at, read_at
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)`+cursor+order, args...)
+	if err != nil {
+		return page, fmt.Errorf("could not get notifications: %v", err)
+	}
+	defer rows.Close()
+
+	var notifications []types.Notification
+	for rows.Next() {
+		var notification types.Notification
+		if err := rows.Scan(
+			&notification.ID,
+			&notification.UserID,
+			&notification.Kind,
+			&notification.Title,
+			&notification.Body,
+			&notification.Link,
+			&notification.CourseID,
+			&notification.CreatedAt,
+			&notification.ReadAt,
+		); err != nil {
+			return page, fmt.Errorf("could not scan notification: %v", err)
+		}
+		notifications = append(notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("row iteration error: %v", err)
+	}
+	return pagination.NewPage(notifications, params, notificationKey), nil
+}
+
+
+func (s *Store) CountUnread(userID int) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("could not count notifications: %v", err)
+	}
+	return count, nil
+}
+
+
+// MarkRead marks one of the user's notifications read. Marking it again is
+// harmless.
+func (s *Store) MarkRead(userID int, notificationID int) error {
+	result, err := s.db.Exec(`UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2`, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("could not mark notification read: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+
+func (s *Store) MarkAllRead(userID int) error {
+	_, err := s.db.Exec(`UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("could not mark notifications read: %v", err)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package order
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/sikozonpc/ecom/service/auth"
+	"github.com/sikozonpc/ecom/service/cart"
 
 	"github.com/sikozonpc/ecom/types"
 	"github.com/sikozonpc/ecom/utils"
@@ -88,6 +90,29 @@ func (h *Handler) createOrderHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	// Re-check blocking prerequisites; the student may have added the course
+	// before the teacher switched its policy to block
+	for _, item := range items {
+		policy, missing, err := h.cart.GetMissingPrerequisites(userID, item.CourseID)
+		if err != nil {
+			if errors.Is(err, cart.ErrCourseNotFound) {
+				utils.WriteError(writer, http.StatusNotFound, fmt.Errorf("course %d in the cart: %v", item.CourseID, err))
+				return
+			}
+			utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to check prerequisites: %v", err))
+			return
+		}
+		if len(missing) > 0 && policy == types.PrerequisiteBlock {
+			response := map[string]interface{}{
+				"err":                   "complete the prerequisites of this course before buying it",
+				"course_id":             item.CourseID,
+				"missing_prerequisites": missing,
+			}
+			utils.WriteJSON(writer, http.StatusConflict, response)
+			return
+		}
+	}
+
 	// Call CreateOrder with fetched cart items
 	orderID, totalPrice, err := h.CreateOrder(userID, items, payload.FirstName, payload.LastName, payload.Email, payload.Country)
 	if err != nil {
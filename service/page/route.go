@@ -2,14 +2,18 @@ package page
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/sikozonpc/ecom/types"
 	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
 )
 
 type Handler struct {
@@ -17,15 +21,17 @@ type Handler struct {
 	store  types.UserStore
 	teacher types.TeacherStore
 	rating  types.RatingStore
+	recommendation types.RecommendationStore
 }
 
 
-func NewHandler(page types.PageStore, store types.UserStore, teacher types.TeacherStore, rating  types.RatingStore) *Handler {
+func NewHandler(page types.PageStore, store types.UserStore, teacher types.TeacherStore, rating  types.RatingStore, recommendation types.RecommendationStore) *Handler {
     return &Handler{
 		page: page,
 		store: store,
 		teacher: teacher,
 		rating:  rating,
+		recommendation: recommendation,
 	}
 }
 
@@ -38,28 +44,17 @@ func (h *Handler) PageRoutes(router *mux.Router) {
 	router.HandleFunc("/course/{slug}", h.courseDetailsHandler).Methods(http.MethodGet)
 	router.HandleFunc("/course/{slug}/ratings", h.courseRatingsHandler).Methods(http.MethodGet)
 	router.HandleFunc("/teacher/profile/{id}", h.getTeacherProfile).Methods(http.MethodGet)
+
+	// tag autocomplete and landing pages
+	router.HandleFunc("/tags", h.searchTagsHandle).Methods(http.MethodGet)
+	router.HandleFunc("/tags/{slug}", h.tagPageHandle).Methods(http.MethodGet)
 }
 
 func (h *Handler) getCoursesHandle(writer http.ResponseWriter, request *http.Request) {
-	// Default values for pagination
-	limit := 10
-	offset := 0
-
-	// Get query parameters for limit and offset
-	queryParams := request.URL.Query()
-
-	if l, ok := queryParams["limit"]; ok {
-		parsedLimit, err := strconv.Atoi(l[0])
-		if err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-		}
-	}
-
-	if o, ok := queryParams["offset"]; ok {
-		parsedOffset, err := strconv.Atoi(o[0])
-		if err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
-		}
+	params, err := pagination.FromRequest(request, "courses", 10, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
 	}
 
 	// Fetch total number of courses
@@ -69,30 +64,21 @@ func (h *Handler) getCoursesHandle(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	// Fetch paginated courses
-	courses, err := h.teacher.GetCourses(limit, offset)
+	// Fetch the requested page of courses
+	courses, err := h.teacher.GetCourses(params)
 	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
 		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to fetch courses: %v", err))
 		return
 	}
 
-	// Create a slice to hold the courses with average ratings
-	coursesWithRatings := make([]map[string]interface{}, len(courses))
-
-	// Iterate through courses to get average ratings
-	for i, course := range courses {
-		avgRating, err := h.rating.GetAverageRating(course.ID) 
-		
-		if err != nil {
-			utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to get average rating for course ID %d: %v", course.ID, err))
-			return
-		}
-		_, reviewCount, err := h.rating.CountRatingsAndReviews(course.ID)
-		if err!= nil {
-            utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to get review count and ratings for course ID %d: %v", course.ID, err))
-            return
-        }
+	// Ratings come with the courses, from the aggregates kept on each course
+	coursesWithRatings := make([]map[string]interface{}, len(courses.Data))
 
+	for i, course := range courses.Data {
 		// Create a map for the course with the average rating
 		courseData := map[string]interface{}{
 			"id" : course.ID,
@@ -103,42 +89,25 @@ func (h *Handler) getCoursesHandle(writer http.ResponseWriter, request *http.Req
 			"teacher" : map[string]string{
                 "full_name" : fmt.Sprintf("%s %s", course.FirstName, course.LastName),
 			},
-			"rating":  avgRating,
-			"review_count" : reviewCount,
+			"rating":  course.RatingAverage,
+			"rating_count": course.RatingCount,
+			"review_count" : course.ReviewCount,
+			"total_duration": course.TotalDuration,
+			"total_duration_text": utils.FormatDuration(course.TotalDuration),
+			"section_count": course.SectionCount,
+			"lecture_count": course.LectureCount,
+			"last_updated": course.ContentUpdatedAt.Format("01 / 2006"),
 		}
 		coursesWithRatings[i] = courseData
 	}
 
-	// Generate next and previous page URLs
-	nextPageOffset := offset + limit
-	prevPageOffset := offset - limit
-	if prevPageOffset < 0 {
-		prevPageOffset = 0
-	}
-
-	baseURL := request.URL.Path
-	nextPageURL := ""
-	prevPageURL := ""
-
-	// Assign URLs only if they are valid
-	if nextPageOffset < totalCourses {
-		nextPageURL = fmt.Sprintf("%s?limit=%d&offset=%d", baseURL, limit, nextPageOffset)
-	}
-	if prevPageOffset >= 0 {
-		prevPageURL = fmt.Sprintf("%s?limit=%d&offset=%d", baseURL, limit, prevPageOffset)
-	}
-
-	// Response with metadata
-	response := map[string]interface{}{
-		"data":           coursesWithRatings,
-		"total":          totalCourses,
-		"limit":          limit,
-		"offset":         offset,
-		"next_page_url":  nextPageURL,
-		"prev_page_url":  prevPageURL,
+	response := pagination.Page[map[string]interface{}]{
+		Data:       coursesWithRatings,
+		NextCursor: courses.NextCursor,
+		PrevCursor: courses.PrevCursor,
 	}
 
-	utils.WriteJSON(writer, http.StatusOK, response)
+	utils.WriteJSON(writer, http.StatusOK, response.WithTotal(totalCourses))
 }
 
 
@@ -169,30 +138,37 @@ func (h *Handler) courseDetailsHandler(writer http.ResponseWriter, request *http
 		return
 	}
 
-	// Fetch average rating for the course
-	averageRating, err := h.rating.GetAverageRating(courseID)
+	summary, err := h.rating.GetRatingSummary(slug)
 	if err != nil {
-		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("error getting average rating: %v", err))
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("error getting rating summary: %v", err))
 		return
 	}
 
-
 	previewLimit := 5
-	previewRatings, _, err := h.rating.GetRatingsForCourse(slug, 1, previewLimit)
+	previewRatings, err := h.rating.GetRatingsForCourse(slug, types.RatingSortHelpful, pagination.First("course_ratings:helpful", previewLimit))
 	if err != nil {
 		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("error getting preview ratings: %v", err))
 		return
 	}
 
 	// Construct URL to view all ratings
-	viewAllRatingsURL := fmt.Sprintf("/api/v1/course/%s/ratings?limit=10&page=1", slug)
+	viewAllRatingsURL := fmt.Sprintf("/api/v1/course/%s/ratings?sort=helpful&limit=10", slug)
+
+	// The "students also bought" block is optional; the page works without it
+	alsoBought, err := h.recommendation.GetAlsoBought(courseID, 6)
+	if err != nil {
+		log.Printf("could not get also bought courses for %s: %v", slug, err)
+		alsoBought = []types.RecommendedCourse{}
+	}
 
 	// Create a response structure to include course details, average rating, preview ratings, and the view-all link
 	response := map[string]interface{}{
 		"course":               courseDetail,
-		"rating":      			averageRating,
-		"preview_ratings":      previewRatings,
+		"rating":      			summary.Average,
+		"rating_summary":       summary,
+		"preview_ratings":      previewRatings.Data,
 		"view_all_ratings_and_reviews_url": viewAllRatingsURL,
+		"students_also_bought": alsoBought,
 	}
 
 	utils.WriteJSON(writer, http.StatusOK, response)
@@ -209,74 +185,46 @@ func (h *Handler) courseRatingsHandler(writer http.ResponseWriter, request *http
 		return
 	}
 
-	// Parse pagination parameters
-	pageStr := request.URL.Query().Get("page")
-	limitStr := request.URL.Query().Get("limit")
-
-	// Set default values for pagination
-	page := 1  // default to first page
-	limit := 10 // default to 10 items per page
-
-	// Parse page number
-	if pageStr != "" {
-		var err error
-		page, err = strconv.Atoi(pageStr)
-		if err != nil || page < 1 {
-			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid page number"))
-			return
-		}
+	sort := types.RatingSort(request.URL.Query().Get("sort"))
+	switch sort {
+	case "":
+		sort = types.RatingSortNewest
+	case types.RatingSortNewest, types.RatingSortHelpful, types.RatingSortHighest, types.RatingSortLowest:
+	default:
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid sort parameter, expected newest, helpful, highest or lowest"))
+		return
 	}
 
-	// Parse limit number
-	if limitStr != "" {
-		var err error
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil || limit < 1 {
-			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid limit number"))
-			return
-		}
+	params, err := pagination.FromRequest(request, "course_ratings:"+string(sort), 10, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
 	}
 
-	// Calculate offsets
-	offset := (page - 1) * limit
-
-	// Call the function to get ratings with pagination
-	ratings, totalRatings, err := h.rating.GetRatingsForCourse(slug, page, limit)
+	ratings, err := h.rating.GetRatingsForCourse(slug, sort, params)
 	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
 		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("error getting ratings for course: %v", err))
 		return
 	}
 
-	// Generate next and previous page URLs
-	nextPageOffset := offset + limit
-	prevPageOffset := offset - limit
-	if prevPageOffset < 0 {
-		prevPageOffset = 0
-	}
-
-	baseURL := request.URL.Path
-	nextPageURL := ""
-	prevPageURL := ""
-
-	// Assign URLs only if they are valid
-	if nextPageOffset < totalRatings {
-		nextPageURL = fmt.Sprintf("%s?limit=%d&page=%d", baseURL, limit, (nextPageOffset/limit)+1)
-	}
-	if prevPageOffset >= 0 {
-		prevPageURL = fmt.Sprintf("%s?limit=%d&page=%d", baseURL, limit, (prevPageOffset/limit)+1)
-	}
-
-	// Prepare response map
-	response := map[string]interface{}{
-		"data":          ratings,
-		"total":         totalRatings,
-		"limit":         limit,
-		"offset":        offset,
-		"next_page_url": nextPageURL,
-		"prev_page_url": prevPageURL,
+	summary, err := h.rating.GetRatingSummary(slug)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("error getting rating summary: %v", err))
+		return
 	}
 
-	utils.WriteJSON(writer, http.StatusOK, response)
+	utils.WriteJSON(writer, http.StatusOK, map[string]interface{}{
+		"data":        ratings.Data,
+		"next_cursor": ratings.NextCursor,
+		"prev_cursor": ratings.PrevCursor,
+		"total":       ratings.Total,
+		"sort":        sort,
+		"summary":     summary,
+	})
 }
 
 
@@ -326,4 +274,47 @@ func (h *Handler) getTeacherProfile(writer http.ResponseWriter, request *http.Re
 	}
 
 	utils.WriteJSON(writer, http.StatusOK, response)
-}
\ No newline at end of file
+}
+
+
+
+func (h *Handler) searchTagsHandle(writer http.ResponseWriter, request *http.Request) {
+	prefix := strings.Join(strings.Fields(request.URL.Query().Get("q")), " ")
+
+	tags, err := h.page.SearchTags(prefix, pagination.QueryLimit(request, 10, 50))
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, tags)
+}
+
+
+func (h *Handler) tagPageHandle(writer http.ResponseWriter, request *http.Request) {
+	slug := mux.Vars(request)["slug"]
+
+	tag, err := h.page.GetTagBySlug(slug)
+	if err != nil {
+		if errors.Is(err, ErrTagNotFound) {
+			utils.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	courses, err := h.page.GetTopCoursesByTag(tag.ID, pagination.QueryLimit(request, 20, 100))
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"tag":        tag,
+		"courses":    courses,
+		"search_url": fmt.Sprintf("/api/v1/search?tags=%s", tag.Slug),
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
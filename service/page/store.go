@@ -2,10 +2,17 @@ package page
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
 )
 
+var ErrTagNotFound = errors.New("tag not found")
+
 type Store struct {
 	db *sql.DB
 }
@@ -19,10 +26,11 @@ func (s *Store) GetCourseSectionsAndVideos(courseID int) ([]map[string]interface
 	var sections []map[string]interface{}
 
 	query := `
-	SELECT s.id, s.title, v.id, v.title
+	SELECT s.id, s.title, s."order", v.id, v.title, v."order"
 	FROM sections s
 	LEFT JOIN videos v ON s.id = v.section_id
 	WHERE s.course_id = $1
+	ORDER BY s."order", s.id, v."order", v.id
 	`
 
 	rows, err := s.db.Query(query, courseID)
@@ -31,68 +39,90 @@ func (s *Store) GetCourseSectionsAndVideos(courseID int) ([]map[string]interface
     }
 	defer rows.Close()
 
-	sectionMap := make(map[int]map[string]interface{})
+	// Rows arrive sorted, so the sections are built up in order
+	sectionIndex := make(map[int]int)
 
 	for rows.Next() {
 		var sectionID int
         var title string
-        var videoID int
-        var videoTitle string
+        var order int
+        var videoID sql.NullInt64
+        var videoTitle sql.NullString
+        var videoOrder sql.NullInt64
 
-		err := rows.Scan(&sectionID, &title, &videoID, &videoTitle)
+		err := rows.Scan(&sectionID, &title, &order, &videoID, &videoTitle, &videoOrder)
         if err!= nil {
             return nil, fmt.Errorf("failed to scan row: %v", err)
         }
 
-		if _, exists := sectionMap[sectionID]; !exists {
-			sectionMap[sectionID] = map[string]interface{}{
+		index, exists := sectionIndex[sectionID]
+		if !exists {
+			index = len(sections)
+			sectionIndex[sectionID] = index
+			sections = append(sections, map[string]interface{}{
 				"id":   sectionID,
                 "title": title,
-                "videos": map[string]any{
-					"id": videoID,
-					"title": videoTitle,
-				},
-			}
+                "order": order,
+                "videos": []map[string]interface{}{},
+			})
 		}
 
-	}
-
-	for _, section := range sectionMap {
-		sections = append(sections, section)
+		if videoID.Valid {
+			sections[index]["videos"] = append(sections[index]["videos"].([]map[string]interface{}), map[string]interface{}{
+				"id": videoID.Int64,
+				"title": videoTitle.String,
+				"order": videoOrder.Int64,
+			})
+		}
 	}
 
 	return sections, nil
 }
 
 
-
 func (s *Store) GetCourseDetailBySlug(slug string) (map[string]interface{}, error) {
 	courseDetail := make(map[string]interface{})
 
 	query := `
-	SELECT c.id, c.name, c.price, c.created_at, c.modified_at, u.first_name, u.last_name
+	SELECT c.id, c.name, c.price, c.language, c.level, c.total_duration, c.section_count, c.lecture_count,
+	       GREATEST(c.modified_at, c.content_updated_at), c.created_at, c.modified_at, u.first_name, u.last_name,
+	       c.rating_average, c.rating_count, c.review_count
 	FROM courses c
 	JOIN teachers t ON c.teacher_id = t.id
 	JOIN users u ON t.user_id = u.id
-	WHERE c.slug = $1
+	WHERE c.slug = $1 AND c.status = 'published'
 	`
 
 	var courseID int
 	var name string
 	var price float64
+	var language, level string
+	var totalDuration, sectionCount, lectureCount int
+	var lastUpdated time.Time
 	var createdAt time.Time
 	var modifiedAt time.Time
 	var firstName string
 	var lastName string
+	var ratingAverage float64
+	var ratingCount, reviewCount int
 
 	err := s.db.QueryRow(query, slug).Scan(
 		&courseID,
         &name,
         &price,
+		&language,
+		&level,
+		&totalDuration,
+		&sectionCount,
+		&lectureCount,
+		&lastUpdated,
 		&createdAt,
         &modifiedAt,
         &firstName,
         &lastName,
+		&ratingAverage,
+		&ratingCount,
+		&reviewCount,
 	)
 	if err!= nil {
 		if err == sql.ErrNoRows {
@@ -105,8 +135,18 @@ func (s *Store) GetCourseDetailBySlug(slug string) (map[string]interface{}, erro
 	courseDetail["id"] = courseID
 	courseDetail["name"] = name
 	courseDetail["price"] = price
+	courseDetail["language"] = language
+	courseDetail["level"] = level
 	courseDetail["created_at"] = createdAt.Format("01 / 2006")
 	courseDetail["modified_at"] = modifiedAt.Format("01 / 2006")
+	courseDetail["last_updated"] = lastUpdated.Format("01 / 2006")
+	courseDetail["total_duration"] = totalDuration
+	courseDetail["total_duration_text"] = utils.FormatDuration(totalDuration)
+	courseDetail["section_count"] = sectionCount
+	courseDetail["lecture_count"] = lectureCount
+	courseDetail["rating_average"] = ratingAverage
+	courseDetail["rating_count"] = ratingCount
+	courseDetail["review_count"] = reviewCount
 	courseDetail["teacher"] = map[string]string{
 		"first_name": firstName,
         "last_name":  lastName,
@@ -119,6 +159,199 @@ func (s *Store) GetCourseDetailBySlug(slug string) (map[string]interface{}, erro
 
 	courseDetail["sections"] = sections
 
+	tags, err := s.getCourseTags(courseID)
+	if err != nil {
+		return nil, err
+	}
+	courseDetail["tags"] = tags
+
+	policy, prerequisites, err := s.getCoursePrerequisites(courseID)
+	if err != nil {
+		return nil, err
+	}
+	courseDetail["prerequisite_policy"] = policy
+	courseDetail["prerequisites"] = prerequisites
+
 	return courseDetail, nil
 
 }
+
+
+func (s *Store) getCourseTags(courseID int) ([]types.CourseTag, error) {
+	query := `SELECT t.id, t.name, t.slug, ct.kind
+		FROM course_tags ct
+		JOIN tags t ON ct.tag_id = t.id
+		WHERE ct.course_id = $1
+		ORDER BY ct.kind, t.name`
+
+	rows, err := s.db.Query(query, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch course tags: %v", err)
+	}
+	defer rows.Close()
+
+	tags := []types.CourseTag{}
+	for rows.Next() {
+		var tag types.CourseTag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Kind); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+
+// getCoursePrerequisites lists the published prerequisites of a course with
+// the policy applied when a student does not own them.
+func (s *Store) getCoursePrerequisites(courseID int) (types.PrerequisitePolicy, []types.CoursePrerequisite, error) {
+	var policy types.PrerequisitePolicy
+	err := s.db.QueryRow(`SELECT prerequisite_policy FROM courses WHERE id = $1`, courseID).Scan(&policy)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not fetch prerequisite policy: %v", err)
+	}
+
+	rows, err := s.db.Query(`SELECT c.id, c.name, c.slug
+		FROM course_prerequisites cp
+		JOIN courses c ON cp.prerequisite_id = c.id
+		WHERE cp.course_id = $1 AND c.status = 'published'
+		ORDER BY c.name, c.id`, courseID)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not fetch prerequisites: %v", err)
+	}
+	defer rows.Close()
+
+	prerequisites := []types.CoursePrerequisite{}
+	for rows.Next() {
+		var prerequisite types.CoursePrerequisite
+		if err := rows.Scan(&prerequisite.ID, &prerequisite.Name, &prerequisite.Slug); err != nil {
+			return "", nil, err
+		}
+		prerequisites = append(prerequisites, prerequisite)
+	}
+	return policy, prerequisites, rows.Err()
+}
+
+
+// SearchTags autocompletes tag names starting with prefix. Tags used by more
+// published courses come first; an empty prefix lists the most used tags.
+func (s *Store) SearchTags(prefix string, limit int) ([]types.Tag, error) {
+	query := `SELECT t.id, t.name, t.slug, COUNT(c.id) AS course_count
+		FROM tags t
+		LEFT JOIN course_tags ct ON ct.tag_id = t.id
+		LEFT JOIN courses c ON c.id = ct.course_id AND c.status = 'published'
+		WHERE LOWER(t.name) LIKE $1
+		GROUP BY t.id
+		ORDER BY course_count DESC, t.name
+		LIMIT $2`
+
+	rows, err := s.db.Query(query, likePrefix(prefix), limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not search tags: %v", err)
+	}
+	defer rows.Close()
+
+	tags := []types.Tag{}
+	for rows.Next() {
+		var tag types.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.CourseCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+
+// likePrefix escapes LIKE wildcards in a user supplied prefix.
+func likePrefix(prefix string) string {
+	escaped := make([]rune, 0, len(prefix)+1)
+	for _, r := range prefix {
+		if r == '%' || r == '_' || r == '\\' {
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, r)
+	}
+	return strings.ToLower(string(escaped)) + "%"
+}
+
+
+func (s *Store) GetTagBySlug(slug string) (*types.Tag, error) {
+	query := `SELECT t.id, t.name, t.slug,
+		(SELECT COUNT(*) FROM course_tags ct JOIN courses c ON c.id = ct.course_id
+		 WHERE ct.tag_id = t.id AND c.status = 'published')
+		FROM tags t WHERE t.slug = $1`
+
+	var tag types.Tag
+	err := s.db.QueryRow(query, slug).Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.CourseCount)
+	if err == sql.ErrNoRows {
+		return nil, ErrTagNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch tag: %v", err)
+	}
+	return &tag, nil
+}
+
+
+// GetTopCoursesByTag lists the published courses carrying a tag, most
+// enrolled first and then by average rating.
+func (s *Store) GetTopCoursesByTag(tagID, limit int) ([]map[string]interface{}, error) {
+	query := `
+	SELECT c.id, c.name, c.slug, c.description, c.image, c.price, c.total_duration,
+	       c.section_count, c.lecture_count, GREATEST(c.modified_at, c.content_updated_at),
+	       u.first_name, u.last_name, ct.kind,
+	       (SELECT COUNT(*) FROM enrollments e WHERE e.course_id = c.id) AS enrollment_count,
+	       c.rating_average AS avg_rating
+	FROM course_tags ct
+	JOIN courses c ON c.id = ct.course_id
+	JOIN teachers t ON c.teacher_id = t.id
+	JOIN users u ON t.user_id = u.id
+	WHERE ct.tag_id = $1 AND c.status = 'published'
+	ORDER BY enrollment_count DESC, avg_rating DESC, c.id
+	LIMIT $2
+	`
+
+	rows, err := s.db.Query(query, tagID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch courses for tag: %v", err)
+	}
+	defer rows.Close()
+
+	courses := []map[string]interface{}{}
+	for rows.Next() {
+		var courseID, totalDuration, sectionCount, lectureCount, enrollments int
+		var name, slug, description, firstName, lastName, kind string
+		var image sql.NullString
+		var price, rating float64
+		var lastUpdated time.Time
+
+		err := rows.Scan(&courseID, &name, &slug, &description, &image, &price, &totalDuration,
+			&sectionCount, &lectureCount, &lastUpdated, &firstName, &lastName, &kind,
+			&enrollments, &rating)
+		if err != nil {
+			return nil, err
+		}
+
+		courses = append(courses, map[string]interface{}{
+			"id":                  courseID,
+			"name":                name,
+			"slug":                slug,
+			"description":         description,
+			"image_url":           image.String,
+			"price":               price,
+			"total_duration":      totalDuration,
+			"total_duration_text": utils.FormatDuration(totalDuration),
+			"section_count":       sectionCount,
+			"lecture_count":       lectureCount,
+			"last_updated":        lastUpdated.Format("01 / 2006"),
+			"teacher": map[string]string{
+				"full_name": fmt.Sprintf("%s %s", firstName, lastName),
+			},
+			"tag_kind":         kind,
+			"enrollment_count": enrollments,
+			"rating":           rating,
+		})
+	}
+	return courses, rows.Err()
+}
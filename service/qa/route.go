@@ -0,0 +1,203 @@
+package qa
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sikozonpc/ecom/service/auth"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+type Handler struct {
+	qa    types.QAStore
+	store types.UserStore
+}
+
+
+func NewHandler(qa types.QAStore, store types.UserStore) *Handler {
+	return &Handler{
+		qa:    qa,
+		store: store,
+	}
+}
+
+
+func (h *Handler) QARoutes(router *mux.Router) {
+	// The store checks that the user is enrolled in the course or teaches it
+	allRoles := []types.UserRole{types.TEACHER, types.STUDENT, types.ADMIN}
+
+	router.HandleFunc("/course/{slug}/questions", auth.WithJWTAuth(h.questionsHandler, h.store, allRoles)).Methods(http.MethodGet)
+	router.HandleFunc("/course/{slug}/questions", auth.WithJWTAuth(h.createQuestionHandler, h.store, allRoles)).Methods(http.MethodPost)
+	router.HandleFunc("/course/{slug}/questions/{id:[0-9]+}", auth.WithJWTAuth(h.questionHandler, h.store, allRoles)).Methods(http.MethodGet)
+	router.HandleFunc("/course/{slug}/questions/{id:[0-9]+}/answers", auth.WithJWTAuth(h.createAnswerHandler, h.store, allRoles)).Methods(http.MethodPost)
+	router.HandleFunc("/course/{slug}/questions/{id:[0-9]+}/upvote", auth.WithJWTAuth(h.voteHandler(h.qa.VoteQuestion, true), h.store, allRoles)).Methods(http.MethodPost)
+	router.HandleFunc("/course/{slug}/questions/{id:[0-9]+}/upvote", auth.WithJWTAuth(h.voteHandler(h.qa.VoteQuestion, false), h.store, allRoles)).Methods(http.MethodDelete)
+	router.HandleFunc("/course/{slug}/answers/{id:[0-9]+}/upvote", auth.WithJWTAuth(h.voteHandler(h.qa.VoteAnswer, true), h.store, allRoles)).Methods(http.MethodPost)
+	router.HandleFunc("/course/{slug}/answers/{id:[0-9]+}/upvote", auth.WithJWTAuth(h.voteHandler(h.qa.VoteAnswer, false), h.store, allRoles)).Methods(http.MethodDelete)
+}
+
+
+// writeStoreError maps the store's errors to HTTP statuses.
+func writeStoreError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNoAccess), errors.Is(err, ErrOwnPost):
+		utils.WriteError(writer, http.StatusForbidden, err)
+	case errors.Is(err, ErrCourseNotFound), errors.Is(err, ErrQuestionNotFound), errors.Is(err, ErrAnswerNotFound):
+		utils.WriteError(writer, http.StatusNotFound, err)
+	case errors.Is(err, ErrInvalidVideo), errors.Is(err, ErrInvalidParent), errors.Is(err, pagination.ErrInvalidCursor):
+		utils.WriteError(writer, http.StatusBadRequest, err)
+	default:
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+	}
+}
+
+
+func (h *Handler) questionsHandler(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+
+	filter := types.QuestionFilter{
+		Query:  query.Get("q"),
+		Status: types.QuestionStatus(query.Get("status")),
+		Sort:   types.QuestionSort(query.Get("sort")),
+	}
+	switch filter.Status {
+	case "", types.QuestionUnanswered, types.QuestionInstructor:
+	default:
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid status %q", filter.Status))
+		return
+	}
+	switch filter.Sort {
+	case "":
+		filter.Sort = types.QuestionSortNewest
+	case types.QuestionSortNewest, types.QuestionSortTop:
+	default:
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid sort %q", filter.Sort))
+		return
+	}
+	if videoID := query.Get("video_id"); videoID != "" {
+		id, err := strconv.Atoi(videoID)
+		if err != nil {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid video ID"))
+			return
+		}
+		filter.VideoID = id
+	}
+
+	params, err := pagination.FromRequest(request, "course_questions:"+string(filter.Sort), pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	userID := auth.GetUserIDFromContext(request.Context())
+	questions, err := h.qa.GetQuestions(mux.Vars(request)["slug"], userID, filter, params)
+	if err != nil {
+		writeStoreError(writer, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, map[string]interface{}{
+		"data":        questions.Data,
+		"next_cursor": questions.NextCursor,
+		"prev_cursor": questions.PrevCursor,
+		"sort":        filter.Sort,
+	})
+}
+
+
+func (h *Handler) questionHandler(writer http.ResponseWriter, request *http.Request) {
+	questionID, err := strconv.Atoi(mux.Vars(request)["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid question ID"))
+		return
+	}
+
+	userID := auth.GetUserIDFromContext(request.Context())
+	question, err := h.qa.GetQuestion(mux.Vars(request)["slug"], userID, questionID)
+	if err != nil {
+		writeStoreError(writer, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, question)
+}
+
+
+func (h *Handler) createQuestionHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload types.CreateQuestionPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	userID := auth.GetUserIDFromContext(request.Context())
+	question, err := h.qa.CreateQuestion(mux.Vars(request)["slug"], userID, payload)
+	if err != nil {
+		writeStoreError(writer, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusCreated, question)
+}
+
+
+func (h *Handler) createAnswerHandler(writer http.ResponseWriter, request *http.Request) {
+	questionID, err := strconv.Atoi(mux.Vars(request)["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid question ID"))
+		return
+	}
+
+	var payload types.CreateAnswerPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	userID := auth.GetUserIDFromContext(request.Context())
+	answer, err := h.qa.CreateAnswer(mux.Vars(request)["slug"], userID, questionID, payload)
+	if err != nil {
+		writeStoreError(writer, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusCreated, answer)
+}
+
+
+// voteHandler adds an upvote, or takes it back when up is false, through
+// vote, which is VoteQuestion or VoteAnswer.
+func (h *Handler) voteHandler(vote func(slug string, userID int, id int, up bool) (int, error), up bool) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(request)["id"])
+		if err != nil {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid ID"))
+			return
+		}
+
+		userID := auth.GetUserIDFromContext(request.Context())
+		upvotes, err := vote(mux.Vars(request)["slug"], userID, id, up)
+		if err != nil {
+			writeStoreError(writer, err)
+			return
+		}
+
+		utils.WriteJSON(writer, http.StatusOK, map[string]interface{}{
+			"upvoted": up,
+			"upvotes": upvotes,
+		})
+	}
+}
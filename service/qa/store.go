@@ -0,0 +1,463 @@
+package qa
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+var ErrCourseNotFound = errors.New("course not found")
+var ErrNoAccess = errors.New("only enrolled students and the course's teacher can use its Q&A")
+var ErrQuestionNotFound = errors.New("question not found")
+var ErrAnswerNotFound = errors.New("answer not found")
+var ErrInvalidVideo = errors.New("the lecture is not part of this course")
+var ErrInvalidParent = errors.New("the answer replied to is not part of this question")
+var ErrOwnPost = errors.New("you cannot upvote your own post")
+
+// searchConfig must match the configuration of course_questions.search_vector
+const searchConfig = "english"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+
+// queryer is a *sql.DB or a *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// course is a course as seen by a Q&A participant.
+type course struct {
+	id            int
+	name          string
+	teacherUserID int
+	isTeacher     bool
+}
+
+// courseAccess looks up the course of slug and checks that userID is
+// enrolled in it or teaches it.
+func courseAccess(db queryer, slug string, userID int) (*course, error) {
+	var c course
+	var enrolled bool
+	err := db.QueryRow(`SELECT c.id, c.name, t.user_id,
+			EXISTS(SELECT 1 FROM enrollments e WHERE e.course_id = c.id AND e.student_id = $2)
+		FROM courses c
+		JOIN teachers t ON c.teacher_id = t.id
+		WHERE c.slug = $1`, slug, userID).Scan(&c.id, &c.name, &c.teacherUserID, &enrolled)
+	if err == sql.ErrNoRows {
+		return nil, ErrCourseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get course: %v", err)
+	}
+
+	c.isTeacher = c.teacherUserID == userID
+	if !enrolled && !c.isTeacher {
+		return nil, ErrNoAccess
+	}
+	return &c, nil
+}
+
+
+const questionColumns = `q.id, q.course_id, q.video_id, v.title, q.author_id, u.first_name || ' ' || u.last_name,
+	q.title, q.body, q.upvotes, q.answer_count, q.answered_by_instructor,
+	EXISTS(SELECT 1 FROM question_votes qv WHERE qv.question_id = q.id AND qv.user_id = $2),
+	q.created_at`
+
+const questionJoins = `FROM course_questions q
+	JOIN users u ON q.author_id = u.id
+	LEFT JOIN videos v ON q.video_id = v.id`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanQuestion(row scanner) (types.Question, error) {
+	var question types.Question
+	err := row.Scan(
+		&question.ID,
+		&question.CourseID,
+		&question.VideoID,
+		&question.VideoTitle,
+		&question.AuthorID,
+		&question.AuthorName,
+		&question.Title,
+		&question.Body,
+		&question.Upvotes,
+		&question.AnswerCount,
+		&question.AnsweredByInstructor,
+		&question.Upvoted,
+		&question.CreatedAt,
+	)
+	return question, err
+}
+
+
+// questionKeysets are the orderings of a course's questions.
+var questionKeysets = map[types.QuestionSort]pagination.Keyset{
+	types.QuestionSortNewest: {Columns: []string{"q.created_at", "q.id"}, Desc: true},
+	types.QuestionSortTop:    {Columns: []string{"q.upvotes", "q.created_at", "q.id"}, Desc: true},
+}
+
+var questionKeys = map[types.QuestionSort]func(types.Question) []interface{}{
+	types.QuestionSortNewest: func(question types.Question) []interface{} {
+		return []interface{}{question.CreatedAt, question.ID}
+	},
+	types.QuestionSortTop: func(question types.Question) []interface{} {
+		return []interface{}{question.Upvotes, question.CreatedAt, question.ID}
+	},
+}
+
+
+// GetQuestions lists a page of the questions of a course, narrowed down
+// by filter.
+func (s *Store) GetQuestions(slug string, userID int, filter types.QuestionFilter, params pagination.Params) (pagination.Page[types.Question], error) {
+	var page pagination.Page[types.Question]
+
+	c, err := courseAccess(s.db, slug, userID)
+	if err != nil {
+		return page, err
+	}
+
+	keyset, ok := questionKeysets[filter.Sort]
+	if !ok {
+		return page, fmt.Errorf("unknown question sort %q", filter.Sort)
+	}
+
+	where := ` WHERE q.course_id = $1`
+	args := []interface{}{c.id, userID}
+	if filter.VideoID != 0 {
+		args = append(args, filter.VideoID)
+		where += ` AND q.video_id = $` + strconv.Itoa(len(args))
+	}
+	if filter.Query != "" {
+		args = append(args, filter.Query)
+		where += ` AND q.search_vector @@ websearch_to_tsquery('` + searchConfig + `', $` + strconv.Itoa(len(args)) + `)`
+	}
+	switch filter.Status {
+	case types.QuestionUnanswered:
+		where += ` AND q.answer_count = 0`
+	case types.QuestionInstructor:
+		where += ` AND q.answered_by_instructor`
+	}
+
+	cursor, args, err := keyset.Where(params, args)
+	if err != nil {
+		return page, err
+	}
+	order, args := keyset.OrderBy(params, args)
+
+	rows, err := s.db.Query(`SELECT `+questionColumns+` `+questionJoins+where+cursor+order, args...)
+	if err != nil {
+		return page, fmt.Errorf("could not get questions: %v", err)
+	}
+	defer rows.Close()
+
+	var questions []types.Question
+	for rows.Next() {
+		question, err := scanQuestion(rows)
+		if err != nil {
+			return page, fmt.Errorf("could not scan question: %v", err)
+		}
+		questions = append(questions, question)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("row iteration error: %v", err)
+	}
+	return pagination.NewPage(questions, params, questionKeys[filter.Sort]), nil
+}
+
+
+// GetQuestion returns a question with its answers as a thread. Answers by
+// the instructor come first, then the most upvoted; replies are in the
+// order they were posted.
+func (s *Store) GetQuestion(slug string, userID int, questionID int) (*types.Question, error) {
+	c, err := courseAccess(s.db, slug, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	question, err := scanQuestion(s.db.QueryRow(`SELECT `+questionColumns+` `+questionJoins+`
+		WHERE q.id = $3 AND q.course_id = $1`, c.id, userID, questionID))
+	if err == sql.ErrNoRows {
+		return nil, ErrQuestionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get question: %v", err)
+	}
+
+	rows, err := s.db.Query(`SELECT a.id, a.question_id, a.parent_id, a.author_id, u.first_name || ' ' || u.last_name,
+			a.body, a.by_instructor, a.upvotes,
+			EXISTS(SELECT 1 FROM answer_votes av WHERE av.answer_id = a.id AND av.user_id = $2),
+			a.created_at
+		FROM question_answers a
+		JOIN users u ON a.author_id = u.id
+		WHERE a.question_id = $1
+		ORDER BY a.created_at, a.id`, questionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get answers: %v", err)
+	}
+	defer rows.Close()
+
+	var answers []*types.Answer
+	for rows.Next() {
+		answer := &types.Answer{Replies: []*types.Answer{}}
+		if err := rows.Scan(
+			&answer.ID,
+			&answer.QuestionID,
+			&answer.ParentID,
+			&answer.AuthorID,
+			&answer.AuthorName,
+			&answer.Body,
+			&answer.ByInstructor,
+			&answer.Upvotes,
+			&answer.Upvoted,
+			&answer.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("could not scan answer: %v", err)
+		}
+		answers = append(answers, answer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %v", err)
+	}
+
+	question.Answers = thread(answers)
+	return &question, nil
+}
+
+
+// thread nests answers, given oldest first, under the answers they reply
+// to and returns the top level ones.
+func thread(answers []*types.Answer) []*types.Answer {
+	byID := make(map[int]*types.Answer, len(answers))
+	for _, answer := range answers {
+		byID[answer.ID] = answer
+	}
+
+	top := []*types.Answer{}
+	for _, answer := range answers {
+		if answer.ParentID != nil {
+			if parent, ok := byID[*answer.ParentID]; ok {
+				parent.Replies = append(parent.Replies, answer)
+				continue
+			}
+		}
+		top = append(top, answer)
+	}
+
+	sort.SliceStable(top, func(i, j int) bool {
+		if top[i].ByInstructor != top[j].ByInstructor {
+			return top[i].ByInstructor
+		}
+		return top[i].Upvotes > top[j].Upvotes
+	})
+	return top
+}
+
+
+// CreateQuestion posts a question to a course, optionally about one of its
+// lectures, and lets the course's teacher know.
+func (s *Store) CreateQuestion(slug string, userID int, payload types.CreateQuestionPayload) (*types.Question, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	c, err := courseAccess(tx, slug, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.VideoID != nil {
+		var inCourse bool
+		err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM videos v JOIN sections s ON v.section_id = s.id
+			WHERE v.id = $1 AND s.course_id = $2)`, *payload.VideoID, c.id).Scan(&inCourse)
+		if err != nil {
+			return nil, fmt.Errorf("could not check lecture: %v", err)
+		}
+		if !inCourse {
+			return nil, ErrInvalidVideo
+		}
+	}
+
+	var questionID int
+	err = tx.QueryRow(`INSERT INTO course_questions (course_id, video_id, author_id, title, body)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, c.id, payload.VideoID, userID, payload.Title, payload.Body).Scan(&questionID)
+	if err != nil {
+		return nil, fmt.Errorf("could not create question: %v", err)
+	}
+
+	if !c.isTeacher {
+		_, err = tx.Exec(`INSERT INTO notifications (user_id, kind, course_id, title, body, link)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			c.teacherUserID, types.NotificationNewQuestion, c.id,
+			"New question in "+c.name, payload.Title,
+			fmt.Sprintf("/course/%s/questions/%d", slug, questionID))
+		if err != nil {
+			return nil, fmt.Errorf("could not notify teacher: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetQuestion(slug, userID, questionID)
+}
+
+
+// CreateAnswer answers a question or, with a parent, replies to one of its
+// answers. Answers from the course's teacher mark the question answered by
+// the instructor.
+func (s *Store) CreateAnswer(slug string, userID int, questionID int, payload types.CreateAnswerPayload) (*types.Answer, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	c, err := courseAccess(tx, slug, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = tx.QueryRow(`SELECT id FROM course_questions WHERE id = $1 AND course_id = $2 FOR UPDATE`, questionID, c.id).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrQuestionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get question: %v", err)
+	}
+
+	if payload.ParentID != nil {
+		var inQuestion bool
+		err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM question_answers WHERE id = $1 AND question_id = $2)`,
+			*payload.ParentID, questionID).Scan(&inQuestion)
+		if err != nil {
+			return nil, fmt.Errorf("could not check answer: %v", err)
+		}
+		if !inQuestion {
+			return nil, ErrInvalidParent
+		}
+	}
+
+	answer := types.Answer{
+		QuestionID:   questionID,
+		ParentID:     payload.ParentID,
+		AuthorID:     userID,
+		Body:         payload.Body,
+		ByInstructor: c.isTeacher,
+		Replies:      []*types.Answer{},
+	}
+	err = tx.QueryRow(`INSERT INTO question_answers (question_id, parent_id, author_id, body, by_instructor)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, (SELECT first_name || ' ' || last_name FROM users WHERE id = $3)`,
+		questionID, payload.ParentID, userID, payload.Body, c.isTeacher).Scan(&answer.ID, &answer.CreatedAt, &answer.AuthorName)
+	if err != nil {
+		return nil, fmt.Errorf("could not create answer: %v", err)
+	}
+
+	_, err = tx.Exec(`UPDATE course_questions
+		SET answer_count = answer_count + 1, answered_by_instructor = answered_by_instructor OR $2
+		WHERE id = $1`, questionID, c.isTeacher)
+	if err != nil {
+		return nil, fmt.Errorf("could not update question: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &answer, nil
+}
+
+
+// VoteQuestion adds or, when up is false, takes back the user's upvote of a
+// question and returns its upvotes.
+func (s *Store) VoteQuestion(slug string, userID int, questionID int, up bool) (int, error) {
+	return s.vote(slug, userID, questionID, up, voteTarget{
+		lookup:  `SELECT author_id FROM course_questions WHERE id = $1 AND course_id = $2 FOR UPDATE`,
+		add:     `INSERT INTO question_votes (question_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		remove:  `DELETE FROM question_votes WHERE question_id = $1 AND user_id = $2`,
+		count:   `UPDATE course_questions SET upvotes = (SELECT COUNT(*) FROM question_votes WHERE question_id = $1) WHERE id = $1 RETURNING upvotes`,
+		missing: ErrQuestionNotFound,
+	})
+}
+
+
+// VoteAnswer adds or, when up is false, takes back the user's upvote of an
+// answer and returns its upvotes.
+func (s *Store) VoteAnswer(slug string, userID int, answerID int, up bool) (int, error) {
+	return s.vote(slug, userID, answerID, up, voteTarget{
+		lookup: `SELECT a.author_id FROM question_answers a
+			JOIN course_questions q ON a.question_id = q.id
+			WHERE a.id = $1 AND q.course_id = $2 FOR UPDATE OF a`,
+		add:     `INSERT INTO answer_votes (answer_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		remove:  `DELETE FROM answer_votes WHERE answer_id = $1 AND user_id = $2`,
+		count:   `UPDATE question_answers SET upvotes = (SELECT COUNT(*) FROM answer_votes WHERE answer_id = $1) WHERE id = $1 RETURNING upvotes`,
+		missing: ErrAnswerNotFound,
+	})
+}
+
+
+// voteTarget holds the queries that vote on one kind of post. lookup
+// returns the post's author given its ID and course.
+type voteTarget struct {
+	lookup, add, remove, count string
+	missing                    error
+}
+
+func (s *Store) vote(slug string, userID int, postID int, up bool, target voteTarget) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	c, err := courseAccess(tx, slug, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var authorID int
+	err = tx.QueryRow(target.lookup, postID, c.id).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		return 0, target.missing
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not get post: %v", err)
+	}
+	if authorID == userID {
+		return 0, ErrOwnPost
+	}
+
+	query := target.remove
+	if up {
+		query = target.add
+	}
+	if _, err := tx.Exec(query, postID, userID); err != nil {
+		return 0, fmt.Errorf("could not vote: %v", err)
+	}
+
+	var upvotes int
+	if err := tx.QueryRow(target.count, postID).Scan(&upvotes); err != nil {
+		return 0, fmt.Errorf("could not count votes: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return upvotes, nil
+}
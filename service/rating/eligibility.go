@@ -0,0 +1,159 @@
+package rating
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/sikozonpc/ecom/types"
+)
+
+// progressColumn is the percent of course c that the student of enrollment
+// e completed, weighing lectures by their duration, or counting them when
+// the course has no durations yet.
+const progressColumn = `LEAST(100, COALESCE((
+	SELECT CASE WHEN c.total_duration > 0 THEN SUM(v.duration) * 100.0 / c.total_duration
+	            ELSE COUNT(*) * 100.0 / NULLIF(c.lecture_count, 0) END
+	FROM lecture_progress lp
+	JOIN videos v ON v.id = lp.video_id
+	JOIN sections s ON s.id = v.section_id
+	WHERE lp.student_id = e.student_id AND s.course_id = c.id), 0))::float8`
+
+
+// GetCourseProgress reports whether a student is enrolled in a course and
+// how much of it they completed.
+func (s *Store) GetCourseProgress(studentID int, courseID int) (*types.CourseProgress, error) {
+	var progress types.CourseProgress
+	var enrolledAt sql.NullTime
+	err := s.db.QueryRow(`SELECT e.enrolled_at, `+progressColumn+`
+		FROM enrollments e
+		JOIN courses c ON c.id = e.course_id
+		WHERE e.student_id = $1 AND e.course_id = $2
+		ORDER BY e.enrolled_at
+		LIMIT 1`, studentID, courseID).Scan(&enrolledAt, &progress.Percent)
+	if err == sql.ErrNoRows {
+		return &progress, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get course progress: %v", err)
+	}
+
+	// Without an enrollment date the enrolled-for rule cannot be met
+	progress.Enrolled = true
+	if enrolledAt.Valid {
+		progress.EnrolledAt = &enrolledAt.Time
+	}
+	progress.Percent = math.Round(progress.Percent*10) / 10
+	return &progress, nil
+}
+
+
+// eligibility applies the review rules to a student's progress in a course.
+func eligibility(rules types.ReviewRules, progress *types.CourseProgress, now time.Time) types.ReviewEligibility {
+	result := types.ReviewEligibility{
+		Progress:    progress.Percent,
+		MinProgress: rules.MinProgress,
+	}
+	if !progress.Enrolled {
+		result.Reason = "you must be enrolled in the course to rate it"
+		return result
+	}
+	if rules.Allows(progress.Percent, progress.EnrolledAt, now) {
+		result.Eligible = true
+		return result
+	}
+
+	switch {
+	case rules.MinProgress > 0 && rules.MinEnrolledFor > 0 && progress.EnrolledAt != nil:
+		eligibleAt := progress.EnrolledAt.Add(rules.MinEnrolledFor)
+		result.EligibleAt = &eligibleAt
+		result.Reason = fmt.Sprintf("you can rate this course once you completed %g%% of it or on %s",
+			rules.MinProgress, eligibleAt.Format("2006-01-02 15:04 MST"))
+	case rules.MinProgress > 0:
+		result.Reason = fmt.Sprintf("you can rate this course once you completed %g%% of it", rules.MinProgress)
+	case progress.EnrolledAt == nil:
+		result.Reason = "your enrollment has no start date, so you cannot rate this course yet"
+	default:
+		eligibleAt := progress.EnrolledAt.Add(rules.MinEnrolledFor)
+		result.EligibleAt = &eligibleAt
+		result.Reason = fmt.Sprintf("you can rate this course on %s", eligibleAt.Format("2006-01-02 15:04 MST"))
+	}
+	return result
+}
+
+
+// ErrPromptsRunning is returned when another API process is already
+// sending review prompts.
+var ErrPromptsRunning = errors.New("review prompts are already being sent")
+
+// promptLock is the advisory lock key held while sending review prompts.
+const promptLock = 49001
+
+
+// PromptReviews asks every student who became eligible to review a course
+// they have not rated to do so, once per course. It returns how many
+// students were prompted. Only one run sends prompts at a time; the others
+// return ErrPromptsRunning.
+func (s *Store) PromptReviews(rules types.ReviewRules) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1)`, promptLock).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("could not lock review prompts: %v", err)
+	}
+	if !locked {
+		return 0, ErrPromptsRunning
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO notifications (user_id, kind, course_id, title, body, link)
+		SELECT DISTINCT e.student_id, $3, c.id,
+		       'How is ' || c.name || ' going?',
+		       'Rate the course to help other students decide.',
+		       '/course/' || c.slug
+		FROM enrollments e
+		JOIN courses c ON c.id = e.course_id
+		WHERE e.student_id IS NOT NULL AND c.status = 'published'
+		AND NOT EXISTS (SELECT 1 FROM ratings r WHERE r.student_id = e.student_id AND r.course_id = c.id)
+		AND NOT EXISTS (SELECT 1 FROM notifications n WHERE n.user_id = e.student_id AND n.course_id = c.id AND n.kind = $3)
+		AND (($1::float8 <= 0 AND $2::float8 <= 0)
+		     OR ($1::float8 > 0 AND `+progressColumn+` >= $1::float8)
+		     OR ($2::float8 > 0 AND e.enrolled_at <= NOW() - make_interval(secs => $2::float8)))
+		ON CONFLICT (user_id, course_id) WHERE kind = 'review_prompt' DO NOTHING`,
+		rules.MinProgress, rules.MinEnrolledFor.Seconds(), types.NotificationReviewPrompt)
+	if err != nil {
+		return 0, fmt.Errorf("could not prompt reviews: %v", err)
+	}
+	prompted, _ := result.RowsAffected()
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(prompted), nil
+}
+
+
+// PromptEvery sends review prompts on a fixed interval until ctx is
+// cancelled. Failures are logged and retried on the next tick.
+func PromptEvery(ctx context.Context, store types.RatingStore, rules types.ReviewRules, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := store.PromptReviews(rules); err != nil && !errors.Is(err, ErrPromptsRunning) {
+				log.Println(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
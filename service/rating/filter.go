@@ -0,0 +1,115 @@
+package rating
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// The review filter holds back reviews that look abusive or like spam
+// until an admin has looked at them. It errs on the side of letting reviews
+// through: anything it misses can still be reported.
+
+// blockedWords are matched against whole words after undoing common
+// character swaps, so "sh1t" and "$hit" are caught but "Scunthorpe" is not.
+var blockedWords = map[string]bool{
+	"fuck": true, "fucking": true, "fucker": true, "motherfucker": true,
+	"shit": true, "shitty": true, "bullshit": true,
+	"bitch": true, "bastard": true, "asshole": true, "dick": true,
+	"cunt": true, "whore": true, "slut": true, "retard": true,
+	"wanker": true, "twat": true, "prick": true, "douchebag": true,
+}
+
+// spamPhrases are what promotional reviews tend to say.
+var spamPhrases = []string{
+	"buy now", "click here", "free money", "work from home", "make money fast",
+	"limited offer", "visit my", "check out my", "use my code", "promo code",
+	"whatsapp", "telegram",
+}
+
+var (
+	// A bare word.tld is too often a technology name, such as ASP.NET or
+	// socket.io, so links need a scheme, a www. prefix, a path or a
+	// subdomain
+	linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+` +
+		`|\b[a-z0-9-]+(\.[a-z0-9-]+)*\.(com|net|org|io|xyz|ru|info|biz)/\S*` +
+		`|\b[a-z0-9-]+(\.[a-z0-9-]+)+\.(com|net|org|io|xyz|ru|info|biz)\b`)
+	emailPattern = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`)
+	phonePattern = regexp.MustCompile(`\+?\d[\d\s().-]{8,}\d`)
+)
+
+var leetReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i",
+)
+
+
+// checkReview returns why a review should be held for moderation, or ""
+// when it can be published straight away.
+func checkReview(review string) string {
+	text := strings.TrimSpace(review)
+	if text == "" {
+		return ""
+	}
+
+	for _, word := range strings.FieldsFunc(leetReplacer.Replace(strings.ToLower(text)), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		if blockedWords[word] {
+			return "profanity"
+		}
+	}
+
+	lower := strings.ToLower(text)
+	for _, phrase := range spamPhrases {
+		if strings.Contains(lower, phrase) {
+			return "spam: promotional wording"
+		}
+	}
+	if linkPattern.MatchString(text) {
+		return "spam: contains a link"
+	}
+	if emailPattern.MatchString(text) || phonePattern.MatchString(text) {
+		return "spam: contains contact details"
+	}
+	if repeatedRun(text, 7) {
+		return "spam: repeated characters"
+	}
+	if shouting(text) {
+		return "spam: written in capitals"
+	}
+	return ""
+}
+
+
+// repeatedRun reports whether a character repeats n or more times in a row,
+// as in "sooooooooo".
+func repeatedRun(text string, n int) bool {
+	var last rune
+	run := 0
+	for _, r := range text {
+		if r == last {
+			run++
+		} else {
+			last, run = r, 1
+		}
+		if run >= n && !unicode.IsSpace(r) {
+			return true
+		}
+	}
+	return false
+}
+
+
+// shouting reports whether a review of some length is mostly capitals.
+func shouting(text string) bool {
+	letters, upper := 0, 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	return letters >= 20 && upper*10 >= letters*8
+}
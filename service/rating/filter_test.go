@@ -0,0 +1,37 @@
+package rating
+
+import "testing"
+
+func TestCheckReview(t *testing.T) {
+	tests := []struct {
+		name   string
+		review string
+		want   string
+	}{
+		{"clean", "Clear explanations and good exercises, I learned a lot.", ""},
+		{"empty", "   ", ""},
+		{"profanity", "This course is shit.", "profanity"},
+		{"leetspeak", "Total sh1t, do not buy", "profanity"},
+		{"symbol swaps", "what a $hit course", "profanity"},
+		{"Scunthorpe", "I took it on the train to Scunthorpe and loved it.", ""},
+		{"ASP.NET and socket.io", "Great intro to ASP.NET, and the socket.io chapter is a gem.", ""},
+		{"file names", "Node.js and Vue.js are covered, see main.go too.", ""},
+		{"promotional", "Click here for a discount on my course!", "spam: promotional wording"},
+		{"scheme", "Better course at https://example.com", "spam: contains a link"},
+		{"www", "go to www.cheapcourses.xyz instead", "spam: contains a link"},
+		{"path", "grab the notes at mysite.io/notes", "spam: contains a link"},
+		{"subdomain", "more on deals.cheapcourses.com today", "spam: contains a link"},
+		{"email", "Write to me at student@example.com for the answers", "spam: contains contact details"},
+		{"phone", "Call +1 (555) 123-4567 for tutoring", "spam: contains contact details"},
+		{"repeated characters", "Sooooooooo good", "spam: repeated characters"},
+		{"shouting", "THIS IS THE BEST COURSE I HAVE EVER TAKEN", "spam: written in capitals"},
+		{"short capitals", "GREAT COURSE", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := checkReview(test.review); got != test.want {
+				t.Errorf("checkReview(%q) = %q, want %q", test.review, got, test.want)
+			}
+		})
+	}
+}
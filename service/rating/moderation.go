@@ -0,0 +1,210 @@
+package rating
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+
+// logModeration records an action on a review in review_moderation_log.
+// moderatorID is 0 for actions nobody took, like the filter's.
+func logModeration(db execer, ratingID int, action types.ModerationAction, reason string, moderatorID int) error {
+	_, err := db.Exec(`
+		INSERT INTO review_moderation_log (rating_id, course_id, action, reason, moderator_id)
+		SELECT id, course_id, $2, $3, NULLIF($4, 0) FROM ratings WHERE id = $1`,
+		ratingID, action, reason, moderatorID)
+	if err != nil {
+		return fmt.Errorf("could not log moderation: %v", err)
+	}
+	return nil
+}
+
+
+// ReportReview flags a published review. Once reportThreshold reports are
+// open the review is held back as pending until an admin acts on it.
+func (s *Store) ReportReview(report *types.ReviewReport) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var authorID, courseID int
+	var status types.RatingStatus
+	err = tx.QueryRow(`SELECT student_id, course_id, status FROM ratings WHERE id = $1 FOR UPDATE`, report.RatingID).Scan(&authorID, &courseID, &status)
+	if err == sql.ErrNoRows || (err == nil && status != types.RatingPublished) {
+		return ErrRatingNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not get rating: %v", err)
+	}
+	if authorID == report.ReporterID {
+		return ErrOwnReview
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO review_reports (rating_id, reporter_id, reason, details)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		report.RatingID, report.ReporterID, report.Reason, report.Details).Scan(&report.ID, &report.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrAlreadyReported
+		}
+		return fmt.Errorf("could not report review: %v", err)
+	}
+	if err := logModeration(tx, report.RatingID, types.ModerationReport, report.Reason, 0); err != nil {
+		return err
+	}
+
+	var open int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM review_reports WHERE rating_id = $1 AND resolved_at IS NULL`, report.RatingID).Scan(&open)
+	if err != nil {
+		return fmt.Errorf("could not count reports: %v", err)
+	}
+	if open >= reportThreshold {
+		_, err = tx.Exec(`UPDATE ratings SET status = 'pending', moderation_reason = $2 WHERE id = $1`,
+			report.RatingID, fmt.Sprintf("reported by %d users", open))
+		if err != nil {
+			return fmt.Errorf("could not hold back review: %v", err)
+		}
+		if err := refreshRatingStats(tx, courseID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+
+// queueKeyset lists the reviews that have waited longest first.
+var queueKeyset = pagination.Keyset{Columns: []string{"r.created_at", "r.id"}}
+
+func queueKey(item types.ModerationQueueItem) []interface{} {
+	return []interface{}{item.CreatedAt, item.ID}
+}
+
+
+// GetModerationQueue lists the reviews an admin has to look at: pending
+// ones and published ones with open reports, narrowed down by queue.
+func (s *Store) GetModerationQueue(queue types.ModerationQueue, params pagination.Params) (pagination.Page[types.ModerationQueueItem], error) {
+	var page pagination.Page[types.ModerationQueueItem]
+	var items []types.ModerationQueueItem
+
+	reported := `(r.status = 'published' AND EXISTS (
+		SELECT 1 FROM review_reports o WHERE o.rating_id = r.id AND o.resolved_at IS NULL))`
+	var condition string
+	switch queue {
+	case types.QueuePending:
+		condition = `r.status = 'pending'`
+	case types.QueueReported:
+		condition = reported
+	default:
+		condition = `(r.status = 'pending' OR ` + reported + `)`
+	}
+
+	cursor, args, err := queueKeyset.Where(params, nil)
+	if err != nil {
+		return page, err
+	}
+	order, args := queueKeyset.OrderBy(params, args)
+
+	query := `
+		SELECT r.id, r.student_id, u.first_name, u.last_name, r.course_id, c.name, r.rating, r.review, r.created_at,
+		       r.status, r.moderation_reason,
+		       COUNT(rr.id), COALESCE(array_agg(DISTINCT rr.reason) FILTER (WHERE rr.id IS NOT NULL), '{}')
+		FROM ratings AS r
+		JOIN courses AS c ON r.course_id = c.id
+		JOIN users AS u ON r.student_id = u.id
+		LEFT JOIN review_reports AS rr ON rr.rating_id = r.id AND rr.resolved_at IS NULL
+		WHERE ` + condition + cursor + `
+		GROUP BY r.id, u.first_name, u.last_name, c.name` + order
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return page, fmt.Errorf("could not get moderation queue: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item types.ModerationQueueItem
+		if err := rows.Scan(
+			&item.ID, &item.StudentID, &item.StudentFirstName, &item.StudentLastName, &item.CourseID,
+			&item.CourseName, &item.Rating.Rating, &item.Review, &item.CreatedAt,
+			&item.Status, &item.ModerationReason,
+			&item.OpenReports, pq.Array(&item.ReportReasons),
+		); err != nil {
+			return page, fmt.Errorf("could not scan review: %v", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("row iteration error: %v", err)
+	}
+	return pagination.NewPage(items, params, queueKey), nil
+}
+
+
+// ModerateReview approves, hides or deletes a review on behalf of an
+// admin and resolves its open reports.
+func (s *Store) ModerateReview(ratingID int, action types.ModerationAction, reason string, moderatorID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var courseID int
+	err = tx.QueryRow(`SELECT course_id FROM ratings WHERE id = $1 FOR UPDATE`, ratingID).Scan(&courseID)
+	if err == sql.ErrNoRows {
+		return ErrRatingNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not get rating: %v", err)
+	}
+
+	// Logged first, the log entry needs the rating's course
+	if err := logModeration(tx, ratingID, action, reason, moderatorID); err != nil {
+		return err
+	}
+
+	switch action {
+	case types.ModerationApprove, types.ModerationHide:
+		status := types.RatingPublished
+		if action == types.ModerationHide {
+			status = types.RatingHidden
+		}
+		_, err = tx.Exec(`
+			UPDATE ratings
+			SET status = $2, moderation_reason = NULLIF($3, ''), moderated_by = NULLIF($4, 0), moderated_at = NOW()
+			WHERE id = $1`, ratingID, status, reason, moderatorID)
+		if err != nil {
+			return fmt.Errorf("could not moderate review: %v", err)
+		}
+		_, err = tx.Exec(`UPDATE review_reports SET resolved_at = NOW() WHERE rating_id = $1 AND resolved_at IS NULL`, ratingID)
+		if err != nil {
+			return fmt.Errorf("could not resolve reports: %v", err)
+		}
+	case types.ModerationDelete:
+		// Reports go with the rating
+		if _, err := tx.Exec(`DELETE FROM ratings WHERE id = $1`, ratingID); err != nil {
+			return fmt.Errorf("could not delete review: %v", err)
+		}
+	default:
+		return fmt.Errorf("unknown moderation action %q", action)
+	}
+
+	if err := refreshRatingStats(tx, courseID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
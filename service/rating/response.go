@@ -0,0 +1,163 @@
+package rating
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/sikozonpc/ecom/types"
+)
+
+var ErrNotCourseTeacher = errors.New("only the course's teacher can respond to its reviews")
+var ErrResponseNotFound = errors.New("response not found")
+var ErrAlreadyResponded = errors.New("this review already has a response, edit it instead")
+
+
+// courseTeacher returns the ID of the teacher behind teacherUserID if they
+// teach the course of a published review.
+func (s *Store) courseTeacher(ratingID int, teacherUserID int) (int, error) {
+	var courseTeacherID int
+	var teacherID sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT c.teacher_id, (SELECT id FROM teachers WHERE user_id = $2)
+		FROM ratings AS r
+		JOIN courses AS c ON r.course_id = c.id
+		WHERE r.id = $1 AND r.status = 'published'`, ratingID, teacherUserID).Scan(&courseTeacherID, &teacherID)
+	if err == sql.ErrNoRows {
+		return 0, ErrRatingNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not get rating: %v", err)
+	}
+	if !teacherID.Valid || int(teacherID.Int64) != courseTeacherID {
+		return 0, ErrNotCourseTeacher
+	}
+	return courseTeacherID, nil
+}
+
+
+func (s *Store) getResponse(ratingID int) (*types.ReviewResponse, error) {
+	var response types.ReviewResponse
+	err := s.db.QueryRow(`
+		SELECT rr.rating_id, rr.teacher_id, u.first_name || ' ' || u.last_name, rr.body, rr.created_at, rr.updated_at
+		FROM review_responses AS rr
+		JOIN teachers AS t ON rr.teacher_id = t.id
+		JOIN users AS u ON t.user_id = u.id
+		WHERE rr.rating_id = $1`, ratingID).Scan(
+		&response.RatingID, &response.TeacherID, &response.TeacherName,
+		&response.Body, &response.CreatedAt, &response.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrResponseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get response: %v", err)
+	}
+	return &response, nil
+}
+
+
+// CreateResponse posts the teacher's response to a review of their course.
+// A review has at most one response.
+func (s *Store) CreateResponse(ratingID int, teacherUserID int, body string) (*types.ReviewResponse, error) {
+	teacherID, err := s.courseTeacher(ratingID, teacherUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO review_responses (rating_id, teacher_id, body) VALUES ($1, $2, $3)`,
+		ratingID, teacherID, body)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, ErrAlreadyResponded
+		}
+		return nil, fmt.Errorf("could not create response: %v", err)
+	}
+	return s.getResponse(ratingID)
+}
+
+
+// UpdateResponse replaces the text of the teacher's response to a review.
+func (s *Store) UpdateResponse(ratingID int, teacherUserID int, body string) (*types.ReviewResponse, error) {
+	teacherID, err := s.courseTeacher(ratingID, teacherUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE review_responses SET body = $3, teacher_id = $2, updated_at = NOW()
+		WHERE rating_id = $1`, ratingID, teacherID, body)
+	if err != nil {
+		return nil, fmt.Errorf("could not update response: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrResponseNotFound
+	}
+	return s.getResponse(ratingID)
+}
+
+
+// DeleteResponse removes the teacher's response to a review.
+func (s *Store) DeleteResponse(ratingID int, teacherUserID int) error {
+	if _, err := s.courseTeacher(ratingID, teacherUserID); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`DELETE FROM review_responses WHERE rating_id = $1`, ratingID)
+	if err != nil {
+		return fmt.Errorf("could not delete response: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrResponseNotFound
+	}
+	return nil
+}
+
+
+// VoteReview records whether userID found a published review helpful.
+// Each user has one vote per review; voting again changes it. The review's
+// helpful and unhelpful vote totals are returned.
+func (s *Store) VoteReview(ratingID int, userID int, helpful bool) (int, int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var authorID int
+	err = tx.QueryRow(`SELECT student_id FROM ratings WHERE id = $1 AND status = 'published' FOR UPDATE`, ratingID).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrRatingNotFound
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not get rating: %v", err)
+	}
+	if authorID == userID {
+		return 0, 0, ErrOwnReview
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO review_votes (rating_id, user_id, helpful) VALUES ($1, $2, $3)
+		ON CONFLICT (rating_id, user_id) DO UPDATE SET helpful = EXCLUDED.helpful, created_at = NOW()`,
+		ratingID, userID, helpful)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not vote on review: %v", err)
+	}
+
+	var helpfulVotes, unhelpfulVotes int
+	err = tx.QueryRow(`
+		UPDATE ratings SET
+			helpful_votes = (SELECT COUNT(*) FROM review_votes WHERE rating_id = $1 AND helpful),
+			unhelpful_votes = (SELECT COUNT(*) FROM review_votes WHERE rating_id = $1 AND NOT helpful)
+		WHERE id = $1
+		RETURNING helpful_votes, unhelpful_votes`, ratingID).Scan(&helpfulVotes, &unhelpfulVotes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not count votes: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return helpfulVotes, unhelpfulVotes, nil
+}
@@ -1,26 +1,35 @@
 package rating
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sikozonpc/ecom/service/auth"
 	"github.com/sikozonpc/ecom/types"
 	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
 )
 
 type Handler struct {
 	rating types.RatingStore
 	store  types.UserStore
+	rules  types.ReviewRules
+	// indexer keeps the rating filters and sorts of search in step
+	indexer types.SearchIndexer
 }
 
 
-func NewHandler(rating types.RatingStore, store types.UserStore) *Handler {
+func NewHandler(rating types.RatingStore, store types.UserStore, rules types.ReviewRules, indexer types.SearchIndexer) *Handler {
 	return &Handler{
 		rating: rating,
         store:  store,
+		rules:  rules,
+		indexer: indexer,
     }
 }
 
@@ -33,11 +42,30 @@ func (h *Handler) RatingRoutes(router *mux.Router) {
 	}
 
 	router.HandleFunc("/student/rating/post", auth.WithJWTAuth(h.createRatingHandler, h.store, usersOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/student/rating", auth.WithJWTAuth(h.createRatingHandler, h.store, usersOnly)).Methods(http.MethodPut)
 	router.HandleFunc("/student/rating/edit/{id}", auth.WithJWTAuth(h.updateRatingHandler, h.store, usersOnly)).Methods(http.MethodPatch)
+	router.HandleFunc("/student/rating/eligibility/{course_id:[0-9]+}", auth.WithJWTAuth(h.eligibilityHandler, h.store, usersOnly)).Methods(http.MethodGet)
 	router.HandleFunc("/student/rating/{id}", auth.WithJWTAuth(h.GetRatingHandler, h.store, usersOnly)).Methods(http.MethodGet)
 	router.HandleFunc("/student/ratings", auth.WithJWTAuth(h.GetStudentRatingHandler, h.store, usersOnly)).Methods(http.MethodGet)
 	router.HandleFunc("/student/ratings", auth.WithJWTAuth(h.GetStudentRatingHandler, h.store, usersOnly)).Methods(http.MethodGet)
 	router.HandleFunc("/student/rating/delete/{id}", auth.WithJWTAuth(h.deleteRatingHandler, h.store, usersOnly)).Methods(http.MethodDelete)
+
+	// Any signed in user can report a review
+	allRoles := []types.UserRole{types.TEACHER, types.STUDENT, types.ADMIN}
+	adminOnly := []types.UserRole{types.ADMIN}
+
+	router.HandleFunc("/reviews/{id}/report", auth.WithJWTAuth(h.reportReviewHandler, h.store, allRoles)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/reviews/queue", auth.WithJWTAuth(h.moderationQueueHandler, h.store, adminOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/review/{id}/approve", auth.WithJWTAuth(h.moderateReviewHandler(types.ModerationApprove), h.store, adminOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/review/{id}/hide", auth.WithJWTAuth(h.moderateReviewHandler(types.ModerationHide), h.store, adminOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/review/{id}", auth.WithJWTAuth(h.moderateReviewHandler(types.ModerationDelete), h.store, adminOnly)).Methods(http.MethodDelete)
+
+	teacherOnly := []types.UserRole{types.TEACHER}
+
+	router.HandleFunc("/reviews/{id}/vote", auth.WithJWTAuth(h.voteReviewHandler, h.store, allRoles)).Methods(http.MethodPost)
+	router.HandleFunc("/teacher/review/{id}/response", auth.WithJWTAuth(h.createResponseHandler, h.store, teacherOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/teacher/review/{id}/response", auth.WithJWTAuth(h.updateResponseHandler, h.store, teacherOnly)).Methods(http.MethodPut)
+	router.HandleFunc("/teacher/review/{id}/response", auth.WithJWTAuth(h.deleteResponseHandler, h.store, teacherOnly)).Methods(http.MethodDelete)
 }
 
 
@@ -62,15 +90,15 @@ func (h *Handler) createRatingHandler(writer http.ResponseWriter, request *http.
         return
     }
 
-	enrolled, err := h.rating.IsStudentEnrolledInCourse(studentID, payload.CourseID)
+	progress, err := h.rating.GetCourseProgress(studentID, payload.CourseID)
     if err != nil {
         utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("error checking enrollment: %v", err))
         return
     }
-    if !enrolled {
-        utils.WriteError(writer, http.StatusForbidden, fmt.Errorf("you must be enrolled in the course to rate it"))
-        return
-    }
+	if eligible := eligibility(h.rules, progress, time.Now()); !eligible.Eligible {
+		utils.WriteError(writer, http.StatusForbidden, errors.New(eligible.Reason))
+		return
+	}
 	if err := utils.ValidateRating(payload.Rating); err != nil {
         utils.WriteError(writer, http.StatusBadRequest, err)
         return
@@ -82,16 +110,32 @@ func (h *Handler) createRatingHandler(writer http.ResponseWriter, request *http.
         CourseID: payload.CourseID,
         Rating: payload.Rating,
 		Review: payload.Review,
+		Status: types.RatingPublished,
+		ReviewerProgress: &progress.Percent,
     }
+	holdForModeration(rating)
 
-	_, err = h.rating.CreateRating(rating) 
+	created, err := h.rating.UpsertRating(rating)
     if err != nil {
-        utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to create rating: %v", err))
+        utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to save rating: %v", err))
         return
     }
+	h.reindexCourse(rating.CourseID)
 
 
-	response := map[string]string{"message": "rating created successfully"}
+	// Rating a course again replaces the earlier rating
+	action := "updated"
+	if created {
+		action = "created"
+	}
+	response := map[string]interface{}{
+		"message": fmt.Sprintf("rating %s successfully", action),
+		"id":      rating.ID,
+		"created": created,
+	}
+	if rating.Status == types.RatingPending {
+		response["message"] = fmt.Sprintf("rating %s, the review will be published once a moderator approves it", action)
+	}
 	utils.WriteJSON(writer, http.StatusOK, response)
 
 }
@@ -134,16 +178,31 @@ func (h *Handler) updateRatingHandler(writer http.ResponseWriter, request *http.
         return
     }
 
+	// Edits keep the review's moderation status and reason, so a hidden
+	// review stays hidden, unless the new text is held back by the filter
 	updateRating := &types.Rating{
 		Rating: payload.Rating,
 		Review: payload.Review,
+		Status: rating.Status,
+	}
+	if rating.Status != types.RatingHidden {
+		holdForModeration(updateRating)
+	}
+	// Progress is kept as of the latest edit; if the student has since been
+	// unenrolled the earlier figure stays
+	if progress, err := h.rating.GetCourseProgress(studentID, rating.CourseID); err == nil && progress.Enrolled {
+		updateRating.ReviewerProgress = &progress.Percent
 	}
 
 	if err := h.rating.UpdateRating(ratingID, updateRating); err != nil {
 		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to update rating: %v", err))
 		return
 	}
+	h.reindexCourse(rating.CourseID)
 	response := map[string]string{"message": "rating updated successfully"}
+	if updateRating.Status == types.RatingPending {
+		response["message"] = "rating updated, the review will be published once a moderator approves it"
+	}
 	utils.WriteJSON(writer, http.StatusOK, response)
 }
 
@@ -179,8 +238,18 @@ func (h *Handler) GetStudentRatingHandler(writer http.ResponseWriter, request *h
         return
     }
 
-    ratings, err := h.rating.GetRatingsByStudent(studentID)
+	params, err := pagination.FromRequest(request, "student_ratings", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+    ratings, err := h.rating.GetRatingsByStudent(studentID, params)
     if err!= nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
         utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to get student ratings: %v", err))
         return
     }
@@ -218,6 +287,284 @@ func (h *Handler) deleteRatingHandler(writer http.ResponseWriter, request *http.
         utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to delete rating: %v", err))
         return
     }
+	h.reindexCourse(rating.CourseID)
 	response := map[string]string{"message": "rating deleted successfully"}
 	utils.WriteJSON(writer, http.StatusNoContent, response)
-}
\ No newline at end of file
+}
+
+
+// reindexCourse refreshes a course in the search index after its rating
+// aggregates changed. The rating change itself is already saved, so a
+// failure is only logged.
+func (h *Handler) reindexCourse(courseID int) {
+	if err := h.indexer.IndexCourse(courseID); err != nil {
+		log.Printf("could not index course %d: %v", courseID, err)
+	}
+}
+
+
+// holdForModeration marks a rating pending when the filter flags its review.
+func holdForModeration(rating *types.Rating) {
+	if rating.Review == nil {
+		return
+	}
+	if reason := checkReview(*rating.Review); reason != "" {
+		reason = "filter: " + reason
+		rating.Status = types.RatingPending
+		rating.ModerationReason = &reason
+	}
+}
+
+
+func (h *Handler) reportReviewHandler(writer http.ResponseWriter, request *http.Request) {
+	ratingID, err := strconv.Atoi(mux.Vars(request)["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid rating ID: %s", mux.Vars(request)["id"]))
+		return
+	}
+
+	var payload types.ReportReviewPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	report := &types.ReviewReport{
+		RatingID:   ratingID,
+		ReporterID: auth.GetUserIDFromContext(request.Context()),
+		Reason:     payload.Reason,
+		Details:    payload.Details,
+	}
+	if err := h.rating.ReportReview(report); err != nil {
+		switch {
+		case errors.Is(err, ErrRatingNotFound):
+			utils.WriteError(writer, http.StatusNotFound, err)
+		case errors.Is(err, ErrOwnReview):
+			utils.WriteError(writer, http.StatusForbidden, err)
+		case errors.Is(err, ErrAlreadyReported):
+			utils.WriteError(writer, http.StatusConflict, err)
+		default:
+			utils.WriteError(writer, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	// Enough reports take the review down, out of the course's rating
+	if reported, err := h.rating.GetRating(ratingID); err == nil && reported.Status != types.RatingPublished {
+		h.reindexCourse(reported.CourseID)
+	}
+
+	utils.WriteJSON(writer, http.StatusCreated, map[string]string{"message": "review reported, thank you"})
+}
+
+
+func (h *Handler) moderationQueueHandler(writer http.ResponseWriter, request *http.Request) {
+	queue := types.ModerationQueue(request.URL.Query().Get("status"))
+	if queue != "" && queue != types.QueuePending && queue != types.QueueReported {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid status parameter, expected pending or reported"))
+		return
+	}
+
+	params, err := pagination.FromRequest(request, "review_queue:"+string(queue), pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	reviews, err := h.rating.GetModerationQueue(queue, params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, reviews)
+}
+
+
+// moderateReviewHandler applies action to a review. Hiding and deleting
+// need a reason, which is shown to the author.
+func (h *Handler) moderateReviewHandler(action types.ModerationAction) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		ratingID, err := strconv.Atoi(mux.Vars(request)["id"])
+		if err != nil {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid rating ID: %s", mux.Vars(request)["id"]))
+			return
+		}
+
+		var payload types.ModerateReviewPayload
+		if request.ContentLength != 0 {
+			if err := utils.ParseJSON(request, &payload); err != nil {
+				utils.WriteError(writer, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if err := utils.Validate.Struct(payload); err != nil {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		if action != types.ModerationApprove && payload.Reason == "" {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("a reason is required to %s a review", action))
+			return
+		}
+
+		// Read before a delete takes the rating away
+		rating, err := h.rating.GetRating(ratingID)
+		if err != nil {
+			if errors.Is(err, ErrRatingNotFound) {
+				utils.WriteError(writer, http.StatusNotFound, err)
+				return
+			}
+			utils.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		err = h.rating.ModerateReview(ratingID, action, payload.Reason, auth.GetUserIDFromContext(request.Context()))
+		if err != nil {
+			if errors.Is(err, ErrRatingNotFound) {
+				utils.WriteError(writer, http.StatusNotFound, err)
+				return
+			}
+			utils.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		h.reindexCourse(rating.CourseID)
+
+		messages := map[types.ModerationAction]string{
+			types.ModerationApprove: "review approved",
+			types.ModerationHide:    "review hidden",
+			types.ModerationDelete:  "review deleted",
+		}
+		utils.WriteJSON(writer, http.StatusOK, map[string]string{"message": messages[action]})
+	}
+}
+
+
+func (h *Handler) voteReviewHandler(writer http.ResponseWriter, request *http.Request) {
+	ratingID, err := strconv.Atoi(mux.Vars(request)["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid rating ID: %s", mux.Vars(request)["id"]))
+		return
+	}
+
+	var payload types.ReviewVotePayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	helpful, unhelpful, err := h.rating.VoteReview(ratingID, auth.GetUserIDFromContext(request.Context()), *payload.Helpful)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRatingNotFound):
+			utils.WriteError(writer, http.StatusNotFound, err)
+		case errors.Is(err, ErrOwnReview):
+			utils.WriteError(writer, http.StatusForbidden, err)
+		default:
+			utils.WriteError(writer, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, map[string]int{
+		"helpful_votes":   helpful,
+		"unhelpful_votes": unhelpful,
+	})
+}
+
+
+// writeResponseError maps the errors of the teacher response store calls.
+func writeResponseError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrRatingNotFound), errors.Is(err, ErrResponseNotFound):
+		utils.WriteError(writer, http.StatusNotFound, err)
+	case errors.Is(err, ErrNotCourseTeacher):
+		utils.WriteError(writer, http.StatusForbidden, err)
+	case errors.Is(err, ErrAlreadyResponded):
+		utils.WriteError(writer, http.StatusConflict, err)
+	default:
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+	}
+}
+
+
+func (h *Handler) createResponseHandler(writer http.ResponseWriter, request *http.Request) {
+	h.saveResponse(writer, request, h.rating.CreateResponse, http.StatusCreated)
+}
+
+
+func (h *Handler) updateResponseHandler(writer http.ResponseWriter, request *http.Request) {
+	h.saveResponse(writer, request, h.rating.UpdateResponse, http.StatusOK)
+}
+
+
+func (h *Handler) saveResponse(writer http.ResponseWriter, request *http.Request,
+	save func(ratingID int, teacherUserID int, body string) (*types.ReviewResponse, error), status int) {
+	ratingID, err := strconv.Atoi(mux.Vars(request)["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid rating ID: %s", mux.Vars(request)["id"]))
+		return
+	}
+
+	var payload types.ReviewResponsePayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	response, err := save(ratingID, auth.GetUserIDFromContext(request.Context()), payload.Body)
+	if err != nil {
+		writeResponseError(writer, err)
+		return
+	}
+
+	utils.WriteJSON(writer, status, response)
+}
+
+
+func (h *Handler) deleteResponseHandler(writer http.ResponseWriter, request *http.Request) {
+	ratingID, err := strconv.Atoi(mux.Vars(request)["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid rating ID: %s", mux.Vars(request)["id"]))
+		return
+	}
+
+	if err := h.rating.DeleteResponse(ratingID, auth.GetUserIDFromContext(request.Context())); err != nil {
+		writeResponseError(writer, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, map[string]string{"message": "response deleted successfully"})
+}
+
+
+// eligibilityHandler tells a student whether they may rate a course yet.
+func (h *Handler) eligibilityHandler(writer http.ResponseWriter, request *http.Request) {
+	courseID, err := strconv.Atoi(mux.Vars(request)["course_id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid course ID"))
+		return
+	}
+
+	progress, err := h.rating.GetCourseProgress(auth.GetUserIDFromContext(request.Context()), courseID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, eligibility(h.rules, progress, time.Now()))
+}
@@ -2,11 +2,22 @@ package rating
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
 
+	"github.com/lib/pq"
 	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils/pagination"
 )
 
+var ErrRatingNotFound = errors.New("rating not found")
+var ErrOwnReview = errors.New("you cannot report or vote on your own review")
+var ErrAlreadyReported = errors.New("you have already reported this review")
+
+// Open reports that take a published review down until an admin looks at it
+const reportThreshold = 3
+
 type Store struct {
 	db *sql.DB
 }
@@ -32,29 +43,147 @@ func (s *Store) IsStudentEnrolledInCourse(studentID int, courseID int) (bool, er
 }
 
 
-func (s *Store) CreateRating(rating *types.Rating) (int, error) {
-	var ratingID int
+// UpsertRating saves a student's rating of a course. A student has one
+// rating per course, so rating it again replaces the rating and review
+// they gave before. Replacing a review keeps its moderation status unless
+// the new text is held back by the filter, and a hidden review stays
+// hidden. Votes and the teacher's response were given to the old text, so
+// they are dropped when the text changes. rating.ID and rating.Status are
+// set to the saved values.
+func (s *Store) UpsertRating(rating *types.Rating) (bool, error) {
+	if rating.Status == "" {
+		rating.Status = types.RatingPublished
+	}
+	held := rating.Status == types.RatingPending
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the rating being replaced, if any, to compare its review text
+	var previous sql.NullString
+	err = tx.QueryRow(`SELECT review FROM ratings WHERE student_id = $1 AND course_id = $2 FOR UPDATE`,
+		rating.StudentID, rating.CourseID).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("could not get rating: %v", err)
+	}
+	replaced := err == nil
+
+	var created bool
 	query := `
-		INSERT INTO ratings (student_id, course_id, rating, review, created_at)
-		VALUES ($1, $2, $3, $4, NOW())
-		RETURNING id`
-	err := s.db.QueryRow(query, rating.StudentID, rating.CourseID, rating.Rating, rating.Review).Scan(&ratingID)
+		INSERT INTO ratings (student_id, course_id, rating, review, status, moderation_reason, reviewer_progress, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (student_id, course_id) DO UPDATE SET
+			rating = EXCLUDED.rating,
+			review = EXCLUDED.review,
+			reviewer_progress = EXCLUDED.reviewer_progress,
+			status = CASE
+				WHEN ratings.status = 'hidden' THEN ratings.status
+				WHEN EXCLUDED.status = 'pending' THEN EXCLUDED.status
+				ELSE ratings.status END,
+			moderation_reason = CASE
+				WHEN ratings.status <> 'hidden' AND EXCLUDED.status = 'pending' THEN EXCLUDED.moderation_reason
+				ELSE ratings.moderation_reason END,
+			updated_at = NOW()
+		RETURNING id, status, moderation_reason, xmax = 0`
+	err = tx.QueryRow(query, rating.StudentID, rating.CourseID, rating.Rating, rating.Review,
+		rating.Status, rating.ModerationReason, rating.ReviewerProgress).Scan(&rating.ID, &rating.Status, &rating.ModerationReason, &created)
 	if err != nil {
-		return 0, fmt.Errorf("could not create rating: %v", err)
+		return false, fmt.Errorf("could not save rating: %v", err)
+	}
+
+	if replaced && previous.String != reviewText(rating.Review) {
+		if err := resetReviewFeedback(tx, rating.ID); err != nil {
+			return false, err
+		}
 	}
-	return ratingID, nil
+
+	if held && rating.Status == types.RatingPending && rating.ModerationReason != nil {
+		if err := logModeration(tx, rating.ID, types.ModerationFilter, *rating.ModerationReason, 0); err != nil {
+			return false, err
+		}
+	}
+	if err := refreshRatingStats(tx, rating.CourseID); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return created, nil
 }
 
-// UpdateRating updates an existing rating and/or review by a student for a specific course.
+// UpdateRating updates an existing rating and/or review by a student for a
+// specific course, along with its moderation status. A ModerationReason is
+// only passed when the filter flagged the new text, and is logged; nil
+// keeps the current reason. Changing the review text drops its votes and
+// response, as in UpsertRating.
 func (s *Store) UpdateRating(ratingID int, updatedRating *types.Rating) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var courseID int
+	var reviewChanged bool
 	query := `
-		UPDATE ratings
-		SET rating = $1, review = $2
-		WHERE id = $3`
-	_, err := s.db.Exec(query, updatedRating.Rating, updatedRating.Review, ratingID)
+		UPDATE ratings AS r
+		SET rating = $1, review = $2, status = $3, moderation_reason = COALESCE($4, r.moderation_reason),
+		    reviewer_progress = COALESCE($5, r.reviewer_progress), updated_at = NOW()
+		FROM (SELECT id, review FROM ratings WHERE id = $6 FOR UPDATE) AS old
+		WHERE r.id = old.id
+		RETURNING r.course_id, COALESCE(old.review, '') <> COALESCE(r.review, '')`
+	err = tx.QueryRow(query, updatedRating.Rating, updatedRating.Review,
+		updatedRating.Status, updatedRating.ModerationReason, updatedRating.ReviewerProgress, ratingID).Scan(&courseID, &reviewChanged)
+	if err == sql.ErrNoRows {
+		return ErrRatingNotFound
+	}
 	if err != nil {
 		return fmt.Errorf("could not update rating: %v", err)
 	}
+
+	if reviewChanged {
+		if err := resetReviewFeedback(tx, ratingID); err != nil {
+			return err
+		}
+	}
+
+	if updatedRating.Status == types.RatingPending && updatedRating.ModerationReason != nil {
+		if err := logModeration(tx, ratingID, types.ModerationFilter, *updatedRating.ModerationReason, 0); err != nil {
+			return err
+		}
+	}
+	if err := refreshRatingStats(tx, courseID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+
+func reviewText(review *string) string {
+	if review == nil {
+		return ""
+	}
+	return *review
+}
+
+
+// resetReviewFeedback drops the votes on a review and the teacher's
+// response to it, after the student rewrote the review they answered.
+func resetReviewFeedback(db execer, ratingID int) error {
+	if _, err := db.Exec(`DELETE FROM review_votes WHERE rating_id = $1`, ratingID); err != nil {
+		return fmt.Errorf("could not delete review votes: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE ratings SET helpful_votes = 0, unhelpful_votes = 0 WHERE id = $1`, ratingID); err != nil {
+		return fmt.Errorf("could not reset review votes: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM review_responses WHERE rating_id = $1`, ratingID); err != nil {
+		return fmt.Errorf("could not delete review response: %v", err)
+	}
 	return nil
 }
 
@@ -62,16 +191,17 @@ func (s *Store) UpdateRating(ratingID int, updatedRating *types.Rating) error {
 func (s *Store) GetRating(ratingID int) (*types.Rating, error) {
 	var rating types.Rating
 	query := `
-		SELECT id, student_id, course_id, rating, review, created_at
+		SELECT id, student_id, course_id, rating, review, created_at, status, moderation_reason
 		FROM ratings
 		WHERE id = $1`
 	err := s.db.QueryRow(query, ratingID).Scan(
 		&rating.ID, &rating.StudentID, &rating.CourseID,
 		&rating.Rating, &rating.Review, &rating.CreatedAt,
+		&rating.Status, &rating.ModerationReason,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("rating not found")
+			return nil, ErrRatingNotFound
 		}
 		return nil, fmt.Errorf("could not get rating: %v", err)
 	}
@@ -80,81 +210,160 @@ func (s *Store) GetRating(ratingID int) (*types.Rating, error) {
 func (s *Store) GetRatingByStudentID(ratingID int, studentID int) (*types.Rating, error) {
 	var rating types.Rating
 	query := `
-		SELECT r.id, r.student_id, r.course_id, c.name, r.rating, r.review, r.created_at
+		SELECT r.id, r.student_id, r.course_id, c.name, r.rating, r.review, r.created_at, r.status, r.moderation_reason
 		FROM ratings AS r
 		JOIN courses AS c ON r.course_id = c.id
 		WHERE r.id = $1 AND r.student_id = $2`
 	err := s.db.QueryRow(query, ratingID, studentID).Scan(
 		&rating.ID, &rating.StudentID, &rating.CourseID, &rating.CourseName,
 		&rating.Rating, &rating.Review, &rating.CreatedAt,
+		&rating.Status, &rating.ModerationReason,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("rating not found")
+			return nil, ErrRatingNotFound
 		}
 		return nil, fmt.Errorf("could not get rating: %v", err)
 	}
 	return &rating, nil
 }
 
-// GetRatingsForCourse retrieves all ratings and reviews for a given course.
-func (s *Store) GetRatingsForCourse(slug string, page int, limit int) ([]types.Rating, int, error) {
+// ratingKeyset lists the newest ratings first.
+var ratingKeyset = pagination.Keyset{Columns: []string{"r.created_at", "r.id"}, Desc: true}
+
+func ratingKey(rating types.Rating) []interface{} {
+	return []interface{}{rating.CreatedAt, rating.ID}
+}
+
+
+// courseRatingKeysets are the orderings of a course's ratings. Ties fall
+// back to the newest rating; lowest negates the rating so every column
+// still sorts the same way.
+var courseRatingKeysets = map[types.RatingSort]pagination.Keyset{
+	types.RatingSortNewest:  ratingKeyset,
+	types.RatingSortHelpful: {Columns: []string{"r.helpful_votes", "r.created_at", "r.id"}, Desc: true},
+	types.RatingSortHighest: {Columns: []string{"r.rating", "r.created_at", "r.id"}, Desc: true},
+	types.RatingSortLowest:  {Columns: []string{"-r.rating", "r.created_at", "r.id"}, Desc: true},
+}
+
+var courseRatingKeys = map[types.RatingSort]func(types.Rating) []interface{}{
+	types.RatingSortNewest: ratingKey,
+	types.RatingSortHelpful: func(rating types.Rating) []interface{} {
+		return []interface{}{rating.HelpfulVotes, rating.CreatedAt, rating.ID}
+	},
+	types.RatingSortHighest: func(rating types.Rating) []interface{} {
+		return []interface{}{ratingValue(rating.Rating), rating.CreatedAt, rating.ID}
+	},
+	types.RatingSortLowest: func(rating types.Rating) []interface{} {
+		return []interface{}{-ratingValue(rating.Rating), rating.CreatedAt, rating.ID}
+	},
+}
+
+// ratingValue undoes the float32 rounding of a NUMERIC(2,1) rating, so a
+// cursor compares equal to the stored value.
+func ratingValue(rating float32) float64 {
+	return math.Round(float64(rating)*10) / 10
+}
+
+
+// GetRatingsForCourse retrieves a page of the published ratings and reviews
+// for a given course in sort order, with their teacher responses and the
+// total number of them.
+func (s *Store) GetRatingsForCourse(slug string, sort types.RatingSort, params pagination.Params) (pagination.Page[types.Rating], error) {
+	var page pagination.Page[types.Rating]
 	var ratings []types.Rating
 
-	// Calculate offset for pagination
-	offset := (page - 1) * limit
+	keyset, ok := courseRatingKeysets[sort]
+	if !ok {
+		return page, fmt.Errorf("unknown rating sort %q", sort)
+	}
+	cursor, args, err := keyset.Where(params, []interface{}{slug})
+	if err != nil {
+		return page, err
+	}
+	order, args := keyset.OrderBy(params, args)
 
 	query := `
-		SELECT r.id, r.student_id, u.first_name, u.last_name, r.course_id, c.name, r.rating, r.review, r.created_at
+		SELECT r.id, r.student_id, u.first_name, u.last_name, r.course_id, c.name, r.rating, r.review, r.created_at,
+		       r.helpful_votes, r.unhelpful_votes, r.reviewer_progress,
+		       rr.teacher_id, tu.first_name || ' ' || tu.last_name, rr.body, rr.created_at, rr.updated_at
 		FROM ratings AS r
 		JOIN courses AS c ON r.course_id = c.id
 		JOIN users AS u ON r.student_id = u.id
-		WHERE c.slug = $1
-		LIMIT $2 OFFSET $3`
-	rows, err := s.db.Query(query, slug, limit, offset)
+		LEFT JOIN review_responses AS rr ON rr.rating_id = r.id
+		LEFT JOIN teachers AS t ON rr.teacher_id = t.id
+		LEFT JOIN users AS tu ON t.user_id = tu.id
+		WHERE c.slug = $1 AND r.status = 'published'` + cursor + order
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("could not get ratings for course: %v", err)
+		return page, fmt.Errorf("could not get ratings for course: %v", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var rating types.Rating
+		var teacherID sql.NullInt64
+		var teacherName, body sql.NullString
+		var respondedAt, updatedAt sql.NullTime
 		if err := rows.Scan(
 			&rating.ID, &rating.StudentID, &rating.StudentFirstName, &rating.StudentLastName, &rating.CourseID,
 			&rating.CourseName, &rating.Rating, &rating.Review, &rating.CreatedAt,
+			&rating.HelpfulVotes, &rating.UnhelpfulVotes, &rating.ReviewerProgress,
+			&teacherID, &teacherName, &body, &respondedAt, &updatedAt,
 		); err != nil {
-			return nil, 0, fmt.Errorf("could not scan rating: %v", err)
+			return page, fmt.Errorf("could not scan rating: %v", err)
+		}
+		if teacherID.Valid {
+			rating.Response = &types.ReviewResponse{
+				RatingID:    rating.ID,
+				TeacherID:   int(teacherID.Int64),
+				TeacherName: teacherName.String,
+				Body:        body.String,
+				CreatedAt:   respondedAt.Time,
+				UpdatedAt:   updatedAt.Time,
+			}
 		}
 		ratings = append(ratings, rating)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("row iteration error: %v", err)
+		return page, fmt.Errorf("row iteration error: %v", err)
 	}
 
 	// Get total count of ratings for the course
 	var totalRatings int
-	countQuery := `SELECT COUNT(*) FROM ratings AS r JOIN courses AS c ON r.course_id = c.id WHERE c.slug = $1`
+	countQuery := `SELECT COUNT(*) FROM ratings AS r JOIN courses AS c ON r.course_id = c.id WHERE c.slug = $1 AND r.status = 'published'`
 	err = s.db.QueryRow(countQuery, slug).Scan(&totalRatings)
 	if err != nil {
-		return nil, 0, fmt.Errorf("could not count ratings: %v", err)
+		return page, fmt.Errorf("could not count ratings: %v", err)
 	}
 
-	return ratings, totalRatings, nil
+	return pagination.NewPage(ratings, params, courseRatingKeys[sort]).WithTotal(totalRatings), nil
 }
 
 
-// GetRatingsByStudent retrieves all ratings submitted by a specific student.
-func (s *Store) GetRatingsByStudent(studentID int) ([]types.Rating, error) {
+// GetRatingsByStudent retrieves a page of the ratings submitted by a
+// specific student, newest first. Students see their held back and hidden
+// reviews too, with their moderation status.
+func (s *Store) GetRatingsByStudent(studentID int, params pagination.Params) (pagination.Page[types.Rating], error) {
+	var page pagination.Page[types.Rating]
 	var ratings []types.Rating
+
+	cursor, args, err := ratingKeyset.Where(params, []interface{}{studentID})
+	if err != nil {
+		return page, err
+	}
+	order, args := ratingKeyset.OrderBy(params, args)
+
 	query := `
-		SELECT r.id, r.student_id, u.first_name, u.last_name, r.course_id, c.name, r.rating, r.review, r.created_at
+		SELECT r.id, r.student_id, u.first_name, u.last_name, r.course_id, c.name, r.rating, r.review, r.created_at,
+		       r.status, r.moderation_reason, r.helpful_votes, r.unhelpful_votes
 		FROM ratings AS r
 		JOIN courses AS c ON r.course_id = c.id
 		JOIN users AS u on r.student_id = u.id
-		WHERE r.student_id = $1`
-	rows, err := s.db.Query(query, studentID)
+		WHERE r.student_id = $1` + cursor + order
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("could not get ratings by student: %v", err)
+		return page, fmt.Errorf("could not get ratings by student: %v", err)
 	}
 	defer rows.Close()
 
@@ -163,55 +372,129 @@ func (s *Store) GetRatingsByStudent(studentID int) ([]types.Rating, error) {
 		if err := rows.Scan(
 			&rating.ID, &rating.StudentID, &rating.StudentFirstName, &rating.StudentLastName, &rating.CourseID,
 			&rating.CourseName, &rating.Rating, &rating.Review, &rating.CreatedAt,
+			&rating.Status, &rating.ModerationReason, &rating.HelpfulVotes, &rating.UnhelpfulVotes,
 		); err != nil {
-			return nil, fmt.Errorf("could not scan rating: %v", err)
+			return page, fmt.Errorf("could not scan rating: %v", err)
 		}
 		ratings = append(ratings, rating)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %v", err)
+		return page, fmt.Errorf("row iteration error: %v", err)
 	}
-	return ratings, nil
+	return pagination.NewPage(ratings, params, ratingKey), nil
 }
 
 
 // DeleteRating removes a rating by its ID.
 func (s *Store) DeleteRating(ratingID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var courseID int
 	query := `
 		DELETE FROM ratings
-		WHERE id = $1`
-	_, err := s.db.Exec(query, ratingID)
+		WHERE id = $1
+		RETURNING course_id`
+	err = tx.QueryRow(query, ratingID).Scan(&courseID)
+	if err == sql.ErrNoRows {
+		return ErrRatingNotFound
+	}
 	if err != nil {
 		return fmt.Errorf("could not delete rating: %v", err)
 	}
+	if err := refreshRatingStats(tx, courseID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+
+// refreshRatingStatsQuery recomputes the rating aggregates kept on a course
+// from its published ratings.
+const refreshRatingStatsQuery = `
+	UPDATE courses c SET (rating_average, rating_count, review_count, rating_histogram) = (
+		SELECT COALESCE(AVG(r.rating), 0)::float8,
+		       COUNT(*),
+		       COUNT(CASE WHEN r.review IS NOT NULL AND r.review <> '' THEN 1 END),
+		       ARRAY[COUNT(*) FILTER (WHERE r.rating < 1.5),
+		             COUNT(*) FILTER (WHERE r.rating >= 1.5 AND r.rating < 2.5),
+		             COUNT(*) FILTER (WHERE r.rating >= 2.5 AND r.rating < 3.5),
+		             COUNT(*) FILTER (WHERE r.rating >= 3.5 AND r.rating < 4.5),
+		             COUNT(*) FILTER (WHERE r.rating >= 4.5)]::int[]
+		FROM ratings r
+		WHERE r.course_id = c.id AND r.status = 'published')
+	WHERE c.id = $1`
+
+// refreshRatingStats runs in the transaction that changed a rating of the
+// course, so the aggregates never disagree with the ratings. Updating the
+// course row also serializes concurrent rating changes of one course.
+func refreshRatingStats(db execer, courseID int) error {
+	if _, err := db.Exec(refreshRatingStatsQuery, courseID); err != nil {
+		return fmt.Errorf("could not refresh rating stats: %v", err)
+	}
 	return nil
 }
 
-// GetAverageRating calculates the average rating for a specific course.
+
+// GetAverageRating returns the average published rating of a course.
 func (s *Store) GetAverageRating(courseID int) (float32, error) {
 	var avgRating float32
-	query := `
-		SELECT COALESCE(AVG(rating), 0)
-		FROM ratings
-		WHERE course_id = $1`
+	query := `SELECT rating_average FROM courses WHERE id = $1`
 	err := s.db.QueryRow(query, courseID).Scan(&avgRating)
-	if err != nil {
-		return 0, fmt.Errorf("could not calculate average rating: %v", err)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("could not get average rating: %v", err)
 	}
 	return avgRating, nil
 }
 
-// CountRatingsAndReviews returns the total count of ratings and reviews for a course.
+// CountRatingsAndReviews returns the total count of published ratings and reviews for a course.
 func (s *Store) CountRatingsAndReviews(courseID int) (int, int, error) {
 	var ratingCount, reviewCount int
-	query := `
-		SELECT COUNT(rating) AS rating_count,
-		       COUNT(CASE WHEN review IS NOT NULL AND review <> '' THEN 1 END) AS review_count
-		FROM ratings
-		WHERE course_id = $1`
+	query := `SELECT rating_count, review_count FROM courses WHERE id = $1`
 	err := s.db.QueryRow(query, courseID).Scan(&ratingCount, &reviewCount)
-	if err != nil {
+	if err != nil && err != sql.ErrNoRows {
 		return 0, 0, fmt.Errorf("could not count ratings and reviews: %v", err)
 	}
 	return ratingCount, reviewCount, nil
-}
\ No newline at end of file
+}
+
+
+// GetRatingSummary sums up the published ratings of a course: their
+// average, a Bayesian average that pulls courses with few ratings towards
+// the site wide average, and how many ratings gave each number of stars.
+func (s *Store) GetRatingSummary(slug string) (*types.RatingSummary, error) {
+	var summary types.RatingSummary
+	var prior float64
+	var counts []int64
+	query := `
+		SELECT rating_average, rating_count, review_count, rating_histogram,
+		       (SELECT COALESCE(SUM(rating_average * rating_count) / NULLIF(SUM(rating_count), 0), 0) FROM courses)
+		FROM courses
+		WHERE slug = $1`
+	err := s.db.QueryRow(query, slug).Scan(
+		&summary.Average, &summary.RatingCount, &summary.ReviewCount, pq.Array(&counts), &prior,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("could not summarize ratings: %v", err)
+	}
+
+	sum := summary.Average * float64(summary.RatingCount)
+	summary.BayesianAverage = (types.RatingPriorWeight*prior + sum) / float64(types.RatingPriorWeight+summary.RatingCount)
+
+	summary.Histogram = make([]types.RatingBucket, 5)
+	for i := range summary.Histogram {
+		bucket := types.RatingBucket{Stars: i + 1}
+		if i < len(counts) {
+			bucket.Count = int(counts[i])
+		}
+		if summary.RatingCount > 0 {
+			bucket.Percent = math.Round(float64(bucket.Count)*1000/float64(summary.RatingCount)) / 10
+		}
+		summary.Histogram[i] = bucket
+	}
+	return &summary, nil
+}
@@ -0,0 +1,328 @@
+package recommendation
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/sikozonpc/ecom/types"
+)
+
+// Course is a published course that may be recommended. Popularity counts
+// its enrollments, with those within popularityWindow counting twice.
+type Course struct {
+	ID         int
+	CategoryID int
+	CreatedAt  time.Time
+	Popularity float64
+}
+
+// Taken is everything one student did with one course: enrolled in it,
+// bought it in a completed order and rated it.
+type Taken struct {
+	StudentID int
+	CourseID  int
+	Enrolled  bool
+	Bought    bool
+	Rated     bool
+	Rating    float64
+}
+
+// Options tune a recompute. Jitter shuffles courses with close scores so
+// students see some variety between runs; it is left at 0 in deterministic
+// mode, which also takes Now from the data instead of the clock, so the
+// same signals always give the same recommendations.
+type Options struct {
+	Now        time.Time
+	PerStudent int
+	PerCourse  int
+	Popular    int
+	Jitter     float64
+	Seed       int64
+}
+
+// DefaultOptions are the options the API and the recompute command run with.
+func DefaultOptions(deterministic bool) Options {
+	opts := Options{PerStudent: 20, PerCourse: 10, Popular: 50}
+	if !deterministic {
+		opts.Now = time.Now()
+		opts.Jitter = 0.05
+		opts.Seed = time.Now().UnixNano()
+	}
+	return opts
+}
+
+const (
+	// A course bought together with another says more than a free
+	// enrollment, and every purchase is an enrollment as well
+	enrollmentWeight = 1.0
+	purchaseWeight   = 2.0
+
+	// How much the share of a student's courses in a category counts
+	// against the co-enrollment score
+	categoryWeight = 0.5
+
+	// Popularity only breaks ties between otherwise equal candidates
+	popularityWeight = 0.1
+
+	// Enrollments within the window count twice towards popularity
+	popularityWindow = 90 * 24 * time.Hour
+)
+
+
+// model derives the recommendations in two passes over the students, so
+// only one student's history is in memory at a time: learn is called with
+// every student's history to build the course similarities, then finish,
+// then forStudent with every history again in the same order.
+type model struct {
+	opts          Options
+	courses       []Course
+	published     map[int]Course
+	maxPopularity float64
+	random        *rand.Rand
+
+	// norms and similarity hold the squared column norms and dot products
+	// of the student by course matrix until finish turns them into cosines
+	norms      map[int]float64
+	similarity map[int]map[int]float64
+}
+
+
+func newModel(courses []Course, opts Options) *model {
+	m := &model{
+		opts:       opts,
+		courses:    courses,
+		published:  make(map[int]Course, len(courses)),
+		norms:      make(map[int]float64),
+		similarity: make(map[int]map[int]float64),
+	}
+	for _, course := range courses {
+		m.published[course.ID] = course
+		m.maxPopularity = math.Max(m.maxPopularity, course.Popularity)
+	}
+	if opts.Jitter > 0 {
+		m.random = rand.New(rand.NewSource(opts.Seed))
+	}
+	return m
+}
+
+
+// learn adds one student's courses to the course similarities: the cosine
+// between the courses' columns of the student by course matrix, where an
+// enrollment counts enrollmentWeight and a purchase adds purchaseWeight.
+// Ratings play no part here; they only weigh a student's own history.
+func (m *model) learn(history []Taken) {
+	weights := make(map[int]float64, len(history))
+	for _, t := range history {
+		weight := 0.0
+		if t.Enrolled {
+			weight += enrollmentWeight
+		}
+		if t.Bought {
+			weight += purchaseWeight
+		}
+		if weight > 0 {
+			weights[t.CourseID] = weight
+		}
+	}
+
+	for a, wa := range weights {
+		m.norms[a] += wa * wa
+		for b, wb := range weights {
+			if a == b {
+				continue
+			}
+			if m.similarity[a] == nil {
+				m.similarity[a] = make(map[int]float64)
+			}
+			m.similarity[a][b] += wa * wb
+		}
+	}
+}
+
+
+func (m *model) finish() {
+	for a, row := range m.similarity {
+		for b := range row {
+			row[b] /= math.Sqrt(m.norms[a] * m.norms[b])
+		}
+	}
+	m.norms = nil
+}
+
+
+// forStudent ranks the courses a student has not taken yet.
+func (m *model) forStudent(studentID int, history []Taken) []types.Recommendation {
+	weights := studentWeights(history)
+
+	// Sums run in ID order so that equal inputs give bit-identical scores
+	seeds := sortedKeys(weights)
+
+	// Share of the student's liked courses in each category
+	categories := make(map[int]float64)
+	liked := 0.0
+	for _, courseID := range seeds {
+		if course, ok := m.published[courseID]; ok && weights[courseID] > 0 {
+			categories[course.CategoryID] += weights[courseID]
+			liked += weights[courseID]
+		}
+	}
+
+	collaborative := make(map[int]float64)
+	for _, seedID := range seeds {
+		for _, candidateID := range sortedKeys(m.similarity[seedID]) {
+			collaborative[candidateID] += weights[seedID] * m.similarity[seedID][candidateID]
+		}
+	}
+
+	var candidates []candidate
+	for _, course := range m.courses {
+		courseID := course.ID
+		if _, taken := weights[courseID]; taken {
+			continue
+		}
+		cf := collaborative[courseID]
+		category := 0.0
+		if liked > 0 {
+			category = categoryWeight * categories[course.CategoryID] / liked
+		}
+		if cf <= 0 && category <= 0 {
+			continue
+		}
+
+		score := math.Max(cf, 0) + category
+		if m.maxPopularity > 0 {
+			score += popularityWeight * course.Popularity / m.maxPopularity
+		}
+		if m.random != nil {
+			score *= 1 + m.opts.Jitter*(2*m.random.Float64()-1)
+		}
+
+		reason := types.ReasonSimilarStudents
+		if category > cf {
+			reason = types.ReasonCategory
+		}
+		candidates = append(candidates, candidate{courseID: courseID, score: score, reason: reason})
+	}
+
+	return rank(types.RecommendForStudent, studentID, candidates, m.opts.PerStudent)
+}
+
+
+type candidate struct {
+	courseID int
+	score    float64
+	reason   types.RecommendationReason
+}
+
+// rank keeps the limit best candidates, highest score first and lowest ID
+// on ties, and numbers them.
+func rank(kind types.RecommendationKind, subjectID int, candidates []candidate, limit int) []types.Recommendation {
+	sort.Slice(candidates, func(a, b int) bool {
+		if candidates[a].score != candidates[b].score {
+			return candidates[a].score > candidates[b].score
+		}
+		return candidates[a].courseID < candidates[b].courseID
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	recs := make([]types.Recommendation, len(candidates))
+	for i, c := range candidates {
+		recs[i] = types.Recommendation{
+			Kind:      kind,
+			SubjectID: subjectID,
+			CourseID:  c.courseID,
+			Score:     c.score,
+			Position:  i + 1,
+			Reason:    c.reason,
+		}
+	}
+	return recs
+}
+
+
+// studentWeights weighs the courses a student took. Every course a student
+// enrolled in or bought counts once, scaled by their rating when they left
+// one: 5 stars counts 1.5, 3 stars 0.5 and anything below 2 turns negative,
+// steering away from similar courses.
+func studentWeights(history []Taken) map[int]float64 {
+	weights := make(map[int]float64, len(history))
+	for _, t := range history {
+		weights[t.CourseID] = 1
+		if t.Rated {
+			weights[t.CourseID] = (t.Rating - 2) / 2
+		}
+	}
+	return weights
+}
+
+
+// alsoBought lists, for every published course, the published courses most
+// often taken together with it.
+func (m *model) alsoBought() []types.Recommendation {
+	courses := make([]int, 0, len(m.similarity))
+	for courseID := range m.similarity {
+		if _, ok := m.published[courseID]; ok {
+			courses = append(courses, courseID)
+		}
+	}
+	sort.Ints(courses)
+
+	var recs []types.Recommendation
+	for _, courseID := range courses {
+		var candidates []candidate
+		for otherID, sim := range m.similarity[courseID] {
+			if _, ok := m.published[otherID]; ok {
+				candidates = append(candidates, candidate{courseID: otherID, score: sim, reason: types.ReasonAlsoBought})
+			}
+		}
+		recs = append(recs, rank(types.RecommendAlsoBought, courseID, candidates, m.opts.PerCourse)...)
+	}
+	return recs
+}
+
+
+// popular is the fallback for students without history: the most popular
+// courses, newest first among equals so a fresh catalog still gets a list.
+func (m *model) popular() []types.Recommendation {
+	sorted := make([]Course, len(m.courses))
+	copy(sorted, m.courses)
+	sort.Slice(sorted, func(a, b int) bool {
+		pa, pb := sorted[a].Popularity, sorted[b].Popularity
+		if pa != pb {
+			return pa > pb
+		}
+		if !sorted[a].CreatedAt.Equal(sorted[b].CreatedAt) {
+			return sorted[a].CreatedAt.After(sorted[b].CreatedAt)
+		}
+		return sorted[a].ID < sorted[b].ID
+	})
+	if len(sorted) > m.opts.Popular {
+		sorted = sorted[:m.opts.Popular]
+	}
+
+	recs := make([]types.Recommendation, len(sorted))
+	for i, course := range sorted {
+		recs[i] = types.Recommendation{
+			Kind:     types.RecommendPopular,
+			CourseID: course.ID,
+			Score:    course.Popularity,
+			Position: i + 1,
+			Reason:   types.ReasonPopular,
+		}
+	}
+	return recs
+}
+
+
+func sortedKeys(m map[int]float64) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,154 @@
+package recommendation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sikozonpc/ecom/types"
+)
+
+func day(n int) time.Time { return time.Date(2024, 1, n, 0, 0, 0, 0, time.UTC) }
+
+// testCatalog has two programming courses (1, 2), two design courses (3, 4)
+// and a cooking course (5).
+func testCatalog() []Course {
+	return []Course{
+		{ID: 1, CategoryID: 10, CreatedAt: day(1), Popularity: 8},
+		{ID: 2, CategoryID: 10, CreatedAt: day(2), Popularity: 5},
+		{ID: 3, CategoryID: 20, CreatedAt: day(3), Popularity: 5},
+		{ID: 4, CategoryID: 20, CreatedAt: day(4), Popularity: 2},
+		{ID: 5, CategoryID: 30, CreatedAt: day(5), Popularity: 0},
+	}
+}
+
+func enrolled(studentID int, courseIDs ...int) []Taken {
+	history := make([]Taken, len(courseIDs))
+	for i, courseID := range courseIDs {
+		history[i] = Taken{StudentID: studentID, CourseID: courseID, Enrolled: true}
+	}
+	return history
+}
+
+// recommendations runs the model the way Recompute does: a learning pass
+// over every history, then a ranking pass over the same histories in the
+// same order.
+func recommendations(courses []Course, histories [][]Taken, opts Options) ([][]types.Recommendation, []types.Recommendation, []types.Recommendation) {
+	m := newModel(courses, opts)
+	for _, history := range histories {
+		m.learn(history)
+	}
+	m.finish()
+
+	perStudent := make([][]types.Recommendation, len(histories))
+	for i, history := range histories {
+		perStudent[i] = m.forStudent(history[0].StudentID, history)
+	}
+	return perStudent, m.alsoBought(), m.popular()
+}
+
+
+func courseIDs(recs []types.Recommendation) []int {
+	ids := []int{}
+	for _, rec := range recs {
+		ids = append(ids, rec.CourseID)
+	}
+	return ids
+}
+
+
+func TestDeterministicRunsMatch(t *testing.T) {
+	histories := [][]Taken{
+		enrolled(1, 1, 2, 3),
+		enrolled(2, 1, 2),
+		enrolled(3, 2, 3, 4),
+		enrolled(4, 1),
+	}
+
+	firstStudents, firstAlso, firstPopular := recommendations(testCatalog(), histories, DefaultOptions(true))
+	secondStudents, secondAlso, secondPopular := recommendations(testCatalog(), histories, DefaultOptions(true))
+
+	if !reflect.DeepEqual(firstStudents, secondStudents) {
+		t.Errorf("student picks differ between runs:\n%v\n%v", firstStudents, secondStudents)
+	}
+	if !reflect.DeepEqual(firstAlso, secondAlso) {
+		t.Errorf("also bought differs between runs:\n%v\n%v", firstAlso, secondAlso)
+	}
+	if !reflect.DeepEqual(firstPopular, secondPopular) {
+		t.Errorf("popular differs between runs:\n%v\n%v", firstPopular, secondPopular)
+	}
+	if len(firstStudents[3]) == 0 {
+		t.Error("a student with history got no picks")
+	}
+}
+
+
+func TestNoHistoryFallsBackToPopular(t *testing.T) {
+	m := newModel(testCatalog(), DefaultOptions(true))
+	m.learn(enrolled(1, 1, 2))
+	m.finish()
+
+	if picks := m.forStudent(2, nil); len(picks) != 0 {
+		t.Errorf("a student without history got personal picks %v", courseIDs(picks))
+	}
+
+	// Courses 2 and 3 are equally popular; the newer one comes first
+	popular := m.popular()
+	if got, want := courseIDs(popular), []int{1, 3, 2, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("popular = %v, want %v", got, want)
+	}
+	for i, rec := range popular {
+		if rec.Kind != types.RecommendPopular || rec.Position != i+1 {
+			t.Errorf("popular[%d] = %+v", i, rec)
+		}
+	}
+}
+
+
+func TestLowRatingsWeighNegative(t *testing.T) {
+	weights := studentWeights([]Taken{
+		{CourseID: 1, Enrolled: true, Rated: true, Rating: 1},
+		{CourseID: 2, Enrolled: true, Rated: true, Rating: 5},
+		{CourseID: 3, Enrolled: true},
+	})
+	if want := map[int]float64{1: -0.5, 2: 1.5, 3: 1}; !reflect.DeepEqual(weights, want) {
+		t.Errorf("weights = %v, want %v", weights, want)
+	}
+
+	// Courses 1 and 5 are always taken together and share no category
+	histories := [][]Taken{
+		enrolled(1, 1, 5),
+		enrolled(2, 1, 5),
+		{{StudentID: 3, CourseID: 1, Enrolled: true, Rated: true, Rating: 5}},
+		{{StudentID: 4, CourseID: 1, Enrolled: true, Rated: true, Rating: 1}},
+	}
+	picks, _, _ := recommendations(testCatalog(), histories, DefaultOptions(true))
+
+	// Course 5 through the students who took both, course 2 through the category
+	if got := courseIDs(picks[2]); !reflect.DeepEqual(got, []int{5, 2}) {
+		t.Errorf("picks after a good rating = %v, want [5 2]", got)
+	}
+	if got := courseIDs(picks[3]); len(got) != 0 {
+		t.Errorf("picks after a bad rating = %v, want none", got)
+	}
+}
+
+
+func TestRankBreaksTiesByLowestID(t *testing.T) {
+	candidates := []candidate{
+		{courseID: 9, score: 1},
+		{courseID: 4, score: 2},
+		{courseID: 7, score: 1},
+		{courseID: 2, score: 1},
+	}
+	recs := rank(types.RecommendForStudent, 1, candidates, 3)
+
+	if got, want := courseIDs(recs), []int{4, 2, 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ranked = %v, want %v", got, want)
+	}
+	for i, rec := range recs {
+		if rec.Position != i+1 || rec.SubjectID != 1 {
+			t.Errorf("recs[%d] = %+v", i, rec)
+		}
+	}
+}
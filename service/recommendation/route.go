@@ -0,0 +1,54 @@
+package recommendation
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sikozonpc/ecom/service/auth"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+)
+
+type Handler struct {
+	recommendation types.RecommendationStore
+	store          types.UserStore
+}
+
+
+func NewHandler(recommendation types.RecommendationStore, store types.UserStore) *Handler {
+	return &Handler{
+		recommendation: recommendation,
+		store:          store,
+	}
+}
+
+
+func (h *Handler) RecommendationRoutes(router *mux.Router) {
+	// Anonymous visitors get popular courses
+	router.HandleFunc("/recommendations", h.recommendationsHandle).Methods(http.MethodGet)
+}
+
+
+func (h *Handler) recommendationsHandle(writer http.ResponseWriter, request *http.Request) {
+	limit := 10
+	if value := request.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 50 {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid limit parameter, expected 1 to 50"))
+			return
+		}
+	}
+
+	studentID, _ := auth.GetStudentIDFromToken(request)
+
+	courses, err := h.recommendation.GetRecommendations(studentID, limit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, courses)
+}
@@ -0,0 +1,311 @@
+package recommendation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sikozonpc/ecom/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+
+// ErrRecomputeRunning is returned when another API process or the CLI is
+// already recomputing.
+var ErrRecomputeRunning = errors.New("recommendations are already being recomputed")
+
+// recomputeLock is the advisory lock key held while recomputing.
+const recomputeLock = 43001
+
+
+// loadCourses reads the published courses with their popularity as of now,
+// or as of the latest enrollment when now is zero.
+func loadCourses(tx *sql.Tx, now time.Time) ([]Course, error) {
+	var asOf sql.NullTime
+	if !now.IsZero() {
+		asOf = sql.NullTime{Time: now, Valid: true}
+	}
+
+	rows, err := tx.Query(`
+		WITH as_of AS (SELECT COALESCE($1, (SELECT MAX(enrolled_at) FROM enrollments)) AS now)
+		SELECT c.id, c.category_id, c.created_at,
+		       COUNT(e.course_id) + COUNT(e.course_id) FILTER (WHERE e.enrolled_at > as_of.now - $2::FLOAT * INTERVAL '1 second')
+		FROM courses c
+		CROSS JOIN as_of
+		LEFT JOIN enrollments e ON e.course_id = c.id AND e.student_id IS NOT NULL
+		WHERE c.status = 'published'
+		GROUP BY c.id, as_of.now
+		ORDER BY c.id`, asOf, popularityWindow.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("could not load courses: %v", err)
+	}
+	defer rows.Close()
+
+	var courses []Course
+	for rows.Next() {
+		var course Course
+		if err := rows.Scan(&course.ID, &course.CategoryID, &course.CreatedAt, &course.Popularity); err != nil {
+			return nil, err
+		}
+		courses = append(courses, course)
+	}
+	return courses, rows.Err()
+}
+
+
+// eachStudent streams what every student did, one row per student and
+// course, and calls visit with each student's rows in student ID order.
+func eachStudent(tx *sql.Tx, visit func(studentID int, history []Taken) error) error {
+	rows, err := tx.Query(`
+		SELECT student_id, course_id, BOOL_OR(enrolled), BOOL_OR(bought), MAX(rating)
+		FROM (
+			SELECT student_id, course_id, TRUE AS enrolled, FALSE AS bought, NULL::FLOAT AS rating
+			FROM enrollments WHERE student_id IS NOT NULL AND course_id IS NOT NULL
+			UNION ALL
+			SELECT o.user_id, oi.course_id, FALSE, TRUE, NULL
+			FROM order_items oi JOIN orders o ON oi.order_id = o.id
+			WHERE o.status = 'completed' AND o.user_id IS NOT NULL AND oi.course_id IS NOT NULL
+			UNION ALL
+			SELECT student_id, course_id, FALSE, FALSE, rating
+			FROM ratings WHERE status = 'published' AND student_id IS NOT NULL AND course_id IS NOT NULL
+		) taken
+		GROUP BY student_id, course_id
+		ORDER BY student_id, course_id`)
+	if err != nil {
+		return fmt.Errorf("could not load student histories: %v", err)
+	}
+	defer rows.Close()
+
+	var history []Taken
+	for rows.Next() {
+		var t Taken
+		var rating sql.NullFloat64
+		if err := rows.Scan(&t.StudentID, &t.CourseID, &t.Enrolled, &t.Bought, &rating); err != nil {
+			return err
+		}
+		t.Rated, t.Rating = rating.Valid, rating.Float64
+
+		if len(history) > 0 && history[0].StudentID != t.StudentID {
+			if err := visit(history[0].StudentID, history); err != nil {
+				return err
+			}
+			history = history[:0]
+		}
+		history = append(history, t)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(history) > 0 {
+		return visit(history[0].StudentID, history)
+	}
+	return nil
+}
+
+
+// Recompute rebuilds every recommendation and returns how many it stored.
+// It reads the signals twice from one snapshot, first to learn the course
+// similarities and then to rank each student's picks, and streams the
+// results into the table, so no more than one student's history is held in
+// memory. The old set is replaced in one transaction, so readers see either
+// it or the new one. Only one recompute runs at a time; the others return
+// ErrRecomputeRunning.
+func (s *Store) Recompute(opts Options) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1)`, recomputeLock).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("could not lock recommendations: %v", err)
+	}
+	if !locked {
+		return 0, ErrRecomputeRunning
+	}
+
+	// The signals are read from their own snapshot while tx writes
+	read, err := s.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer read.Rollback()
+
+	courses, err := loadCourses(read, opts.Now)
+	if err != nil {
+		return 0, err
+	}
+	m := newModel(courses, opts)
+	err = eachStudent(read, func(studentID int, history []Taken) error {
+		m.learn(history)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	m.finish()
+
+	if _, err := tx.Exec(`DELETE FROM recommendations`); err != nil {
+		return 0, fmt.Errorf("could not clear recommendations: %v", err)
+	}
+	stmt, err := tx.Prepare(pq.CopyIn("recommendations", "kind", "subject_id", "course_id", "score", "position", "reason"))
+	if err != nil {
+		return 0, fmt.Errorf("could not prepare recommendations: %v", err)
+	}
+	defer stmt.Close()
+
+	count := 0
+	save := func(recs []types.Recommendation) error {
+		for _, rec := range recs {
+			if _, err := stmt.Exec(rec.Kind, rec.SubjectID, rec.CourseID, rec.Score, rec.Position, rec.Reason); err != nil {
+				return fmt.Errorf("could not save recommendation: %v", err)
+			}
+		}
+		count += len(recs)
+		return nil
+	}
+
+	if err := save(m.popular()); err != nil {
+		return 0, err
+	}
+	if err := save(m.alsoBought()); err != nil {
+		return 0, err
+	}
+	err = eachStudent(read, func(studentID int, history []Taken) error {
+		return save(m.forStudent(studentID, history))
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		return 0, fmt.Errorf("could not save recommendations: %v", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+
+// RecomputeEvery recomputes once straight away, so a fresh database has
+// popular courses to fall back on, and then on a fixed interval until ctx is
+// cancelled. Failures are logged and retried on the next tick. Every API
+// process runs it; whichever holds the lock recomputes and the rest skip.
+func RecomputeEvery(ctx context.Context, store *Store, interval time.Duration, deterministic bool) {
+	recompute := func() {
+		_, err := store.Recompute(DefaultOptions(deterministic))
+		if err != nil && !errors.Is(err, ErrRecomputeRunning) {
+			log.Printf("could not recompute recommendations: %v", err)
+		}
+	}
+	recompute()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			recompute()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+
+const recommendedColumns = `c.id, c.name, c.slug, COALESCE(c.image, ''), c.price, u.first_name || ' ' || u.last_name,
+	c.rating_average,
+	(SELECT COUNT(*) FROM enrollments e WHERE e.course_id = c.id),
+	r.score, r.reason, r.computed_at`
+
+const recommendedJoins = `FROM recommendations r
+	JOIN courses c ON r.course_id = c.id
+	JOIN teachers t ON c.teacher_id = t.id
+	JOIN users u ON t.user_id = u.id`
+
+func (s *Store) queryRecommended(query string, args ...interface{}) ([]types.RecommendedCourse, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch recommendations: %v", err)
+	}
+	defer rows.Close()
+
+	courses := []types.RecommendedCourse{}
+	for rows.Next() {
+		var course types.RecommendedCourse
+		err := rows.Scan(
+			&course.ID,
+			&course.Name,
+			&course.Slug,
+			&course.Image,
+			&course.Price,
+			&course.Instructor,
+			&course.Rating,
+			&course.EnrollmentCount,
+			&course.Score,
+			&course.Reason,
+			&course.ComputedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		courses = append(courses, course)
+	}
+	return courses, rows.Err()
+}
+
+
+// GetRecommendations returns a student's picks, topped up with popular
+// courses when they have too few, as new students do. A studentID of 0
+// gets popular courses only. Courses the student has enrolled in since the
+// last recompute, or that were unpublished, are left out.
+func (s *Store) GetRecommendations(studentID int, limit int) ([]types.RecommendedCourse, error) {
+	courses, err := s.queryRecommended(`SELECT `+recommendedColumns+` `+recommendedJoins+`
+		WHERE r.kind = $1 AND r.subject_id = $2 AND c.status = 'published'
+		AND NOT EXISTS (SELECT 1 FROM enrollments en WHERE en.course_id = c.id AND en.student_id = $2)
+		ORDER BY r.position
+		LIMIT $3`, types.RecommendForStudent, studentID, limit)
+	if err != nil || len(courses) >= limit {
+		return courses, err
+	}
+
+	picked := make([]int, len(courses))
+	for i, course := range courses {
+		picked[i] = course.ID
+	}
+
+	popular, err := s.queryRecommended(`SELECT `+recommendedColumns+` `+recommendedJoins+`
+		WHERE r.kind = $1 AND r.subject_id = 0 AND c.status = 'published'
+		AND NOT EXISTS (SELECT 1 FROM enrollments en WHERE en.course_id = c.id AND en.student_id = $2)
+		AND NOT c.id = ANY($3)
+		ORDER BY r.position
+		LIMIT $4`, types.RecommendPopular, studentID, pq.Array(picked), limit-len(courses))
+	if err != nil {
+		return nil, err
+	}
+	return append(courses, popular...), nil
+}
+
+
+// GetAlsoBought returns the courses most often taken together with a
+// course, for the "students also bought" block.
+func (s *Store) GetAlsoBought(courseID int, limit int) ([]types.RecommendedCourse, error) {
+	return s.queryRecommended(`SELECT `+recommendedColumns+` `+recommendedJoins+`
+		WHERE r.kind = $1 AND r.subject_id = $2 AND c.status = 'published'
+		ORDER BY r.position
+		LIMIT $3`, types.RecommendAlsoBought, courseID, limit)
+}
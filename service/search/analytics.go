@@ -0,0 +1,201 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sikozonpc/ecom/types"
+)
+
+var (
+	ErrSearchNotFound = errors.New("search not found")
+	ErrCourseNotFound = errors.New("course not found")
+)
+
+// normalizeQuery is the form queries are grouped by in the reports.
+func normalizeQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+
+// LogSearch stores a search and sets its ID.
+func (s *Store) LogSearch(entry *types.SearchLogEntry) error {
+	filters, err := json.Marshal(entry.Filters)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.QueryRow(`INSERT INTO search_queries
+		(token, query, normalized_query, filters, sort, page, result_count, latency_ms, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, 0))
+		RETURNING id, created_at`,
+		entry.Token, entry.Query, normalizeQuery(entry.Query), filters, entry.Sort, entry.Page,
+		entry.ResultCount, entry.LatencyMS, entry.UserID,
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("could not log search: %v", err)
+	}
+	return nil
+}
+
+
+// LogSearchClick records that a result of a search was opened. Opening the
+// same course twice from one search counts once.
+func (s *Store) LogSearchClick(click *types.SearchClick) error {
+	var searchID int
+	err := s.db.QueryRow(`SELECT id FROM search_queries WHERE token = $1`, click.SearchToken).Scan(&searchID)
+	if err == sql.ErrNoRows {
+		return ErrSearchNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO search_clicks (search_id, course_id, position, user_id)
+		VALUES ($1, $2, $3, NULLIF($4, 0))
+		ON CONFLICT (search_id, course_id) DO NOTHING`,
+		searchID, click.CourseID, click.Position, click.UserID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrCourseNotFound
+		}
+		return fmt.Errorf("could not log search click: %v", err)
+	}
+	return nil
+}
+
+
+// SearchLog writes search log entries in the background, so logging adds no
+// database round trip to a search. Entries are dropped, and logged as such,
+// when the queue is full.
+type SearchLog struct {
+	store   types.SearchAnalyticsStore
+	entries chan *types.SearchLogEntry
+}
+
+
+func NewSearchLog(store types.SearchAnalyticsStore, size int) *SearchLog {
+	return &SearchLog{store: store, entries: make(chan *types.SearchLogEntry, size)}
+}
+
+
+// Add queues an entry without blocking and reports whether it was queued.
+func (l *SearchLog) Add(entry *types.SearchLogEntry) bool {
+	select {
+	case l.entries <- entry:
+		return true
+	default:
+		log.Printf("search log queue is full; dropping the search for %q", entry.Query)
+		return false
+	}
+}
+
+
+// Run writes queued entries until ctx is cancelled.
+func (l *SearchLog) Run(ctx context.Context) {
+	for {
+		select {
+		case entry := <-l.entries:
+			if err := l.store.LogSearch(entry); err != nil {
+				log.Println(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+
+// GetTopQueries returns the most searched terms between from and to, with
+// how often each led to a click. Searches without a term are left out.
+func (s *Store) GetTopQueries(from, to time.Time, limit int) ([]types.QueryStats, error) {
+	rows, err := s.db.Query(`
+		SELECT q.normalized_query, COUNT(*), AVG(q.result_count),
+		       COALESCE(SUM(c.clicks), 0), COUNT(c.search_id)::FLOAT / COUNT(*)
+		FROM search_queries q
+		LEFT JOIN (SELECT search_id, COUNT(*) AS clicks FROM search_clicks GROUP BY search_id) c
+		       ON c.search_id = q.id
+		WHERE q.normalized_query <> '' AND q.created_at >= $1 AND q.created_at < $2
+		GROUP BY q.normalized_query
+		ORDER BY 2 DESC, 1
+		LIMIT $3`, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not report top queries: %v", err)
+	}
+	defer rows.Close()
+
+	stats := []types.QueryStats{}
+	for rows.Next() {
+		var stat types.QueryStats
+		if err := rows.Scan(&stat.Query, &stat.Searches, &stat.AvgResults, &stat.Clicks, &stat.ClickThroughRate); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+
+// GetZeroResultQueries returns the terms that found nothing between from and
+// to, most frequent first: the content students look for and do not find.
+func (s *Store) GetZeroResultQueries(from, to time.Time, limit int) ([]types.ZeroResultQuery, error) {
+	rows, err := s.db.Query(`
+		SELECT normalized_query, COUNT(*), MAX(created_at)
+		FROM search_queries
+		WHERE result_count = 0 AND normalized_query <> '' AND created_at >= $1 AND created_at < $2
+		GROUP BY normalized_query
+		ORDER BY 2 DESC, 3 DESC
+		LIMIT $3`, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not report zero result queries: %v", err)
+	}
+	defer rows.Close()
+
+	queries := []types.ZeroResultQuery{}
+	for rows.Next() {
+		var query types.ZeroResultQuery
+		if err := rows.Scan(&query.Query, &query.Searches, &query.LastSearchedAt); err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	return queries, rows.Err()
+}
+
+
+func (s *Store) GetClickThrough(from, to time.Time) (*types.ClickThroughReport, error) {
+	report := &types.ClickThroughReport{From: from, To: to}
+
+	var zeroResults int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE result_count = 0), COALESCE(AVG(latency_ms), 0)
+		FROM search_queries
+		WHERE created_at >= $1 AND created_at < $2`, from, to,
+	).Scan(&report.Searches, &zeroResults, &report.AvgLatencyMS)
+	if err != nil {
+		return nil, fmt.Errorf("could not report searches: %v", err)
+	}
+
+	err = s.db.QueryRow(`
+		SELECT COUNT(DISTINCT c.search_id), COUNT(*), COALESCE(AVG(c.position), 0)
+		FROM search_clicks c
+		JOIN search_queries q ON c.search_id = q.id
+		WHERE q.created_at >= $1 AND q.created_at < $2`, from, to,
+	).Scan(&report.SearchesWithClicks, &report.Clicks, &report.AvgClickPosition)
+	if err != nil {
+		return nil, fmt.Errorf("could not report search clicks: %v", err)
+	}
+
+	if report.Searches > 0 {
+		report.ClickThroughRate = float64(report.SearchesWithClicks) / float64(report.Searches)
+		report.ZeroResultRate = float64(zeroResults) / float64(report.Searches)
+	}
+	return report, nil
+}
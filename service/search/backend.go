@@ -0,0 +1,101 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sikozonpc/ecom/types"
+)
+
+// NewBackend returns the search backend named by kind: "postgres" (the
+// default) searches the full-text column on courses, "embedded" keeps an
+// in-process index saved at indexPath.
+func NewBackend(kind string, db *sql.DB, indexPath string) (types.SearchBackend, error) {
+	switch kind {
+	case "", "postgres":
+		return NewStore(db), nil
+	case "embedded":
+		return NewIndex(db, indexPath)
+	default:
+		return nil, fmt.Errorf("unknown search backend: %s", kind)
+	}
+}
+
+
+// RebuildEvery rebuilds the backend right away, so an index loaded from a
+// snapshot catches up with changes made while the API was down, then on a
+// fixed interval until ctx is cancelled. Failures are logged and retried on
+// the next tick.
+func RebuildEvery(ctx context.Context, backend types.SearchBackend, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	if _, err := backend.Rebuild(); err != nil {
+		log.Println(err)
+	}
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := backend.Rebuild(); err != nil {
+				log.Println(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+
+// RequestRebuild asks every running API to rebuild its search backend; see
+// FollowRebuildRequests.
+func RequestRebuild(db *sql.DB) error {
+	if _, err := db.Exec(`INSERT INTO search_rebuild_requests DEFAULT VALUES`); err != nil {
+		return fmt.Errorf("could not request a search rebuild: %v", err)
+	}
+	return nil
+}
+
+
+// FollowRebuildRequests rebuilds the backend whenever a new rebuild request
+// shows up, checking every interval until ctx is cancelled. An embedded
+// index lives in each API process, so a rebuild run from the CLI only
+// reaches them this way.
+func FollowRebuildRequests(ctx context.Context, db *sql.DB, backend types.SearchBackend, interval time.Duration) {
+	latest := func() (int, error) {
+		var id int
+		err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM search_rebuild_requests`).Scan(&id)
+		return id, err
+	}
+
+	seen, err := latest()
+	if err != nil {
+		log.Println(err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			id, err := latest()
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if id == seen {
+				continue
+			}
+			if _, err := backend.Rebuild(); err != nil {
+				log.Println(err)
+				continue
+			}
+			seen = id
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,1043 @@
+package search
+
+import (
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+// Index is the embedded search backend: an in-process inverted index over
+// the published catalog. It loads its documents from Postgres, answers
+// queries from memory and saves a snapshot to disk so restarts and the
+// rebuild CLI do not need to reindex every time.
+//
+// It is written for this catalog rather than built on a general engine such
+// as Bleve: the whole catalog fits in memory, and results have to match the
+// Postgres backend's ranking, filters, facets and keyset pagination, which
+// map directly onto a small purpose-built index but not onto a generic
+// query language. index_test.go pins that behaviour.
+//
+// The course builder reindexes a course whenever it saves one, and category
+// and teacher renames reindex the courses they show up in. Enrollment counts
+// are only as fresh as the last Rebuild.
+type Index struct {
+	db    *sql.DB
+	store *Store
+	path  string
+
+	mu       sync.RWMutex
+	courses  map[int]*indexedCourse
+	postings map[string]map[int]float64
+	terms    map[int]map[string]float64
+	words    map[int]map[string]bool
+	lexicon  map[string]int
+
+	// Every load from the database and every removal takes the next seq.
+	// applied holds the seq behind each course's current entry, so a load
+	// that started before a newer one finished cannot overwrite it.
+	seq     int64
+	applied map[int]int64
+
+	// Snapshots are written by flush, off the index lock. saveTimer batches
+	// the writes following single course updates.
+	saveMu    sync.Mutex
+	saveTimer *time.Timer
+}
+
+// indexVersion is bumped whenever indexedCourse changes shape; older
+// snapshots are then rebuilt instead of loaded.
+const indexVersion = 2
+
+type indexSnapshot struct {
+	Version int
+	Courses []indexedCourse
+}
+
+// indexedCourse is the document stored for one published course.
+type indexedCourse struct {
+	ID            int
+	TeacherID     int
+	CategoryID    int
+	Name          string
+	Slug          string
+	Description   string
+	IntroVideo    sql.NullString
+	Image         sql.NullString
+	Price         float64
+	Language      string
+	Level         types.CourseLevel
+	TotalDuration int
+	SectionCount  int
+	LectureCount  int
+	LastUpdated   time.Time
+	CreatedAt     time.Time
+	ModifiedAt    time.Time
+	Instructor    string
+	CategoryName  string
+	CategorySlug  string
+	// CategoryPath holds the course's category and all of its ancestors
+	CategoryPath []int
+	Tags         []types.CourseTag
+	Rating       float64
+	Enrollments  int
+}
+
+// Field weights follow ts_rank's defaults for the A, B and C labels used by
+// the Postgres backend.
+const (
+	weightName        = 1.0
+	weightRelated     = 0.4
+	weightDescription = 0.2
+)
+
+
+// NewIndex opens the embedded index. The snapshot at path is loaded when it
+// exists and matches the current format; otherwise the index is rebuilt
+// from the database. An empty path keeps the index in memory only.
+func NewIndex(db *sql.DB, path string) (*Index, error) {
+	index := &Index{db: db, store: NewStore(db), path: path}
+	index.reset(nil)
+
+	if path != "" {
+		courses, err := readSnapshot(path)
+		if err == nil {
+			index.reset(courses)
+			return index, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			// The snapshot is only a cache of the database
+			log.Printf("%v; rebuilding the search index", err)
+		}
+	}
+
+	if _, err := index.Rebuild(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+
+func readSnapshot(path string) ([]indexedCourse, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var snapshot indexSnapshot
+	if err := gob.NewDecoder(file).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("could not read search index %s: %v", path, err)
+	}
+	if snapshot.Version != indexVersion {
+		return nil, fmt.Errorf("search index %s has version %d: %w", path, snapshot.Version, os.ErrNotExist)
+	}
+	return snapshot.Courses, nil
+}
+
+
+// saveDelay is how long single course updates are batched before the
+// snapshot is written.
+const saveDelay = 5 * time.Second
+
+
+// scheduleSave writes the snapshot once saveDelay has passed. The caller
+// holds the lock.
+func (i *Index) scheduleSave() {
+	if i.path == "" || i.saveTimer != nil {
+		return
+	}
+	i.saveTimer = time.AfterFunc(saveDelay, func() {
+		if err := i.flush(); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+
+// flush copies the index under the lock and writes it to disk after
+// releasing it, so searches are not held up by the write.
+func (i *Index) flush() error {
+	if i.path == "" {
+		return nil
+	}
+
+	i.saveMu.Lock()
+	defer i.saveMu.Unlock()
+
+	i.mu.Lock()
+	if i.saveTimer != nil {
+		i.saveTimer.Stop()
+		i.saveTimer = nil
+	}
+	snapshot := indexSnapshot{Version: indexVersion, Courses: make([]indexedCourse, 0, len(i.courses))}
+	for _, course := range i.courses {
+		snapshot.Courses = append(snapshot.Courses, *course)
+	}
+	i.mu.Unlock()
+
+	return writeSnapshot(i.path, snapshot)
+}
+
+
+// writeSnapshot writes the snapshot next to the index file and renames it
+// into place so readers never see a partial file.
+func writeSnapshot(path string, snapshot indexSnapshot) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not save search index: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not save search index: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+
+// reset replaces the whole index. The caller holds the lock.
+func (i *Index) reset(courses []indexedCourse) {
+	i.courses = make(map[int]*indexedCourse, len(courses))
+	i.postings = make(map[string]map[int]float64)
+	i.terms = make(map[int]map[string]float64, len(courses))
+	i.words = make(map[int]map[string]bool, len(courses))
+	i.lexicon = make(map[string]int)
+	i.applied = make(map[int]int64, len(courses))
+
+	for n := range courses {
+		i.add(&courses[n])
+	}
+}
+
+
+func (i *Index) add(course *indexedCourse) {
+	weights := make(map[string]float64)
+	addField := func(text string, weight float64) {
+		for _, term := range terms(text) {
+			weights[term] += weight
+		}
+	}
+	addField(course.Name, weightName)
+	addField(course.CategoryName, weightRelated)
+	addField(course.Instructor, weightRelated)
+	for _, tag := range course.Tags {
+		addField(tag.Name, weightRelated)
+	}
+	addField(course.Description, weightDescription)
+
+	for term, weight := range weights {
+		if i.postings[term] == nil {
+			i.postings[term] = make(map[int]float64)
+		}
+		i.postings[term][course.ID] = weight
+	}
+
+	// The lexicon keeps whole words, as typed, for corrections
+	seen := make(map[string]bool)
+	texts := []string{course.Name, course.Description, course.CategoryName, course.Instructor}
+	for _, tag := range course.Tags {
+		texts = append(texts, tag.Name)
+	}
+	for _, text := range texts {
+		for _, word := range words(text) {
+			if len([]rune(word)) >= 3 && strings.Trim(word, "0123456789") != "" && !seen[word] {
+				seen[word] = true
+				i.lexicon[word]++
+			}
+		}
+	}
+
+	i.courses[course.ID] = course
+	i.terms[course.ID] = weights
+	i.words[course.ID] = seen
+}
+
+
+func (i *Index) remove(courseID int) {
+	for term := range i.terms[courseID] {
+		delete(i.postings[term], courseID)
+		if len(i.postings[term]) == 0 {
+			delete(i.postings, term)
+		}
+	}
+	for word := range i.words[courseID] {
+		i.lexicon[word]--
+		if i.lexicon[word] <= 0 {
+			delete(i.lexicon, word)
+		}
+	}
+	delete(i.courses, courseID)
+	delete(i.terms, courseID)
+	delete(i.words, courseID)
+}
+
+
+// INDEXING
+
+// begin numbers a load that is about to start.
+func (i *Index) begin() int64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.seq++
+	return i.seq
+}
+
+
+// apply brings the courses in scope in line with a load numbered seq: loaded
+// courses are (re)indexed and the rest of scope, no longer published, is
+// dropped. Courses changed by a later load or removal are left alone. The
+// caller holds the lock.
+func (i *Index) apply(seq int64, scope []int, loaded []indexedCourse) {
+	found := make(map[int]bool, len(loaded))
+	for n := range loaded {
+		course := &loaded[n]
+		found[course.ID] = true
+		if i.applied[course.ID] > seq {
+			continue
+		}
+		i.remove(course.ID)
+		i.add(course)
+		i.applied[course.ID] = seq
+	}
+
+	for _, id := range scope {
+		if found[id] || i.applied[id] > seq {
+			continue
+		}
+		i.remove(id)
+		i.applied[id] = seq
+	}
+}
+
+
+// Rebuild reloads every published course from the database and replaces the
+// index with them, then saves the snapshot.
+func (i *Index) Rebuild() (int, error) {
+	seq := i.begin()
+	courses, err := i.load(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	i.mu.Lock()
+	scope := make([]int, 0, len(i.courses))
+	for id := range i.courses {
+		scope = append(scope, id)
+	}
+	i.apply(seq, scope, courses)
+	count := len(i.courses)
+	i.mu.Unlock()
+
+	return count, i.flush()
+}
+
+
+func (i *Index) IndexCourse(courseID int) error {
+	return i.reindex([]int{courseID})
+}
+
+
+// IndexCategory reindexes the courses filed under the category or any of its
+// subcategories, after it was renamed, moved or merged away.
+func (i *Index) IndexCategory(categoryID int) error {
+	return i.reindex(i.scope(func(course *indexedCourse) bool {
+		return inCategories(course, []int{categoryID})
+	}))
+}
+
+
+// IndexTeacher reindexes the courses of a teacher whose name changed.
+func (i *Index) IndexTeacher(teacherID int) error {
+	return i.reindex(i.scope(func(course *indexedCourse) bool {
+		return course.TeacherID == teacherID
+	}))
+}
+
+
+// scope lists the indexed courses matching keep.
+func (i *Index) scope(keep func(*indexedCourse) bool) []int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var ids []int
+	for id, course := range i.courses {
+		if keep(course) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+
+func (i *Index) reindex(courseIDs []int) error {
+	if len(courseIDs) == 0 {
+		return nil
+	}
+
+	seq := i.begin()
+	courses, err := i.load(courseIDs)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.apply(seq, courseIDs, courses)
+	i.scheduleSave()
+	return nil
+}
+
+
+func (i *Index) RemoveCourse(courseID int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.seq++
+	i.applied[courseID] = i.seq
+	if _, ok := i.courses[courseID]; !ok {
+		return nil
+	}
+	i.remove(courseID)
+	i.scheduleSave()
+	return nil
+}
+
+
+// load reads the published courses among courseIDs from the database, or
+// every published course when courseIDs is nil.
+func (i *Index) load(courseIDs []int) ([]indexedCourse, error) {
+	query := `
+		SELECT c.id, c.teacher_id, c.category_id, c.name, c.slug, c.description, c.intro_video, c.image, c.price,
+		       c.language, c.level, c.total_duration, c.section_count, c.lecture_count, GREATEST(c.modified_at, c.content_updated_at),
+		       c.created_at, c.modified_at, u.first_name, u.last_name, COALESCE(cat.name, ''), COALESCE(cat.slug, ''),
+		       ` + ratingColumn + `, ` + enrollmentColumn + `
+		FROM courses c
+		JOIN teachers t ON c.teacher_id = t.id
+		JOIN users u ON t.user_id = u.id
+		LEFT JOIN categories cat ON c.category_id = cat.id
+		WHERE c.status = 'published' AND ($1 OR c.id = ANY($2))`
+
+	rows, err := i.db.Query(query, courseIDs == nil, pq.Array(courseIDs))
+	if err != nil {
+		return nil, fmt.Errorf("could not load courses: %v", err)
+	}
+	defer rows.Close()
+
+	var courses []indexedCourse
+	var ids []int
+	for rows.Next() {
+		var course indexedCourse
+		var firstName, lastName string
+		err := rows.Scan(
+			&course.ID,
+			&course.TeacherID,
+			&course.CategoryID,
+			&course.Name,
+			&course.Slug,
+			&course.Description,
+			&course.IntroVideo,
+			&course.Image,
+			&course.Price,
+			&course.Language,
+			&course.Level,
+			&course.TotalDuration,
+			&course.SectionCount,
+			&course.LectureCount,
+			&course.LastUpdated,
+			&course.CreatedAt,
+			&course.ModifiedAt,
+			&firstName,
+			&lastName,
+			&course.CategoryName,
+			&course.CategorySlug,
+			&course.Rating,
+			&course.Enrollments,
+		)
+		if err != nil {
+			return nil, err
+		}
+		course.Instructor = fmt.Sprintf("%s %s", firstName, lastName)
+		courses = append(courses, course)
+		ids = append(ids, course.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(courses) == 0 {
+		return nil, nil
+	}
+
+	parents, err := i.categoryParents()
+	if err != nil {
+		return nil, err
+	}
+	tags, err := i.courseTags(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for n := range courses {
+		course := &courses[n]
+		for id, depth := course.CategoryID, 0; id != 0 && depth < 64; id, depth = parents[id], depth+1 {
+			course.CategoryPath = append(course.CategoryPath, id)
+		}
+		course.Tags = tags[course.ID]
+	}
+	return courses, nil
+}
+
+
+func (i *Index) categoryParents() (map[int]int, error) {
+	rows, err := i.db.Query(`SELECT id, COALESCE(parent_id, 0) FROM categories`)
+	if err != nil {
+		return nil, fmt.Errorf("could not load categories: %v", err)
+	}
+	defer rows.Close()
+
+	parents := make(map[int]int)
+	for rows.Next() {
+		var id, parentID int
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, err
+		}
+		parents[id] = parentID
+	}
+	return parents, rows.Err()
+}
+
+
+func (i *Index) courseTags(courseIDs []int) (map[int][]types.CourseTag, error) {
+	rows, err := i.db.Query(`SELECT ct.course_id, t.id, t.name, t.slug, ct.kind
+		FROM course_tags ct JOIN tags t ON ct.tag_id = t.id
+		WHERE ct.course_id = ANY($1)`, pq.Array(courseIDs))
+	if err != nil {
+		return nil, fmt.Errorf("could not load course tags: %v", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[int][]types.CourseTag)
+	for rows.Next() {
+		var courseID int
+		var tag types.CourseTag
+		if err := rows.Scan(&courseID, &tag.ID, &tag.Name, &tag.Slug, &tag.Kind); err != nil {
+			return nil, err
+		}
+		tags[courseID] = append(tags[courseID], tag)
+	}
+	return tags, rows.Err()
+}
+
+
+// QUERYING
+
+// Categories stay in Postgres, so name lookups go straight to it.
+func (i *Index) GetCategoryIDsByName(name string) ([]int, error) {
+	return i.store.GetCategoryIDsByName(name)
+}
+
+
+type scoredCourse struct {
+	course *indexedCourse
+	score  float64
+}
+
+
+// match returns the courses passing every filter of params with their
+// relevance. The caller holds the read lock.
+func (i *Index) match(params types.CourseSearchParams) ([]scoredCourse, error) {
+	createdAfter, createdBefore, err := parseDateRange(params.CreatedAfter, params.CreatedBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	query := parseQuery(params.Term)
+	if params.Term != "" && len(query.include) == 0 {
+		// Only stop words or exclusions: nothing to match, as in Postgres
+		return nil, nil
+	}
+
+	total := float64(len(i.courses))
+	scores := make(map[int]float64)
+	if len(query.include) > 0 {
+		for n, term := range query.include {
+			postings := i.postings[term]
+			idf := math.Log(1 + total/float64(len(postings)+1))
+			next := make(map[int]float64)
+			for id, weight := range postings {
+				if n == 0 {
+					next[id] = weight * idf
+				} else if score, ok := scores[id]; ok {
+					next[id] = score + weight*idf
+				}
+			}
+			scores = next
+		}
+	} else {
+		for id := range i.courses {
+			scores[id] = 0
+		}
+	}
+
+	tags := make(map[string]bool, len(params.Tags))
+	for _, tag := range params.Tags {
+		tags[tag] = true
+	}
+
+	var matched []scoredCourse
+	for id, score := range scores {
+		course := i.courses[id]
+		if excluded(i.terms[id], query.exclude) ||
+			(params.TeacherID != 0 && course.TeacherID != params.TeacherID) ||
+			(len(params.Categories) > 0 && !inCategories(course, params.Categories)) ||
+			(len(tags) > 0 && !hasTags(course, tags)) ||
+			(params.PriceMin > 0 && params.PriceMax > 0 && (course.Price < params.PriceMin || course.Price > params.PriceMax)) ||
+			(!createdAfter.IsZero() && (course.CreatedAt.Before(createdAfter) || course.CreatedAt.After(createdBefore))) ||
+			(params.MinRating > 0 && course.Rating < params.MinRating) ||
+			(params.DurationMin > 0 && course.TotalDuration < params.DurationMin) ||
+			(params.DurationMax > 0 && course.TotalDuration > params.DurationMax) ||
+			(len(params.Languages) > 0 && !containsString(params.Languages, course.Language)) ||
+			(len(params.Levels) > 0 && !containsLevel(params.Levels, course.Level)) {
+			continue
+		}
+		matched = append(matched, scoredCourse{course, score})
+	}
+	return matched, nil
+}
+
+
+func excluded(courseTerms map[string]float64, exclude []string) bool {
+	for _, term := range exclude {
+		if _, ok := courseTerms[term]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+
+func containsLevel(levels []types.CourseLevel, level types.CourseLevel) bool {
+	for _, l := range levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+
+func inCategories(course *indexedCourse, categories []int) bool {
+	for _, id := range course.CategoryPath {
+		for _, wanted := range categories {
+			if id == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+
+// hasTags reports whether the course carries every wanted tag, given as
+// lowercase names or slugs.
+func hasTags(course *indexedCourse, wanted map[string]bool) bool {
+	for term := range wanted {
+		found := false
+		for _, tag := range course.Tags {
+			if tag.Slug == term || strings.ToLower(tag.Name) == term {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+
+// parseDateRange parses the created_after/created_before pair. Like the
+// Postgres backend, the range only applies when both ends are given.
+func parseDateRange(after, before string) (time.Time, time.Time, error) {
+	if after == "" || before == "" {
+		return time.Time{}, time.Time{}, nil
+	}
+	from, err := parseDate(after)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parseDate(before)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return from, to, nil
+}
+
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %s", value)
+}
+
+
+// indexKeys returns the sort key of a match for each sort option, in the
+// order sortCourses compares them. Times are in microseconds.
+var indexKeys = map[types.SearchSort]func(scoredCourse) []interface{}{
+	types.SortRelevance: func(m scoredCourse) []interface{} { return []interface{}{m.score, m.course.ID} },
+	types.SortNewest: func(m scoredCourse) []interface{} {
+		return []interface{}{m.course.CreatedAt.UnixMicro(), m.course.ID}
+	},
+	types.SortPriceAsc:     func(m scoredCourse) []interface{} { return []interface{}{m.course.Price, m.course.ID} },
+	types.SortPriceDesc:    func(m scoredCourse) []interface{} { return []interface{}{m.course.Price, m.course.ID} },
+	types.SortHighestRated: func(m scoredCourse) []interface{} { return []interface{}{m.course.Rating, m.course.Enrollments, m.course.ID} },
+	types.SortMostEnrolled: func(m scoredCourse) []interface{} { return []interface{}{m.course.Enrollments, m.course.Rating, m.course.ID} },
+}
+
+
+// sortCourses orders matches like searchKeysets does in SQL.
+func sortCourses(matched []scoredCourse, by types.SearchSort) {
+	less := map[types.SearchSort]func(a, b scoredCourse) bool{
+		types.SortRelevance: func(a, b scoredCourse) bool {
+			if a.score != b.score {
+				return a.score > b.score
+			}
+			return a.course.ID > b.course.ID
+		},
+		types.SortPriceAsc: func(a, b scoredCourse) bool {
+			if a.course.Price != b.course.Price {
+				return a.course.Price < b.course.Price
+			}
+			return a.course.ID < b.course.ID
+		},
+		types.SortPriceDesc: func(a, b scoredCourse) bool {
+			if a.course.Price != b.course.Price {
+				return a.course.Price > b.course.Price
+			}
+			return a.course.ID > b.course.ID
+		},
+		types.SortHighestRated: func(a, b scoredCourse) bool {
+			if a.course.Rating != b.course.Rating {
+				return a.course.Rating > b.course.Rating
+			}
+			if a.course.Enrollments != b.course.Enrollments {
+				return a.course.Enrollments > b.course.Enrollments
+			}
+			return a.course.ID > b.course.ID
+		},
+		types.SortMostEnrolled: func(a, b scoredCourse) bool {
+			if a.course.Enrollments != b.course.Enrollments {
+				return a.course.Enrollments > b.course.Enrollments
+			}
+			if a.course.Rating != b.course.Rating {
+				return a.course.Rating > b.course.Rating
+			}
+			return a.course.ID > b.course.ID
+		},
+	}
+
+	newest := func(a, b scoredCourse) bool {
+		if !a.course.CreatedAt.Equal(b.course.CreatedAt) {
+			return a.course.CreatedAt.After(b.course.CreatedAt)
+		}
+		return a.course.ID > b.course.ID
+	}
+
+	compare, ok := less[by]
+	if !ok {
+		compare = newest
+	}
+	sort.Slice(matched, func(a, b int) bool { return compare(matched[a], matched[b]) })
+}
+
+
+func (i *Index) SearchCourses(params types.CourseSearchParams) (pagination.Page[map[string]interface{}], error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	matched, err := i.match(params)
+	if err != nil {
+		return pagination.Page[map[string]interface{}]{}, err
+	}
+
+	sortBy := params.Sort
+	if _, ok := indexKeys[sortBy]; !ok || (sortBy == types.SortRelevance && params.Term == "") {
+		sortBy = types.SortNewest
+	}
+	sortCourses(matched, sortBy)
+
+	highlighted := make(map[string]bool)
+	for _, term := range parseQuery(params.Term).include {
+		highlighted[term] = true
+	}
+
+	page, err := pagination.Slice(matched, params.Page, indexKeys[sortBy], sortBy != types.SortPriceAsc)
+	if err != nil {
+		return pagination.Page[map[string]interface{}]{}, err
+	}
+
+	results := pagination.Map(page, func(match scoredCourse) map[string]interface{} {
+		course := match.course
+		result := map[string]interface{}{
+			"id":                  course.ID,
+			"teacher_id":          course.TeacherID,
+			"category_id":         course.CategoryID,
+			"name":                course.Name,
+			"slug":                course.Slug,
+			"description":         course.Description,
+			"intro_video":         course.IntroVideo,
+			"image":               course.Image,
+			"price":               course.Price,
+			"language":            course.Language,
+			"level":               course.Level,
+			"total_duration":      course.TotalDuration,
+			"total_duration_text": utils.FormatDuration(course.TotalDuration),
+			"section_count":       course.SectionCount,
+			"lecture_count":       course.LectureCount,
+			"last_updated":        course.LastUpdated,
+			"created_at":          course.CreatedAt,
+			"modified_at":         course.ModifiedAt,
+			"instructor":          course.Instructor,
+			"rating":              course.Rating,
+			"enrollment_count":    course.Enrollments,
+		}
+		if params.Term != "" {
+			result["rank"] = match.score
+			result["highlights"] = map[string]string{
+				"name":        highlight(course.Name, highlighted),
+				"description": snippet(course.Description, highlighted, 35),
+			}
+		}
+		return result
+	})
+
+	return results.WithTotal(len(matched)), nil
+}
+
+
+func (i *Index) GetSearchFacets(params types.CourseSearchParams) (*types.SearchFacets, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	matched, err := i.match(params)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := make(map[int]*types.FacetBucket)
+	teachers := make(map[int]*types.FacetBucket)
+	prices := make([]int, len(priceBuckets))
+	ratings := make([]int, len(ratingBuckets))
+
+	for _, match := range matched {
+		course := match.course
+		if categories[course.CategoryID] == nil {
+			categories[course.CategoryID] = &types.FacetBucket{Value: fmt.Sprint(course.CategoryID), Label: course.CategoryName}
+		}
+		categories[course.CategoryID].Count++
+
+		if teachers[course.TeacherID] == nil {
+			teachers[course.TeacherID] = &types.FacetBucket{Value: fmt.Sprint(course.TeacherID), Label: course.Instructor}
+		}
+		teachers[course.TeacherID].Count++
+
+		for n, bucket := range priceBuckets {
+			if course.Price >= bucket.min && (bucket.max == 0 || course.Price < bucket.max) {
+				prices[n]++
+			}
+		}
+		for n, threshold := range ratingBuckets {
+			if course.Rating >= threshold {
+				ratings[n]++
+			}
+		}
+	}
+
+	facets := &types.SearchFacets{
+		Categories: topBuckets(categories),
+		Teachers:   topBuckets(teachers),
+	}
+	for n, bucket := range priceBuckets {
+		facets.Prices = append(facets.Prices, types.FacetBucket{Value: bucket.value, Label: bucket.label, Count: prices[n]})
+	}
+	for n, threshold := range ratingBuckets {
+		facets.Ratings = append(facets.Ratings, types.FacetBucket{
+			Value: fmt.Sprintf("%.1f", threshold),
+			Label: fmt.Sprintf("%.1f & up", threshold),
+			Count: ratings[n],
+		})
+	}
+	return facets, nil
+}
+
+
+// topBuckets orders buckets by count, then label, keeping the facetLimit
+// largest ones.
+func topBuckets(buckets map[int]*types.FacetBucket) []types.FacetBucket {
+	out := []types.FacetBucket{}
+	for _, bucket := range buckets {
+		out = append(out, *bucket)
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Count != out[b].Count {
+			return out[a].Count > out[b].Count
+		}
+		return out[a].Label < out[b].Label
+	})
+	if len(out) > facetLimit {
+		out = out[:facetLimit]
+	}
+	return out
+}
+
+
+// suggestThreshold mirrors pg_trgm's default word_similarity_threshold.
+const suggestThreshold = 0.6
+
+type rankedSuggestion struct {
+	suggestion types.Suggestion
+	prefix     bool
+	score      float64
+}
+
+
+// Suggest completes term against the indexed course names, teachers,
+// categories and tags. Only categories and tags used by a published course
+// are offered.
+func (i *Index) Suggest(term string, limit int) (*types.SearchSuggestions, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	lower := strings.ToLower(term)
+	courses := make(map[int]rankedSuggestion)
+	teachers := make(map[int]rankedSuggestion)
+	categories := make(map[int]rankedSuggestion)
+	tags := make(map[int]rankedSuggestion)
+
+	consider := func(into map[int]rankedSuggestion, suggestion types.Suggestion) {
+		if _, seen := into[suggestion.ID]; seen {
+			return
+		}
+		prefix := strings.HasPrefix(strings.ToLower(suggestion.Name), lower)
+		score := wordSimilarity(lower, suggestion.Name)
+		if prefix || score >= suggestThreshold {
+			into[suggestion.ID] = rankedSuggestion{suggestion, prefix, score}
+		}
+	}
+
+	for _, course := range i.courses {
+		consider(courses, types.Suggestion{ID: course.ID, Name: course.Name, Slug: course.Slug})
+		consider(teachers, types.Suggestion{ID: course.TeacherID, Name: course.Instructor})
+		if course.CategoryID != 0 {
+			consider(categories, types.Suggestion{ID: course.CategoryID, Name: course.CategoryName, Slug: course.CategorySlug})
+		}
+		for _, tag := range course.Tags {
+			consider(tags, types.Suggestion{ID: tag.ID, Name: tag.Name, Slug: tag.Slug})
+		}
+	}
+
+	return &types.SearchSuggestions{
+		Courses:    bestSuggestions(courses, limit),
+		Teachers:   bestSuggestions(teachers, limit),
+		Categories: bestSuggestions(categories, limit),
+		Tags:       bestSuggestions(tags, limit),
+	}, nil
+}
+
+
+func bestSuggestions(candidates map[int]rankedSuggestion, limit int) []types.Suggestion {
+	ranked := make([]rankedSuggestion, 0, len(candidates))
+	for _, candidate := range candidates {
+		ranked = append(ranked, candidate)
+	}
+	sort.Slice(ranked, func(a, b int) bool {
+		if ranked[a].prefix != ranked[b].prefix {
+			return ranked[a].prefix
+		}
+		if ranked[a].score != ranked[b].score {
+			return ranked[a].score > ranked[b].score
+		}
+		return ranked[a].suggestion.ID < ranked[b].suggestion.ID
+	})
+
+	suggestions := []types.Suggestion{}
+	for n := 0; n < len(ranked) && n < limit; n++ {
+		suggestions = append(suggestions, ranked[n].suggestion)
+	}
+	return suggestions
+}
+
+
+// SuggestCorrection works like the Postgres version, drawing replacement
+// words from the index's own lexicon.
+func (i *Index) SuggestCorrection(term string) (string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	fields := strings.Fields(strings.ToLower(term))
+	corrected := false
+
+	for n, word := range fields {
+		if len([]rune(word)) < 3 || strings.ContainsAny(word, `-"`) || i.lexicon[word] > 0 {
+			continue
+		}
+
+		best, bestScore, bestCount := "", correctionThreshold, 0
+		for candidate, count := range i.lexicon {
+			score := similarity(word, candidate)
+			if score > bestScore || (score == bestScore && best != "" && (count > bestCount || (count == bestCount && candidate < best))) {
+				best, bestScore, bestCount = candidate, score, count
+			} else if score == bestScore && best == "" {
+				best, bestCount = candidate, count
+			}
+		}
+		if best != "" {
+			fields[n] = best
+			corrected = true
+		}
+	}
+
+	if !corrected {
+		return "", nil
+	}
+
+	suggestion := strings.Join(fields, " ")
+	matched, err := i.match(types.CourseSearchParams{Term: suggestion})
+	if err != nil || len(matched) == 0 {
+		return "", err
+	}
+	return suggestion, nil
+}
@@ -0,0 +1,267 @@
+package search
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+// testCourses is a small catalog: categories 1 (Programming) > 2 (Go) and
+// 3 (Design), taught by teachers 10 and 20.
+func testCourses() []indexedCourse {
+	day := func(n int) time.Time { return time.Date(2024, 1, n, 0, 0, 0, 0, time.UTC) }
+	return []indexedCourse{
+		{
+			ID: 1, TeacherID: 10, CategoryID: 2, CategoryPath: []int{2, 1},
+			Name: "Go Programming", Description: "Build web servers in Go.",
+			Instructor: "Ada Lovelace", CategoryName: "Go", Price: 20, Rating: 4.5, Enrollments: 30,
+			Language: "en", Level: types.LevelBeginner, CreatedAt: day(1),
+			Tags: []types.CourseTag{{ID: 1, Name: "Golang", Slug: "golang-1"}, {ID: 2, Name: "Web", Slug: "web-2"}},
+		},
+		{
+			ID: 2, TeacherID: 10, CategoryID: 1, CategoryPath: []int{1},
+			Name: "Python for Programmers", Description: "Scripting and automation for developers who program.",
+			Instructor: "Ada Lovelace", CategoryName: "Programming", Price: 50, Rating: 4.8, Enrollments: 10,
+			Language: "en", Level: types.LevelIntermediate, CreatedAt: day(2),
+			Tags: []types.CourseTag{{ID: 3, Name: "Python", Slug: "python-3"}},
+		},
+		{
+			ID: 3, TeacherID: 20, CategoryID: 3, CategoryPath: []int{3},
+			Name: "Web Design", Description: "Layouts, colour and typography for the web.",
+			Instructor: "Grace Hopper", CategoryName: "Design", Price: 0, Rating: 3.9, Enrollments: 50,
+			Language: "es", Level: types.LevelBeginner, CreatedAt: day(3),
+			Tags: []types.CourseTag{{ID: 2, Name: "Web", Slug: "web-2"}},
+		},
+	}
+}
+
+
+func newTestIndex(courses []indexedCourse) *Index {
+	index := &Index{}
+	index.reset(courses)
+	return index
+}
+
+
+func searchIDs(t *testing.T, index *Index, params types.CourseSearchParams) []int {
+	t.Helper()
+	if params.Page.Limit == 0 {
+		params.Page = pagination.First("test", pagination.DefaultLimit)
+	}
+	page, err := index.SearchCourses(params)
+	if err != nil {
+		t.Fatalf("SearchCourses: %v", err)
+	}
+	ids := []int{}
+	for _, course := range page.Data {
+		ids = append(ids, course["id"].(int))
+	}
+	return ids
+}
+
+
+func TestIndexSearch(t *testing.T) {
+	index := newTestIndex(testCourses())
+
+	tests := []struct {
+		name   string
+		params types.CourseSearchParams
+		want   []int
+	}{
+		{"stemmed name, category and description", types.CourseSearchParams{Term: "programming", Sort: types.SortRelevance}, []int{2, 1}},
+		{"every term must match", types.CourseSearchParams{Term: "web go"}, []int{1}},
+		{"exclusion", types.CourseSearchParams{Term: "web -go"}, []int{3}},
+		{"teacher name", types.CourseSearchParams{Term: "hopper"}, []int{3}},
+		{"stop words only", types.CourseSearchParams{Term: "the and"}, []int{}},
+		{"no term lists newest first", types.CourseSearchParams{}, []int{3, 2, 1}},
+		{"category subtree", types.CourseSearchParams{Categories: []int{1}}, []int{2, 1}},
+		{"tag by name or slug", types.CourseSearchParams{Tags: []string{"web", "golang-1"}}, []int{1}},
+		{"teacher", types.CourseSearchParams{TeacherID: 20}, []int{3}},
+		{"price range", types.CourseSearchParams{PriceMin: 10, PriceMax: 30}, []int{1}},
+		{"minimum rating", types.CourseSearchParams{MinRating: 4.6}, []int{2}},
+		{"language and level", types.CourseSearchParams{Languages: []string{"en"}, Levels: []types.CourseLevel{types.LevelBeginner}}, []int{1}},
+		{"cheapest first", types.CourseSearchParams{Sort: types.SortPriceAsc}, []int{3, 1, 2}},
+		{"highest rated", types.CourseSearchParams{Sort: types.SortHighestRated}, []int{2, 1, 3}},
+		{"most enrolled", types.CourseSearchParams{Sort: types.SortMostEnrolled}, []int{3, 1, 2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := searchIDs(t, index, test.params); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+
+func TestIndexPagination(t *testing.T) {
+	index := newTestIndex(testCourses())
+
+	params := types.CourseSearchParams{Sort: types.SortPriceAsc, Page: pagination.First("test", 2)}
+	first, err := index.SearchCourses(params)
+	if err != nil {
+		t.Fatalf("SearchCourses: %v", err)
+	}
+	if len(first.Data) != 2 || first.NextCursor == "" || *first.Total != 3 {
+		t.Fatalf("first page: %d results, next cursor %q, total %d", len(first.Data), first.NextCursor, *first.Total)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/search?limit=2&cursor="+first.NextCursor, nil)
+	params.Page, err = pagination.FromRequest(request, "test", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		t.Fatalf("could not decode cursor: %v", err)
+	}
+	if got := searchIDs(t, index, params); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("second page = %v, want [2]", got)
+	}
+}
+
+
+func TestIndexRemoveKeepsLexiconInSync(t *testing.T) {
+	index := newTestIndex(testCourses())
+
+	index.remove(2)
+	if _, ok := index.lexicon["python"]; ok {
+		t.Error("lexicon still holds a word only the removed course used")
+	}
+	if index.lexicon["web"] != 2 {
+		t.Errorf("lexicon counts %d courses for \"web\", want 2", index.lexicon["web"])
+	}
+	if got := searchIDs(t, index, types.CourseSearchParams{Term: "python"}); len(got) != 0 {
+		t.Errorf("removed course still found: %v", got)
+	}
+}
+
+
+func TestIndexApplyIgnoresOlderLoads(t *testing.T) {
+	index := newTestIndex(testCourses())
+
+	// A per-course update numbered 2 lands before a rebuild that started
+	// earlier, as 1, and finishes later with the old name
+	renamed := testCourses()[0]
+	renamed.Name = "Concurrency in Go"
+	index.apply(2, []int{1}, []indexedCourse{renamed})
+	index.apply(1, []int{1, 2, 3}, testCourses())
+
+	if got := index.courses[1].Name; got != "Concurrency in Go" {
+		t.Errorf("course 1 is named %q after the older rebuild", got)
+	}
+	if got := searchIDs(t, index, types.CourseSearchParams{Term: "concurrency"}); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("search for the new name = %v, want [1]", got)
+	}
+
+	// Courses missing from a newer load are no longer published
+	index.apply(3, []int{1, 2, 3}, testCourses()[:2])
+	if _, ok := index.courses[3]; ok {
+		t.Error("unpublished course is still indexed")
+	}
+}
+
+
+func TestIndexRemoveCourseWinsOverOlderLoad(t *testing.T) {
+	index := newTestIndex(testCourses())
+
+	seq := index.begin()
+	if err := index.RemoveCourse(3); err != nil {
+		t.Fatalf("RemoveCourse: %v", err)
+	}
+	index.apply(seq, []int{1, 2, 3}, testCourses())
+
+	if _, ok := index.courses[3]; ok {
+		t.Error("a load that started before the removal brought the course back")
+	}
+}
+
+
+func TestIndexSuggest(t *testing.T) {
+	index := newTestIndex(testCourses())
+
+	suggestions, err := index.Suggest("pyth", 5)
+	if err != nil {
+		t.Fatalf("Suggest: %v", err)
+	}
+	if len(suggestions.Courses) != 1 || suggestions.Courses[0].ID != 2 {
+		t.Errorf("course suggestions = %+v, want course 2", suggestions.Courses)
+	}
+	if len(suggestions.Tags) != 1 || suggestions.Tags[0].ID != 3 {
+		t.Errorf("tag suggestions = %+v, want tag 3", suggestions.Tags)
+	}
+}
+
+
+func TestIndexSuggestCorrection(t *testing.T) {
+	index := newTestIndex(testCourses())
+
+	got, err := index.SuggestCorrection("pythn")
+	if err != nil {
+		t.Fatalf("SuggestCorrection: %v", err)
+	}
+	if got != "python" {
+		t.Errorf("correction = %q, want \"python\"", got)
+	}
+
+	if got, _ := index.SuggestCorrection("python"); got != "" {
+		t.Errorf("known word corrected to %q", got)
+	}
+}
+
+
+func TestIndexFacets(t *testing.T) {
+	index := newTestIndex(testCourses())
+
+	facets, err := index.GetSearchFacets(types.CourseSearchParams{Term: "web"})
+	if err != nil {
+		t.Fatalf("GetSearchFacets: %v", err)
+	}
+	teachers := map[string]int{}
+	for _, bucket := range facets.Teachers {
+		teachers[bucket.Label] = bucket.Count
+	}
+	if want := map[string]int{"Ada Lovelace": 1, "Grace Hopper": 1}; !reflect.DeepEqual(teachers, want) {
+		t.Errorf("teacher facets = %v, want %v", teachers, want)
+	}
+}
+
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "search.idx")
+	index := newTestIndex(testCourses())
+	index.path = path
+
+	if err := index.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	courses, err := readSnapshot(path)
+	if err != nil {
+		t.Fatalf("readSnapshot: %v", err)
+	}
+	loaded := newTestIndex(courses)
+	if got := searchIDs(t, loaded, types.CourseSearchParams{Term: "programming", Sort: types.SortRelevance}); !reflect.DeepEqual(got, []int{2, 1}) {
+		t.Errorf("search on the loaded snapshot = %v, want [2 1]", got)
+	}
+}
+
+
+func TestSnapshotCorruptOrMissing(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := readSnapshot(filepath.Join(dir, "missing.idx")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing snapshot: got %v, want os.ErrNotExist", err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.idx")
+	if err := os.WriteFile(corrupt, []byte("not a snapshot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSnapshot(corrupt); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Errorf("corrupt snapshot: got %v, want a read error", err)
+	}
+}
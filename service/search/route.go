@@ -1,79 +1,86 @@
 package search
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/sikozonpc/ecom/service/auth"
 	"github.com/sikozonpc/ecom/types"
 	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
 )
 
 type Handler struct {
-	search types.SearchResult
+	search    types.SearchResult
+	analytics types.SearchAnalyticsStore
+	searches  *SearchLog
+	store     types.UserStore
 }
 
-func NewHandler(search types.SearchResult) *Handler {
-    return &Handler{search: search}
+func NewHandler(search types.SearchResult, analytics types.SearchAnalyticsStore, searches *SearchLog, store types.UserStore) *Handler {
+    return &Handler{search: search, analytics: analytics, searches: searches, store: store}
 }
 
 
 func (h *Handler) SearchRoutes(router *mux.Router) {
+	adminOnly := []types.UserRole{types.ADMIN}
+
 	router.HandleFunc("/search", h.searchCoursesHandler).Methods(http.MethodGet)
+	router.HandleFunc("/search/suggest", h.suggestHandler).Methods(http.MethodGet)
+	router.HandleFunc("/search/{token}/clicks", h.searchClickHandler).Methods(http.MethodPost)
+
+	// search analytics
+	router.HandleFunc("/admin/search/top_queries", auth.WithJWTAuth(h.topQueriesHandler, h.store, adminOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/search/zero_results", auth.WithJWTAuth(h.zeroResultQueriesHandler, h.store, adminOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/search/click_through", auth.WithJWTAuth(h.clickThroughHandler, h.store, adminOnly)).Methods(http.MethodGet)
 }
 
 
 
 
 func (h *Handler) searchCoursesHandler(writer http.ResponseWriter, request *http.Request) {
+	started := time.Now()
 	queryParams := request.URL.Query()
 
 	searchTerm := queryParams.Get("q")
 	categoryIDs := queryParams.Get("category_id")
 	categoryNames := queryParams.Get("category_name")
+	tagNames := queryParams.Get("tags")
 	teacherID := queryParams.Get("teacher_id")
 
 	priceMin := queryParams.Get("price_min")
 	priceMax := queryParams.Get("price_max")
 	createdAfter := queryParams.Get("created_after")
 	createdBefore := queryParams.Get("created_before")
-
-	pageStr := queryParams.Get("page")
-	limitStr := queryParams.Get("limit")
-
-	page := 1
-	limit := 10
+	minRating := queryParams.Get("min_rating")
+	durationMin := queryParams.Get("duration_min")
+	durationMax := queryParams.Get("duration_max")
+	languageCodes := queryParams.Get("language")
+	levelNames := queryParams.Get("level")
 
 	var err error
-	if pageStr!= "" {
-		page, err = strconv.Atoi(pageStr)
-		if err != nil || page < 1 {
-			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid page parameter"))
-			return
-		}
-	}
-
-	if limitStr!= "" {
-		limit, err = strconv.Atoi(limitStr)
-        if err!= nil || limit < 1 || limit > 100 {
-            utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid limit parameter"))
-            return
-        }
-	}
-
 	var categories []int
 
 	if categoryNames != "" {
 		names := strings.Split(categoryNames, ",")
 		for _, name := range names {
-			categoryID, err := h.search.GetCategoryIDByName(name)
+			categoryIDs, err := h.search.GetCategoryIDsByName(name)
 			if err!= nil {
+				if err == ErrCategoryNotFound {
+					utils.WriteError(writer, http.StatusNotFound, fmt.Errorf("category not found: %s", name))
+					return
+				}
                 utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to get category ID by name"))
                 return
             }
-			categories = append(categories, categoryID)
+			categories = append(categories, categoryIDs...)
 		}
 	}
 
@@ -89,6 +96,17 @@ func (h *Handler) searchCoursesHandler(writer http.ResponseWriter, request *http
 		}
 	}
 
+	// tags are comma separated slugs or names; a course must carry all of them
+	var tags []string
+	seenTags := make(map[string]bool)
+	for _, tag := range strings.Split(tagNames, ",") {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag != "" && !seenTags[tag] {
+			seenTags[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
 	var teacher int
 
 	if teacherID!= "" {
@@ -116,36 +134,298 @@ func (h *Handler) searchCoursesHandler(writer http.ResponseWriter, request *http
         }
 	}
 
-	offset := (page - 1) * limit
+	var minRatingFloat float64
+	if minRating != "" {
+		minRatingFloat, err = strconv.ParseFloat(minRating, 64)
+		if err != nil || minRatingFloat < 0 || minRatingFloat > 5 {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid min_rating parameter"))
+			return
+		}
+	}
+
+	// durations are given in minutes and stored in seconds
+	var durationMinSeconds, durationMaxSeconds int
+	if durationMin != "" {
+		minutes, err := strconv.Atoi(durationMin)
+		if err != nil || minutes < 0 {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid duration_min parameter"))
+			return
+		}
+		durationMinSeconds = minutes * 60
+	}
+	if durationMax != "" {
+		minutes, err := strconv.Atoi(durationMax)
+		if err != nil || minutes < 1 {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid duration_max parameter"))
+			return
+		}
+		durationMaxSeconds = minutes * 60
+	}
+	if durationMaxSeconds > 0 && durationMinSeconds > durationMaxSeconds {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("duration_min must not be greater than duration_max"))
+		return
+	}
+
+	// languages and levels are comma separated; a course may match any of them
+	var languages []string
+	for _, language := range strings.Split(languageCodes, ",") {
+		if language = strings.ToLower(strings.TrimSpace(language)); language != "" {
+			languages = append(languages, language)
+		}
+	}
+
+	var levels []types.CourseLevel
+	for _, level := range strings.Split(levelNames, ",") {
+		switch level := types.CourseLevel(strings.TrimSpace(level)); level {
+		case "":
+		case types.LevelBeginner, types.LevelIntermediate, types.LevelAdvanced, types.LevelAllLevels:
+			levels = append(levels, level)
+		default:
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid level: %s", level))
+			return
+		}
+	}
+
+	sort, err := ParseSort(queryParams.Get("sort"), searchTerm != "")
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
 
-	results, totalCourses, err := h.search.SearchCourses(searchTerm, categories, teacher, priceMinFloat, priceMaxFloat, createdAfter, createdBefore, page, limit)
+	// A cursor only makes sense for the ordering it was issued for
+	page, err := pagination.FromRequest(request, "search:"+string(sort), 10, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	params := types.CourseSearchParams{
+		Term:          searchTerm,
+		Categories:    categories,
+		Tags:          tags,
+		TeacherID:     teacher,
+		PriceMin:      priceMinFloat,
+		PriceMax:      priceMaxFloat,
+		CreatedAfter:  createdAfter,
+		CreatedBefore: createdBefore,
+		MinRating:     minRatingFloat,
+		DurationMin:   durationMinSeconds,
+		DurationMax:   durationMaxSeconds,
+		Languages:     languages,
+		Levels:        levels,
+		Sort:          sort,
+		Page:          page,
+	}
+
+	results, err := h.search.SearchCourses(params)
 	if err!= nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
         utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to search courses: %v", err))
         return
     }
+	totalCourses := *results.Total
 
-	nextPageOffset := offset + limit
-	prevPageOffset := offset - limit
-	if prevPageOffset < 0 {
-        prevPageOffset = 0
-    }
-
-	baseURL := request.URL.Path
-	nextPageURL := fmt.Sprintf("%s?limit=%d&page=%d", baseURL, limit, nextPageOffset)
-	prevPageURL := ""
-	if page > 1 {
-		prevPageURL = fmt.Sprintf("%s?limit=%d&page=%d", baseURL, limit, prevPageOffset)
+	facets, err := h.search.GetSearchFacets(params)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to count search facets: %v", err))
+		return
 	}
 
 	response := map[string]interface{}{
-		"data":           results,
-		"total":          totalCourses,
-		"limit":          limit,
-		"offset":         offset,
-		"current_page":   page,
-		"next_page_url":  nextPageURL,
-		"prev_page_url":  prevPageURL,
+		"data":        results.Data,
+		"next_cursor": results.NextCursor,
+		"prev_cursor": results.PrevCursor,
+		"total":       totalCourses,
+		"sort":        sort,
+		"facets":      facets,
+	}
+
+	// Nothing matched: offer a corrected query when the catalog has one
+	if totalCourses == 0 && searchTerm != "" {
+		suggestion, err := h.search.SuggestCorrection(searchTerm)
+		if err != nil {
+			log.Printf("could not suggest a correction for %q: %v", searchTerm, err)
+		} else if suggestion != "" {
+			corrected := request.URL.Query()
+			corrected.Set("q", suggestion)
+			corrected.Del("cursor")
+			response["did_you_mean"] = map[string]string{
+				"query": suggestion,
+				"url":   request.URL.Path + "?" + corrected.Encode(),
+			}
+		}
+	}
+
+	// Analytics must never fail or slow down the search itself
+	entry := &types.SearchLogEntry{
+		Token:       utils.GenerateTOken(),
+		Query:       searchTerm,
+		Filters:     searchFilters(queryParams),
+		Sort:        sort,
+		Page:        results.Offset/page.Limit + 1,
+		ResultCount: totalCourses,
+		LatencyMS:   float64(time.Since(started).Microseconds()) / 1000,
+	}
+	entry.UserID, _ = auth.GetStudentIDFromToken(request)
+	if h.searches.Add(entry) {
+		response["search_id"] = entry.Token
 	}
 
 	utils.WriteJSON(writer, http.StatusOK, response)
-}
\ No newline at end of file
+}
+
+
+// searchFilters keeps the query parameters that narrowed a search, leaving
+// out the term, ordering and paging.
+func searchFilters(queryParams url.Values) map[string]string {
+	filters := make(map[string]string)
+	for key := range queryParams {
+		switch key {
+		case "q", "sort", "cursor", "limit":
+			continue
+		}
+		if value := queryParams.Get(key); value != "" {
+			filters[key] = value
+		}
+	}
+	return filters
+}
+
+
+func (h *Handler) suggestHandler(writer http.ResponseWriter, request *http.Request) {
+	term := strings.Join(strings.Fields(request.URL.Query().Get("q")), " ")
+	if term == "" {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("missing q parameter"))
+		return
+	}
+
+	limit := 5
+	if limitStr := request.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 20 {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid limit parameter"))
+			return
+		}
+	}
+
+	suggestions, err := h.search.Suggest(term, limit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to get suggestions: %v", err))
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, suggestions)
+}
+
+
+// SEARCH ANALYTICS
+
+// searchClickHandler records which result of a search was opened. It is
+// public like /search, so the search is named by the unguessable search_id
+// token that search returned; the user is attached when a JWT is sent.
+func (h *Handler) searchClickHandler(writer http.ResponseWriter, request *http.Request) {
+	searchToken := mux.Vars(request)["token"]
+
+	var payload types.SearchClickPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	click := &types.SearchClick{SearchToken: searchToken, CourseID: payload.CourseID, Position: payload.Position}
+	click.UserID, _ = auth.GetStudentIDFromToken(request)
+
+	if err := h.analytics.LogSearchClick(click); err != nil {
+		if err == ErrSearchNotFound || err == ErrCourseNotFound {
+			utils.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusCreated, map[string]string{"message": "Click recorded"})
+}
+
+
+// reportPeriod reads the ?from= and ?to= dates of a report. Both days are
+// included; the default is the last 30 days.
+func reportPeriod(request *http.Request) (time.Time, time.Time, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today.AddDate(0, 0, -29), today
+
+	var err error
+	if value := request.URL.Query().Get("from"); value != "" {
+		if from, err = time.Parse("2006-01-02", value); err != nil {
+			return from, to, fmt.Errorf("invalid from date, expected YYYY-MM-DD")
+		}
+	}
+	if value := request.URL.Query().Get("to"); value != "" {
+		if to, err = time.Parse("2006-01-02", value); err != nil {
+			return from, to, fmt.Errorf("invalid to date, expected YYYY-MM-DD")
+		}
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("to must not be before from")
+	}
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+
+func (h *Handler) topQueriesHandler(writer http.ResponseWriter, request *http.Request) {
+	from, to, err := reportPeriod(request)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	queries, err := h.analytics.GetTopQueries(from, to, pagination.QueryLimit(request, 20, 100))
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, queries)
+}
+
+
+func (h *Handler) zeroResultQueriesHandler(writer http.ResponseWriter, request *http.Request) {
+	from, to, err := reportPeriod(request)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	queries, err := h.analytics.GetZeroResultQueries(from, to, pagination.QueryLimit(request, 20, 100))
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, queries)
+}
+
+
+func (h *Handler) clickThroughHandler(writer http.ResponseWriter, request *http.Request) {
+	from, to, err := reportPeriod(request)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	report, err := h.analytics.GetClickThrough(from, to)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, report)
+}
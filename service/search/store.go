@@ -2,12 +2,20 @@ package search
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"html"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
 )
 
+var ErrCategoryNotFound = errors.New("category not found")
+
 type Store struct {
 	db *sql.DB
 }
@@ -18,140 +26,283 @@ func NewStore(db *sql.DB) *Store {
 }
 
 
-func (s *Store) GetCategoryIDByName(name string) (int, error) {
-	var categoryID int
-
-	query := `SELECT id FROM categories WHERE TRIM(name) ILIKE $1`
+// GetCategoryIDsByName returns every category whose name or slug matches.
+// The same name can appear under different parents, so there may be several.
+func (s *Store) GetCategoryIDsByName(name string) ([]int, error) {
+	query := `SELECT id FROM categories WHERE TRIM(name) ILIKE $1 OR slug = LOWER($1) ORDER BY id`
 
-	err := s.db.QueryRow(query, name).Scan(&categoryID)
+	rows, err := s.db.Query(query, strings.TrimSpace(name))
 	if err != nil {
-        if err == sql.ErrNoRows {
-            fmt.Println("No category found for:", name)  // Log category search failure
-            return 0, fmt.Errorf("category not found")
-        }
-        fmt.Println("Error querying category:", err)  // Log any query errors
-        return 0, err
-    }
+		return nil, err
+	}
+	defer rows.Close()
 
+	var categoryIDs []int
+	for rows.Next() {
+		var categoryID int
+		if err := rows.Scan(&categoryID); err != nil {
+			return nil, err
+		}
+		categoryIDs = append(categoryIDs, categoryID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return categoryID, nil
+	if len(categoryIDs) == 0 {
+		return nil, ErrCategoryNotFound
+	}
+	return categoryIDs, nil
 }
 
 
-func (s *Store) SearchCourses(searchTerm string, categories []int, teacherID int, priceMin, priceMax float64, createdAfter, createdBefore string, page, limit int) ([]map[string]interface{}, int, error) {
-	var courses []map[string]interface{}
-	offset := (page - 1) * limit
+// categorySubtree matches courses in the given categories or any category
+// below them in the taxonomy.
+const categorySubtree = ` AND c.category_id IN (
+		WITH RECURSIVE tree AS (
+			SELECT id FROM categories WHERE id = ANY(%[1]s)
+			UNION
+			SELECT child.id FROM categories child JOIN tree ON child.parent_id = tree.id
+		)
+		SELECT id FROM tree)`
 
-	query := `
-		SELECT c.id, c.teacher_id, c.category_id, c.name, c.slug, c.description, c.intro_video, c.image, c.price, c.created_at, c.modified_at,
-		       	 t.id, u.first_name, u.last_name
-		FROM courses c
-		JOIN teachers t ON c.teacher_id = t.id
-		JOIN users u ON t.user_id = u.id
-		WHERE 1=1`
 
-	var args []interface{}
-	argIndex := 1
+// courseTagFilter keeps courses carrying every listed tag. Tags are matched by
+// slug or, ignoring case, by name. Each term is checked on its own, so terms
+// naming the same tag or a term matching several tags do not skew a count.
+const courseTagFilter = ` AND NOT EXISTS (
+		SELECT 1 FROM unnest(%[1]s::text[]) AS term
+		WHERE NOT EXISTS (
+			SELECT 1 FROM course_tags ct
+			JOIN tags t ON ct.tag_id = t.id
+			WHERE ct.course_id = c.id AND (t.slug = term OR LOWER(t.name) = term)))`
+
+
+// searchConfig is the text search configuration used both to build
+// courses.search_vector and to parse queries; the two must agree.
+const searchConfig = "english"
+
+// ts_headline copies the stored text verbatim, so matches are delimited with
+// private use characters and the snippet is HTML escaped before they are
+// turned into <mark> tags. markText strips the delimiters from the source
+// text so a course cannot forge its own marks.
+const (
+	markStart = "\uE000"
+	markStop  = "\uE001"
+	markText  = `translate(%s, chr(57344) || chr(57345), '')`
+)
+
+// headlineOptions wraps matched words in the mark delimiters for the snippets.
+const headlineOptions = "StartSel=" + markStart + ", StopSel=" + markStop + ", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" ... \""
+
+
+// markHighlights escapes a ts_headline snippet and replaces its delimiters
+// with <mark> tags.
+func markHighlights(headline string) string {
+	escaped := html.EscapeString(headline)
+	return strings.NewReplacer(markStart, "<mark>", markStop, "</mark>").Replace(escaped)
+}
+
 
-	// Search by name or description
-	if searchTerm != "" {
-		query += fmt.Sprintf(` AND (c.name ILIKE $%d OR c.description ILIKE $%d)`, argIndex, argIndex)
-		args = append(args, "%"+searchTerm+"%")
-		argIndex++
+// courseFilter accumulates the WHERE clause shared by the result and count
+// queries along with its positional arguments.
+type courseFilter struct {
+	where string
+	args  []interface{}
+}
+
+
+// arg appends a value and returns its placeholder.
+func (f *courseFilter) arg(value interface{}) string {
+	f.args = append(f.args, value)
+	return fmt.Sprintf("$%d", len(f.args))
+}
+
+
+// newCourseFilter builds the filter for a search. When a search term is set
+// it is always the first argument, so the ranking and snippet expressions
+// can refer to it as tsQuery.
+func newCourseFilter(params types.CourseSearchParams) *courseFilter {
+	f := &courseFilter{where: ` WHERE c.status = 'published'`}
+
+	// Full-text match on name, description, teacher, category and tags
+	if params.Term != "" {
+		f.where += ` AND c.search_vector @@ websearch_to_tsquery('` + searchConfig + `', ` + f.arg(params.Term) + `)`
 	}
 
 	// Filter by teacher ID if provided
-	if teacherID != 0 {
-		query += fmt.Sprintf(` AND c.teacher_id = $%d`, argIndex)
-		args = append(args, teacherID)
-		argIndex++
+	if params.TeacherID != 0 {
+		f.where += ` AND c.teacher_id = ` + f.arg(params.TeacherID)
+	}
+
+	// Filter by categories and their descendants if provided
+	if len(params.Categories) > 0 {
+		f.where += fmt.Sprintf(categorySubtree, f.arg(pq.Array(params.Categories)))
 	}
 
-	// Filter by categories if provided
-	if len(categories) > 0 {
-		query += fmt.Sprintf(` AND c.category_id = ANY($%d)`, argIndex)
-		args = append(args, pq.Array(categories))
-		argIndex++
+	// Filter by tags if provided
+	if len(params.Tags) > 0 {
+		f.where += fmt.Sprintf(courseTagFilter, f.arg(pq.Array(params.Tags)))
 	}
 
 	// Filter by price range if provided
-	if priceMin > 0 && priceMax > 0 {
-		query += fmt.Sprintf(` AND c.price BETWEEN $%d AND $%d`, argIndex, argIndex+1)
-		args = append(args, priceMin, priceMax)
-		argIndex += 2
+	if params.PriceMin > 0 && params.PriceMax > 0 {
+		f.where += fmt.Sprintf(` AND c.price BETWEEN %s AND %s`, f.arg(params.PriceMin), f.arg(params.PriceMax))
 	}
 
 	// Filter by creation date range if provided
-	if createdAfter != "" && createdBefore != "" {
-		query += fmt.Sprintf(` AND c.created_at BETWEEN $%d AND $%d`, argIndex, argIndex+1)
-		args = append(args, createdAfter, createdBefore)
-		argIndex += 2
+	if params.CreatedAfter != "" && params.CreatedBefore != "" {
+		f.where += fmt.Sprintf(` AND c.created_at BETWEEN %s AND %s`, f.arg(params.CreatedAfter), f.arg(params.CreatedBefore))
 	}
 
-	// Add pagination
-	query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, argIndex, argIndex+1)
-	args = append(args, limit, offset)
+	// Filter by minimum average rating if provided
+	if params.MinRating > 0 {
+		f.where += ` AND ` + ratingColumn + ` >= ` + f.arg(params.MinRating)
+	}
 
-	// Get total number of courses (for pagination metadata)
-	totalQuery := `SELECT COUNT(*) FROM courses c WHERE 1=1`
-	var totalArgs []interface{}
-	totalArgIndex := 1
+	// Filter by total duration if provided; either end may be left open
+	if params.DurationMin > 0 {
+		f.where += ` AND c.total_duration >= ` + f.arg(params.DurationMin)
+	}
+	if params.DurationMax > 0 {
+		f.where += ` AND c.total_duration <= ` + f.arg(params.DurationMax)
+	}
 
-	// Search by name or description for total count
-	if searchTerm != "" {
-		totalQuery += fmt.Sprintf(` AND (c.name ILIKE $%d OR c.description ILIKE $%d)`, totalArgIndex, totalArgIndex)
-		totalArgs = append(totalArgs, "%"+searchTerm+"%")
-		totalArgIndex++
+	// Filter by languages and levels if provided
+	if len(params.Languages) > 0 {
+		f.where += ` AND c.language = ANY(` + f.arg(pq.Array(params.Languages)) + `)`
+	}
+	if len(params.Levels) > 0 {
+		levels := make([]string, len(params.Levels))
+		for i, level := range params.Levels {
+			levels[i] = string(level)
+		}
+		f.where += ` AND c.level = ANY(` + f.arg(pq.Array(levels)) + `)`
 	}
 
-	// Filter by teacher ID for total count
-	if teacherID != 0 {
-		totalQuery += fmt.Sprintf(` AND c.teacher_id = $%d`, totalArgIndex)
-		totalArgs = append(totalArgs, teacherID)
-		totalArgIndex++
+	return f
+}
+
+
+const tsQuery = `websearch_to_tsquery('` + searchConfig + `', $1)`
+
+
+const (
+	ratingColumn     = `c.rating_average`
+	enrollmentColumn = `(SELECT COUNT(*) FROM enrollments e WHERE e.course_id = c.id)`
+)
+
+// searchKeysets maps each sort option onto the keyset it pages by. Every
+// keyset ends on the course ID so pages never overlap. The rating average
+// is a float8 column so that the value a cursor carries compares exactly.
+var searchKeysets = map[types.SearchSort]pagination.Keyset{
+	types.SortRelevance:    {Columns: []string{`ts_rank(c.search_vector, ` + tsQuery + `)`, "c.id"}, Desc: true},
+	types.SortNewest:       {Columns: []string{"c.created_at", "c.id"}, Desc: true},
+	types.SortPriceAsc:     {Columns: []string{"c.price", "c.id"}},
+	types.SortPriceDesc:    {Columns: []string{"c.price", "c.id"}, Desc: true},
+	types.SortHighestRated: {Columns: []string{ratingColumn, enrollmentColumn, "c.id"}, Desc: true},
+	types.SortMostEnrolled: {Columns: []string{enrollmentColumn, ratingColumn, "c.id"}, Desc: true},
+}
+
+// searchKeys returns the sort key of a search result for each sort option,
+// in the order of its keyset columns.
+var searchKeys = map[types.SearchSort]func(map[string]interface{}) []interface{}{
+	types.SortRelevance: func(c map[string]interface{}) []interface{} { return []interface{}{c["rank"], c["id"]} },
+	types.SortNewest: func(c map[string]interface{}) []interface{} {
+		return []interface{}{c["created_at"].(time.Time).Format(time.RFC3339Nano), c["id"]}
+	},
+	types.SortPriceAsc:     func(c map[string]interface{}) []interface{} { return []interface{}{c["price"], c["id"]} },
+	types.SortPriceDesc:    func(c map[string]interface{}) []interface{} { return []interface{}{c["price"], c["id"]} },
+	types.SortHighestRated: func(c map[string]interface{}) []interface{} { return []interface{}{c["rating"], c["enrollment_count"], c["id"]} },
+	types.SortMostEnrolled: func(c map[string]interface{}) []interface{} { return []interface{}{c["enrollment_count"], c["rating"], c["id"]} },
+}
+
+
+// ParseSort validates a sort option. Relevance needs a search term, so an
+// empty sort means relevance when there is one and newest otherwise.
+func ParseSort(name string, hasTerm bool) (types.SearchSort, error) {
+	sort := types.SearchSort(name)
+	if sort == "" {
+		if hasTerm {
+			return types.SortRelevance, nil
+		}
+		return types.SortNewest, nil
 	}
+	if _, ok := searchKeysets[sort]; !ok {
+		return "", fmt.Errorf("unknown sort option: %s", name)
+	}
+	if sort == types.SortRelevance && !hasTerm {
+		return types.SortNewest, nil
+	}
+	return sort, nil
+}
+
+
+// SearchCourses runs a catalog search. With a search term, results carry a
+// relevance score and highlighted name and description snippets.
+func (s *Store) SearchCourses(params types.CourseSearchParams) (pagination.Page[map[string]interface{}], error) {
+	var page pagination.Page[map[string]interface{}]
+	courses := []map[string]interface{}{}
 
-	// Filter by categories for total count
-	if len(categories) > 0 {
-		totalQuery += fmt.Sprintf(` AND c.category_id = ANY($%d)`, totalArgIndex)
-		totalArgs = append(totalArgs, pq.Array(categories))
-		totalArgIndex++
+	filter := newCourseFilter(params)
+
+	// Get total number of courses (for pagination metadata)
+	var totalCourses int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM courses c`+filter.where, filter.args...).Scan(&totalCourses)
+	if err != nil {
+		return page, err
 	}
 
-	// Filter by price range for total count
-	if priceMin > 0 && priceMax > 0 {
-		totalQuery += fmt.Sprintf(` AND c.price BETWEEN $%d AND $%d`, totalArgIndex, totalArgIndex+1)
-		totalArgs = append(totalArgs, priceMin, priceMax)
-		totalArgIndex += 2
+	rank := `0::real`
+	nameHeadline := `c.name`
+	descriptionHeadline := `''`
+	if params.Term != "" {
+		rank = `ts_rank(c.search_vector, ` + tsQuery + `)`
+		nameHeadline = `ts_headline('` + searchConfig + `', ` + fmt.Sprintf(markText, `c.name`) + `, ` + tsQuery +
+			`, 'HighlightAll=true, StartSel=` + markStart + `, StopSel=` + markStop + `')`
+		descriptionHeadline = `ts_headline('` + searchConfig + `', ` + fmt.Sprintf(markText, `c.description`) + `, ` + tsQuery + `, '` + headlineOptions + `')`
 	}
 
-	// Filter by creation date range for total count
-	if createdAfter != "" && createdBefore != "" {
-		totalQuery += fmt.Sprintf(` AND c.created_at BETWEEN $%d AND $%d`, totalArgIndex, totalArgIndex+1)
-		totalArgs = append(totalArgs, createdAfter, createdBefore)
-		totalArgIndex += 2
+	sortBy := params.Sort
+	if _, ok := searchKeysets[sortBy]; !ok || (sortBy == types.SortRelevance && params.Term == "") {
+		sortBy = types.SortNewest
 	}
+	keyset := searchKeysets[sortBy]
 
-	var totalCourses int
-	err := s.db.QueryRow(totalQuery, totalArgs...).Scan(&totalCourses)
+	cursor, args, err := keyset.Where(params.Page, filter.args)
 	if err != nil {
-		return nil, 0, err
+		return page, err
 	}
+	order, args := keyset.OrderBy(params.Page, args)
+
+	query := `
+		SELECT c.id, c.teacher_id, c.category_id, c.name, c.slug, c.description, c.intro_video, c.image, c.price,
+		       c.language, c.level, c.total_duration, c.section_count, c.lecture_count, GREATEST(c.modified_at, c.content_updated_at),
+		       c.created_at, c.modified_at, t.id, u.first_name, u.last_name,
+		       ` + rank + ` AS rank, ` + nameHeadline + `, ` + descriptionHeadline + `,
+		       ` + ratingColumn + ` AS rating, ` + enrollmentColumn + ` AS enrollment_count
+		FROM courses c
+		JOIN teachers t ON c.teacher_id = t.id
+		JOIN users u ON t.user_id = u.id` + filter.where + cursor + order
 
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, err
+		return page, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var courseID, teacherID, categoryID int
 		var name, slug, description, firstName, lastName string
+		var language, level string
 		var price float64
-		var createdAt, modifiedAt time.Time
+		var totalDuration, sectionCount, lectureCount int
+		var lastUpdated, createdAt, modifiedAt time.Time
 		var introVideo, image sql.NullString
-	
-		
+		var relevance, rating float64
+		var nameSnippet, descriptionSnippet string
+		var enrollments int
+
 		err := rows.Scan(
 			&courseID,
 			&teacherID,
@@ -162,16 +313,27 @@ func (s *Store) SearchCourses(searchTerm string, categories []int, teacherID int
 			&introVideo,
 			&image,
 			&price,
+			&language,
+			&level,
+			&totalDuration,
+			&sectionCount,
+			&lectureCount,
+			&lastUpdated,
 			&createdAt,
 			&modifiedAt,
 			&teacherID,
 			&firstName,
 			&lastName,
+			&relevance,
+			&nameSnippet,
+			&descriptionSnippet,
+			&rating,
+			&enrollments,
 		)
 		if err != nil {
-			return nil, 0, err
+			return page, err
 		}
-	
+
 		// Add the course with the instructor details to the response
 		course := map[string]interface{}{
 			"id":          courseID,
@@ -183,13 +345,328 @@ func (s *Store) SearchCourses(searchTerm string, categories []int, teacherID int
 			"intro_video": introVideo,
 			"image":       image,
 			"price":       price,
+			"language":    language,
+			"level":       level,
+			"total_duration": totalDuration,
+			"total_duration_text": utils.FormatDuration(totalDuration),
+			"section_count": sectionCount,
+			"lecture_count": lectureCount,
+			"last_updated": lastUpdated,
 			"created_at":  createdAt,
 			"modified_at": modifiedAt,
 			"instructor":  fmt.Sprintf("%s %s", firstName, lastName), // Combine first name and last name
+			"rating":      rating,
+			"enrollment_count": enrollments,
 		}
-	
+		if params.Term != "" {
+			course["rank"] = relevance
+			course["highlights"] = map[string]string{
+				"name":        markHighlights(nameSnippet),
+				"description": markHighlights(descriptionSnippet),
+			}
+		}
+
 		courses = append(courses, course)
-	}	
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	return pagination.NewPage(courses, params.Page, searchKeys[sortBy]).WithTotal(totalCourses), nil
+}
+
+
+// SEARCH FACETS
+
+// priceBuckets split the matching courses by price. Max is exclusive and
+// zero means no upper bound.
+var priceBuckets = []struct {
+	value, label string
+	min, max     float64
+}{
+	{"free", "Free", 0, 0.01},
+	{"0-20", "Under $20", 0.01, 20},
+	{"20-50", "$20 to $50", 20, 50},
+	{"50-100", "$50 to $100", 50, 100},
+	{"100+", "$100 and more", 100, 0},
+}
+
+// ratingBuckets are cumulative: "4.0" counts every course rated 4 or more.
+var ratingBuckets = []float64{4.5, 4.0, 3.5, 3.0}
+
+// facetLimit caps the category and teacher facets to their largest buckets.
+const facetLimit = 20
+
+
+// GetSearchFacets counts the courses matching a search per category, price
+// bucket, rating bucket and teacher. The counts cover the whole result set,
+// not just the current page.
+func (s *Store) GetSearchFacets(params types.CourseSearchParams) (*types.SearchFacets, error) {
+	filter := newCourseFilter(params)
+	facets := &types.SearchFacets{}
+
+	var err error
+	facets.Categories, err = s.groupFacet(`SELECT cat.id::text, cat.name, COUNT(*)
+		FROM courses c JOIN categories cat ON c.category_id = cat.id`+filter.where+`
+		GROUP BY cat.id, cat.name`, filter.args)
+	if err != nil {
+		return nil, fmt.Errorf("could not count categories: %v", err)
+	}
+
+	facets.Teachers, err = s.groupFacet(`SELECT t.id::text, u.first_name || ' ' || u.last_name, COUNT(*)
+		FROM courses c JOIN teachers t ON c.teacher_id = t.id JOIN users u ON t.user_id = u.id`+filter.where+`
+		GROUP BY t.id, u.first_name, u.last_name`, filter.args)
+	if err != nil {
+		return nil, fmt.Errorf("could not count teachers: %v", err)
+	}
+
+	var counts []string
+	for _, bucket := range priceBuckets {
+		condition := fmt.Sprintf(`c.price >= %g`, bucket.min)
+		if bucket.max > 0 {
+			condition += fmt.Sprintf(` AND c.price < %g`, bucket.max)
+		}
+		counts = append(counts, `COUNT(*) FILTER (WHERE `+condition+`)`)
+	}
+	prices, err := s.countFacet(`SELECT `+strings.Join(counts, ", ")+` FROM courses c`+filter.where, filter.args, len(priceBuckets))
+	if err != nil {
+		return nil, fmt.Errorf("could not count prices: %v", err)
+	}
+	for i, bucket := range priceBuckets {
+		facets.Prices = append(facets.Prices, types.FacetBucket{Value: bucket.value, Label: bucket.label, Count: prices[i]})
+	}
+
+	counts = nil
+	for _, threshold := range ratingBuckets {
+		counts = append(counts, fmt.Sprintf(`COUNT(*) FILTER (WHERE rating >= %g)`, threshold))
+	}
+	ratings, err := s.countFacet(`SELECT `+strings.Join(counts, ", ")+`
+		FROM (SELECT `+ratingColumn+` AS rating FROM courses c`+filter.where+`) matched`, filter.args, len(ratingBuckets))
+	if err != nil {
+		return nil, fmt.Errorf("could not count ratings: %v", err)
+	}
+	for i, threshold := range ratingBuckets {
+		facets.Ratings = append(facets.Ratings, types.FacetBucket{
+			Value: fmt.Sprintf("%.1f", threshold),
+			Label: fmt.Sprintf("%.1f & up", threshold),
+			Count: ratings[i],
+		})
+	}
+
+	return facets, nil
+}
+
+
+// groupFacet runs a query returning value, label and count rows and keeps
+// the largest buckets.
+func (s *Store) groupFacet(query string, args []interface{}) ([]types.FacetBucket, error) {
+	query += fmt.Sprintf(` ORDER BY 3 DESC, 2 LIMIT %d`, facetLimit)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []types.FacetBucket{}
+	for rows.Next() {
+		var bucket types.FacetBucket
+		if err := rows.Scan(&bucket.Value, &bucket.Label, &bucket.Count); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+
+// countFacet runs a query returning a single row of n counts.
+func (s *Store) countFacet(query string, args []interface{}, n int) ([]int, error) {
+	counts := make([]int, n)
+	targets := make([]interface{}, n)
+	for i := range counts {
+		targets[i] = &counts[i]
+	}
+	if err := s.db.QueryRow(query, args...).Scan(targets...); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+
+// SUGGESTIONS
+
+// suggestQueries complete a partial query against each kind of entity.
+// Prefix matches come first, then the closest trigram matches, so both
+// "pyt" and "pyhton" find Python.
+var suggestQueries = map[string]string{
+	"courses": `SELECT c.id, c.name, c.slug FROM courses c
+		WHERE c.status = 'published' AND (c.name ILIKE $2 OR $1 <% c.name)
+		ORDER BY c.name ILIKE $2 DESC, word_similarity($1, c.name) DESC, c.id
+		LIMIT $3`,
+	"teachers": `SELECT t.id, u.first_name || ' ' || u.last_name, '' FROM teachers t
+		JOIN users u ON t.user_id = u.id
+		WHERE EXISTS (SELECT 1 FROM courses c WHERE c.teacher_id = t.id AND c.status = 'published')
+		  AND ((u.first_name || ' ' || u.last_name) ILIKE $2 OR u.last_name ILIKE $2 OR $1 <% (u.first_name || ' ' || u.last_name))
+		ORDER BY (u.first_name || ' ' || u.last_name) ILIKE $2 DESC, word_similarity($1, u.first_name || ' ' || u.last_name) DESC, t.id
+		LIMIT $3`,
+	"categories": `SELECT c.id, c.name, c.slug FROM categories c
+		WHERE c.name ILIKE $2 OR $1 <% c.name
+		ORDER BY c.name ILIKE $2 DESC, word_similarity($1, c.name) DESC, c.id
+		LIMIT $3`,
+	"tags": `SELECT t.id, t.name, t.slug FROM tags t
+		WHERE t.name ILIKE $2 OR $1 <% t.name
+		ORDER BY t.name ILIKE $2 DESC, word_similarity($1, t.name) DESC, t.id
+		LIMIT $3`,
+}
+
+
+// Suggest returns up to limit completions of term per entity kind.
+func (s *Store) Suggest(term string, limit int) (*types.SearchSuggestions, error) {
+	prefix := escapeLike(term) + "%"
+
+	lists := make(map[string][]types.Suggestion, len(suggestQueries))
+	for kind, query := range suggestQueries {
+		rows, err := s.db.Query(query, term, prefix, limit)
+		if err != nil {
+			return nil, fmt.Errorf("could not suggest %s: %v", kind, err)
+		}
+
+		suggestions := []types.Suggestion{}
+		for rows.Next() {
+			var suggestion types.Suggestion
+			if err := rows.Scan(&suggestion.ID, &suggestion.Name, &suggestion.Slug); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			suggestions = append(suggestions, suggestion)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		lists[kind] = suggestions
+	}
+
+	return &types.SearchSuggestions{
+		Courses:    lists["courses"],
+		Teachers:   lists["teachers"],
+		Categories: lists["categories"],
+		Tags:       lists["tags"],
+	}, nil
+}
+
+
+// escapeLike escapes LIKE wildcards in user input.
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(value)
+}
+
+
+// correctionThreshold is the lowest trigram similarity accepted when
+// replacing a misspelt word.
+const correctionThreshold = 0.3
+
+// SuggestCorrection rewrites term word by word, replacing words missing from
+// the catalog lexicon with the closest known word. It returns "" when
+// nothing could be corrected or the corrected query finds no courses either.
+func (s *Store) SuggestCorrection(term string) (string, error) {
+	words := strings.Fields(strings.ToLower(term))
+	corrected := false
+
+	for i, word := range words {
+		// Short words and operators such as "or" and "-term" are left alone
+		if len([]rune(word)) < 3 || strings.ContainsAny(word, `-"`) {
+			continue
+		}
+
+		var known bool
+		err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM search_lexicon WHERE word = $1)`, word).Scan(&known)
+		if err != nil {
+			return "", fmt.Errorf("could not look up word: %v", err)
+		}
+		if known {
+			continue
+		}
+
+		var replacement string
+		err = s.db.QueryRow(`SELECT word FROM search_lexicon
+			WHERE word % $1 AND similarity(word, $1) >= $2
+			ORDER BY similarity(word, $1) DESC, ndoc DESC, word
+			LIMIT 1`, word, correctionThreshold).Scan(&replacement)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not correct word: %v", err)
+		}
+
+		words[i] = replacement
+		corrected = true
+	}
+
+	if !corrected {
+		return "", nil
+	}
+
+	suggestion := strings.Join(words, " ")
+	var hits int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM courses c
+		WHERE c.status = 'published' AND c.search_vector @@ websearch_to_tsquery('`+searchConfig+`', $1)`,
+		suggestion).Scan(&hits)
+	if err != nil {
+		return "", err
+	}
+	if hits == 0 {
+		return "", nil
+	}
+	return suggestion, nil
+}
+
+
+// RefreshLexicon rebuilds the word list used for corrections from the
+// published catalog.
+func (s *Store) RefreshLexicon() error {
+	if _, err := s.db.Exec(`REFRESH MATERIALIZED VIEW CONCURRENTLY search_lexicon`); err != nil {
+		return fmt.Errorf("could not refresh search lexicon: %v", err)
+	}
+	return nil
+}
+
+
+// The Postgres backend indexes through triggers on the course tables, so
+// there is nothing to do when a course changes.
+
+func (s *Store) IndexCourse(courseID int) error {
+	return nil
+}
+
+
+func (s *Store) RemoveCourse(courseID int) error {
+	return nil
+}
+
+
+// IndexCategory and IndexTeacher have nothing to do either: triggers on
+// categories and users refresh the affected search vectors.
+func (s *Store) IndexCategory(categoryID int) error {
+	return nil
+}
+
+
+func (s *Store) IndexTeacher(teacherID int) error {
+	return nil
+}
+
+
+// Rebuild refreshes the correction lexicon; the full-text column itself is
+// kept current by triggers.
+func (s *Store) Rebuild() (int, error) {
+	if err := s.RefreshLexicon(); err != nil {
+		return 0, err
+	}
 
-	return courses, totalCourses, nil
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM courses WHERE status = 'published'`).Scan(&count)
+	return count, err
 }
@@ -0,0 +1,207 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Text analysis for the embedded index. It approximates what the "english"
+// configuration does in Postgres: lowercase words, drop stop words and strip
+// the most common suffixes, so "programming" and "programs" both match
+// "program".
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "how": true, "in": true,
+	"into": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "with": true, "your": true,
+	"you": true, "we": true, "will": true,
+}
+
+
+// words splits text into lowercase words of letters and digits.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+
+// stem strips a common English suffix when enough of the word is left.
+func stem(word string) string {
+	for _, suffix := range []string{"ational", "ations", "ation", "ings", "ing", "ness", "ers", "ies", "ed", "er", "es", "ly", "s"} {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= 3 {
+			word = strings.TrimSuffix(word, suffix)
+			switch {
+			case suffix == "ies":
+				word += "y"
+			case doubled(word) && (suffix == "ing" || suffix == "ings" || suffix == "ed" || suffix == "er" || suffix == "ers"):
+				// "programming" and "programmer" both become "program"
+				word = word[:len(word)-1]
+			}
+			return word
+		}
+	}
+	return word
+}
+
+
+// doubled reports whether word ends in a doubled consonant other than l, s
+// or z, which English keeps in words such as "install" and "class".
+func doubled(word string) bool {
+	n := len(word)
+	if n < 2 || word[n-1] != word[n-2] {
+		return false
+	}
+	return !strings.ContainsRune("aeioulsz", rune(word[n-1]))
+}
+
+
+// terms analyses text into the stems stored in and looked up from the index.
+func terms(text string) []string {
+	var out []string
+	for _, word := range words(text) {
+		if !stopWords[word] {
+			out = append(out, stem(word))
+		}
+	}
+	return out
+}
+
+
+// parsedQuery is a search in the websearch_to_tsquery style: every included
+// term must match and no excluded term may. Quotes are accepted but phrases
+// are matched as separate terms.
+type parsedQuery struct {
+	include []string
+	exclude []string
+}
+
+
+func parseQuery(query string) parsedQuery {
+	var parsed parsedQuery
+	for _, field := range strings.Fields(strings.ReplaceAll(query, `"`, " ")) {
+		if strings.EqualFold(field, "or") {
+			continue
+		}
+		if strings.HasPrefix(field, "-") {
+			parsed.exclude = append(parsed.exclude, terms(field[1:])...)
+			continue
+		}
+		parsed.include = append(parsed.include, terms(field)...)
+	}
+	return parsed
+}
+
+
+// trigrams returns the padded character trigrams of a word, as pg_trgm
+// builds them.
+func trigrams(word string) map[string]bool {
+	runes := []rune("  " + strings.ToLower(word) + " ")
+	grams := make(map[string]bool, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])] = true
+	}
+	return grams
+}
+
+
+// similarity is the share of trigrams two words have in common, the same
+// measure as pg_trgm's similarity().
+func similarity(a, b string) float64 {
+	ga, gb := trigrams(a), trigrams(b)
+	shared := 0
+	for gram := range ga {
+		if gb[gram] {
+			shared++
+		}
+	}
+	total := len(ga) + len(gb) - shared
+	if total == 0 {
+		return 0
+	}
+	return float64(shared) / float64(total)
+}
+
+
+// wordSimilarity scores how well term matches the closest word of text,
+// roughly pg_trgm's word_similarity().
+func wordSimilarity(term, text string) float64 {
+	best := 0.0
+	for _, word := range words(text) {
+		if score := similarity(term, word); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+
+// highlight HTML escapes text and wraps the words whose stem is in matched
+// in <mark> tags.
+func highlight(text string, matched map[string]bool) string {
+	var out strings.Builder
+	start := -1
+	flush := func(end int) {
+		word := html.EscapeString(text[start:end])
+		if matched[stem(strings.ToLower(text[start:end]))] {
+			out.WriteString("<mark>" + word + "</mark>")
+		} else {
+			out.WriteString(word)
+		}
+		start = -1
+	}
+
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			flush(i)
+		}
+		out.WriteString(html.EscapeString(string(r)))
+	}
+	if start >= 0 {
+		flush(len(text))
+	}
+	return out.String()
+}
+
+
+// snippet returns up to size words of text starting a few words before the
+// first match, HTML escaped and with matches highlighted.
+func snippet(text string, matched map[string]bool, size int) string {
+	fields := strings.Fields(text)
+	first := 0
+search:
+	for i, field := range fields {
+		for _, word := range words(field) {
+			if matched[stem(word)] {
+				first = i
+				break search
+			}
+		}
+	}
+
+	begin := first - 5
+	if begin < 0 {
+		begin = 0
+	}
+	end := begin + size
+	if end > len(fields) {
+		end = len(fields)
+	}
+
+	out := highlight(strings.Join(fields[begin:end], " "), matched)
+	if begin > 0 {
+		out = "... " + out
+	}
+	if end < len(fields) {
+		out += " ..."
+	}
+	return out
+}
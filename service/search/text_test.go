@@ -0,0 +1,80 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"programming", "program"},
+		{"programmer", "program"},
+		{"programs", "program"},
+		{"libraries", "library"},
+		{"installing", "install"},
+		{"classes", "class"},
+		{"go", "go"},
+		{"is", "is"},
+	}
+	for _, test := range tests {
+		if got := stem(test.word); got != test.want {
+			t.Errorf("stem(%q) = %q, want %q", test.word, got, test.want)
+		}
+	}
+}
+
+
+func TestTermsDropsStopWords(t *testing.T) {
+	got := terms("Learn the Basics of Go-Programming")
+	want := []string{"learn", "basic", "go", "program"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("terms = %q, want %q", got, want)
+	}
+}
+
+
+func TestParseQuery(t *testing.T) {
+	got := parseQuery(`"web servers" or golang -python`)
+	if want := []string{"web", "serv", "golang"}; !reflect.DeepEqual(got.include, want) {
+		t.Errorf("include = %q, want %q", got.include, want)
+	}
+	if want := []string{"python"}; !reflect.DeepEqual(got.exclude, want) {
+		t.Errorf("exclude = %q, want %q", got.exclude, want)
+	}
+}
+
+
+func TestSimilarity(t *testing.T) {
+	if got := similarity("golang", "golang"); got != 1 {
+		t.Errorf("similarity of equal words = %v, want 1", got)
+	}
+	if got := similarity("golang", "golng"); got <= correctionThreshold || got >= 1 {
+		t.Errorf("similarity of a typo = %v, want between %v and 1", got, correctionThreshold)
+	}
+	if got := similarity("golang", "kotlin"); got >= correctionThreshold {
+		t.Errorf("similarity of unrelated words = %v, want below %v", got, correctionThreshold)
+	}
+}
+
+
+func TestHighlightEscapesHTML(t *testing.T) {
+	matched := map[string]bool{"script": true}
+	got := highlight(`Learn <script>alert("x")</script> & more`, matched)
+	want := `Learn &lt;<mark>script</mark>&gt;alert(&#34;x&#34;)&lt;/<mark>script</mark>&gt; &amp; more`
+	if got != want {
+		t.Errorf("highlight = %q, want %q", got, want)
+	}
+}
+
+
+func TestSnippet(t *testing.T) {
+	text := "one two three four five six seven eight golang nine ten eleven twelve"
+	got := snippet(text, map[string]bool{"golang": true}, 6)
+	want := "... four five six seven eight <mark>golang</mark> ..."
+	if got != want {
+		t.Errorf("snippet = %q, want %q", got, want)
+	}
+}
@@ -1,13 +1,16 @@
 package student
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/sikozonpc/ecom/service/auth"
 	"github.com/sikozonpc/ecom/types"
 	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
 )
 
 type Handler struct {
@@ -31,6 +34,12 @@ func (h *Handler) StudentRoutes(router *mux.Router) {
 	
 	router.HandleFunc("/student/learning", auth.WithJWTAuth(h.studentLearning, h.store, usersOnly)).Methods(http.MethodGet)
 	router.HandleFunc("/student/learning/{slug}", auth.WithJWTAuth(h.studentLearningDetail, h.store, usersOnly)).Methods(http.MethodGet)
+
+	// lecture and learning path progress
+	router.HandleFunc("/student/learning/{slug}/videos/{id}/complete", auth.WithJWTAuth(h.completeLecture, h.store, usersOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/student/learning/{slug}/videos/{id}/complete", auth.WithJWTAuth(h.uncompleteLecture, h.store, usersOnly)).Methods(http.MethodDelete)
+	router.HandleFunc("/student/paths", auth.WithJWTAuth(h.studentPaths, h.store, usersOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/student/paths/{slug}", auth.WithJWTAuth(h.studentPathDetail, h.store, usersOnly)).Methods(http.MethodGet)
 }
 
 
@@ -41,8 +50,18 @@ func (h *Handler) studentLearning(writer http.ResponseWriter, request *http.Requ
         return
     }
 
-	courses, err := h.student.GetEnrolledCourses(studentID)
+	params, err := pagination.FromRequest(request, "student_learning", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	courses, err := h.student.GetEnrolledCourses(studentID, params)
 	if err!= nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
         utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to get enrolled courses: %v", err))
         return
     }
@@ -76,4 +95,92 @@ func (h *Handler) studentLearningDetail(writer http.ResponseWriter, request *htt
 	}
 
 	utils.WriteJSON(writer, http.StatusOK, courseData)
-}
\ No newline at end of file
+}
+
+
+
+func (h *Handler) completeLecture(writer http.ResponseWriter, request *http.Request) {
+	h.setLectureComplete(writer, request, true)
+}
+
+
+func (h *Handler) uncompleteLecture(writer http.ResponseWriter, request *http.Request) {
+	h.setLectureComplete(writer, request, false)
+}
+
+
+func (h *Handler) setLectureComplete(writer http.ResponseWriter, request *http.Request, done bool) {
+	studentID, err := auth.GetStudentIDFromToken(request)
+	if err != nil {
+		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("unauthorized access"))
+		return
+	}
+
+	vars := mux.Vars(request)
+	videoID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid video ID: %s", vars["id"]))
+		return
+	}
+
+	if err := h.student.SetLectureComplete(studentID, vars["slug"], videoID, done); err != nil {
+		if errors.Is(err, ErrLectureNotFound) {
+			utils.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"video_id":  videoID,
+		"completed": done,
+	}
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+func (h *Handler) studentPaths(writer http.ResponseWriter, request *http.Request) {
+	studentID, err := auth.GetStudentIDFromToken(request)
+	if err != nil {
+		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("unauthorized access"))
+		return
+	}
+
+	params, err := pagination.FromRequest(request, "student_paths", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	paths, err := h.student.GetPathsProgress(studentID, params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to get learning paths: %v", err))
+		return
+	}
+	utils.WriteJSON(writer, http.StatusOK, paths)
+}
+
+
+func (h *Handler) studentPathDetail(writer http.ResponseWriter, request *http.Request) {
+	studentID, err := auth.GetStudentIDFromToken(request)
+	if err != nil {
+		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("unauthorized access"))
+		return
+	}
+
+	path, err := h.student.GetPathProgress(studentID, mux.Vars(request)["slug"])
+	if err != nil {
+		if errors.Is(err, ErrPathNotFound) {
+			utils.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to get learning path progress: %v", err))
+		return
+	}
+	utils.WriteJSON(writer, http.StatusOK, path)
+}
@@ -2,9 +2,13 @@ package student
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"time"
 
-
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils/pagination"
 )
 
 type Store struct {
@@ -17,22 +21,37 @@ func NewStore(db *sql.DB) *Store {
 }
 
 
-func (s *Store) GetEnrolledCourses(studentID int) ([]map[string]interface{}, error) {
+// enrollmentKeyset lists the most recently enrolled courses first.
+var enrollmentKeyset = pagination.Keyset{Columns: []string{"e.enrolled_at", "c.id"}, Desc: true}
+
+func enrollmentKey(course map[string]interface{}) []interface{} {
+	return []interface{}{course["enrolled_at"], course["id"]}
+}
+
+
+func (s *Store) GetEnrolledCourses(studentID int, params pagination.Params) (pagination.Page[map[string]interface{}], error) {
+	var page pagination.Page[map[string]interface{}]
 	var courses []map[string]interface{}
 
+	cursor, args, err := enrollmentKeyset.Where(params, []interface{}{studentID})
+	if err != nil {
+		return page, err
+	}
+	order, args := enrollmentKeyset.OrderBy(params, args)
+
 	query := `
 	SELECT c.id, c.teacher_id, c.name, c.slug, 
 	       c.description, c.image, 
-	       u.first_name, u.last_name
+	       u.first_name, u.last_name, e.enrolled_at
 	FROM enrollments e
 	JOIN courses c ON e.course_id = c.id
 	JOIN teachers t ON c.teacher_id = t.id
 	JOIN users u ON t.user_id = u.id
-	WHERE e.student_id = $1`
+	WHERE e.student_id = $1` + cursor + order
 
-	rows, err := s.db.Query(query, studentID)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("could not fetch enrolled courses: %v", err)
+		return page, fmt.Errorf("could not fetch enrolled courses: %v", err)
 	}
 	defer rows.Close()
 
@@ -46,6 +65,7 @@ func (s *Store) GetEnrolledCourses(studentID int) ([]map[string]interface{}, err
 			image       sql.NullString
 			firstName   string
 			lastName    string
+			enrolledAt  time.Time
 		)
 
 		if err := rows.Scan(
@@ -57,8 +77,9 @@ func (s *Store) GetEnrolledCourses(studentID int) ([]map[string]interface{}, err
 			&image,
 			&firstName,
 			&lastName,
+			&enrolledAt,
 		); err != nil {
-			return nil, fmt.Errorf("could not scan course data: %v", err)
+			return page, fmt.Errorf("could not scan course data: %v", err)
 		}
 
 		courseData := map[string]interface{}{
@@ -69,16 +90,17 @@ func (s *Store) GetEnrolledCourses(studentID int) ([]map[string]interface{}, err
 			"description": description,
 			"image":       image.String,
 			"instructor":  fmt.Sprintf("%s %s", firstName, lastName),
+			"enrolled_at": enrolledAt,
 		}
 
 		courses = append(courses, courseData)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %v", err)
+		return page, fmt.Errorf("row iteration error: %v", err)
 	}
 
-	return courses, nil
+	return pagination.NewPage(courses, params, enrollmentKey), nil
 }
 
 
@@ -170,10 +192,11 @@ func (s *Store) GetEnrolledCourseSectionsAndVideos(courseID int) ([]map[string]i
 	var sections []map[string]interface{}
 
 	query := `
-	SELECT s.id, s.title, v.id, v.title, COALESCE(v.video_file, '') as video_url
+	SELECT s.id, s.title, s."order", v.id, v.title, COALESCE(v.video_file, '') as video_url, v."order"
 	FROM sections s
 	LEFT JOIN videos v ON s.id = v.section_id
 	WHERE s.course_id = $1
+	ORDER BY s."order", s.id, v."order", v.id
 	`
 
 	rows, err := s.db.Query(query, courseID)
@@ -182,40 +205,229 @@ func (s *Store) GetEnrolledCourseSectionsAndVideos(courseID int) ([]map[string]i
     }
 	defer rows.Close()
 
-	sectionMap := make(map[int]map[string]interface{})
+	// Rows arrive sorted, so the sections are built up in order
+	sectionIndex := make(map[int]int)
 
 	for rows.Next() {
 		var sectionID int
         var title string
-        var videoID int
-        var videoTitle string
+        var order int
+        var videoID sql.NullInt64
+        var videoTitle sql.NullString
         var videoURL sql.NullString
+        var videoOrder sql.NullInt64
 
-		err := rows.Scan(&sectionID, &title, &videoID, &videoTitle, &videoURL)
+		err := rows.Scan(&sectionID, &title, &order, &videoID, &videoTitle, &videoURL, &videoOrder)
         if err!= nil {
             return nil, fmt.Errorf("failed to scan row: %v", err)
         }
 
-		if _, exists := sectionMap[sectionID]; !exists {
-			sectionMap[sectionID] = map[string]interface{}{
+		index, exists := sectionIndex[sectionID]
+		if !exists {
+			index = len(sections)
+			sectionIndex[sectionID] = index
+			sections = append(sections, map[string]interface{}{
 				"id":   sectionID,
                 "title": title,
+                "order": order,
                 "videos": []map[string]interface{}{},
-			}
+			})
 		}
 
-		if videoURL.Valid {
-            sectionMap[sectionID]["videos"] = append(sectionMap[sectionID]["videos"].([]map[string]interface{}), map[string]interface{}{
-                "id": videoID,
-                "title": videoTitle,
+		if videoID.Valid {
+            sections[index]["videos"] = append(sections[index]["videos"].([]map[string]interface{}), map[string]interface{}{
+                "id": videoID.Int64,
+                "title": videoTitle.String,
                 "file": videoURL.String,
+                "order": videoOrder.Int64,
             })
         }
 	}
 
-	for _, section := range sectionMap {
-		sections = append(sections, section)
+	return sections, nil
+}
+
+
+
+// LEARNING PROGRESS
+
+var ErrLectureNotFound = errors.New("lecture not found in an enrolled course")
+var ErrPathNotFound = errors.New("learning path not found")
+
+// SetLectureComplete marks a lecture of an enrolled course as finished, or
+// clears the mark when done is false.
+func (s *Store) SetLectureComplete(studentID int, slug string, videoID int, done bool) error {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS(
+		SELECT 1 FROM videos v
+		JOIN sections s ON v.section_id = s.id
+		JOIN courses c ON s.course_id = c.id
+		JOIN enrollments e ON e.course_id = c.id
+		WHERE v.id = $1 AND c.slug = $2 AND e.student_id = $3)`, videoID, slug, studentID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("could not check lecture: %v", err)
+	}
+	if !exists {
+		return ErrLectureNotFound
 	}
 
-	return sections, nil
-}
\ No newline at end of file
+	if done {
+		_, err = s.db.Exec(`INSERT INTO lecture_progress (student_id, video_id, completed_at) VALUES ($1, $2, NOW())
+			ON CONFLICT (student_id, video_id) DO NOTHING`, studentID, videoID)
+	} else {
+		_, err = s.db.Exec(`DELETE FROM lecture_progress WHERE student_id = $1 AND video_id = $2`, studentID, videoID)
+	}
+	if err != nil {
+		return fmt.Errorf("could not update lecture progress: %v", err)
+	}
+	return nil
+}
+
+
+// pathKeyset lists learning paths by title.
+var pathKeyset = pagination.Keyset{Columns: []string{"p.title", "p.id"}}
+
+func pathKey(path types.PathProgress) []interface{} {
+	return []interface{}{path.Title, path.PathID}
+}
+
+
+// GetPathsProgress reports progress on every learning path that contains at
+// least one course the student is enrolled in.
+func (s *Store) GetPathsProgress(studentID int, params pagination.Params) (pagination.Page[types.PathProgress], error) {
+	var page pagination.Page[types.PathProgress]
+
+	cursor, args, err := pathKeyset.Where(params, []interface{}{studentID})
+	if err != nil {
+		return page, err
+	}
+	order, args := pathKeyset.OrderBy(params, args)
+
+	rows, err := s.db.Query(`SELECT DISTINCT p.id, p.title, p.slug
+		FROM learning_paths p
+		JOIN learning_path_courses lpc ON lpc.path_id = p.id
+		JOIN enrollments e ON e.course_id = lpc.course_id
+		WHERE e.student_id = $1`+cursor+order, args...)
+	if err != nil {
+		return page, fmt.Errorf("could not fetch learning paths: %v", err)
+	}
+	defer rows.Close()
+
+	paths := []types.PathProgress{}
+	for rows.Next() {
+		var path types.PathProgress
+		if err := rows.Scan(&path.PathID, &path.Title, &path.Slug); err != nil {
+			return page, err
+		}
+		paths = append(paths, path)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	page = pagination.NewPage(paths, params, pathKey)
+	for i := range page.Data {
+		if err := s.fillPathProgress(&page.Data[i], studentID); err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+
+func (s *Store) GetPathProgress(studentID int, slug string) (*types.PathProgress, error) {
+	var path types.PathProgress
+	err := s.db.QueryRow(`SELECT id, title, slug FROM learning_paths WHERE slug = $1`, slug).Scan(
+		&path.PathID,
+		&path.Title,
+		&path.Slug,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPathNotFound
+		}
+		return nil, fmt.Errorf("could not fetch learning path: %v", err)
+	}
+
+	if err := s.fillPathProgress(&path, studentID); err != nil {
+		return nil, err
+	}
+	return &path, nil
+}
+
+
+// fillPathProgress loads the courses of a path with the student's progress
+// in each and rolls them up. A course counts as completed once every lecture
+// in it is marked as finished.
+func (s *Store) fillPathProgress(path *types.PathProgress, studentID int) error {
+	rows, err := s.db.Query(`SELECT lpc.position, c.id, c.name, c.slug, COALESCE(c.image, ''), c.price,
+			c.lecture_count, c.total_duration,
+			EXISTS(SELECT 1 FROM enrollments e WHERE e.course_id = c.id AND e.student_id = $2),
+			(SELECT COUNT(*) FROM lecture_progress lp
+			 JOIN videos v ON lp.video_id = v.id
+			 JOIN sections s ON v.section_id = s.id
+			 WHERE s.course_id = c.id AND lp.student_id = $2)
+		FROM learning_path_courses lpc
+		JOIN courses c ON lpc.course_id = c.id
+		WHERE lpc.path_id = $1 AND c.status = 'published'
+		ORDER BY lpc.position`, path.PathID, studentID)
+	if err != nil {
+		return fmt.Errorf("could not fetch path progress: %v", err)
+	}
+	defer rows.Close()
+
+	path.Courses = []types.PathCourseProgress{}
+	for rows.Next() {
+		var course types.PathCourseProgress
+		err := rows.Scan(
+			&course.Position,
+			&course.CourseID,
+			&course.Name,
+			&course.Slug,
+			&course.Image,
+			&course.Price,
+			&course.LectureCount,
+			&course.TotalDuration,
+			&course.Enrolled,
+			&course.CompletedLectures,
+		)
+		if err != nil {
+			return err
+		}
+
+		// Lectures deleted after being finished no longer count
+		if course.CompletedLectures > course.LectureCount {
+			course.CompletedLectures = course.LectureCount
+		}
+		if course.LectureCount > 0 {
+			course.Percent = percent(course.CompletedLectures, course.LectureCount)
+			course.Completed = course.Enrolled && course.CompletedLectures == course.LectureCount
+		}
+
+		path.Courses = append(path.Courses, course)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	path.TotalCourses = len(path.Courses)
+	for i, course := range path.Courses {
+		path.TotalLectures += course.LectureCount
+		path.CompletedLectures += course.CompletedLectures
+		if course.Completed {
+			path.CompletedCourses++
+		} else if path.NextCourse == nil {
+			path.NextCourse = &path.Courses[i].LearningPathCourse
+		}
+	}
+	path.Percent = percent(path.CompletedLectures, path.TotalLectures)
+	return nil
+}
+
+
+func percent(done, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(done)*1000/float64(total)) / 10
+}
@@ -0,0 +1,154 @@
+package teacher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/sikozonpc/ecom/service/archive"
+	"github.com/sikozonpc/ecom/service/auth"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+)
+
+// maxArchiveSize caps uploaded course archives. Media is referenced rather
+// than embedded, so real archives are small.
+const maxArchiveSize = 32 << 20
+
+func (h *Handler) exportCourseHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	query := request.URL.Query()
+	format, err := archive.ParseFormat(query.Get("format"))
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	manifest, err := archive.ParseManifest(query.Get("manifest"))
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if manifest != archive.ManifestNone && format != archive.FormatZIP {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("manifests are only included in zip archives"))
+		return
+	}
+
+	exported, err := h.teacher.ExportCourse(course.ID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("could not export course: %v", err))
+		return
+	}
+
+	// Encode up front so a failure can still produce an error response
+	var buf bytes.Buffer
+	if err := archive.Write(&buf, exported, format, manifest); err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	contentType := "application/zip"
+	if format == archive.FormatJSON {
+		contentType = "application/json"
+	}
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", archive.Filename(exported, format)))
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(buf.Bytes())
+}
+
+
+// readArchiveUpload returns the uploaded archive, sent either as the raw
+// request body or as the "archive" field of a multipart form.
+func readArchiveUpload(writer http.ResponseWriter, request *http.Request) ([]byte, error) {
+	request.Body = http.MaxBytesReader(writer, request.Body, maxArchiveSize)
+
+	if err := request.ParseMultipartForm(maxArchiveSize); err == nil {
+		file, _, err := request.FormFile("archive")
+		if err != nil {
+			return nil, fmt.Errorf("missing archive file: %v", err)
+		}
+		defer file.Close()
+		return io.ReadAll(file)
+	} else if err != http.ErrNotMultipart {
+		return nil, err
+	}
+
+	return io.ReadAll(request.Body)
+}
+
+
+func (h *Handler) importCourseHandle(writer http.ResponseWriter, request *http.Request) {
+	teacher := h.getTeacher(writer, request)
+	if teacher == nil {
+		return
+	}
+
+	query := request.URL.Query()
+	categoryID := 0
+	if value := query.Get("category_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid category ID: %s", value))
+			return
+		}
+		categoryID = id
+	}
+
+	opts, err := archive.ParseImportOptions(teacher.ID, categoryID, query.Get("slug_conflict"), query.Get("category_conflict"))
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	// The taxonomy is admin-managed, so teachers can only import into
+	// existing categories
+	if opts.Categories == types.CategoryConflictCreate && auth.GetUserRoleFromContext(request.Context()) != types.ADMIN {
+		auth.PermissionDenied(writer, "only admins can create categories")
+		return
+	}
+
+	data, err := readArchiveUpload(writer, request)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("could not read archive: %v", err))
+		return
+	}
+
+	imported, err := archive.Read(data)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	course, jobs, err := h.teacher.ImportCourse(imported, opts)
+	if err != nil {
+		if errors.Is(err, ErrSlugConflict) {
+			utils.WriteError(writer, http.StatusConflict, err)
+			return
+		}
+		if errors.Is(err, ErrCategoryNotFound) {
+			utils.WriteError(writer, http.StatusUnprocessableEntity, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("could not import course: %v", err))
+		return
+	}
+
+	for _, job := range jobs {
+		h.enqueueTranscode(&types.Video{ID: job.VideoID, VideoFile: job.VideoFile})
+	}
+
+	response := map[string]interface{}{
+		"message": "Course imported successfully",
+		"course":  course,
+		"media":   imported.Media,
+	}
+
+	utils.WriteJSON(writer, http.StatusCreated, response)
+}
@@ -0,0 +1,222 @@
+package teacher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+)
+
+// Categories form one global taxonomy managed by admins. Teachers pick from
+// it when creating a course.
+
+// buildCategoryTree nests a flat category list under its parents. Course
+// counts are rolled up so each node counts its whole subtree.
+func buildCategoryTree(categories []types.Category) []types.Category {
+	children := make(map[int][]types.Category)
+	var roots []types.Category
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var attach func(category *types.Category) int
+	attach = func(category *types.Category) int {
+		total := category.CourseCount
+		for _, child := range children[category.ID] {
+			total += attach(&child)
+			category.Children = append(category.Children, child)
+		}
+		category.CourseCount = total
+		return total
+	}
+
+	for i := range roots {
+		attach(&roots[i])
+	}
+	return roots
+}
+
+
+func (h *Handler) getCategoriesHandle(writer http.ResponseWriter, request *http.Request) {
+	categories, err := h.teacher.GetCategory()
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	// ?flat=true returns the list without nesting, handy for pickers
+	if request.URL.Query().Get("flat") == "true" {
+		utils.WriteJSON(writer, http.StatusOK, categories)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, buildCategoryTree(categories))
+}
+
+
+// writeCategoryError maps taxonomy errors onto HTTP statuses.
+func writeCategoryError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrCategoryNotFound):
+		utils.WriteError(writer, http.StatusNotFound, err)
+	case errors.Is(err, ErrDuplicateCategory), errors.Is(err, ErrCategoryInUse):
+		utils.WriteError(writer, http.StatusConflict, err)
+	case errors.Is(err, ErrCategoryCycle):
+		utils.WriteError(writer, http.StatusBadRequest, err)
+	default:
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+	}
+}
+
+
+func (h *Handler) getCategoryFromRequest(writer http.ResponseWriter, request *http.Request) *types.Category {
+	vars := mux.Vars(request)
+	categoryID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid category ID: %s", vars["id"]))
+		return nil
+	}
+
+	category, err := h.teacher.GetCategoryByID(categoryID)
+	if err != nil {
+		writeCategoryError(writer, err)
+		return nil
+	}
+	return category
+}
+
+
+func (h *Handler) createCategoryHandle(writer http.ResponseWriter, request *http.Request) {
+	var payload types.CreateCategoryPayload
+
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	category := &types.Category{
+		ParentID:    payload.ParentID,
+		Name:        payload.Name,
+		Description: payload.Description,
+	}
+
+	if err := h.teacher.CreateCategory(category); err != nil {
+		writeCategoryError(writer, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":  "Category created successfully",
+		"category": category,
+	}
+
+	utils.WriteJSON(writer, http.StatusCreated, response)
+}
+
+
+func (h *Handler) editCategoryHandle(writer http.ResponseWriter, request *http.Request) {
+	category := h.getCategoryFromRequest(writer, request)
+	if category == nil {
+		return
+	}
+
+	var payload types.UpdateCategoryPayload
+
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(payload.ParentID) > 0 {
+		var parentID *int
+		if err := json.Unmarshal(payload.ParentID, &parentID); err != nil {
+			utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid parent_id"))
+			return
+		}
+		category.ParentID = parentID
+	}
+	category.Name = payload.Name
+	category.Description = payload.Description
+	category.Slug = utils.Slugify(payload.Name, category.ID)
+
+	if err := h.teacher.UpdateCategory(category); err != nil {
+		writeCategoryError(writer, err)
+		return
+	}
+	h.reindexCategory(category.ID)
+
+	response := map[string]interface{}{
+		"message":  "Category updated successfully",
+		"category": category,
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+func (h *Handler) deleteCategoryHandle(writer http.ResponseWriter, request *http.Request) {
+	category := h.getCategoryFromRequest(writer, request)
+	if category == nil {
+		return
+	}
+
+	if err := h.teacher.DeleteCategory(category.ID); err != nil {
+		writeCategoryError(writer, err)
+		return
+	}
+
+	response := map[string]string{"message": "Category deleted successfully"}
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+func (h *Handler) mergeCategoryHandle(writer http.ResponseWriter, request *http.Request) {
+	source := h.getCategoryFromRequest(writer, request)
+	if source == nil {
+		return
+	}
+
+	var payload types.MergeCategoryPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	moved, err := h.teacher.MergeCategory(source.ID, payload.TargetID)
+	if err != nil {
+		writeCategoryError(writer, err)
+		return
+	}
+	h.reindexCategory(source.ID)
+
+	response := map[string]interface{}{
+		"message":       fmt.Sprintf("Category %q merged successfully", source.Name),
+		"target_id":     payload.TargetID,
+		"courses_moved": moved,
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
@@ -0,0 +1,261 @@
+package teacher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sikozonpc/ecom/service/auth"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+// cloneCourse copies source into a new draft for teacher and writes the
+// response. When the payload names no category, the source category is kept.
+func (h *Handler) cloneCourse(writer http.ResponseWriter, source *types.Course, teacher *types.Teacher, payload types.CloneCoursePayload) {
+	name := payload.Name
+	if name == "" {
+		name = source.Name + " (Copy)"
+	}
+
+	categoryID := payload.CategoryID
+	if categoryID == 0 {
+		categoryID = source.CategoryID
+	}
+
+	if _, err := h.teacher.GetCategoryByID(categoryID); err != nil {
+		writeCategoryError(writer, err)
+		return
+	}
+
+	course, jobs, err := h.teacher.CloneCourse(source.ID, teacher.ID, name, categoryID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("could not clone course: %v", err))
+		return
+	}
+
+	for _, job := range jobs {
+		h.enqueueTranscode(&types.Video{ID: job.VideoID, VideoFile: job.VideoFile})
+	}
+
+	response := map[string]interface{}{
+		"message": "Course cloned successfully",
+		"course":  course,
+	}
+
+	utils.WriteJSON(writer, http.StatusCreated, response)
+}
+
+
+// getTeacher loads the teacher profile of the logged-in user. It writes the
+// error response itself and returns nil when the request should stop.
+func (h *Handler) getTeacher(writer http.ResponseWriter, request *http.Request) *types.Teacher {
+	userID, err := auth.GetTeacherIDFromToken(request)
+	if err != nil {
+		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+		return nil
+	}
+
+	teacher, err := h.teacher.GetTeacherByUserID(userID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("teacher not found for this user"))
+		return nil
+	}
+	return teacher
+}
+
+
+func parseClonePayload(writer http.ResponseWriter, request *http.Request) (types.CloneCoursePayload, bool) {
+	var payload types.CloneCoursePayload
+
+	// The body is optional; an empty one keeps every default
+	if request.ContentLength != 0 {
+		if err := utils.ParseJSON(request, &payload); err != nil {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return payload, false
+		}
+	}
+	return payload, true
+}
+
+
+func (h *Handler) cloneCourseHandle(writer http.ResponseWriter, request *http.Request) {
+	source := h.getOwnedCourse(writer, request)
+	if source == nil {
+		return
+	}
+
+	teacher := h.getTeacher(writer, request)
+	if teacher == nil {
+		return
+	}
+
+	payload, ok := parseClonePayload(writer, request)
+	if !ok {
+		return
+	}
+
+	h.cloneCourse(writer, source, teacher, payload)
+}
+
+
+func (h *Handler) getTemplatesHandle(writer http.ResponseWriter, request *http.Request) {
+	params, err := pagination.FromRequest(request, "templates", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	templates, err := h.teacher.GetTemplates(params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, templates)
+}
+
+
+func (h *Handler) getTemplateFromRequest(writer http.ResponseWriter, request *http.Request) *types.CourseTemplate {
+	vars := mux.Vars(request)
+	templateID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid template ID: %s", vars["id"]))
+		return nil
+	}
+
+	template, err := h.teacher.GetTemplateByID(templateID)
+	if err != nil {
+		if err == ErrTemplateNotFound {
+			utils.WriteError(writer, http.StatusNotFound, err)
+			return nil
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return nil
+	}
+	return template
+}
+
+
+func (h *Handler) useTemplateHandle(writer http.ResponseWriter, request *http.Request) {
+	template := h.getTemplateFromRequest(writer, request)
+	if template == nil {
+		return
+	}
+
+	teacher := h.getTeacher(writer, request)
+	if teacher == nil {
+		return
+	}
+
+	payload, ok := parseClonePayload(writer, request)
+	if !ok {
+		return
+	}
+	if payload.Name == "" {
+		payload.Name = template.Title
+	}
+
+	source, err := h.teacher.GetCourseByID(template.CourseID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusNotFound, fmt.Errorf("template course not found"))
+		return
+	}
+
+	h.cloneCourse(writer, source, teacher, payload)
+}
+
+
+// ADMIN TEMPLATES
+
+func (h *Handler) createTemplateHandle(writer http.ResponseWriter, request *http.Request) {
+	var payload types.CreateTemplatePayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.teacher.GetCourseByID(payload.CourseID); err != nil {
+		utils.WriteError(writer, http.StatusNotFound, fmt.Errorf("course not found"))
+		return
+	}
+
+	template := &types.CourseTemplate{
+		CourseID:    payload.CourseID,
+		Title:       payload.Title,
+		Description: payload.Description,
+		CreatedBy:   auth.GetUserIDFromContext(request.Context()),
+	}
+
+	if err := h.teacher.CreateTemplate(template); err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":  "Template created successfully",
+		"template": template,
+	}
+
+	utils.WriteJSON(writer, http.StatusCreated, response)
+}
+
+
+func (h *Handler) editTemplateHandle(writer http.ResponseWriter, request *http.Request) {
+	template := h.getTemplateFromRequest(writer, request)
+	if template == nil {
+		return
+	}
+
+	var payload types.UpdateTemplatePayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	template.Title = payload.Title
+	template.Description = payload.Description
+
+	if err := h.teacher.UpdateTemplate(template); err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":  "Template updated successfully",
+		"template": template,
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+func (h *Handler) deleteTemplateHandle(writer http.ResponseWriter, request *http.Request) {
+	template := h.getTemplateFromRequest(writer, request)
+	if template == nil {
+		return
+	}
+
+	if err := h.teacher.DeleteTemplate(template.ID); err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]string{"message": "Template deleted successfully"}
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
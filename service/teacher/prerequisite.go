@@ -0,0 +1,85 @@
+package teacher
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+)
+
+// writePrerequisiteError maps the prerequisite store errors to HTTP statuses.
+func writePrerequisiteError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrCourseNotFound):
+		utils.WriteError(writer, http.StatusNotFound, err)
+	case errors.Is(err, ErrInvalidPrerequisite), errors.Is(err, ErrPrerequisiteCycle):
+		utils.WriteError(writer, http.StatusBadRequest, err)
+	default:
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+	}
+}
+
+
+func (h *Handler) getPrerequisitesHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	prerequisites, err := h.teacher.GetPrerequisites(course.ID)
+	if err != nil {
+		writePrerequisiteError(writer, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, prerequisites)
+}
+
+
+// setPrerequisitesHandle replaces the prerequisite list of a course. The
+// policy is kept when the payload leaves it out.
+func (h *Handler) setPrerequisitesHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	var payload types.SetPrerequisitesPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	current, err := h.teacher.GetPrerequisites(course.ID)
+	if err != nil {
+		writePrerequisiteError(writer, err)
+		return
+	}
+	policy := payload.Policy
+	if policy == "" {
+		policy = current.Policy
+	}
+
+	if err := h.teacher.SetPrerequisites(course.ID, payload.CourseIDs, policy); err != nil {
+		writePrerequisiteError(writer, err)
+		return
+	}
+
+	prerequisites, err := h.teacher.GetPrerequisites(course.ID)
+	if err != nil {
+		writePrerequisiteError(writer, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":       "Prerequisites updated successfully",
+		"prerequisites": prerequisites,
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
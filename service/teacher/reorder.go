@@ -0,0 +1,247 @@
+package teacher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+)
+
+var ErrInvalidOrder = errors.New("invalid order")
+
+// validateSectionOrder checks that ids lists every section in existing
+// exactly once.
+func validateSectionOrder(existing map[int]bool, ids []int) error {
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if !existing[id] {
+			return fmt.Errorf("%w: section %d does not belong to this course", ErrInvalidOrder, id)
+		}
+		if seen[id] {
+			return fmt.Errorf("%w: section %d is listed more than once", ErrInvalidOrder, id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(existing) {
+		return fmt.Errorf("%w: all %d sections of the course must be listed", ErrInvalidOrder, len(existing))
+	}
+	return nil
+}
+
+
+// validateVideoOrder checks a video reorder against the course content.
+// courseSections holds the course's section IDs and videoSections maps each
+// of its videos to the section it is in now. Every video currently in a
+// listed section must appear exactly once, and only videos from listed
+// sections may appear.
+func validateVideoOrder(courseSections map[int]bool, videoSections map[int]int, sections []types.SectionVideoOrder) error {
+	listed := make(map[int]bool, len(sections))
+	for _, section := range sections {
+		if !courseSections[section.SectionID] {
+			return fmt.Errorf("%w: section %d does not belong to this course", ErrInvalidOrder, section.SectionID)
+		}
+		if listed[section.SectionID] {
+			return fmt.Errorf("%w: section %d is listed more than once", ErrInvalidOrder, section.SectionID)
+		}
+		listed[section.SectionID] = true
+	}
+
+	seen := make(map[int]bool)
+	for _, section := range sections {
+		for _, videoID := range section.VideoIDs {
+			current, exists := videoSections[videoID]
+			if !exists {
+				return fmt.Errorf("%w: video %d does not belong to this course", ErrInvalidOrder, videoID)
+			}
+			if !listed[current] {
+				return fmt.Errorf("%w: video %d is in section %d, which must also be listed", ErrInvalidOrder, videoID, current)
+			}
+			if seen[videoID] {
+				return fmt.Errorf("%w: video %d is listed more than once", ErrInvalidOrder, videoID)
+			}
+			seen[videoID] = true
+		}
+	}
+
+	for videoID, sectionID := range videoSections {
+		if listed[sectionID] && !seen[videoID] {
+			return fmt.Errorf("%w: video %d from section %d is missing", ErrInvalidOrder, videoID, sectionID)
+		}
+	}
+	return nil
+}
+
+
+func snapshotSectionIDs(snapshot *types.CourseSnapshot) map[int]bool {
+	ids := make(map[int]bool, len(snapshot.Sections))
+	for _, section := range snapshot.Sections {
+		ids[section.ID] = true
+	}
+	return ids
+}
+
+
+func snapshotVideoSections(snapshot *types.CourseSnapshot) map[int]int {
+	videos := make(map[int]int)
+	for _, section := range snapshot.Sections {
+		for _, video := range section.Videos {
+			videos[video.ID] = section.ID
+		}
+	}
+	return videos
+}
+
+
+// applySectionOrder renumbers the sections of a snapshot in the given order.
+func applySectionOrder(snapshot *types.CourseSnapshot, ids []int) {
+	position := make(map[int]int, len(ids))
+	for i, id := range ids {
+		position[id] = i + 1
+	}
+	for i := range snapshot.Sections {
+		snapshot.Sections[i].Order = position[snapshot.Sections[i].ID]
+	}
+	sort.SliceStable(snapshot.Sections, func(i, j int) bool {
+		return snapshot.Sections[i].Order < snapshot.Sections[j].Order
+	})
+}
+
+
+// applyVideoOrder rebuilds the video lists of the listed sections of a
+// snapshot, moving videos between sections as needed.
+func applyVideoOrder(snapshot *types.CourseSnapshot, sections []types.SectionVideoOrder) {
+	videos := make(map[int]types.VideoSnapshot)
+	for _, section := range snapshot.Sections {
+		for _, video := range section.Videos {
+			videos[video.ID] = video
+		}
+	}
+
+	for _, order := range sections {
+		section := findSection(snapshot, order.SectionID)
+		section.Videos = make([]types.VideoSnapshot, 0, len(order.VideoIDs))
+		for i, videoID := range order.VideoIDs {
+			video := videos[videoID]
+			video.Order = i + 1
+			section.Videos = append(section.Videos, video)
+		}
+	}
+}
+
+
+// stageReorder validates a reorder against the course's draft revision,
+// applies it there and writes the response. Published courses use this
+// instead of changing the live content.
+func (h *Handler) stageReorder(writer http.ResponseWriter, course *types.Course, validate func(snapshot *types.CourseSnapshot) error, stage func(snapshot *types.CourseSnapshot)) {
+	var invalid error
+	draft, err := h.teacher.EditDraftRevision(course.ID, course.TeacherID, func(snapshot *types.CourseSnapshot) error {
+		if invalid = validate(snapshot); invalid != nil {
+			return invalid
+		}
+		stage(snapshot)
+		return nil
+	})
+	if invalid != nil {
+		utils.WriteError(writer, http.StatusBadRequest, invalid)
+		return
+	}
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("could not stage reorder: %v", err))
+		return
+	}
+
+	writeStaged(writer, draft)
+}
+
+
+func (h *Handler) reorderSectionsHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil || lockedForReview(writer, course) {
+		return
+	}
+
+	var payload types.ReorderSectionsPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	if course.Status == types.CoursePublished {
+		h.stageReorder(writer, course,
+			func(snapshot *types.CourseSnapshot) error {
+				return validateSectionOrder(snapshotSectionIDs(snapshot), payload.SectionIDs)
+			},
+			func(snapshot *types.CourseSnapshot) {
+				applySectionOrder(snapshot, payload.SectionIDs)
+			})
+		return
+	}
+
+	if err := h.teacher.ReorderSections(course.ID, payload.SectionIDs); err != nil {
+		if errors.Is(err, ErrInvalidOrder) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":     "Sections reordered successfully",
+		"section_ids": payload.SectionIDs,
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+func (h *Handler) reorderVideosHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil || lockedForReview(writer, course) {
+		return
+	}
+
+	var payload types.ReorderVideosPayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	if course.Status == types.CoursePublished {
+		h.stageReorder(writer, course,
+			func(snapshot *types.CourseSnapshot) error {
+				return validateVideoOrder(snapshotSectionIDs(snapshot), snapshotVideoSections(snapshot), payload.Sections)
+			},
+			func(snapshot *types.CourseSnapshot) {
+				applyVideoOrder(snapshot, payload.Sections)
+			})
+		return
+	}
+
+	if err := h.teacher.ReorderVideos(course.ID, payload.Sections); err != nil {
+		if errors.Is(err, ErrInvalidOrder) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":  "Videos reordered successfully",
+		"sections": payload.Sections,
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
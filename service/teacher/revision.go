@@ -0,0 +1,445 @@
+package teacher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+// Edits to a published course are staged in a draft revision instead of being
+// written to the live tables, so enrolled students keep seeing the published
+// content until the teacher publishes the draft.
+
+// stageEdit applies edit to the course's draft revision and writes the
+// response. An error from edit means the edited item is not in the draft.
+func (h *Handler) stageEdit(writer http.ResponseWriter, course *types.Course, edit func(snapshot *types.CourseSnapshot) error) {
+	var editErr error
+	draft, err := h.teacher.EditDraftRevision(course.ID, course.TeacherID, func(snapshot *types.CourseSnapshot) error {
+		editErr = edit(snapshot)
+		return editErr
+	})
+	if editErr != nil {
+		utils.WriteError(writer, http.StatusNotFound, editErr)
+		return
+	}
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("could not stage edit: %v", err))
+		return
+	}
+
+	writeStaged(writer, draft)
+}
+
+
+func writeStaged(writer http.ResponseWriter, draft *types.CourseRevision) {
+	response := map[string]interface{}{
+		"message":  "Changes staged in draft revision; publish the draft to make them live",
+		"revision": draft,
+	}
+
+	utils.WriteJSON(writer, http.StatusAccepted, response)
+}
+
+
+func findSection(snapshot *types.CourseSnapshot, sectionID int) *types.SectionSnapshot {
+	for i := range snapshot.Sections {
+		if snapshot.Sections[i].ID == sectionID {
+			return &snapshot.Sections[i]
+		}
+	}
+	return nil
+}
+
+
+func findVideo(snapshot *types.CourseSnapshot, videoID int) *types.VideoSnapshot {
+	for i := range snapshot.Sections {
+		for j := range snapshot.Sections[i].Videos {
+			if snapshot.Sections[i].Videos[j].ID == videoID {
+				return &snapshot.Sections[i].Videos[j]
+			}
+		}
+	}
+	return nil
+}
+
+
+// stagedID returns a placeholder ID for a section or video added to a
+// draft, below every ID already in the snapshot.
+func stagedID(snapshot *types.CourseSnapshot) int {
+	id := 0
+	for _, section := range snapshot.Sections {
+		id = min(id, section.ID)
+		for _, video := range section.Videos {
+			id = min(id, video.ID)
+		}
+	}
+	return id - 1
+}
+
+
+// removeSection takes a section and its videos out of a draft.
+func removeSection(snapshot *types.CourseSnapshot, sectionID int) bool {
+	for i, section := range snapshot.Sections {
+		if section.ID != sectionID {
+			continue
+		}
+		snapshot.Sections = append(snapshot.Sections[:i], snapshot.Sections[i+1:]...)
+		if sectionID > 0 {
+			snapshot.DeletedSections = append(snapshot.DeletedSections, sectionID)
+		}
+		for _, video := range section.Videos {
+			if video.ID > 0 {
+				snapshot.DeletedVideos = append(snapshot.DeletedVideos, video.ID)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+
+// removeVideo takes a video out of a draft.
+func removeVideo(snapshot *types.CourseSnapshot, videoID int) bool {
+	for i := range snapshot.Sections {
+		videos := snapshot.Sections[i].Videos
+		for j, video := range videos {
+			if video.ID != videoID {
+				continue
+			}
+			snapshot.Sections[i].Videos = append(videos[:j], videos[j+1:]...)
+			if videoID > 0 {
+				snapshot.DeletedVideos = append(snapshot.DeletedVideos, videoID)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+
+// published queues transcodes for any videos whose source file changed in
+// a newly published revision and reports it.
+func (h *Handler) published(writer http.ResponseWriter, course *types.Course, revision *types.CourseRevision, jobs []types.TranscodeJob) {
+	for _, job := range jobs {
+		h.enqueueTranscode(&types.Video{ID: job.VideoID, VideoFile: job.VideoFile})
+	}
+	h.reindexCourse(course.ID)
+
+	response := map[string]interface{}{
+		"message":  fmt.Sprintf("Revision %d published successfully", revision.Number),
+		"revision": revision,
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+func (h *Handler) listRevisionsHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	params, err := pagination.FromRequest(request, "revisions", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	revisions, err := h.teacher.GetRevisions(course.ID, params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, revisions)
+}
+
+
+func (h *Handler) getRevisionHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	number, err := strconv.Atoi(mux.Vars(request)["number"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid revision number"))
+		return
+	}
+
+	revision, err := h.teacher.GetRevision(course.ID, number)
+	if err != nil {
+		if err == ErrRevisionNotFound {
+			utils.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, revision)
+}
+
+
+func (h *Handler) getDraftRevisionHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	draft, err := h.teacher.GetDraftRevision(course.ID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	if draft == nil {
+		utils.WriteError(writer, http.StatusNotFound, fmt.Errorf("course has no draft revision"))
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, draft)
+}
+
+
+func (h *Handler) discardDraftRevisionHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	if err := h.teacher.DeleteDraftRevision(course.ID); err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]string{"message": "Draft revision discarded"}
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+func (h *Handler) publishDraftRevisionHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+	if lockedForReview(writer, course) {
+		return
+	}
+
+	var payload types.PublishRevisionPayload
+	if request.ContentLength > 0 {
+		if err := utils.ParseJSON(request, &payload); err != nil {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	revision, jobs, err := h.teacher.PublishDraftRevision(course.ID, course.TeacherID, payload.Message)
+	if err != nil {
+		if err == ErrNoDraftRevision {
+			utils.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("could not publish revision: %v", err))
+		return
+	}
+
+	h.published(writer, course, revision, jobs)
+}
+
+
+func (h *Handler) rollbackRevisionHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+	if lockedForReview(writer, course) {
+		return
+	}
+
+	number, err := strconv.Atoi(mux.Vars(request)["number"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid revision number"))
+		return
+	}
+
+	revision, jobs, err := h.teacher.RollbackRevision(course.ID, number, course.TeacherID, fmt.Sprintf("Rollback to revision %d", number))
+	if err != nil {
+		switch err {
+		case ErrRevisionNotFound:
+			utils.WriteError(writer, http.StatusNotFound, err)
+		case ErrDraftRevisionPending:
+			utils.WriteError(writer, http.StatusConflict, err)
+		default:
+			utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("could not publish revision: %v", err))
+		}
+		return
+	}
+
+	h.published(writer, course, revision, jobs)
+}
+
+
+// diffRevisionsHandle compares two versions of a course. Each side is a
+// revision number, "live" or "draft"; by default the draft is compared
+// against the live content.
+func (h *Handler) diffRevisionsHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	from := request.URL.Query().Get("from")
+	to := request.URL.Query().Get("to")
+	if from == "" {
+		from = "live"
+	}
+	if to == "" {
+		to = "draft"
+	}
+
+	fromSnapshot, err := h.resolveSnapshot(course.ID, from)
+	if err != nil {
+		utils.WriteError(writer, http.StatusNotFound, err)
+		return
+	}
+	toSnapshot, err := h.resolveSnapshot(course.ID, to)
+	if err != nil {
+		utils.WriteError(writer, http.StatusNotFound, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"from": from,
+		"to":   to,
+		"diff": diffSnapshots(fromSnapshot, toSnapshot),
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+func (h *Handler) resolveSnapshot(courseID int, ref string) (*types.CourseSnapshot, error) {
+	switch ref {
+	case "live":
+		return h.teacher.GetCourseSnapshot(courseID)
+	case "draft":
+		draft, err := h.teacher.GetDraftRevision(courseID)
+		if err != nil {
+			return nil, err
+		}
+		if draft == nil {
+			return nil, fmt.Errorf("course has no draft revision")
+		}
+		return draft.Snapshot, nil
+	}
+
+	number, err := strconv.Atoi(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revision reference: %s", ref)
+	}
+	revision, err := h.teacher.GetRevision(courseID, number)
+	if err != nil {
+		return nil, err
+	}
+	return revision.Snapshot, nil
+}
+
+
+func changedFields(fields ...types.FieldChange) []types.FieldChange {
+	changes := []types.FieldChange{}
+	for _, field := range fields {
+		if field.From != field.To {
+			changes = append(changes, field)
+		}
+	}
+	return changes
+}
+
+
+func diffSnapshots(from, to *types.CourseSnapshot) types.RevisionDiff {
+	diff := types.RevisionDiff{
+		Course: changedFields(
+			types.FieldChange{Field: "category_id", From: from.CategoryID, To: to.CategoryID},
+			types.FieldChange{Field: "name", From: from.Name, To: to.Name},
+			types.FieldChange{Field: "description", From: from.Description, To: to.Description},
+			types.FieldChange{Field: "for_who", From: from.ForWho, To: to.ForWho},
+			types.FieldChange{Field: "reason", From: from.Reason, To: to.Reason},
+			types.FieldChange{Field: "intro_video", From: from.IntroVideo, To: to.IntroVideo},
+			types.FieldChange{Field: "image", From: from.Image, To: to.Image},
+			types.FieldChange{Field: "price", From: from.Price, To: to.Price},
+			types.FieldChange{Field: "language", From: from.Language, To: to.Language},
+			types.FieldChange{Field: "level", From: from.Level, To: to.Level},
+			types.FieldChange{Field: "tags", From: tagSummary(from.Tags), To: tagSummary(to.Tags)},
+		),
+		Sections: []types.ItemChange{},
+		Videos:   []types.ItemChange{},
+	}
+
+	type placedVideo struct {
+		sectionID int
+		video     types.VideoSnapshot
+	}
+	oldSections := make(map[int]types.SectionSnapshot)
+	oldVideos := make(map[int]placedVideo)
+	for _, section := range from.Sections {
+		oldSections[section.ID] = section
+		for _, video := range section.Videos {
+			oldVideos[video.ID] = placedVideo{section.ID, video}
+		}
+	}
+
+	seenSections := make(map[int]bool)
+	seenVideos := make(map[int]bool)
+	for _, section := range to.Sections {
+		seenSections[section.ID] = true
+		old, ok := oldSections[section.ID]
+		if !ok {
+			diff.Sections = append(diff.Sections, types.ItemChange{ID: section.ID, Title: section.Title, Change: "added"})
+		} else if fields := changedFields(
+			types.FieldChange{Field: "title", From: old.Title, To: section.Title},
+			types.FieldChange{Field: "order", From: old.Order, To: section.Order},
+		); len(fields) > 0 {
+			diff.Sections = append(diff.Sections, types.ItemChange{ID: section.ID, Title: section.Title, Change: "modified", Fields: fields})
+		}
+
+		for _, video := range section.Videos {
+			seenVideos[video.ID] = true
+			old, ok := oldVideos[video.ID]
+			if !ok {
+				diff.Videos = append(diff.Videos, types.ItemChange{ID: video.ID, SectionID: section.ID, Title: video.Title, Change: "added"})
+			} else if fields := changedFields(
+				types.FieldChange{Field: "section_id", From: old.sectionID, To: section.ID},
+				types.FieldChange{Field: "title", From: old.video.Title, To: video.Title},
+				types.FieldChange{Field: "video_file", From: old.video.VideoFile, To: video.VideoFile},
+				types.FieldChange{Field: "order", From: old.video.Order, To: video.Order},
+			); len(fields) > 0 {
+				diff.Videos = append(diff.Videos, types.ItemChange{ID: video.ID, SectionID: section.ID, Title: video.Title, Change: "modified", Fields: fields})
+			}
+		}
+	}
+
+	for _, section := range from.Sections {
+		if !seenSections[section.ID] {
+			diff.Sections = append(diff.Sections, types.ItemChange{ID: section.ID, Title: section.Title, Change: "removed"})
+		}
+		for _, video := range section.Videos {
+			if !seenVideos[video.ID] {
+				diff.Videos = append(diff.Videos, types.ItemChange{ID: video.ID, SectionID: section.ID, Title: video.Title, Change: "removed"})
+			}
+		}
+	}
+
+	return diff
+}
@@ -1,29 +1,37 @@
 package teacher
 
 import (
+	"errors"
 	"fmt"
+	"log"
 
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/sikozonpc/ecom/service/auth"
 	"github.com/sikozonpc/ecom/types"
 	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
 
 )
 
 type Handler struct {
 	teacher types.TeacherStore
 	store  types.UserStore
+	transcoder types.TranscodeQueue
+	indexer types.SearchIndexer
 }
 
 
 
-func NewHandler(teacher types.TeacherStore, store types.UserStore) *Handler {
+func NewHandler(teacher types.TeacherStore, store types.UserStore, transcoder types.TranscodeQueue, indexer types.SearchIndexer) *Handler {
 	return &Handler{
 		teacher: teacher,
 		store: store,
+		transcoder: transcoder,
+		indexer: indexer,
 	}
 }
 
@@ -35,18 +43,62 @@ func (h *Handler) TeachRoutes(router *mux.Router){
 		types.ADMIN,
 		types.TEACHER,
 	}
+	adminOnly := []types.UserRole{types.ADMIN}
 
 	// Categories
-	router.HandleFunc("/course_builder/categories", auth.WithJWTAuth(h.getCategoriesByTeacherHandle, h.store, usersOnly)).Methods(http.MethodGet)
-	router.HandleFunc("/course_builder/category/create", auth.WithJWTAuth(h.createCategoryHandle, h.store, usersOnly)).Methods(http.MethodPost)
-	router.HandleFunc("/course_builder/category/edit/{id}", auth.WithJWTAuth(h.editCategoryHandle, h.store, usersOnly)).Methods(http.MethodPatch)
-	router.HandleFunc("/course_builder/category/delete/{id}", auth.WithJWTAuth(h.deleteCategoryHandle, h.store, usersOnly)).Methods(http.MethodDelete)
+	router.HandleFunc("/categories", h.getCategoriesHandle).Methods(http.MethodGet)
+	router.HandleFunc("/course_builder/categories", auth.WithJWTAuth(h.getCategoriesHandle, h.store, usersOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/categories", auth.WithJWTAuth(h.createCategoryHandle, h.store, adminOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/categories/{id}", auth.WithJWTAuth(h.editCategoryHandle, h.store, adminOnly)).Methods(http.MethodPatch)
+	router.HandleFunc("/admin/categories/{id}", auth.WithJWTAuth(h.deleteCategoryHandle, h.store, adminOnly)).Methods(http.MethodDelete)
+	router.HandleFunc("/admin/categories/{id}/merge", auth.WithJWTAuth(h.mergeCategoryHandle, h.store, adminOnly)).Methods(http.MethodPost)
 
 	// courses
 	router.HandleFunc("/course_builder/courses/create", auth.WithJWTAuth(h.createCourseHandle, h.store, usersOnly)).Methods((http.MethodPost))
 	router.HandleFunc("/course_builder/course/edit/{id}", auth.WithJWTAuth(h.editCourseHandle, h.store, usersOnly)).Methods(http.MethodPatch)
 	router.HandleFunc("/course_builder/course/delete/{id}", auth.WithJWTAuth(h.deleteCourseHandle, h.store, usersOnly)).Methods(http.MethodDelete)
 
+	// course publishing
+	router.HandleFunc("/course_builder/course/{id}/submit", auth.WithJWTAuth(h.submitCourseHandle, h.store, usersOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/course_builder/course/{id}/publish", auth.WithJWTAuth(h.publishCourseHandle, h.store, usersOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/course_builder/course/{id}/archive", auth.WithJWTAuth(h.archiveCourseHandle, h.store, usersOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/course_builder/course/{id}/restore", auth.WithJWTAuth(h.restoreCourseHandle, h.store, usersOnly)).Methods(http.MethodPost)
+
+	// cloning and templates
+	router.HandleFunc("/course_builder/course/{id}/clone", auth.WithJWTAuth(h.cloneCourseHandle, h.store, usersOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/course_builder/templates", auth.WithJWTAuth(h.getTemplatesHandle, h.store, usersOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/course_builder/templates/{id}/use", auth.WithJWTAuth(h.useTemplateHandle, h.store, usersOnly)).Methods(http.MethodPost)
+
+	// import and export
+	router.HandleFunc("/course_builder/course/{id}/export", auth.WithJWTAuth(h.exportCourseHandle, h.store, usersOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/course_builder/courses/import", auth.WithJWTAuth(h.importCourseHandle, h.store, usersOnly)).Methods(http.MethodPost)
+
+	// prerequisites
+	router.HandleFunc("/course_builder/course/{id}/prerequisites", auth.WithJWTAuth(h.getPrerequisitesHandle, h.store, usersOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/course_builder/course/{id}/prerequisites", auth.WithJWTAuth(h.setPrerequisitesHandle, h.store, usersOnly)).Methods(http.MethodPut)
+
+	// bulk reordering
+	router.HandleFunc("/course_builder/course/{id}/sections/order", auth.WithJWTAuth(h.reorderSectionsHandle, h.store, usersOnly)).Methods(http.MethodPut)
+	router.HandleFunc("/course_builder/course/{id}/videos/order", auth.WithJWTAuth(h.reorderVideosHandle, h.store, usersOnly)).Methods(http.MethodPut)
+
+	// course revisions
+	router.HandleFunc("/course_builder/course/{id}/revisions", auth.WithJWTAuth(h.listRevisionsHandle, h.store, usersOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/course_builder/course/{id}/revisions/diff", auth.WithJWTAuth(h.diffRevisionsHandle, h.store, usersOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/course_builder/course/{id}/revisions/draft", auth.WithJWTAuth(h.getDraftRevisionHandle, h.store, usersOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/course_builder/course/{id}/revisions/draft", auth.WithJWTAuth(h.discardDraftRevisionHandle, h.store, usersOnly)).Methods(http.MethodDelete)
+	router.HandleFunc("/course_builder/course/{id}/revisions/draft/publish", auth.WithJWTAuth(h.publishDraftRevisionHandle, h.store, usersOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/course_builder/course/{id}/revisions/{number:[0-9]+}", auth.WithJWTAuth(h.getRevisionHandle, h.store, usersOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/course_builder/course/{id}/revisions/{number:[0-9]+}/rollback", auth.WithJWTAuth(h.rollbackRevisionHandle, h.store, usersOnly)).Methods(http.MethodPost)
+
+	// course review
+	router.HandleFunc("/admin/courses/review", auth.WithJWTAuth(h.reviewQueueHandle, h.store, adminOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/course/{id}/approve", auth.WithJWTAuth(h.approveCourseHandle, h.store, adminOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/course/{id}/reject", auth.WithJWTAuth(h.rejectCourseHandle, h.store, adminOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/templates", auth.WithJWTAuth(h.getTemplatesHandle, h.store, adminOnly)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/templates", auth.WithJWTAuth(h.createTemplateHandle, h.store, adminOnly)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/templates/{id}", auth.WithJWTAuth(h.editTemplateHandle, h.store, adminOnly)).Methods(http.MethodPatch)
+	router.HandleFunc("/admin/templates/{id}", auth.WithJWTAuth(h.deleteTemplateHandle, h.store, adminOnly)).Methods(http.MethodDelete)
+
 	// sections
 	router.HandleFunc("/course_builder/sections/create", auth.WithJWTAuth(h.createSectionHandle, h.store, usersOnly)).Methods(http.MethodPost)
 	router.HandleFunc("/course_builder/section/edit/{id}", auth.WithJWTAuth(h.editSectionHandle, h.store, usersOnly)).Methods(http.MethodPatch)
@@ -56,6 +108,7 @@ func (h *Handler) TeachRoutes(router *mux.Router){
 	router.HandleFunc("/course_builder/videos/create", auth.WithJWTAuth(h.createVideoHandle, h.store, usersOnly)).Methods(http.MethodPost)
     router.HandleFunc("/course_builder/video/edit/{id}", auth.WithJWTAuth(h.editVideoHandle, h.store, usersOnly)).Methods(http.MethodPatch)
     router.HandleFunc("/course_builder/video/delete/{id}", auth.WithJWTAuth(h.deleteVideoHandle, h.store, usersOnly)).Methods(http.MethodDelete)
+	router.HandleFunc("/course_builder/video/{id}/status", auth.WithJWTAuth(h.videoStatusHandle, h.store, usersOnly)).Methods(http.MethodGet)
 
 	// course by category
 	router.HandleFunc("/course_builder/category/{id}", auth.WithJWTAuth(h.courseByCategoryHandle, h.store, usersOnly)).Methods(http.MethodGet)
@@ -68,203 +121,6 @@ func (h *Handler) TeachRoutes(router *mux.Router){
 }
 
 
-// Category
-
-func (h *Handler) createCategoryHandle(writer http.ResponseWriter, request *http.Request) {
-	var payload types.CreateCategoryPayload
-
-	if err := utils.ParseJSON(request, &payload); err != nil {
-		utils.WriteError(writer, http.StatusBadRequest, err)
-        return
-	}
-
-	if err := utils.Validate.Struct(payload); err != nil {
-		utils.WriteError(writer, http.StatusBadRequest, err)
-        return
-	}
-
-	userID, err := auth.GetTeacherIDFromToken(request)
-	if err!= nil {
-        utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("unauthorized: %v", err))
-        return
-    }
-
-	// Fetch the teacher associated with the user ID
-	teacher, err := h.teacher.GetTeacherByUserID(userID)
-	if err != nil {
-        utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("teacher not found for this user"))
-        return
-    }
-
-
-	category := &types.Category{
-		TeacherID: teacher.ID,
-		Name: payload.Name,
-		Description: payload.Description,
-	}
-
-	err = h.teacher.CreateCategory(category)
-	if err != nil {
-		if err == ErrDuplicateCategory {
-			utils.WriteError(writer, http.StatusConflict, fmt.Errorf("category with the same name already exists"))
-			return
-		}
-		utils.WriteError(writer, http.StatusInternalServerError, err)
-		return
-	}
-
-	category.Slug = utils.Slugify(payload.Name, category.ID)
-
-	err = h.teacher.UpdateCategory(category)
-	if err!= nil {
-        utils.WriteError(writer, http.StatusInternalServerError, err)
-        return
-    }
-
-	response := map[string]interface{}{
-		"message": "Category Created successfully",
-		"video":   category,
-	}
-	
-	utils.WriteJSON(writer, http.StatusOK, response)
-}
-
-
-
-func (h *Handler) getCategoriesByTeacherHandle(writer http.ResponseWriter, request *http.Request) {
-	userID, err := auth.GetTeacherIDFromToken(request)
-	if err != nil {
-		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
-		return
-	}
-
-	// Fetch the teacher associated with the userID
-	teacher, err := h.teacher.GetTeacherByUserID(userID)
-	if err != nil {
-		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("teacher not found for this user"))
-		return
-	}
-
-	teacherID := teacher.ID
-	ts, err := h.teacher.GetCategoriesByTeacher(teacherID)
-	if err!= nil {
-        utils.WriteError(writer, http.StatusInternalServerError, err)
-        return
-    }
-	utils.WriteJSON(writer, http.StatusOK, ts)
-}
-
-
-
-func (h *Handler) editCategoryHandle(writer http.ResponseWriter, request *http.Request) {
-	userID, err := auth.GetTeacherIDFromToken(request)
-	if err != nil {
-		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
-		return
-	}
-
-	// Fetch the teacher associated with the userID
-	teacher, err := h.teacher.GetTeacherByUserID(userID)
-	if err != nil {
-		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("teacher not found for this user"))
-		return
-	}
-
-	vars := mux.Vars(request)
-	categoryID, err := strconv.Atoi(vars["id"])
-	if err!= nil {
-        utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid category ID: %s", vars["id"]))
-        return
-    }
-
-	category, err := h.teacher.GetCategoryByID(categoryID)
-	if err != nil || category.TeacherID != teacher.ID {
-		auth.PermissionDenied(writer, "you are not allowed to edit this category")
-		return
-	}
-
-	var payload types.UpdateCategoryPayload
-
-	if err := utils.ParseJSON(request, &payload); err!= nil {
-        utils.WriteError(writer, http.StatusBadRequest, err)
-        return
-    }
-
-	if err := utils.Validate.Struct(payload); err!= nil {
-        utils.WriteError(writer, http.StatusBadRequest, err)
-        return
-    }
-
-	category.Name = payload.Name
-	category.Description = payload.Description
-	category.Slug = utils.Slugify(payload.Name, category.ID)
-
-
-	err = h.teacher.UpdateCategory(category)
-	if err!= nil {
-        utils.WriteError(writer, http.StatusInternalServerError, err)
-        return
-    }
-
-	response := map[string]interface{}{
-		"message": "Category updated successfully",
-		"video":   category,
-	}
-	
-	utils.WriteJSON(writer, http.StatusOK, response)
-}
-
-
-
-func (h *Handler) deleteCategoryHandle(writer http.ResponseWriter, request *http.Request) {
-    // Extract the teacher ID from the JWT token
-    userID, err := auth.GetTeacherIDFromToken(request)
-	if err != nil {
-		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
-		return
-	}
-
-	// Fetch the teacher associated with the userID
-	teacher, err := h.teacher.GetTeacherByUserID(userID)
-	if err != nil {
-		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("teacher not found for this user"))
-		return
-	}
-
-    // Extract category ID from the request parameters
-    vars := mux.Vars(request)
-    categoryID, err := strconv.Atoi(vars["id"])
-    if err != nil {
-        utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid category ID: %s", vars["id"]))
-        return
-    }
-
-    // Fetch the category to verify ownership
-    category, err := h.teacher.GetCategoryByID(categoryID)
-    if err != nil {
-        utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to fetch category"))
-        return
-    }
-
-    // Check if the category belongs to the logged-in teacher
-    if category.TeacherID != teacher.ID {
-        auth.PermissionDenied(writer, "you do not have permission to delete this category")
-        return
-    }
-
-    // Proceed with category deletion
-    err = h.teacher.DeleteCategory(categoryID)
-    if err != nil {
-        utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to delete category"))
-        return
-    }
-
-    // Send a success response
-    response := map[string]string{"message": "Category deleted successfully"}
-    utils.WriteJSON(writer, http.StatusNoContent, response)
-}
-
-
 // COURSE MANAGEMENT
 
 func (h *Handler) createCourseHandle(writer http.ResponseWriter, request *http.Request) {
@@ -282,6 +138,12 @@ func (h *Handler) createCourseHandle(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	tags, err := courseTagsFromPayload(payload.Tags, payload.Skills)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
 	userID, err := auth.GetTeacherIDFromToken(request)
 	if err!= nil {
         utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("unauthorized: %v", err))
@@ -301,23 +163,23 @@ func (h *Handler) createCourseHandle(writer http.ResponseWriter, request *http.R
 		CategoryID:  payload.CategoryID,
 		Name:        payload.Name,
 		Description: payload.Description,
+		ForWho:      payload.ForWho,
+		Reason:      payload.Reason,
+		IntroVideo:  payload.IntroVideo,
+		Image:       payload.Image,
 		Price:       payload.Price,
+		Language:    strings.ToLower(payload.Language),
+		Level:       payload.Level,
 	}
 
-	// Insert course into DB
-	err = h.teacher.CreateCourse(course)
-	if err != nil {
-		utils.WriteError(writer, http.StatusInternalServerError, err)
-		return
-	}
-
-	// Generate slug and update the course
-	course.Slug = utils.Slugify(payload.Name, course.ID)
-	err = h.teacher.UpdateCourse(course)
+	// Insert course and its tags into DB
+	err = h.teacher.CreateCourse(course, tags)
 	if err != nil {
 		utils.WriteError(writer, http.StatusInternalServerError, err)
 		return
 	}
+	course.Tags, _ = h.teacher.GetCourseTags(course.ID)
+	h.reindexCourse(course.ID)
 
 	// Return success response
 	response := map[string]interface{}{
@@ -364,6 +226,9 @@ func (h *Handler) editCourseHandle(writer http.ResponseWriter, request *http.Req
 		auth.PermissionDenied(writer, "you are not allowed to edit this course")
 		return
 	}
+	if lockedForReview(writer, course) {
+		return
+	}
 
 	// Parse the incoming update payload
 	var payload types.UpdateCoursePayload
@@ -378,19 +243,65 @@ func (h *Handler) editCourseHandle(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
+	// Tags are only replaced when the payload lists them
+	var tags []types.CourseTag
+	if payload.Tags != nil || payload.Skills != nil {
+		tags, err = courseTagsFromPayload(payload.Tags, payload.Skills)
+		if err != nil {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// Live courses stage the edit in a draft revision
+	if course.Status == types.CoursePublished {
+		h.stageEdit(writer, course, func(snapshot *types.CourseSnapshot) error {
+			if tags != nil {
+				snapshot.Tags = tags
+			}
+			snapshot.CategoryID = payload.CategoryID
+			snapshot.Name = payload.Name
+			setIfPresent(&snapshot.Description, payload.Description)
+			setIfPresent(&snapshot.ForWho, payload.ForWho)
+			setIfPresent(&snapshot.Reason, payload.Reason)
+			setIfPresent(&snapshot.IntroVideo, payload.IntroVideo)
+			setIfPresent(&snapshot.Image, payload.Image)
+			snapshot.Price = payload.Price
+			if payload.Language != "" {
+				snapshot.Language = strings.ToLower(payload.Language)
+			}
+			if payload.Level != "" {
+				snapshot.Level = payload.Level
+			}
+			return nil
+		})
+		return
+	}
+
 	// Update course fields
 	course.CategoryID = payload.CategoryID
 	course.Name = payload.Name
-	course.Description = payload.Description
-	course.Slug = utils.Slugify(payload.Name, course.ID)
+	setIfPresent(&course.Description, payload.Description)
+	setIfPresent(&course.ForWho, payload.ForWho)
+	setIfPresent(&course.Reason, payload.Reason)
+	setIfPresent(&course.IntroVideo, payload.IntroVideo)
+	setIfPresent(&course.Image, payload.Image)
 	course.Price = payload.Price
+	if payload.Language != "" {
+		course.Language = strings.ToLower(payload.Language)
+	}
+	if payload.Level != "" {
+		course.Level = payload.Level
+	}
 
-	// Perform course update
-	err = h.teacher.UpdateCourse(course)
+	// Perform course update, replacing the tags when they were sent
+	err = h.teacher.UpdateCourse(course, tags)
 	if err != nil {
 		utils.WriteError(writer, http.StatusInternalServerError, err)
 		return
 	}
+	course.Tags, _ = h.teacher.GetCourseTags(course.ID)
+	h.reindexCourse(course.ID)
 
 	response := map[string]interface{}{
 		"message": "Course updated successfully",
@@ -439,6 +350,7 @@ func (h *Handler) deleteCourseHandle(writer http.ResponseWriter, request *http.R
         utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to delete course"))
         return
     }
+	h.unindexCourse(courseID)
 
 	response := map[string]string{"message": "Course deleted successfully"}
 	utils.WriteJSON(writer, http.StatusNoContent, response)
@@ -461,6 +373,25 @@ func (h *Handler) createSectionHandle(writer http.ResponseWriter, request *http.
 		return
 	}
 
+	course := h.ownedCourse(writer, request, payload.CourseID)
+	if course == nil || lockedForReview(writer, course) {
+		return
+	}
+
+	// Live courses stage the new section in a draft revision
+	if course.Status == types.CoursePublished {
+		h.stageEdit(writer, course, func(snapshot *types.CourseSnapshot) error {
+			snapshot.Sections = append(snapshot.Sections, types.SectionSnapshot{
+				ID:     stagedID(snapshot),
+				Title:  payload.Title,
+				Order:  payload.Order,
+				Videos: []types.VideoSnapshot{},
+			})
+			return nil
+		})
+		return
+	}
+
 	section := &types.Section{
 		CourseID: payload.CourseID,
 		Title: payload.Title,
@@ -473,6 +404,8 @@ func (h *Handler) createSectionHandle(writer http.ResponseWriter, request *http.
         return
     }
 
+	h.refreshCourseStats(section.CourseID)
+
 	response := map[string]interface{}{
 		"message": "Section Created successfully",
 		"video":   section,
@@ -525,10 +458,12 @@ func (h *Handler) editSectionHandle(writer http.ResponseWriter, request *http.Re
     }
 
 	var courseBelongsToTeacher bool
+	var sectionCourse types.Course
 
 	for _, course := range courses {
 		if course.ID == section.CourseID {
 			courseBelongsToTeacher = true
+			sectionCourse = course
 			break
 		}
 	}
@@ -537,6 +472,9 @@ func (h *Handler) editSectionHandle(writer http.ResponseWriter, request *http.Re
 		auth.PermissionDenied(writer, "you do not have permission to edit this section")
         return
 	}
+	if lockedForReview(writer, &sectionCourse) {
+		return
+	}
 
 	var payload types.UpdateSectionPayload
 	if err := utils.ParseJSON(request, &payload); err!= nil {
@@ -549,6 +487,20 @@ func (h *Handler) editSectionHandle(writer http.ResponseWriter, request *http.Re
         return
     }
 
+    // Live courses stage the edit in a draft revision
+    if sectionCourse.Status == types.CoursePublished {
+        h.stageEdit(writer, &sectionCourse, func(snapshot *types.CourseSnapshot) error {
+            staged := findSection(snapshot, section.ID)
+            if staged == nil {
+                return fmt.Errorf("section %d not found in draft revision", section.ID)
+            }
+            staged.Title = payload.Title
+            staged.Order = payload.Order
+            return nil
+        })
+        return
+    }
+
     section.Title = payload.Title
     section.Order = payload.Order
 
@@ -558,6 +510,8 @@ func (h *Handler) editSectionHandle(writer http.ResponseWriter, request *http.Re
         return
     }
 
+    h.refreshCourseStats(section.CourseID)
+
     response := map[string]interface{}{
 		"message": "Section updated successfully",
 		"video":   section,
@@ -607,10 +561,12 @@ func (h *Handler) deleteSectionHandle(writer http.ResponseWriter, request *http.
         return
     }
 	var courseBelongsToTeacher bool
+	var sectionCourse types.Course
 
 	for _, course := range courses {
 		if course.ID == section.CourseID {
 			courseBelongsToTeacher = true
+			sectionCourse = course
 			break
 		}
 	}
@@ -619,6 +575,20 @@ func (h *Handler) deleteSectionHandle(writer http.ResponseWriter, request *http.
 		auth.PermissionDenied(writer, "you do not have permission to delete this section")
         return
 	}
+	if lockedForReview(writer, &sectionCourse) {
+		return
+	}
+
+	// Live courses stage the removal in a draft revision
+	if sectionCourse.Status == types.CoursePublished {
+		h.stageEdit(writer, &sectionCourse, func(snapshot *types.CourseSnapshot) error {
+			if !removeSection(snapshot, section.ID) {
+				return fmt.Errorf("section %d not found in draft revision", section.ID)
+			}
+			return nil
+		})
+		return
+	}
 
 	err = h.teacher.DeleteSection(sectionID)
 	if err!= nil {
@@ -626,6 +596,8 @@ func (h *Handler) deleteSectionHandle(writer http.ResponseWriter, request *http.
         return
     }
 
+	h.refreshCourseStats(section.CourseID)
+
 	response := map[string]string{"message": "section deleted successfully"}
 
 	utils.WriteJSON(writer, http.StatusNoContent, response)
@@ -647,7 +619,40 @@ func (h *Handler) createVideoHandle(writer http.ResponseWriter, request *http.Re
 		utils.WriteError(writer, http.StatusBadRequest, err)
         return
     }
+	if err := utils.ValidateVideoFile(payload.VideoFile); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
 	
+	section, err := h.teacher.GetSectionByID(payload.SectionID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusNotFound, fmt.Errorf("failed to fetch section: %v", err))
+		return
+	}
+	course := h.ownedCourse(writer, request, section.CourseID)
+	if course == nil || lockedForReview(writer, course) {
+		return
+	}
+
+	// Live courses stage the new video in a draft revision; it is transcoded
+	// when the draft is published
+	if course.Status == types.CoursePublished {
+		h.stageEdit(writer, course, func(snapshot *types.CourseSnapshot) error {
+			staged := findSection(snapshot, section.ID)
+			if staged == nil {
+				return fmt.Errorf("section %d not found in draft revision", section.ID)
+			}
+			staged.Videos = append(staged.Videos, types.VideoSnapshot{
+				ID:        stagedID(snapshot),
+				Title:     payload.Title,
+				VideoFile: payload.VideoFile,
+				Order:     payload.Order,
+			})
+			return nil
+		})
+		return
+	}
+
 	video := &types.Video{
 		SectionID: payload.SectionID,
 		Title: payload.Title,
@@ -655,11 +660,15 @@ func (h *Handler) createVideoHandle(writer http.ResponseWriter, request *http.Re
 		Order: payload.Order,
 	}
 
-	err := h.teacher.CreateVideo(video)
+	err = h.teacher.CreateVideo(video)
 	if err!= nil {
         utils.WriteError(writer, http.StatusInternalServerError, err)
         return
     }
+
+	h.enqueueTranscode(video)
+	h.refreshCourseStats(section.CourseID)
+
 	response := map[string]interface{}{
 		"message": "Video Created successfully",
 		"video":   video,
@@ -716,9 +725,11 @@ func (h *Handler) editVideoHandle(writer http.ResponseWriter, request *http.Requ
 	}
 
 	var courseBelongsToTeacher bool
+	var videoCourse types.Course
 	for _, course := range courses {
 		if course.ID == section.CourseID {
 			courseBelongsToTeacher = true
+			videoCourse = course
 			break
 		}
 	}
@@ -727,6 +738,9 @@ func (h *Handler) editVideoHandle(writer http.ResponseWriter, request *http.Requ
 		auth.PermissionDenied(writer, "you do not have permission to edit this video")
 		return
 	}
+	if lockedForReview(writer, &videoCourse) {
+		return
+	}
 
 	var payload types.UpdateVideoPayload
 
@@ -740,6 +754,28 @@ func (h *Handler) editVideoHandle(writer http.ResponseWriter, request *http.Requ
         utils.WriteError(writer, http.StatusBadRequest, err)
         return
     }
+	if err := utils.ValidateVideoFile(payload.VideoFile); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	// Live courses stage the edit in a draft revision; a new source file is
+	// transcoded when the draft is published
+	if videoCourse.Status == types.CoursePublished {
+		h.stageEdit(writer, &videoCourse, func(snapshot *types.CourseSnapshot) error {
+			staged := findVideo(snapshot, video.ID)
+			if staged == nil {
+				return fmt.Errorf("video %d not found in draft revision", video.ID)
+			}
+			staged.Title = payload.Title
+			staged.VideoFile = payload.VideoFile
+			staged.Order = payload.Order
+			return nil
+		})
+		return
+	}
+
+	fileChanged := video.VideoFile != payload.VideoFile
 
 	video.Title = payload.Title
 	video.VideoFile = payload.VideoFile
@@ -750,6 +786,22 @@ func (h *Handler) editVideoHandle(writer http.ResponseWriter, request *http.Requ
         utils.WriteError(writer, http.StatusInternalServerError, err)
         return
     }
+
+	// A new source file invalidates the existing renditions
+	if fileChanged {
+		if err := h.teacher.UpdateVideoStatus(video.ID, types.VideoQueued, ""); err != nil {
+			utils.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		video.Status = types.VideoQueued
+		video.HLSPlaylist = ""
+		video.Thumbnail = ""
+		video.Duration = 0
+		video.TranscodeError = ""
+		h.enqueueTranscode(video)
+	}
+
+	h.refreshCourseStats(section.CourseID)
 	
 	response := map[string]interface{}{
 		"message": "Video updated successfully",
@@ -805,9 +857,11 @@ func (h *Handler) deleteVideoHandle(writer http.ResponseWriter, request *http.Re
 	}
 
 	var courseBelongsToTeacher bool
+	var videoCourse types.Course
 	for _, course := range courses {
 		if course.ID == section.CourseID {
 			courseBelongsToTeacher = true
+			videoCourse = course
 			break
 		}
 	}
@@ -816,6 +870,20 @@ func (h *Handler) deleteVideoHandle(writer http.ResponseWriter, request *http.Re
 		auth.PermissionDenied(writer, "you do not have permission to delete this video")
 		return
 	}
+	if lockedForReview(writer, &videoCourse) {
+		return
+	}
+
+	// Live courses stage the removal in a draft revision
+	if videoCourse.Status == types.CoursePublished {
+		h.stageEdit(writer, &videoCourse, func(snapshot *types.CourseSnapshot) error {
+			if !removeVideo(snapshot, video.ID) {
+				return fmt.Errorf("video %d not found in draft revision", video.ID)
+			}
+			return nil
+		})
+		return
+	}
 
 	err = h.teacher.DeleteVideo(videoID)
 	if err!= nil {
@@ -823,12 +891,127 @@ func (h *Handler) deleteVideoHandle(writer http.ResponseWriter, request *http.Re
         return
     }
 
+	h.refreshCourseStats(section.CourseID)
+
 	response := map[string]string{"message": "Video deleted successfully"}
 	
     utils.WriteJSON(writer, http.StatusNoContent, response)
 }
 
 
+func (h *Handler) videoStatusHandle(writer http.ResponseWriter, request *http.Request) {
+	userID, err := auth.GetTeacherIDFromToken(request)
+	if err != nil {
+		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+		return
+	}
+
+	// Fetch the teacher associated with the userID
+	teacher, err := h.teacher.GetTeacherByUserID(userID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("teacher not found for this user"))
+		return
+	}
+
+	vars := mux.Vars(request)
+	videoID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid video ID: %s", vars["id"]))
+		return
+	}
+
+	video, err := h.teacher.GetVideoByID(videoID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusNotFound, fmt.Errorf("failed to fetch video: %v", err))
+		return
+	}
+
+	section, err := h.teacher.GetSectionByID(video.SectionID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusNotFound, fmt.Errorf("failed to fetch section: %v", err))
+		return
+	}
+
+	course, err := h.teacher.GetCourseByID(section.CourseID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to fetch course"))
+		return
+	}
+
+	if course.TeacherID != teacher.ID {
+		auth.PermissionDenied(writer, "you do not have permission to view this video")
+		return
+	}
+
+	response := map[string]interface{}{
+		"id":              video.ID,
+		"status":          video.Status,
+		"duration":        video.Duration,
+		"hls_playlist":    video.HLSPlaylist,
+		"thumbnail":       video.Thumbnail,
+		"transcode_error": video.TranscodeError,
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+// setIfPresent applies an optional payload field, leaving the current value
+// alone when the field was left out.
+func setIfPresent(field *string, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+
+// enqueueTranscode hands a video to the transcoding pipeline. A full queue is
+// not fatal: the video stays queued and the pipeline retries it shortly.
+func (h *Handler) enqueueTranscode(video *types.Video) {
+	job := types.TranscodeJob{VideoID: video.ID, VideoFile: video.VideoFile}
+	if err := h.transcoder.Enqueue(job); err != nil {
+		log.Printf("could not enqueue transcode for video %d: %v", video.ID, err)
+	}
+}
+
+
+// refreshCourseStats brings the course runtime and lecture counts in line with
+// its content. The content change has already been saved, so a failure here
+// is logged rather than returned to the client.
+func (h *Handler) refreshCourseStats(courseID int) {
+	if err := h.teacher.RefreshCourseStats(courseID); err != nil {
+		log.Printf("could not refresh stats for course %d: %v", courseID, err)
+	}
+	h.reindexCourse(courseID)
+}
+
+
+// reindexCourse brings the search index in line with a course that was just
+// saved. Like the stats, the change is already stored, so failures are only
+// logged; the periodic rebuild catches up.
+func (h *Handler) reindexCourse(courseID int) {
+	if err := h.indexer.IndexCourse(courseID); err != nil {
+		log.Printf("could not index course %d: %v", courseID, err)
+	}
+}
+
+
+// reindexCategory refreshes the indexed courses under a category that was
+// renamed, moved or merged.
+func (h *Handler) reindexCategory(categoryID int) {
+	if err := h.indexer.IndexCategory(categoryID); err != nil {
+		log.Printf("could not index the courses of category %d: %v", categoryID, err)
+	}
+}
+
+
+func (h *Handler) unindexCourse(courseID int) {
+	if err := h.indexer.RemoveCourse(courseID); err != nil {
+		log.Printf("could not remove course %d from the search index: %v", courseID, err)
+	}
+}
+
+
 // COURSE BY CATEGORY
 func (h *Handler) courseByCategoryHandle(writer http.ResponseWriter, request *http.Request) {
 	userID, err := auth.GetTeacherIDFromToken(request)
@@ -851,8 +1034,18 @@ func (h *Handler) courseByCategoryHandle(writer http.ResponseWriter, request *ht
         return
     }
 
-	courses, err := h.teacher.GetCoursesByCategory(categoryID, teacher.ID)
+	params, err := pagination.FromRequest(request, "category_courses", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	courses, err := h.teacher.GetCoursesByCategory(categoryID, teacher.ID, params)
 	if err != nil  {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
 		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("could not fetch courses: %v", err))
 		return
 	}
@@ -883,8 +1076,18 @@ func (h *Handler) sectionByCourseHandle(writer http.ResponseWriter, request *htt
         return
     }
 
-	sections, err := h.teacher.GetSectionsByCourse(courseID, teacher.ID)
+	params, err := pagination.FromRequest(request, "sections", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	sections, err := h.teacher.GetSectionsByCourse(courseID, teacher.ID, params)
 	if err!= nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
         utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("could not fetch sections: %v", err))
         return
     }
@@ -915,8 +1118,18 @@ func (h *Handler) videoBySectionHandle(writer http.ResponseWriter, request *http
         return
     }
 
-	videos, err := h.teacher.GetVideosBySection(sectionID, teacher.ID)
+	params, err := pagination.FromRequest(request, "videos", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	videos, err := h.teacher.GetVideosBySection(sectionID, teacher.ID, params)
 	if err!= nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
         utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("could not fetch videos: %v", err))
         return
     }
@@ -2,10 +2,17 @@ package teacher
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
 )
 
 type Store struct {
@@ -19,6 +26,7 @@ func NewStore(db *sql.DB) *Store {
 
 var ErrDuplicateCategory = errors.New("category already exists")
 var ErrDuplicateCourse = errors.New("course with the same name already exists")
+var ErrInvalidTransition = errors.New("course is not in a state that allows this action")
 
 // GetTeacherByUserID retrieves the teacher associated with the given user ID
 func (s *Store) GetTeacherByUserID(userID int) (*types.Teacher, error) {
@@ -53,7 +61,7 @@ func (s *Store) GetTeacherByUserID(userID int) (*types.Teacher, error) {
 func (s *Store) GetCoursesByTeacherID(teacherID int) ([]types.Course, error) {
 	var courses []types.Course
 
-	query := `SELECT id, teacher_id, category_id, name, slug, description, price 
+	query := `SELECT id, teacher_id, category_id, name, slug, description, price, status 
 			FROM courses 
 			WHERE teacher_id = $1`
 	
@@ -73,6 +81,7 @@ func (s *Store) GetCoursesByTeacherID(teacherID int) ([]types.Course, error) {
 			&course.Slug,
 			&course.Description,
 			&course.Price,
+			&course.Status,
 		)
 		if err != nil {
 			return nil, err
@@ -87,75 +96,90 @@ func (s *Store) GetCoursesByTeacherID(teacherID int) ([]types.Course, error) {
 }
 
 
-func (s *Store) CreateCategory(category *types.Category) error {
-	var existingCategoryID int
-	err := s.db.QueryRow("SELECT id FROM categories WHERE slug = $1", category.Slug).Scan(&existingCategoryID)
-	
-	if err != nil && err != sql.ErrNoRows { 
-        // If there's an error other than no rows, return it
-        return err
-    }
-	
-    if err == nil { 
-        // If no error, that means a category with the same slug exists (duplicate)
-        return ErrDuplicateCategory
-    }
+// CATEGORY TAXONOMY
 
-	query := `INSERT INTO categories (teacher_id, name, slug, description, created_at, modified_at)
-	        VALUES ($1, $2, $3, $4, NOW(), NOW()) RETURNING id;`
-	
-	// Insert the new category and return the new ID
-	err = s.db.QueryRow(query, category.TeacherID, category.Name, category.Slug, category.Description).Scan(&category.ID)
+var ErrCategoryNotFound = errors.New("category not found")
+var ErrCategoryCycle = errors.New("a category cannot be moved under itself or its descendants")
+var ErrCategoryInUse = errors.New("category still has courses or subcategories")
+
+const categoryColumns = `c.id, c.parent_id, c.name, c.slug, COALESCE(c.description, ''),
+	(SELECT COUNT(*) FROM courses WHERE category_id = c.id), c.created_at, c.modified_at`
+
+func scanCategory(row interface{ Scan(...interface{}) error }) (*types.Category, error) {
+	var category types.Category
+	var parentID sql.NullInt64
+	err := row.Scan(
+		&category.ID,
+		&parentID,
+		&category.Name,
+		&category.Slug,
+		&category.Description,
+		&category.CourseCount,
+		&category.CreatedAt,
+		&category.ModifiedAt,
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	if parentID.Valid {
+		parent := int(parentID.Int64)
+		category.ParentID = &parent
+	}
+	return &category, nil
+}
+
 
+// checkCategoryName reports ErrDuplicateCategory when a sibling under
+// parentID already uses name. exceptID skips the category being renamed.
+func checkCategoryName(q querier, parentID *int, name string, exceptID int) error {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM categories
+		WHERE COALESCE(parent_id, 0) = COALESCE($1, 0) AND LOWER(name) = LOWER($2) AND id <> $3)`
+	if err := q.QueryRow(query, parentID, name, exceptID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrDuplicateCategory
+	}
 	return nil
 }
 
 
-func (s *Store) GetCategory() ([]types.Category, error) {
-	query := `SELECT id, teacher_id, name, slug, description, created_at, modified_at FROM categories`
+func (s *Store) CreateCategory(category *types.Category) error {
+	if err := checkCategoryName(s.db, category.ParentID, category.Name, 0); err != nil {
+		return err
+	}
 
-	rows, err := s.db.Query(query)
+	// Reserve the ID first so the slug can be set in the same insert
+	err := s.db.QueryRow(`SELECT nextval(pg_get_serial_sequence('categories', 'id'))`).Scan(&category.ID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	category.Slug = utils.Slugify(category.Name, category.ID)
 
-	var categories []types.Category
-	for rows.Next() {
-		var category types.Category
-		err := rows.Scan(
-			&category.ID,
-			&category.TeacherID,
-			&category.Name,
-			&category.Slug,
-			&category.Description,
-			&category.CreatedAt,
-			&category.ModifiedAt,
-		)
-		if err != nil {
-			return nil, err
+	query := `INSERT INTO categories (id, parent_id, name, slug, description, created_at, modified_at)
+	        VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING created_at, modified_at`
+	err = s.db.QueryRow(query, category.ID, category.ParentID, category.Name, category.Slug, category.Description).Scan(
+		&category.CreatedAt,
+		&category.ModifiedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrCategoryNotFound
 		}
-
-		categories = append(categories, category)
-	}
-
-	// Check for any error encountered during iteration
-	if err := rows.Err(); err != nil {
-		return nil, err
+		return err
 	}
 
-	return categories, nil
+	return nil
 }
 
 
-func (s *Store) GetCategoriesByTeacher(teacherID int) ([]types.Category, error) {
-	query := `SELECT id, teacher_id, name, slug, description, created_at, modified_at 
-	        FROM categories WHERE teacher_id = $1`
+// GetCategory returns every category in the taxonomy, parents before their
+// children.
+func (s *Store) GetCategory() ([]types.Category, error) {
+	query := `SELECT ` + categoryColumns + ` FROM categories c ORDER BY c.parent_id NULLS FIRST, c.name`
 
-	rows, err := s.db.Query(query, teacherID)
+	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -163,21 +187,12 @@ func (s *Store) GetCategoriesByTeacher(teacherID int) ([]types.Category, error)
 
 	var categories []types.Category
 	for rows.Next() {
-		var category types.Category
-		err := rows.Scan(
-			&category.ID,
-			&category.TeacherID,
-			&category.Name,
-			&category.Slug,
-			&category.Description,
-			&category.CreatedAt,
-			&category.ModifiedAt,
-		)
+		category, err := scanCategory(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		categories = append(categories, category)
+		categories = append(categories, *category)
 	}
 
 	// Check for any error encountered during iteration
@@ -189,54 +204,161 @@ func (s *Store) GetCategoriesByTeacher(teacherID int) ([]types.Category, error)
 }
 
 
-
 func (s *Store) GetCategoryByID(id int) (*types.Category, error) {
-	query := `SELECT id, teacher_id, name, slug, description, created_at, modified_at
-	    	FROM categories WHERE id = $1;`
-
-	var category types.Category
-	err := s.db.QueryRow(query, id).Scan(
-		&category.ID,
-		&category.TeacherID,
-        &category.Name,
-        &category.Slug,
-        &category.Description,
-        &category.CreatedAt,
-		&category.ModifiedAt,
-	)
+	query := `SELECT ` + categoryColumns + ` FROM categories c WHERE c.id = $1`
 
+	category, err := scanCategory(s.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-            return nil, nil
+            return nil, ErrCategoryNotFound
         }
         return nil, err
 	}
-	return &category, nil
+	return category, nil
+}
+
+
+// isCategoryDescendant reports whether candidate is id itself or one of its
+// descendants.
+func isCategoryDescendant(q querier, id int, candidate int) (bool, error) {
+	var found bool
+	query := `
+	WITH RECURSIVE tree AS (
+		SELECT id FROM categories WHERE id = $1
+		UNION
+		SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id
+	)
+	SELECT EXISTS(SELECT 1 FROM tree WHERE id = $2)`
+	err := q.QueryRow(query, id, candidate).Scan(&found)
+	return found, err
 }
 
 
 func (s *Store) UpdateCategory(category *types.Category) error {
-	query := `UPDATE categories SET name = $1, slug = $2, description = $3, modified_at = NOW()
-	    	WHERE id = $4;`
+	if category.ParentID != nil {
+		cycle, err := isCategoryDescendant(s.db, category.ID, *category.ParentID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrCategoryCycle
+		}
+	}
+
+	if err := checkCategoryName(s.db, category.ParentID, category.Name, category.ID); err != nil {
+		return err
+	}
+
+	query := `UPDATE categories SET parent_id = $1, name = $2, slug = $3, description = $4, modified_at = NOW()
+	    	WHERE id = $5;`
 	
-	_, err := s.db.Exec(query, category.Name, category.Slug, category.Description, category.ID)
+	_, err := s.db.Exec(query, category.ParentID, category.Name, category.Slug, category.Description, category.ID)
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrCategoryNotFound
+		}
 		return err
 	}
 	return nil
 }
 
 
+// DeleteCategory removes an empty leaf category. Courses cascade on category
+// deletion, so categories in use must be merged away instead.
 func (s *Store) DeleteCategory(id int) error {
-	query := `DELETE FROM categories WHERE id = $1;`
+	var inUse bool
+	query := `SELECT EXISTS(SELECT 1 FROM courses WHERE category_id = $1)
+		OR EXISTS(SELECT 1 FROM categories WHERE parent_id = $1)`
+	if err := s.db.QueryRow(query, id).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return ErrCategoryInUse
+	}
 
-	_, err := s.db.Exec(query, id)
+	_, err := s.db.Exec(`DELETE FROM categories WHERE id = $1;`, id)
 	if err!= nil {
         return err
     }
 	return nil
 }
 
+
+// MergeCategory folds source into target: its courses and subcategories are
+// moved to target and source is deleted. It returns the number of courses
+// moved.
+func (s *Store) MergeCategory(sourceID int, targetID int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock both rows so concurrent merges cannot interleave
+	ids, err := queryIDs(tx, `SELECT id FROM categories WHERE id = ANY($1) FOR UPDATE`, pq.Array([]int{sourceID, targetID}))
+	if err != nil {
+		return 0, err
+	}
+	if !ids[sourceID] || !ids[targetID] {
+		return 0, ErrCategoryNotFound
+	}
+
+	cycle, err := isCategoryDescendant(tx, sourceID, targetID)
+	if err != nil {
+		return 0, err
+	}
+	if cycle {
+		return 0, ErrCategoryCycle
+	}
+
+	result, err := tx.Exec(`UPDATE courses SET category_id = $1 WHERE category_id = $2`, targetID, sourceID)
+	if err != nil {
+		return 0, fmt.Errorf("could not move courses: %v", err)
+	}
+	moved, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// Children keep their names, so a clash with one of target's children
+	// has to be resolved by merging those first
+	rows, err := tx.Query(`SELECT name FROM categories WHERE parent_id = $1`, sourceID)
+	if err != nil {
+		return 0, err
+	}
+	var children []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		children = append(children, name)
+	}
+	rows.Close()
+	for _, name := range children {
+		if err := checkCategoryName(tx, &targetID, name, 0); err != nil {
+			if err == ErrDuplicateCategory {
+				return 0, fmt.Errorf("%w: %q exists under both categories", ErrDuplicateCategory, name)
+			}
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE categories SET parent_id = $1, modified_at = NOW() WHERE parent_id = $2`, targetID, sourceID); err != nil {
+		return 0, fmt.Errorf("could not move subcategories: %v", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM categories WHERE id = $1`, sourceID); err != nil {
+		return 0, fmt.Errorf("could not delete category: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return int(moved), nil
+}
+
 // COURSE MANAGEMENT
 
 func (s *Store) CheckDuplicateCourse(teacherID int, courseName string) (bool, error) {
@@ -251,31 +373,85 @@ func (s *Store) CheckDuplicateCourse(teacherID int, courseName string) (bool, er
 
 
 
-func (s *Store) CreateCourse(course *types.Course) error {
-	query := `INSERT INTO courses (teacher_id, category_id, name, slug, description, price, created_at, modified_at)
-	    	VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW()) RETURNING id`
-	err := s.db.QueryRow(query, course.TeacherID, course.CategoryID, course.Name, course.Slug, course.Description, course.Price).Scan(&course.ID)
-	if err!= nil {
-        return err
-    }
+// CreateCourse inserts a draft course and its tags in one transaction. The ID
+// is reserved up front so the slug can be derived from it in the same insert.
+func (s *Store) CreateCourse(course *types.Course, tags []types.CourseTag) error {
+	if course.Language == "" {
+		course.Language = types.DefaultCourseLanguage
+	}
+	if course.Level == "" {
+		course.Level = types.LevelAllLevels
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var courseID int
+	if err := tx.QueryRow(`SELECT nextval(pg_get_serial_sequence('courses', 'id'))`).Scan(&courseID); err != nil {
+		return fmt.Errorf("could not reserve course ID: %v", err)
+	}
+	slug := utils.Slugify(course.Name, courseID)
+
+	query := `INSERT INTO courses (id, teacher_id, category_id, name, slug, description, for_who, reason, intro_video, image, price,
+			language, level, created_at, modified_at)
+	    	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NOW(), NOW())`
+	_, err = tx.Exec(query, courseID, course.TeacherID, course.CategoryID, course.Name, slug, course.Description,
+		course.ForWho, course.Reason, course.IntroVideo, course.Image, course.Price,
+		course.Language, course.Level)
+	if err != nil {
+		return err
+	}
+
+	if err := setCourseTags(tx, courseID, tags); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	course.ID = courseID
+	course.Slug = slug
+	course.Status = types.CourseDraft
 	return nil
 }
 
 
-func (s *Store) UpdateCourse(course *types.Course) error {
-	query := `UPDATE courses SET category_id = $1, name = $2, slug = $3, description = $4, price = $5, modified_at = NOW()
-	        WHERE id = $6`
-	_, err := s.db.Exec(query, course.CategoryID, course.Name, course.Slug, course.Description, course.Price, course.ID)
+// UpdateCourse saves the course's details and, when tags is not nil, replaces
+// its tags in the same transaction.
+func (s *Store) UpdateCourse(course *types.Course, tags []types.CourseTag) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE courses SET category_id = $1, name = $2, slug = $3, description = $4, for_who = $5, reason = $6,
+			intro_video = $7, image = $8, price = $9, language = $10, level = $11, modified_at = NOW()
+	        WHERE id = $12`
+	_, err = tx.Exec(query, course.CategoryID, course.Name, course.Slug, course.Description, course.ForWho, course.Reason,
+		course.IntroVideo, course.Image, course.Price, course.Language, course.Level, course.ID)
 	if err != nil {
 
 		return err
 	}
-	return nil
+
+	if tags != nil {
+		if err := setCourseTags(tx, course.ID, tags); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func (s *Store) GetCourseByID(courseID int) (*types.Course, error) {
     var course types.Course
-    query := `SELECT id, teacher_id, category_id, name, slug, description, price, created_at  FROM courses WHERE id = $1`
+    query := `SELECT id, teacher_id, category_id, name, slug, description, COALESCE(for_who, ''), COALESCE(reason, ''),
+		COALESCE(intro_video, ''), COALESCE(image, ''), price, language, level, section_count, lecture_count,
+		status, COALESCE(rejection_reason, ''), submitted_at, published_at, created_at
+		FROM courses WHERE id = $1`
     err := s.db.QueryRow(query, courseID).Scan(
         &course.ID,
         &course.TeacherID,
@@ -283,7 +459,19 @@ func (s *Store) GetCourseByID(courseID int) (*types.Course, error) {
         &course.Name,
         &course.Slug,
         &course.Description,
+        &course.ForWho,
+        &course.Reason,
+        &course.IntroVideo,
+        &course.Image,
         &course.Price,
+		&course.Language,
+		&course.Level,
+		&course.SectionCount,
+		&course.LectureCount,
+		&course.Status,
+		&course.RejectionReason,
+		&course.SubmittedAt,
+		&course.PublishedAt,
 		&course.CreatedAt,
     )
     if err != nil {
@@ -304,18 +492,34 @@ func (s *Store) DeleteCourse(id int) error {
 }
 
 
-func (s *Store) GetCourses(limit, offset int) ([]types.Course, error) {
-	query := `SELECT c.id, c.teacher_id, u.first_name, u.last_name, c.category_id, c.name, c.slug, c.description, c.image, c.price, c.created_at  
+// courseKeyset lists the newest courses first.
+var courseKeyset = pagination.Keyset{Columns: []string{"c.created_at", "c.id"}, Desc: true}
+
+func courseKey(course types.Course) []interface{} {
+	return []interface{}{course.CreatedAt, course.ID}
+}
+
+
+func (s *Store) GetCourses(params pagination.Params) (pagination.Page[types.Course], error) {
+	var page pagination.Page[types.Course]
+
+	cursor, args, err := courseKeyset.Where(params, nil)
+	if err != nil {
+		return page, err
+	}
+	order, args := courseKeyset.OrderBy(params, args)
+
+	query := `SELECT c.id, c.teacher_id, u.first_name, u.last_name, c.category_id, c.name, c.slug, c.description, c.image, c.price,
+	c.total_duration, c.section_count, c.lecture_count, GREATEST(c.modified_at, c.content_updated_at), c.created_at,
+	c.rating_average, c.rating_count, c.review_count, c.rating_histogram
 	FROM courses AS c
 	JOIN teachers AS t ON c.teacher_id = t.id
 	JOIN users AS u ON t.user_id = u.id
-	ORDER BY created_at 
-	DESC LIMIT $1 OFFSET $2
-	`
+	WHERE c.status = 'published'` + cursor + order
 
-	rows, err := s.db.Query(query, limit, offset)
+	rows, err := s.db.Query(query, args...)
 	if err!= nil {
-        return nil, err
+        return page, err
     }
 	defer rows.Close()
 	var courses []types.Course
@@ -334,24 +538,33 @@ func (s *Store) GetCourses(limit, offset int) ([]types.Course, error) {
             &course.Description,
 			&image,
             &course.Price,
+			&course.TotalDuration,
+			&course.SectionCount,
+			&course.LectureCount,
+			&course.ContentUpdatedAt,
 			&course.CreatedAt,
+			&course.RatingAverage,
+			&course.RatingCount,
+			&course.ReviewCount,
+			pq.Array(&course.RatingHistogram),
         )
         if err!= nil {
-            return nil, err
+            return page, err
         }
+        course.Image = image.String
         courses = append(courses, course)
 	}
 	if err := rows.Err(); err!= nil {
-        return nil, err
+        return page, err
     }
-	return courses, nil
+	return pagination.NewPage(courses, params, courseKey), nil
 }
 
 
 func (s *Store) CountCourses() (int, error) {
 	var count int
 
-	query := `SELECT COUNT(*) FROM courses`
+	query := `SELECT COUNT(*) FROM courses WHERE status = 'published'`
 	err := s.db.QueryRow(query).Scan(&count)
 	if err!= nil {
         return 0, err
@@ -422,14 +635,16 @@ func (s *Store) DeleteSection(id int) error {
 // VIDEO MANAGEMENT
 
 func (s *Store) CreateVideo(video *types.Video) error {
-    query := `INSERT INTO videos (section_id, title, video_file, "order", created_at, modified_at)
-            VALUES ($1, $2, $3, $4, NOW(), NOW()) RETURNING id`
+    query := `INSERT INTO videos (section_id, title, video_file, "order", status, created_at, modified_at)
+            VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING id`
+    video.Status = types.VideoQueued
     err := s.db.QueryRow(
         query,
         video.SectionID,
         video.Title,
         video.VideoFile,
         video.Order,
+        video.Status,
     ).Scan(&video.ID)
     if err != nil {
         return err
@@ -440,7 +655,9 @@ func (s *Store) CreateVideo(video *types.Video) error {
 
 func (s *Store) GetVideoByID(id int) (*types.Video, error) {
 	var video types.Video
-    query := `SELECT id, section_id, title, video_file, "order", created_at FROM videos WHERE id = $1`
+    query := `SELECT id, section_id, title, video_file, "order", status, COALESCE(hls_playlist, ''),
+			COALESCE(thumbnail, ''), duration, COALESCE(transcode_error, ''), created_at
+			FROM videos WHERE id = $1`
 
     err := s.db.QueryRow(query, id).Scan(
         &video.ID,
@@ -448,6 +665,11 @@ func (s *Store) GetVideoByID(id int) (*types.Video, error) {
         &video.Title,
         &video.VideoFile,
         &video.Order,
+        &video.Status,
+        &video.HLSPlaylist,
+        &video.Thumbnail,
+        &video.Duration,
+        &video.TranscodeError,
         &video.CreatedAt,
     )
     if err!= nil {
@@ -469,6 +691,99 @@ func (s *Store) UpdateVideo(video *types.Video) error {
     return nil
 }
 
+// UpdateVideoStatus records the transcoding state of a video. Moving a video
+// back to queued clears the outputs of any previous run.
+func (s *Store) UpdateVideoStatus(videoID int, status types.VideoStatus, errMsg string) error {
+	query := `UPDATE videos SET status = $1, transcode_error = NULLIF($2, ''), modified_at = NOW() WHERE id = $3`
+	if status == types.VideoQueued {
+		query = `UPDATE videos SET status = $1, transcode_error = NULLIF($2, ''), hls_playlist = NULL,
+				thumbnail = NULL, duration = 0, modified_at = NOW() WHERE id = $3`
+	}
+	_, err := s.db.Exec(query, status, errMsg, videoID)
+	if err != nil {
+		return fmt.Errorf("could not update video status: %v", err)
+	}
+	return nil
+}
+
+
+// SetTranscodeStatus records the progress of a transcode job, unless the
+// video file was replaced since the job was queued.
+func (s *Store) SetTranscodeStatus(videoID int, videoFile string, status types.VideoStatus, errMsg string) (bool, error) {
+	result, err := s.db.Exec(`UPDATE videos SET status = $1, transcode_error = NULLIF($2, ''), modified_at = NOW()
+		WHERE id = $3 AND video_file = $4`, status, errMsg, videoID, videoFile)
+	if err != nil {
+		return false, fmt.Errorf("could not update video status: %v", err)
+	}
+	updated, _ := result.RowsAffected()
+	return updated > 0, nil
+}
+
+
+// SaveTranscodeResult stores the outputs of a finished transcode, marks the
+// video as ready and refreshes the course runtime. The update is skipped if
+// the video file was replaced while the job was running, since a newer job
+// will produce fresh outputs.
+func (s *Store) SaveTranscodeResult(videoID int, videoFile string, result *types.TranscodeResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE videos SET status = $1, hls_playlist = $2, thumbnail = $3, duration = $4,
+			transcode_error = NULL, modified_at = NOW()
+			WHERE id = $5 AND video_file = $6
+			RETURNING (SELECT course_id FROM sections WHERE id = videos.section_id)`
+	var courseID sql.NullInt64
+	err = tx.QueryRow(query, types.VideoReady, result.Playlist, result.Thumbnail, result.Duration, videoID, videoFile).Scan(&courseID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not save transcode result: %v", err)
+	}
+
+	// Detached videos are in no course until a rollback restores them
+	if courseID.Valid {
+		if _, err := tx.Exec(refreshCourseStatsQuery, courseID.Int64); err != nil {
+			return fmt.Errorf("could not refresh course stats: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+
+// GetPendingTranscodeJobs returns the videos in one of statuses, e.g. those
+// still queued, or also those interrupted mid-run by a restart.
+func (s *Store) GetPendingTranscodeJobs(statuses ...types.VideoStatus) ([]types.TranscodeJob, error) {
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+	query := `SELECT id, video_file FROM videos WHERE status = ANY($1) AND section_id IS NOT NULL ORDER BY id`
+
+	rows, err := s.db.Query(query, pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch pending transcode jobs: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []types.TranscodeJob
+	for rows.Next() {
+		var job types.TranscodeJob
+		if err := rows.Scan(&job.VideoID, &job.VideoFile); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
 func (s *Store) DeleteVideo(id int) error {
 	query := `DELETE FROM videos WHERE id = $1;`
     _, err := s.db.Exec(query, id)
@@ -480,92 +795,281 @@ func (s *Store) DeleteVideo(id int) error {
 
 
 
-// Course Builder Management
-
-func (s *Store) GetCoursesByCategory(categoryID int, teacherID int) ([]types.Course, error) {
-	query := `
-	SELECT id, teacher_id, category_id, name, slug, description, image, price, created_at
-	FROM courses WHERE category_id = $1 AND teacher_id = $2
-	ORDER BY created_at DESC
-	`
+// COURSE CONTENT STATS
 
-	rows, err := s.db.Query(query, categoryID, teacherID)
-	if err!= nil {
-        return nil, err
-    }
-	defer rows.Close()
+const refreshCourseStatsQuery = `
+	UPDATE courses c SET
+		section_count = (SELECT COUNT(*) FROM sections s WHERE s.course_id = c.id),
+		lecture_count = (SELECT COUNT(*) FROM videos v JOIN sections s ON v.section_id = s.id WHERE s.course_id = c.id),
+		total_duration = (SELECT COALESCE(SUM(v.duration), 0) FROM videos v JOIN sections s ON v.section_id = s.id WHERE s.course_id = c.id),
+		content_updated_at = NOW()
+	WHERE c.id = $1`
 
-	var courses []types.Course
-	for rows.Next() {
-		var course types.Course
-        var image sql.NullString
-        err := rows.Scan(
-            &course.ID,
-            &course.TeacherID,
-			&course.CategoryID,
-            &course.Name,
-            &course.Slug,
-            &course.Description,
-            &image,
-            &course.Price,
-            &course.CreatedAt,
-        )
-        if err!= nil {
-            return nil, err
-        }
-        courses = append(courses, course)
+// RefreshCourseStats recomputes the section count, lecture count and total
+// runtime of a course from its sections and videos.
+func (s *Store) RefreshCourseStats(courseID int) error {
+	_, err := s.db.Exec(refreshCourseStatsQuery, courseID)
+	if err != nil {
+		return fmt.Errorf("could not refresh course stats: %v", err)
 	}
-	return courses, nil
+	return nil
 }
 
 
-func (s *Store) GetSectionsByCourse(courseID int, teacherID int) ([]types.Section, error) {
+
+// COURSE PUBLISHING WORKFLOW
+
+// UpdateCourseStatus moves a course from one status to another. The update
+// only applies while the course is still in the expected status, so two
+// concurrent reviews cannot both win.
+func (s *Store) UpdateCourseStatus(courseID int, from, to types.CourseStatus, reason string, reviewerID int) error {
 	query := `
-	SELECT s.id, s.course_id, s.title, s.order 
-	FROM sections s
-	JOIN courses c ON s.course_id = c.id
-	WHERE s.course_id = $1 AND c.teacher_id = $2
-	`
-	rows, err := s.db.Query(query, courseID, teacherID)
-	if err!= nil {
-        return nil, err
-    }
-	defer rows.Close()
+	UPDATE courses SET
+		status = $1,
+		rejection_reason = NULLIF($2, ''),
+		submitted_at = CASE WHEN $1 = 'submitted' THEN NOW() ELSE submitted_at END,
+		reviewed_at = CASE WHEN $1 IN ('approved', 'rejected') THEN NOW() ELSE reviewed_at END,
+		reviewed_by = CASE WHEN $1 IN ('approved', 'rejected') THEN NULLIF($3, 0) ELSE reviewed_by END,
+		published_at = CASE WHEN $1 = 'published' THEN NOW() ELSE published_at END,
+		modified_at = NOW()
+	WHERE id = $4 AND status = $5`
+
+	result, err := s.db.Exec(query, to, reason, reviewerID, courseID, from)
+	if err != nil {
+		return fmt.Errorf("could not update course status: %v", err)
+	}
 
-	var sections []types.Section
-	for rows.Next() {
-		var section types.Section
-        err := rows.Scan(
-            &section.ID,
-            &section.CourseID,
-            &section.Title,
-			&section.Order,
-        )
-        if err!= nil {
-            return nil, err
-        }
-        sections = append(sections, section)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check affected rows: %v", err)
 	}
-	return sections, nil
+	if rowsAffected == 0 {
+		return ErrInvalidTransition
+	}
+	return nil
 }
 
 
-func (s *Store) GetVideosBySection(sectionID int, teacherID int) ([]types.Video, error) {
-	query := `
-	SELECT v.id, v.section_id, v.title, v.video_file, v.order
-		FROM videos v
-		JOIN sections s ON v.section_id = s.id
-		JOIN courses c ON s.course_id = c.id
-		WHERE v.section_id = $1 AND c.teacher_id = $2
-	`
+// statusKeyset lists courses oldest submission first. Courses that were
+// never submitted sort by creation time.
+var statusKeyset = pagination.Keyset{Columns: []string{"COALESCE(c.submitted_at, c.created_at)", "c.id"}}
 
-	rows, err := s.db.Query(query, sectionID, teacherID)
-	if err!= nil {
-        return nil, err
-    }
-	defer rows.Close()
+func statusKey(course types.Course) []interface{} {
+	at := course.CreatedAt
+	if course.SubmittedAt != nil {
+		at = *course.SubmittedAt
+	}
+	return []interface{}{at.Format(time.RFC3339Nano), course.ID}
+}
 
-	var videos []types.Video
+
+func (s *Store) GetCoursesByStatus(status types.CourseStatus, params pagination.Params) (pagination.Page[types.Course], error) {
+	var page pagination.Page[types.Course]
+
+	cursor, args, err := statusKeyset.Where(params, []interface{}{status})
+	if err != nil {
+		return page, err
+	}
+	order, args := statusKeyset.OrderBy(params, args)
+
+	query := `SELECT c.id, c.teacher_id, u.first_name, u.last_name, c.category_id, c.name, c.slug, c.description, c.price,
+	c.section_count, c.lecture_count, c.total_duration, c.status, c.submitted_at, c.created_at
+	FROM courses AS c
+	JOIN teachers AS t ON c.teacher_id = t.id
+	JOIN users AS u ON t.user_id = u.id
+	WHERE c.status = $1` + cursor + order
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return page, fmt.Errorf("could not fetch courses by status: %v", err)
+	}
+	defer rows.Close()
+
+	courses := []types.Course{}
+	for rows.Next() {
+		var course types.Course
+		err := rows.Scan(
+			&course.ID,
+			&course.TeacherID,
+			&course.FirstName,
+			&course.LastName,
+			&course.CategoryID,
+			&course.Name,
+			&course.Slug,
+			&course.Description,
+			&course.Price,
+			&course.SectionCount,
+			&course.LectureCount,
+			&course.TotalDuration,
+			&course.Status,
+			&course.SubmittedAt,
+			&course.CreatedAt,
+		)
+		if err != nil {
+			return page, err
+		}
+		courses = append(courses, course)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pagination.NewPage(courses, params, statusKey), nil
+}
+
+
+// CountEmptySections returns how many sections of a course have no videos.
+func (s *Store) CountEmptySections(courseID int) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM sections s
+		WHERE s.course_id = $1
+		AND NOT EXISTS (SELECT 1 FROM videos v WHERE v.section_id = s.id)`
+
+	var count int
+	err := s.db.QueryRow(query, courseID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("could not count empty sections: %v", err)
+	}
+	return count, nil
+}
+
+
+
+// Course Builder Management
+
+// categoryCourseKeyset lists a teacher's courses in a category newest first.
+var categoryCourseKeyset = pagination.Keyset{Columns: []string{"created_at", "id"}, Desc: true}
+
+
+func (s *Store) GetCoursesByCategory(categoryID int, teacherID int, params pagination.Params) (pagination.Page[types.Course], error) {
+	var page pagination.Page[types.Course]
+
+	cursor, args, err := categoryCourseKeyset.Where(params, []interface{}{categoryID, teacherID})
+	if err != nil {
+		return page, err
+	}
+	order, args := categoryCourseKeyset.OrderBy(params, args)
+
+	query := `
+	SELECT id, teacher_id, category_id, name, slug, description, image, price, status, created_at
+	FROM courses WHERE category_id = $1 AND teacher_id = $2` + cursor + order
+
+	rows, err := s.db.Query(query, args...)
+	if err!= nil {
+        return page, err
+    }
+	defer rows.Close()
+
+	courses := []types.Course{}
+	for rows.Next() {
+		var course types.Course
+        var image sql.NullString
+        err := rows.Scan(
+            &course.ID,
+            &course.TeacherID,
+			&course.CategoryID,
+            &course.Name,
+            &course.Slug,
+            &course.Description,
+            &image,
+            &course.Price,
+            &course.Status,
+            &course.CreatedAt,
+        )
+        if err!= nil {
+            return page, err
+        }
+        courses = append(courses, course)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pagination.NewPage(courses, params, courseKey), nil
+}
+
+
+// sectionKeyset lists sections in course order.
+var sectionKeyset = pagination.Keyset{Columns: []string{`s."order"`, "s.id"}}
+
+func sectionKey(section types.Section) []interface{} {
+	return []interface{}{section.Order, section.ID}
+}
+
+
+func (s *Store) GetSectionsByCourse(courseID int, teacherID int, params pagination.Params) (pagination.Page[types.Section], error) {
+	var page pagination.Page[types.Section]
+
+	cursor, args, err := sectionKeyset.Where(params, []interface{}{courseID, teacherID})
+	if err != nil {
+		return page, err
+	}
+	order, args := sectionKeyset.OrderBy(params, args)
+
+	query := `
+	SELECT s.id, s.course_id, s.title, s."order"
+	FROM sections s
+	JOIN courses c ON s.course_id = c.id
+	WHERE s.course_id = $1 AND c.teacher_id = $2` + cursor + order
+
+	rows, err := s.db.Query(query, args...)
+	if err!= nil {
+        return page, err
+    }
+	defer rows.Close()
+
+	sections := []types.Section{}
+	for rows.Next() {
+		var section types.Section
+        err := rows.Scan(
+            &section.ID,
+            &section.CourseID,
+            &section.Title,
+			&section.Order,
+        )
+        if err!= nil {
+            return page, err
+        }
+        sections = append(sections, section)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pagination.NewPage(sections, params, sectionKey), nil
+}
+
+
+// videoKeyset lists videos in section order.
+var videoKeyset = pagination.Keyset{Columns: []string{`v."order"`, "v.id"}}
+
+func videoKey(video types.Video) []interface{} {
+	return []interface{}{video.Order, video.ID}
+}
+
+
+func (s *Store) GetVideosBySection(sectionID int, teacherID int, params pagination.Params) (pagination.Page[types.Video], error) {
+	var page pagination.Page[types.Video]
+
+	cursor, args, err := videoKeyset.Where(params, []interface{}{sectionID, teacherID})
+	if err != nil {
+		return page, err
+	}
+	order, args := videoKeyset.OrderBy(params, args)
+
+	query := `
+	SELECT v.id, v.section_id, v.title, v.video_file, v."order", v.status, COALESCE(v.hls_playlist, ''),
+		COALESCE(v.thumbnail, ''), v.duration, COALESCE(v.transcode_error, '')
+		FROM videos v
+		JOIN sections s ON v.section_id = s.id
+		JOIN courses c ON s.course_id = c.id
+		WHERE v.section_id = $1 AND c.teacher_id = $2` + cursor + order
+
+	rows, err := s.db.Query(query, args...)
+	if err!= nil {
+        return page, err
+    }
+	defer rows.Close()
+
+	videos := []types.Video{}
 	for rows.Next() {
 		var video types.Video
         err := rows.Scan(
@@ -574,13 +1078,21 @@ func (s *Store) GetVideosBySection(sectionID int, teacherID int) ([]types.Video,
             &video.Title,
             &video.VideoFile,
 			&video.Order,
+			&video.Status,
+			&video.HLSPlaylist,
+			&video.Thumbnail,
+			&video.Duration,
+			&video.TranscodeError,
         )
         if err!= nil {
-            return nil, err
+            return page, err
         }
         videos = append(videos, video)
 	}
-	return videos, nil
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pagination.NewPage(videos, params, videoKey), nil
 }
 
 
@@ -654,12 +1166,9 @@ func (s *Store) GetTeacherProfileByID(teacherID int) (map[string]interface{}, er
 
 func (s *Store) CountRatingsAndReviewsForTeacher(teacherID int) (int, int, error) {
 	query := `
-		SELECT 
-			COUNT(r.rating) AS total_ratings,
-			COUNT(CASE WHEN r.review IS NOT NULL AND r.review <> '' THEN 1 END) AS total_reviews
-		FROM ratings AS r
-		JOIN courses AS c ON r.course_id = c.id
-		WHERE c.teacher_id = $1`
+		SELECT COALESCE(SUM(rating_count), 0), COALESCE(SUM(review_count), 0)
+		FROM courses
+		WHERE teacher_id = $1`
 
 	var totalRatings, totalReviews int
 
@@ -669,4 +1178,1391 @@ func (s *Store) CountRatingsAndReviewsForTeacher(teacherID int) (int, int, error
     }
 
 	return totalRatings, totalReviews, nil
-}
\ No newline at end of file
+}
+
+
+// COURSE REVISIONS
+
+var ErrRevisionNotFound = errors.New("revision not found")
+var ErrNoDraftRevision = errors.New("course has no draft revision")
+var ErrDraftRevisionPending = errors.New("publish or discard the draft revision before rolling back")
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (s *Store) GetCourseSnapshot(courseID int) (*types.CourseSnapshot, error) {
+	return courseSnapshot(s.db, courseID)
+}
+
+// courseSnapshot reads the live state of a course, its sections and videos.
+func courseSnapshot(q querier, courseID int) (*types.CourseSnapshot, error) {
+	var snapshot types.CourseSnapshot
+	query := `SELECT COALESCE(category_id, 0), name, COALESCE(description, ''), COALESCE(for_who, ''), COALESCE(reason, ''),
+			COALESCE(intro_video, ''), COALESCE(image, ''), price, language, level
+			FROM courses WHERE id = $1`
+	err := q.QueryRow(query, courseID).Scan(
+		&snapshot.CategoryID,
+		&snapshot.Name,
+		&snapshot.Description,
+		&snapshot.ForWho,
+		&snapshot.Reason,
+		&snapshot.IntroVideo,
+		&snapshot.Image,
+		&snapshot.Price,
+		&snapshot.Language,
+		&snapshot.Level,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("course not found for ID: %d", courseID)
+		}
+		return nil, err
+	}
+
+	query = `
+	SELECT s.id, s.title, s."order", v.id, v.title, v.video_file, v."order"
+	FROM sections s
+	LEFT JOIN videos v ON v.section_id = s.id
+	WHERE s.course_id = $1
+	ORDER BY s."order", s.id, v."order", v.id`
+
+	rows, err := q.Query(query, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch course content: %v", err)
+	}
+	defer rows.Close()
+
+	snapshot.Tags, err = courseTags(q, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.Sections = []types.SectionSnapshot{}
+	for rows.Next() {
+		var section types.SectionSnapshot
+		var videoID, videoOrder sql.NullInt64
+		var videoTitle, videoFile sql.NullString
+		err := rows.Scan(&section.ID, &section.Title, &section.Order, &videoID, &videoTitle, &videoFile, &videoOrder)
+		if err != nil {
+			return nil, err
+		}
+
+		last := len(snapshot.Sections) - 1
+		if last < 0 || snapshot.Sections[last].ID != section.ID {
+			section.Videos = []types.VideoSnapshot{}
+			snapshot.Sections = append(snapshot.Sections, section)
+			last++
+		}
+		if videoID.Valid {
+			snapshot.Sections[last].Videos = append(snapshot.Sections[last].Videos, types.VideoSnapshot{
+				ID:        int(videoID.Int64),
+				Title:     videoTitle.String,
+				VideoFile: videoFile.String,
+				Order:     int(videoOrder.Int64),
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+
+func scanRevision(row *sql.Row) (*types.CourseRevision, error) {
+	var revision types.CourseRevision
+	var number sql.NullInt64
+	var authorID sql.NullInt64
+	var message sql.NullString
+	var snapshot []byte
+
+	err := row.Scan(
+		&revision.ID,
+		&revision.CourseID,
+		&number,
+		&revision.Status,
+		&authorID,
+		&message,
+		&snapshot,
+		&revision.CreatedAt,
+		&revision.PublishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.Number = int(number.Int64)
+	revision.AuthorID = int(authorID.Int64)
+	revision.Message = message.String
+	if err := json.Unmarshal(snapshot, &revision.Snapshot); err != nil {
+		return nil, fmt.Errorf("could not decode revision snapshot: %v", err)
+	}
+	return &revision, nil
+}
+
+
+// GetDraftRevision returns the staged draft of a course, or nil if there is none.
+func (s *Store) GetDraftRevision(courseID int) (*types.CourseRevision, error) {
+	query := `SELECT id, course_id, number, status, author_id, message, snapshot, created_at, published_at
+			FROM course_revisions WHERE course_id = $1 AND status = 'draft'`
+
+	revision, err := scanRevision(s.db.QueryRow(query, courseID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get draft revision: %v", err)
+	}
+	return revision, nil
+}
+
+
+func (s *Store) GetRevision(courseID int, number int) (*types.CourseRevision, error) {
+	query := `SELECT id, course_id, number, status, author_id, message, snapshot, created_at, published_at
+			FROM course_revisions WHERE course_id = $1 AND number = $2`
+
+	revision, err := scanRevision(s.db.QueryRow(query, courseID, number))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, fmt.Errorf("could not get revision: %v", err)
+	}
+	return revision, nil
+}
+
+
+// revisionKeyset lists revisions newest first. The draft has no number
+// yet and sorts above every published revision.
+var revisionKeyset = pagination.Keyset{Columns: []string{"COALESCE(number, 2147483647)", "id"}, Desc: true}
+
+func revisionKey(revision types.CourseRevision) []interface{} {
+	number := revision.Number
+	if number == 0 {
+		number = math.MaxInt32
+	}
+	return []interface{}{number, revision.ID}
+}
+
+
+// GetRevisions lists the revisions of a course without their snapshots,
+// newest first with any draft on top.
+func (s *Store) GetRevisions(courseID int, params pagination.Params) (pagination.Page[types.CourseRevision], error) {
+	var page pagination.Page[types.CourseRevision]
+
+	cursor, args, err := revisionKeyset.Where(params, []interface{}{courseID})
+	if err != nil {
+		return page, err
+	}
+	order, args := revisionKeyset.OrderBy(params, args)
+
+	query := `SELECT id, course_id, COALESCE(number, 0), status, COALESCE(author_id, 0), COALESCE(message, ''), created_at, published_at
+			FROM course_revisions WHERE course_id = $1` + cursor + order
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return page, fmt.Errorf("could not get revisions: %v", err)
+	}
+	defer rows.Close()
+
+	revisions := []types.CourseRevision{}
+	for rows.Next() {
+		var revision types.CourseRevision
+		err := rows.Scan(
+			&revision.ID,
+			&revision.CourseID,
+			&revision.Number,
+			&revision.Status,
+			&revision.AuthorID,
+			&revision.Message,
+			&revision.CreatedAt,
+			&revision.PublishedAt,
+		)
+		if err != nil {
+			return page, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pagination.NewPage(revisions, params, revisionKey), nil
+}
+
+
+// EditDraftRevision applies edit to the draft revision of a course,
+// starting the draft from the live content if there is none, and saves it.
+// The course row stays locked throughout so concurrent edits apply one
+// after the other instead of overwriting each other. An error from edit is
+// returned as is and nothing is saved.
+func (s *Store) EditDraftRevision(courseID int, authorID int, edit func(snapshot *types.CourseSnapshot) error) (*types.CourseRevision, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM courses WHERE id = $1 FOR UPDATE`, courseID); err != nil {
+		return nil, fmt.Errorf("could not lock course: %v", err)
+	}
+
+	query := `SELECT id, course_id, number, status, author_id, message, snapshot, created_at, published_at
+			FROM course_revisions WHERE course_id = $1 AND status = 'draft'`
+	revision, err := scanRevision(tx.QueryRow(query, courseID))
+	if err == sql.ErrNoRows {
+		snapshot, err := courseSnapshot(tx, courseID)
+		if err != nil {
+			return nil, err
+		}
+		revision = &types.CourseRevision{CourseID: courseID, Status: types.RevisionDraft, Snapshot: snapshot}
+	} else if err != nil {
+		return nil, fmt.Errorf("could not get draft revision: %v", err)
+	}
+
+	if err := edit(revision.Snapshot); err != nil {
+		return nil, err
+	}
+	revision.AuthorID = authorID
+
+	snapshot, err := json.Marshal(revision.Snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode revision snapshot: %v", err)
+	}
+
+	if revision.ID == 0 {
+		query := `INSERT INTO course_revisions (course_id, status, author_id, message, snapshot, created_at)
+				VALUES ($1, 'draft', $2, NULLIF($3, ''), $4, NOW()) RETURNING id, created_at`
+		err = tx.QueryRow(query, courseID, authorID, revision.Message, snapshot).Scan(&revision.ID, &revision.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not create draft revision: %v", err)
+		}
+	} else {
+		query := `UPDATE course_revisions SET snapshot = $1, author_id = $2 WHERE id = $3`
+		if _, err := tx.Exec(query, snapshot, authorID, revision.ID); err != nil {
+			return nil, fmt.Errorf("could not update draft revision: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return revision, nil
+}
+
+
+func (s *Store) DeleteDraftRevision(courseID int) error {
+	query := `DELETE FROM course_revisions WHERE course_id = $1 AND status = 'draft'`
+	_, err := s.db.Exec(query, courseID)
+	if err != nil {
+		return fmt.Errorf("could not delete draft revision: %v", err)
+	}
+	return nil
+}
+
+
+// RecordRevision stores the live state of a course as a new published revision.
+func (s *Store) RecordRevision(courseID int, authorID int, message string) (*types.CourseRevision, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	revision, err := recordRevision(tx, courseID, authorID, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return revision, nil
+}
+
+
+// PublishDraftRevision makes the draft of a course its live content and
+// records it as a new revision. Only the sections and videos the draft
+// added or removed are created or deleted, so other content added or
+// removed since the draft was started is left alone. The course row is
+// locked before the draft is read, so edits staged meanwhile are either
+// published with it or wait for the next draft.
+//
+// The returned jobs are the videos whose source file changed and need to be
+// transcoded again.
+func (s *Store) PublishDraftRevision(courseID int, authorID int, message string) (*types.CourseRevision, []types.TranscodeJob, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM courses WHERE id = $1 FOR UPDATE`, courseID); err != nil {
+		return nil, nil, fmt.Errorf("could not lock course: %v", err)
+	}
+
+	query := `SELECT id, course_id, number, status, author_id, message, snapshot, created_at, published_at
+			FROM course_revisions WHERE course_id = $1 AND status = 'draft'`
+	draft, err := scanRevision(tx.QueryRow(query, courseID))
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrNoDraftRevision
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get draft revision: %v", err)
+	}
+
+	jobs, err := applySnapshot(tx, courseID, draft.Snapshot, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM course_revisions WHERE id = $1`, draft.ID); err != nil {
+		return nil, nil, fmt.Errorf("could not delete draft revision: %v", err)
+	}
+
+	revision, err := recordRevision(tx, courseID, authorID, message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return revision, jobs, nil
+}
+
+
+// RollbackRevision makes the live content of a course match a published
+// revision exactly, recreating missing sections and videos and deleting
+// extra ones, and records the result as a new revision. A course with a
+// draft cannot be rolled back, as the draft would no longer apply.
+func (s *Store) RollbackRevision(courseID int, number int, authorID int, message string) (*types.CourseRevision, []types.TranscodeJob, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM courses WHERE id = $1 FOR UPDATE`, courseID); err != nil {
+		return nil, nil, fmt.Errorf("could not lock course: %v", err)
+	}
+
+	var drafted bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM course_revisions WHERE course_id = $1 AND status = 'draft')`, courseID).Scan(&drafted)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not check for a draft revision: %v", err)
+	}
+	if drafted {
+		return nil, nil, ErrDraftRevisionPending
+	}
+
+	query := `SELECT id, course_id, number, status, author_id, message, snapshot, created_at, published_at
+			FROM course_revisions WHERE course_id = $1 AND number = $2`
+	target, err := scanRevision(tx.QueryRow(query, courseID, number))
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get revision: %v", err)
+	}
+
+	jobs, err := applySnapshot(tx, courseID, target.Snapshot, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revision, err := recordRevision(tx, courseID, authorID, message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return revision, jobs, nil
+}
+
+
+func recordRevision(tx *sql.Tx, courseID int, authorID int, message string) (*types.CourseRevision, error) {
+	// Serialise revision numbering per course
+	if _, err := tx.Exec(`SELECT id FROM courses WHERE id = $1 FOR UPDATE`, courseID); err != nil {
+		return nil, fmt.Errorf("could not lock course: %v", err)
+	}
+
+	snapshot, err := courseSnapshot(tx, courseID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode revision snapshot: %v", err)
+	}
+
+	revision := &types.CourseRevision{
+		CourseID: courseID,
+		Status:   types.RevisionPublished,
+		AuthorID: authorID,
+		Message:  message,
+		Snapshot: snapshot,
+	}
+
+	query := `
+	INSERT INTO course_revisions (course_id, number, status, author_id, message, snapshot, created_at, published_at)
+	VALUES ($1, (SELECT COALESCE(MAX(number), 0) + 1 FROM course_revisions WHERE course_id = $1), 'published', NULLIF($2, 0), NULLIF($3, ''), $4, NOW(), NOW())
+	RETURNING id, number, created_at, published_at`
+	err = tx.QueryRow(query, courseID, authorID, message, data).Scan(&revision.ID, &revision.Number, &revision.CreatedAt, &revision.PublishedAt)
+	if err != nil {
+		return nil, fmt.Errorf("could not record revision: %v", err)
+	}
+	return revision, nil
+}
+
+
+func applySnapshot(tx *sql.Tx, courseID int, snapshot *types.CourseSnapshot, prune bool) ([]types.TranscodeJob, error) {
+	// The slug is set once when the course is created, so renames keep URLs working
+	query := `UPDATE courses SET category_id = NULLIF($1, 0), name = $2, description = $3, for_who = $4, reason = $5,
+			intro_video = $6, image = $7, price = $8, language = COALESCE(NULLIF($9, ''), language),
+			level = COALESCE(NULLIF($10, ''), level), modified_at = NOW()
+			WHERE id = $11`
+	_, err := tx.Exec(query,
+		snapshot.CategoryID,
+		snapshot.Name,
+		snapshot.Description,
+		snapshot.ForWho,
+		snapshot.Reason,
+		snapshot.IntroVideo,
+		snapshot.Image,
+		snapshot.Price,
+		snapshot.Language,
+		snapshot.Level,
+		courseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not update course: %v", err)
+	}
+
+	if snapshot.Tags != nil {
+		if err := setCourseTags(tx, courseID, snapshot.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	liveSections, err := queryIDs(tx, `SELECT id FROM sections WHERE course_id = $1`, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	liveVideos := make(map[int]string)
+	rows, err := tx.Query(`SELECT v.id, v.video_file FROM videos v JOIN sections s ON v.section_id = s.id WHERE s.course_id = $1`, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch videos: %v", err)
+	}
+	for rows.Next() {
+		var id int
+		var file string
+		if err := rows.Scan(&id, &file); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		liveVideos[id] = file
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	keptSections := make(map[int]bool)
+	keptVideos := make(map[int]bool)
+	var jobs []types.TranscodeJob
+
+	for _, section := range snapshot.Sections {
+		sectionID := section.ID
+		if liveSections[sectionID] {
+			_, err := tx.Exec(`UPDATE sections SET title = $1, "order" = $2, modified_at = NOW() WHERE id = $3`, section.Title, section.Order, sectionID)
+			if err != nil {
+				return nil, fmt.Errorf("could not update section: %v", err)
+			}
+		} else if prune || sectionID < 0 {
+			created, err := createSnapshotSection(tx, courseID, section)
+			if err != nil {
+				return nil, fmt.Errorf("could not create section: %v", err)
+			}
+			sectionID = created
+		} else {
+			continue
+		}
+		keptSections[sectionID] = true
+
+		for _, video := range section.Videos {
+			file, exists := liveVideos[video.ID]
+			if !exists && prune && video.ID > 0 {
+				// Bring back a video an earlier publish detached
+				err := tx.QueryRow(`UPDATE videos SET section_id = $1, detached_course_id = NULL
+						WHERE id = $2 AND detached_course_id = $3 RETURNING video_file`, sectionID, video.ID, courseID).Scan(&file)
+				if err != nil && err != sql.ErrNoRows {
+					return nil, fmt.Errorf("could not restore video: %v", err)
+				}
+				exists = err == nil
+			}
+			switch {
+			case exists && file == video.VideoFile:
+				_, err = tx.Exec(`UPDATE videos SET section_id = $1, title = $2, "order" = $3, modified_at = NOW() WHERE id = $4`,
+					sectionID, video.Title, video.Order, video.ID)
+			case exists:
+				_, err = tx.Exec(`UPDATE videos SET section_id = $1, title = $2, video_file = $3, "order" = $4, status = $5,
+						hls_playlist = NULL, thumbnail = NULL, duration = 0, transcode_error = NULL, modified_at = NOW()
+						WHERE id = $6`, sectionID, video.Title, video.VideoFile, video.Order, types.VideoQueued, video.ID)
+				jobs = append(jobs, types.TranscodeJob{VideoID: video.ID, VideoFile: video.VideoFile})
+			case prune || video.ID < 0:
+				var videoID int
+				err = tx.QueryRow(`INSERT INTO videos (section_id, title, video_file, "order", status, created_at, modified_at)
+						VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING id`,
+					sectionID, video.Title, video.VideoFile, video.Order, types.VideoQueued).Scan(&videoID)
+				jobs = append(jobs, types.TranscodeJob{VideoID: videoID, VideoFile: video.VideoFile})
+				video.ID = videoID
+			default:
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("could not apply video: %v", err)
+			}
+			keptVideos[video.ID] = true
+		}
+	}
+
+	// Pruning removes everything the snapshot leaves out; otherwise only
+	// what a draft removed explicitly goes
+	removedVideos := make(map[int]bool)
+	removedSections := make(map[int]bool)
+	for _, id := range snapshot.DeletedVideos {
+		removedVideos[id] = true
+	}
+	for _, id := range snapshot.DeletedSections {
+		removedSections[id] = true
+	}
+
+	// Removed videos are detached rather than deleted, keeping the progress
+	// and questions that refer to them
+	const detach = `UPDATE videos SET section_id = NULL, detached_course_id = $2, modified_at = NOW()`
+	for id := range liveVideos {
+		if !keptVideos[id] && (prune || removedVideos[id]) {
+			if _, err := tx.Exec(detach+` WHERE id = $1`, id, courseID); err != nil {
+				return nil, fmt.Errorf("could not detach video: %v", err)
+			}
+		}
+	}
+	for id := range liveSections {
+		if !keptSections[id] && (prune || removedSections[id]) {
+			if _, err := tx.Exec(detach+` WHERE section_id = $1`, id, courseID); err != nil {
+				return nil, fmt.Errorf("could not detach videos: %v", err)
+			}
+			if _, err := tx.Exec(`DELETE FROM sections WHERE id = $1`, id); err != nil {
+				return nil, fmt.Errorf("could not delete section: %v", err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec(refreshCourseStatsQuery, courseID); err != nil {
+		return nil, fmt.Errorf("could not refresh course stats: %v", err)
+	}
+
+	return jobs, nil
+}
+
+
+// createSnapshotSection inserts a section a snapshot has but the live
+// course does not. A section an earlier publish removed gets its old ID
+// back, as long as it is still free.
+func createSnapshotSection(tx *sql.Tx, courseID int, section types.SectionSnapshot) (int, error) {
+	var id int
+	if section.ID > 0 {
+		err := tx.QueryRow(`INSERT INTO sections (id, course_id, title, "order", created_at, modified_at)
+				VALUES ($1, $2, $3, $4, NOW(), NOW()) ON CONFLICT (id) DO NOTHING RETURNING id`,
+			section.ID, courseID, section.Title, section.Order).Scan(&id)
+		if err != sql.ErrNoRows {
+			return id, err
+		}
+	}
+
+	err := tx.QueryRow(`INSERT INTO sections (course_id, title, "order", created_at, modified_at)
+			VALUES ($1, $2, $3, NOW(), NOW()) RETURNING id`, courseID, section.Title, section.Order).Scan(&id)
+	return id, err
+}
+
+
+func queryIDs(tx *sql.Tx, query string, args ...interface{}) (map[int]bool, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+
+// ReorderSections sets the order of every section in a course. sectionIDs
+// must list each of the course's sections exactly once.
+func (s *Store) ReorderSections(courseID int, sectionIDs []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Serialise concurrent reorders of the same course
+	if _, err := tx.Exec(`SELECT id FROM courses WHERE id = $1 FOR UPDATE`, courseID); err != nil {
+		return fmt.Errorf("could not lock course: %v", err)
+	}
+
+	existing, err := queryIDs(tx, `SELECT id FROM sections WHERE course_id = $1`, courseID)
+	if err != nil {
+		return fmt.Errorf("could not fetch sections: %v", err)
+	}
+	if err := validateSectionOrder(existing, sectionIDs); err != nil {
+		return err
+	}
+
+	for i, sectionID := range sectionIDs {
+		_, err := tx.Exec(`UPDATE sections SET "order" = $1, modified_at = NOW() WHERE id = $2`, i+1, sectionID)
+		if err != nil {
+			return fmt.Errorf("could not update section order: %v", err)
+		}
+	}
+
+	if _, err := tx.Exec(refreshCourseStatsQuery, courseID); err != nil {
+		return fmt.Errorf("could not refresh course stats: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+
+// ReorderVideos sets the order of the videos in the given sections and moves
+// videos between them. Together the lists must contain exactly the videos
+// currently in those sections.
+func (s *Store) ReorderVideos(courseID int, sections []types.SectionVideoOrder) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Serialise concurrent reorders of the same course
+	if _, err := tx.Exec(`SELECT id FROM courses WHERE id = $1 FOR UPDATE`, courseID); err != nil {
+		return fmt.Errorf("could not lock course: %v", err)
+	}
+
+	courseSections, err := queryIDs(tx, `SELECT id FROM sections WHERE course_id = $1`, courseID)
+	if err != nil {
+		return fmt.Errorf("could not fetch sections: %v", err)
+	}
+
+	rows, err := tx.Query(`SELECT v.id, v.section_id FROM videos v JOIN sections s ON v.section_id = s.id WHERE s.course_id = $1`, courseID)
+	if err != nil {
+		return fmt.Errorf("could not fetch videos: %v", err)
+	}
+	videoSections := make(map[int]int)
+	for rows.Next() {
+		var videoID, sectionID int
+		if err := rows.Scan(&videoID, &sectionID); err != nil {
+			rows.Close()
+			return err
+		}
+		videoSections[videoID] = sectionID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := validateVideoOrder(courseSections, videoSections, sections); err != nil {
+		return err
+	}
+
+	for _, section := range sections {
+		for i, videoID := range section.VideoIDs {
+			_, err := tx.Exec(`UPDATE videos SET section_id = $1, "order" = $2, modified_at = NOW() WHERE id = $3`,
+				section.SectionID, i+1, videoID)
+			if err != nil {
+				return fmt.Errorf("could not update video order: %v", err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec(refreshCourseStatsQuery, courseID); err != nil {
+		return fmt.Errorf("could not refresh course stats: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+
+// CloneCourse deep-copies a course with its sections and videos into a new
+// draft owned by teacherID. Every copied video is queued and returned as a
+// job, so the clone gets renditions of its own and does not break when the
+// source's videos are transcoded again or removed.
+func (s *Store) CloneCourse(sourceID int, teacherID int, name string, categoryID int) (*types.Course, []types.TranscodeJob, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Reserve the ID first so the slug can be set in the same insert
+	course := &types.Course{TeacherID: teacherID, CategoryID: categoryID, Name: name, Status: types.CourseDraft}
+	err = tx.QueryRow(`SELECT nextval(pg_get_serial_sequence('courses', 'id'))`).Scan(&course.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not reserve course ID: %v", err)
+	}
+	course.Slug = utils.Slugify(name, course.ID)
+
+	query := `INSERT INTO courses (id, teacher_id, category_id, name, slug, description, for_who, reason, intro_video, image, price,
+			language, level, status, created_at, modified_at)
+		SELECT $1, $2, $3, $4, $5, description, for_who, reason, intro_video, image, price, language, level, $6, NOW(), NOW()
+		FROM courses WHERE id = $7
+		RETURNING COALESCE(description, ''), COALESCE(for_who, ''), COALESCE(reason, ''), COALESCE(intro_video, ''),
+			COALESCE(image, ''), price, language, level, created_at`
+	err = tx.QueryRow(query, course.ID, teacherID, categoryID, name, course.Slug, types.CourseDraft, sourceID).Scan(
+		&course.Description,
+		&course.ForWho,
+		&course.Reason,
+		&course.IntroVideo,
+		&course.Image,
+		&course.Price,
+		&course.Language,
+		&course.Level,
+		&course.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("course not found for ID: %d", sourceID)
+		}
+		return nil, nil, fmt.Errorf("could not copy course: %v", err)
+	}
+
+	sectionIDs, err := queryIDs(tx, `SELECT id FROM sections WHERE course_id = $1`, sourceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not fetch sections: %v", err)
+	}
+
+	var jobs []types.TranscodeJob
+	for sectionID := range sectionIDs {
+		var newSectionID int
+		err := tx.QueryRow(`INSERT INTO sections (course_id, title, "order", created_at, modified_at)
+				SELECT $1, title, "order", NOW(), NOW() FROM sections WHERE id = $2 RETURNING id`,
+			course.ID, sectionID).Scan(&newSectionID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not copy section: %v", err)
+		}
+
+		rows, err := tx.Query(`INSERT INTO videos (section_id, title, video_file, "order", status, created_at, modified_at)
+			SELECT $1, title, video_file, "order", $2, NOW(), NOW()
+			FROM videos WHERE section_id = $3
+			RETURNING id, video_file`,
+			newSectionID, types.VideoQueued, sectionID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not copy videos: %v", err)
+		}
+		for rows.Next() {
+			var job types.TranscodeJob
+			if err := rows.Scan(&job.VideoID, &job.VideoFile); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			jobs = append(jobs, job)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO course_tags (course_id, tag_id, kind) SELECT $1, tag_id, kind FROM course_tags WHERE course_id = $2`,
+		course.ID, sourceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not copy tags: %v", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO course_prerequisites (course_id, prerequisite_id)
+			SELECT $1, prerequisite_id FROM course_prerequisites WHERE course_id = $2`, course.ID, sourceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not copy prerequisites: %v", err)
+	}
+	_, err = tx.Exec(`UPDATE courses SET prerequisite_policy = (SELECT prerequisite_policy FROM courses WHERE id = $2)
+			WHERE id = $1`, course.ID, sourceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not copy prerequisite policy: %v", err)
+	}
+
+	if _, err := tx.Exec(refreshCourseStatsQuery, course.ID); err != nil {
+		return nil, nil, fmt.Errorf("could not refresh course stats: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return course, jobs, nil
+}
+
+
+// COURSE TEMPLATES
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+const templateColumns = `t.id, t.course_id, t.title, COALESCE(t.description, ''), COALESCE(t.created_by, 0),
+	c.section_count, c.lecture_count, t.created_at, t.modified_at`
+
+func scanTemplate(row interface{ Scan(...interface{}) error }) (*types.CourseTemplate, error) {
+	var template types.CourseTemplate
+	err := row.Scan(
+		&template.ID,
+		&template.CourseID,
+		&template.Title,
+		&template.Description,
+		&template.CreatedBy,
+		&template.SectionCount,
+		&template.LectureCount,
+		&template.CreatedAt,
+		&template.ModifiedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+
+func (s *Store) CreateTemplate(template *types.CourseTemplate) error {
+	query := `INSERT INTO course_templates (course_id, title, description, created_by, created_at, modified_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW()) RETURNING id, created_at, modified_at`
+	err := s.db.QueryRow(query, template.CourseID, template.Title, template.Description, template.CreatedBy).Scan(
+		&template.ID,
+		&template.CreatedAt,
+		&template.ModifiedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("could not create template: %v", err)
+	}
+	return nil
+}
+
+
+// templateKeyset lists templates by title.
+var templateKeyset = pagination.Keyset{Columns: []string{"t.title", "t.id"}}
+
+func templateKey(template types.CourseTemplate) []interface{} {
+	return []interface{}{template.Title, template.ID}
+}
+
+
+func (s *Store) GetTemplates(params pagination.Params) (pagination.Page[types.CourseTemplate], error) {
+	var page pagination.Page[types.CourseTemplate]
+
+	cursor, args, err := templateKeyset.Where(params, nil)
+	if err != nil {
+		return page, err
+	}
+	order, args := templateKeyset.OrderBy(params, args)
+
+	query := `SELECT ` + templateColumns + ` FROM course_templates t JOIN courses c ON t.course_id = c.id WHERE TRUE` + cursor + order
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return page, fmt.Errorf("could not fetch templates: %v", err)
+	}
+	defer rows.Close()
+
+	templates := []types.CourseTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return page, err
+		}
+		templates = append(templates, *template)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pagination.NewPage(templates, params, templateKey), nil
+}
+
+
+func (s *Store) GetTemplateByID(id int) (*types.CourseTemplate, error) {
+	query := `SELECT ` + templateColumns + ` FROM course_templates t JOIN courses c ON t.course_id = c.id WHERE t.id = $1`
+	template, err := scanTemplate(s.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, err
+	}
+	return template, nil
+}
+
+
+func (s *Store) UpdateTemplate(template *types.CourseTemplate) error {
+	query := `UPDATE course_templates SET title = $1, description = $2, modified_at = NOW() WHERE id = $3`
+	_, err := s.db.Exec(query, template.Title, template.Description, template.ID)
+	if err != nil {
+		return fmt.Errorf("could not update template: %v", err)
+	}
+	return nil
+}
+
+
+func (s *Store) DeleteTemplate(id int) error {
+	_, err := s.db.Exec(`DELETE FROM course_templates WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("could not delete template: %v", err)
+	}
+	return nil
+}
+
+
+// COURSE PREREQUISITES
+
+var ErrInvalidPrerequisite = errors.New("invalid prerequisite")
+var ErrPrerequisiteCycle = errors.New("prerequisites cannot form a cycle")
+var ErrCourseNotFound = errors.New("course not found")
+
+func (s *Store) GetPrerequisites(courseID int) (*types.CoursePrerequisites, error) {
+	prerequisites := &types.CoursePrerequisites{
+		CourseID:      courseID,
+		Prerequisites: []types.CoursePrerequisite{},
+	}
+
+	err := s.db.QueryRow(`SELECT prerequisite_policy FROM courses WHERE id = $1`, courseID).Scan(&prerequisites.Policy)
+	if err == sql.ErrNoRows {
+		return nil, ErrCourseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch prerequisite policy: %v", err)
+	}
+
+	rows, err := s.db.Query(`SELECT c.id, c.name, c.slug
+		FROM course_prerequisites cp
+		JOIN courses c ON cp.prerequisite_id = c.id
+		WHERE cp.course_id = $1
+		ORDER BY c.name, c.id`, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch prerequisites: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var prerequisite types.CoursePrerequisite
+		if err := rows.Scan(&prerequisite.ID, &prerequisite.Name, &prerequisite.Slug); err != nil {
+			return nil, err
+		}
+		prerequisites.Prerequisites = append(prerequisites.Prerequisites, prerequisite)
+	}
+	return prerequisites, rows.Err()
+}
+
+
+// SetPrerequisites replaces the prerequisites of a course and its policy.
+// Prerequisites must be other published courses, and a course cannot end up
+// requiring itself through a chain of prerequisites.
+func (s *Store) SetPrerequisites(courseID int, prerequisiteIDs []int, policy types.PrerequisitePolicy) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// A cycle can close through any course in the chain, so locking the edited
+	// rows is not enough; serialize every prerequisite change instead
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('course_prerequisites'))`); err != nil {
+		return fmt.Errorf("could not lock prerequisites: %v", err)
+	}
+
+	published, err := queryIDs(tx, `SELECT id FROM courses WHERE id = ANY($1) AND status = 'published'`, pq.Array(prerequisiteIDs))
+	if err != nil {
+		return err
+	}
+	for _, id := range prerequisiteIDs {
+		if id == courseID {
+			return fmt.Errorf("%w: a course cannot require itself", ErrInvalidPrerequisite)
+		}
+		if !published[id] {
+			return fmt.Errorf("%w: course %d does not exist or is not published", ErrInvalidPrerequisite, id)
+		}
+	}
+
+	if len(prerequisiteIDs) > 0 {
+		var cycle bool
+		err = tx.QueryRow(`WITH RECURSIVE chain AS (
+				SELECT prerequisite_id FROM course_prerequisites WHERE course_id = ANY($1)
+				UNION
+				SELECT cp.prerequisite_id FROM course_prerequisites cp JOIN chain ON cp.course_id = chain.prerequisite_id
+			)
+			SELECT EXISTS(SELECT 1 FROM chain WHERE prerequisite_id = $2)`,
+			pq.Array(prerequisiteIDs), courseID).Scan(&cycle)
+		if err != nil {
+			return fmt.Errorf("could not check prerequisite chain: %v", err)
+		}
+		if cycle {
+			return ErrPrerequisiteCycle
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM course_prerequisites WHERE course_id = $1`, courseID); err != nil {
+		return fmt.Errorf("could not clear prerequisites: %v", err)
+	}
+	for _, id := range prerequisiteIDs {
+		_, err := tx.Exec(`INSERT INTO course_prerequisites (course_id, prerequisite_id) VALUES ($1, $2)
+				ON CONFLICT DO NOTHING`, courseID, id)
+		if err != nil {
+			return fmt.Errorf("could not add prerequisite: %v", err)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE courses SET prerequisite_policy = $1 WHERE id = $2`, policy, courseID); err != nil {
+		return fmt.Errorf("could not update prerequisite policy: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+
+// COURSE IMPORT AND EXPORT
+
+var ErrSlugConflict = errors.New("a course with this slug already exists")
+
+// ExportCourse reads a course, its category and its content into a portable
+// archive.
+func (s *Store) ExportCourse(courseID int) (*types.CourseArchive, error) {
+	snapshot, err := courseSnapshot(s.db, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &types.CourseArchive{
+		Version:    types.CourseArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		Course: types.ArchivedCourse{
+			Name:        snapshot.Name,
+			Description: snapshot.Description,
+			ForWho:      snapshot.ForWho,
+			Reason:      snapshot.Reason,
+			IntroVideo:  snapshot.IntroVideo,
+			Image:       snapshot.Image,
+			Price:       snapshot.Price,
+			Language:    snapshot.Language,
+			Level:       snapshot.Level,
+		},
+		Sections: []types.ArchivedSection{},
+	}
+
+	err = s.db.QueryRow(`SELECT slug FROM courses WHERE id = $1`, courseID).Scan(&archive.Course.Slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot.CategoryID != 0 {
+		var category types.ArchivedCategory
+		err := s.db.QueryRow(`SELECT name, slug, COALESCE(description, '') FROM categories WHERE id = $1`, snapshot.CategoryID).Scan(
+			&category.Name,
+			&category.Slug,
+			&category.Description,
+		)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("could not fetch category: %v", err)
+		}
+		if err == nil {
+			archive.Category = &category
+		}
+	}
+
+	media := []string{}
+	addMedia := func(ref string) {
+		if ref != "" {
+			media = append(media, ref)
+		}
+	}
+	addMedia(snapshot.IntroVideo)
+	addMedia(snapshot.Image)
+
+	for _, section := range snapshot.Sections {
+		archived := types.ArchivedSection{Title: section.Title, Order: section.Order, Videos: []types.ArchivedVideo{}}
+		for _, video := range section.Videos {
+			archived.Videos = append(archived.Videos, types.ArchivedVideo{
+				Title:     video.Title,
+				VideoFile: video.VideoFile,
+				Order:     video.Order,
+			})
+			addMedia(video.VideoFile)
+		}
+		archive.Sections = append(archive.Sections, archived)
+	}
+	archive.Media = media
+
+	for _, tag := range snapshot.Tags {
+		archive.Course.Tags = append(archive.Course.Tags, types.CourseTag{Name: tag.Name, Kind: tag.Kind})
+	}
+
+	return archive, nil
+}
+
+
+// ImportCourse recreates an archived course as a draft owned by
+// opts.TeacherID. Every video is queued for transcoding and returned as a job.
+func (s *Store) ImportCourse(archive *types.CourseArchive, opts types.ImportOptions) (*types.Course, []types.TranscodeJob, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	categoryID, err := importCategory(tx, archive.Category, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	course := &types.Course{
+		TeacherID:   opts.TeacherID,
+		CategoryID:  categoryID,
+		Name:        archive.Course.Name,
+		Description: archive.Course.Description,
+		ForWho:      archive.Course.ForWho,
+		Reason:      archive.Course.Reason,
+		IntroVideo:  archive.Course.IntroVideo,
+		Image:       archive.Course.Image,
+		Price:       archive.Course.Price,
+		Language:    strings.ToLower(archive.Course.Language),
+		Level:       archive.Course.Level,
+		Status:      types.CourseDraft,
+	}
+	if course.Language == "" {
+		course.Language = types.DefaultCourseLanguage
+	}
+	if course.Level == "" {
+		course.Level = types.LevelAllLevels
+	}
+
+	err = tx.QueryRow(`SELECT nextval(pg_get_serial_sequence('courses', 'id'))`).Scan(&course.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not reserve course ID: %v", err)
+	}
+
+	// Keep the archived slug so URLs survive the move, unless it is taken
+	course.Slug, err = availableSlug(tx, "courses", archive.Course.Slug)
+	if err != nil {
+		return nil, nil, err
+	}
+	if course.Slug == "" {
+		if archive.Course.Slug != "" && opts.Slugs == types.SlugConflictFail {
+			return nil, nil, fmt.Errorf("%w: %s", ErrSlugConflict, archive.Course.Slug)
+		}
+		course.Slug = utils.Slugify(course.Name, course.ID)
+	}
+
+	query := `INSERT INTO courses (id, teacher_id, category_id, name, slug, description, for_who, reason, intro_video, image, price,
+			language, level, status, created_at, modified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NOW(), NOW()) RETURNING created_at`
+	err = tx.QueryRow(query, course.ID, course.TeacherID, course.CategoryID, course.Name, course.Slug, course.Description,
+		course.ForWho, course.Reason, course.IntroVideo, course.Image, course.Price, course.Language, course.Level,
+		course.Status).Scan(&course.CreatedAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create course: %v", err)
+	}
+
+	var jobs []types.TranscodeJob
+	for _, section := range archive.Sections {
+		var sectionID int
+		err := tx.QueryRow(`INSERT INTO sections (course_id, title, "order", created_at, modified_at)
+				VALUES ($1, $2, $3, NOW(), NOW()) RETURNING id`, course.ID, section.Title, section.Order).Scan(&sectionID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not create section: %v", err)
+		}
+
+		for _, video := range section.Videos {
+			job := types.TranscodeJob{VideoFile: video.VideoFile}
+			err := tx.QueryRow(`INSERT INTO videos (section_id, title, video_file, "order", status, created_at, modified_at)
+					VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING id`,
+				sectionID, video.Title, video.VideoFile, video.Order, types.VideoQueued).Scan(&job.VideoID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not create video: %v", err)
+			}
+			jobs = append(jobs, job)
+		}
+	}
+
+	if err := setCourseTags(tx, course.ID, archive.Course.Tags); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := tx.Exec(refreshCourseStatsQuery, course.ID); err != nil {
+		return nil, nil, fmt.Errorf("could not refresh course stats: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return course, jobs, nil
+}
+
+
+// importCategory resolves the category an imported course goes into,
+// creating it in the taxonomy when opts allow.
+func importCategory(tx *sql.Tx, archived *types.ArchivedCategory, opts types.ImportOptions) (int, error) {
+	if opts.CategoryID != 0 {
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)`, opts.CategoryID).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, fmt.Errorf("%w: %d", ErrCategoryNotFound, opts.CategoryID)
+		}
+		return opts.CategoryID, nil
+	}
+
+	if archived == nil {
+		return 0, fmt.Errorf("archive has no category; a target category ID is required")
+	}
+
+	var categoryID int
+	err := tx.QueryRow(`SELECT id FROM categories WHERE slug = $1 OR LOWER(name) = LOWER($2)
+			ORDER BY (slug = $1) DESC, parent_id NULLS FIRST, id LIMIT 1`, archived.Slug, archived.Name).Scan(&categoryID)
+	if err == nil {
+		return categoryID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("could not match category: %v", err)
+	}
+	if opts.Categories != types.CategoryConflictCreate {
+		return 0, fmt.Errorf("%w: %q", ErrCategoryNotFound, archived.Name)
+	}
+
+	err = tx.QueryRow(`SELECT nextval(pg_get_serial_sequence('categories', 'id'))`).Scan(&categoryID)
+	if err != nil {
+		return 0, fmt.Errorf("could not reserve category ID: %v", err)
+	}
+
+	slug, err := availableSlug(tx, "categories", archived.Slug)
+	if err != nil {
+		return 0, err
+	}
+	if slug == "" {
+		slug = utils.Slugify(archived.Name, categoryID)
+	}
+
+	_, err = tx.Exec(`INSERT INTO categories (id, name, slug, description, created_at, modified_at)
+			VALUES ($1, $2, $3, $4, NOW(), NOW())`, categoryID, archived.Name, slug, archived.Description)
+	if err != nil {
+		return 0, fmt.Errorf("could not create category: %v", err)
+	}
+	return categoryID, nil
+}
+
+
+// availableSlug returns slug if no row in table uses it yet, or "" if it is
+// empty or taken. table is always a constant from this file.
+func availableSlug(tx *sql.Tx, table string, slug string) (string, error) {
+	if slug == "" {
+		return "", nil
+	}
+
+	var taken bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM `+table+` WHERE slug = $1)`, slug).Scan(&taken)
+	if err != nil {
+		return "", fmt.Errorf("could not check slug: %v", err)
+	}
+	if taken {
+		return "", nil
+	}
+	return slug, nil
+}
+
+
+// COURSE TAGS
+
+func (s *Store) GetCourseTags(courseID int) ([]types.CourseTag, error) {
+	return courseTags(s.db, courseID)
+}
+
+
+func courseTags(q querier, courseID int) ([]types.CourseTag, error) {
+	query := `SELECT t.id, t.name, t.slug, ct.kind
+		FROM course_tags ct
+		JOIN tags t ON ct.tag_id = t.id
+		WHERE ct.course_id = $1
+		ORDER BY ct.kind, t.name`
+
+	rows, err := q.Query(query, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch course tags: %v", err)
+	}
+	defer rows.Close()
+
+	tags := []types.CourseTag{}
+	for rows.Next() {
+		var tag types.CourseTag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Kind); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+
+// setCourseTags replaces the tags of a course, creating any tag names that
+// do not exist yet.
+func setCourseTags(tx *sql.Tx, courseID int, tags []types.CourseTag) error {
+	if _, err := tx.Exec(`DELETE FROM course_tags WHERE course_id = $1`, courseID); err != nil {
+		return fmt.Errorf("could not clear course tags: %v", err)
+	}
+
+	for _, tag := range tags {
+		tagID, err := ensureTag(tx, tag.Name)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO course_tags (course_id, tag_id, kind) VALUES ($1, $2, $3)
+				ON CONFLICT (course_id, tag_id) DO NOTHING`, courseID, tagID, tag.Kind)
+		if err != nil {
+			return fmt.Errorf("could not tag course: %v", err)
+		}
+	}
+	return nil
+}
+
+
+// ensureTag returns the ID of the tag with the given name, matched case
+// insensitively, creating it if needed.
+func ensureTag(tx *sql.Tx, name string) (int, error) {
+	var tagID int
+	err := tx.QueryRow(`SELECT id FROM tags WHERE LOWER(name) = LOWER($1)`, name).Scan(&tagID)
+	if err == nil {
+		return tagID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("could not look up tag: %v", err)
+	}
+
+	if err := tx.QueryRow(`SELECT nextval(pg_get_serial_sequence('tags', 'id'))`).Scan(&tagID); err != nil {
+		return 0, fmt.Errorf("could not reserve tag ID: %v", err)
+	}
+
+	// A concurrent request may have created the same name in the meantime
+	err = tx.QueryRow(`INSERT INTO tags (id, name, slug, created_at) VALUES ($1, $2, $3, NOW())
+			ON CONFLICT ((LOWER(name))) DO UPDATE SET name = tags.name
+			RETURNING id`, tagID, name, utils.Slugify(name, tagID)).Scan(&tagID)
+	if err != nil {
+		return 0, fmt.Errorf("could not create tag: %v", err)
+	}
+	return tagID, nil
+}
@@ -0,0 +1,54 @@
+package teacher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sikozonpc/ecom/types"
+)
+
+// courseTagsFromPayload normalises the topic and skill names sent with a
+// course. Whitespace is collapsed and duplicates are dropped ignoring case;
+// a name listed as both a topic and a skill is kept as a skill.
+func courseTagsFromPayload(topics, skills []string) ([]types.CourseTag, error) {
+	tags := []types.CourseTag{}
+	index := make(map[string]int)
+
+	add := func(names []string, kind types.TagKind) {
+		for _, name := range names {
+			name = strings.Join(strings.Fields(name), " ")
+			if name == "" {
+				continue
+			}
+			key := strings.ToLower(name)
+			if i, ok := index[key]; ok {
+				if kind == types.TagSkill {
+					tags[i].Kind = kind
+				}
+				continue
+			}
+			index[key] = len(tags)
+			tags = append(tags, types.CourseTag{Name: name, Kind: kind})
+		}
+	}
+	add(topics, types.TagTopic)
+	add(skills, types.TagSkill)
+
+	if len(tags) > types.MaxCourseTags {
+		return nil, fmt.Errorf("a course can have at most %d tags", types.MaxCourseTags)
+	}
+	return tags, nil
+}
+
+
+// tagSummary renders tags as a stable string so revision diffs can compare
+// them like any other field.
+func tagSummary(tags []types.CourseTag) string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, string(tag.Kind)+":"+strings.ToLower(tag.Name))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,298 @@
+package teacher
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sikozonpc/ecom/service/auth"
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+// courseTransitions lists the statuses a course may move to from each status.
+var courseTransitions = map[types.CourseStatus][]types.CourseStatus{
+	types.CourseDraft:     {types.CourseSubmitted},
+	types.CourseRejected:  {types.CourseSubmitted},
+	types.CourseSubmitted: {types.CourseApproved, types.CourseRejected},
+	types.CourseApproved:  {types.CoursePublished},
+	types.CoursePublished: {types.CourseArchived},
+	types.CourseArchived:  {types.CourseDraft},
+}
+
+func canTransition(from, to types.CourseStatus) bool {
+	for _, next := range courseTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+
+// courseReviewProblems lists what a course is missing before it can be
+// submitted for review. An empty result means the course is ready.
+func (h *Handler) courseReviewProblems(course *types.Course) ([]string, error) {
+	var problems []string
+
+	if course.Description == "" {
+		problems = append(problems, "course must have a description")
+	}
+	if course.SectionCount == 0 {
+		problems = append(problems, "course must have at least one section")
+	}
+	if course.LectureCount == 0 {
+		problems = append(problems, "course must have at least one lecture")
+	}
+
+	emptySections, err := h.teacher.CountEmptySections(course.ID)
+	if err != nil {
+		return nil, err
+	}
+	if emptySections > 0 {
+		problems = append(problems, fmt.Sprintf("%d section(s) have no lectures", emptySections))
+	}
+
+	return problems, nil
+}
+
+
+// getOwnedCourse loads the course named in the URL and checks that it belongs
+// to the logged-in teacher. It writes the error response itself and returns
+// nil when the request should stop.
+func (h *Handler) getOwnedCourse(writer http.ResponseWriter, request *http.Request) *types.Course {
+	vars := mux.Vars(request)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid course ID: %s", vars["id"]))
+		return nil
+	}
+
+	return h.ownedCourse(writer, request, courseID)
+}
+
+
+// ownedCourse is getOwnedCourse for a course ID taken from elsewhere, such
+// as the payload.
+func (h *Handler) ownedCourse(writer http.ResponseWriter, request *http.Request, courseID int) *types.Course {
+	userID, err := auth.GetTeacherIDFromToken(request)
+	if err != nil {
+		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+		return nil
+	}
+
+	// Fetch the teacher associated with the userID
+	teacher, err := h.teacher.GetTeacherByUserID(userID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusUnauthorized, fmt.Errorf("teacher not found for this user"))
+		return nil
+	}
+
+	course, err := h.teacher.GetCourseByID(courseID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusNotFound, fmt.Errorf("course not found"))
+		return nil
+	}
+
+	if course.TeacherID != teacher.ID {
+		auth.PermissionDenied(writer, "you do not have permission to manage this course")
+		return nil
+	}
+
+	return course
+}
+
+
+// lockedForReview reports whether the content of a course is frozen. What
+// the admin reviews is what goes live, so a course waiting for review or
+// for publication cannot be edited until it is rejected or published. It
+// writes the error response itself.
+func lockedForReview(writer http.ResponseWriter, course *types.Course) bool {
+	if course.Status != types.CourseSubmitted && course.Status != types.CourseApproved {
+		return false
+	}
+	utils.WriteError(writer, http.StatusConflict, fmt.Errorf("course is %s; its content cannot change until it is published or rejected", course.Status))
+	return true
+}
+
+
+// applyTransition changes the status of a course. It writes the error
+// response itself and reports whether the change was made.
+func (h *Handler) applyTransition(writer http.ResponseWriter, course *types.Course, to types.CourseStatus, reason string, reviewerID int) bool {
+	if !canTransition(course.Status, to) {
+		utils.WriteError(writer, http.StatusConflict, fmt.Errorf("cannot move course from %s to %s", course.Status, to))
+		return false
+	}
+
+	err := h.teacher.UpdateCourseStatus(course.ID, course.Status, to, reason, reviewerID)
+	if err != nil {
+		if err == ErrInvalidTransition {
+			utils.WriteError(writer, http.StatusConflict, err)
+			return false
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return false
+	}
+
+	course.Status = to
+	course.RejectionReason = reason
+	h.reindexCourse(course.ID)
+	return true
+}
+
+
+// transitionCourse applies a status change and writes the response.
+func (h *Handler) transitionCourse(writer http.ResponseWriter, course *types.Course, to types.CourseStatus, reason string, reviewerID int) {
+	if !h.applyTransition(writer, course, to, reason, reviewerID) {
+		return
+	}
+	writeTransition(writer, course)
+}
+
+
+func writeTransition(writer http.ResponseWriter, course *types.Course) {
+	response := map[string]interface{}{
+		"message": fmt.Sprintf("Course %s successfully", course.Status),
+		"course":  course,
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, response)
+}
+
+
+func (h *Handler) submitCourseHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	problems, err := h.courseReviewProblems(course)
+	if err != nil {
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	if len(problems) > 0 {
+		utils.WriteJSON(writer, http.StatusUnprocessableEntity, map[string]interface{}{
+			"err":      "course is not ready for review",
+			"problems": problems,
+		})
+		return
+	}
+
+	h.transitionCourse(writer, course, types.CourseSubmitted, "", 0)
+}
+
+
+func (h *Handler) publishCourseHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	if !h.applyTransition(writer, course, types.CoursePublished, "", 0) {
+		return
+	}
+
+	// The first publish starts the course's revision history
+	if _, err := h.teacher.RecordRevision(course.ID, course.TeacherID, "Published"); err != nil {
+		log.Printf("could not record revision for course %d: %v", course.ID, err)
+	}
+
+	writeTransition(writer, course)
+}
+
+
+func (h *Handler) archiveCourseHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	h.transitionCourse(writer, course, types.CourseArchived, "", 0)
+}
+
+
+func (h *Handler) restoreCourseHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getOwnedCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	h.transitionCourse(writer, course, types.CourseDraft, "", 0)
+}
+
+
+// ADMIN REVIEW
+
+func (h *Handler) reviewQueueHandle(writer http.ResponseWriter, request *http.Request) {
+	params, err := pagination.FromRequest(request, "review_queue", pagination.DefaultLimit, pagination.MaxLimit)
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	courses, err := h.teacher.GetCoursesByStatus(types.CourseSubmitted, params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			utils.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(writer, http.StatusOK, courses)
+}
+
+
+func (h *Handler) getReviewCourse(writer http.ResponseWriter, request *http.Request) *types.Course {
+	vars := mux.Vars(request)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, fmt.Errorf("invalid course ID: %s", vars["id"]))
+		return nil
+	}
+
+	course, err := h.teacher.GetCourseByID(courseID)
+	if err != nil {
+		utils.WriteError(writer, http.StatusNotFound, fmt.Errorf("course not found"))
+		return nil
+	}
+	return course
+}
+
+
+func (h *Handler) approveCourseHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getReviewCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	reviewerID := auth.GetUserIDFromContext(request.Context())
+	h.transitionCourse(writer, course, types.CourseApproved, "", reviewerID)
+}
+
+
+func (h *Handler) rejectCourseHandle(writer http.ResponseWriter, request *http.Request) {
+	course := h.getReviewCourse(writer, request)
+	if course == nil {
+		return
+	}
+
+	var payload types.RejectCoursePayload
+	if err := utils.ParseJSON(request, &payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	reviewerID := auth.GetUserIDFromContext(request.Context())
+	h.transitionCourse(writer, course, types.CourseRejected, payload.Reason, reviewerID)
+}
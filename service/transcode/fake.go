@@ -0,0 +1,53 @@
+package transcode
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sikozonpc/ecom/types"
+)
+
+// FakeTranscoder returns a canned result without touching ffmpeg or the
+// filesystem. It is meant for tests.
+type FakeTranscoder struct {
+	Duration int
+	Err      error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func NewFakeTranscoder(duration int) *FakeTranscoder {
+	return &FakeTranscoder{Duration: duration}
+}
+
+func (f *FakeTranscoder) Transcode(ctx context.Context, input string, outputDir string) (*types.TranscodeResult, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, input)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	result := &types.TranscodeResult{
+		Playlist:  masterPlaylist,
+		Thumbnail: posterFile,
+		Duration:  f.Duration,
+	}
+	for _, r := range DefaultRenditions {
+		r.Playlist = r.Name + "/index.m3u8"
+		result.Renditions = append(result.Renditions, r)
+	}
+	return result, nil
+}
+
+// Calls returns the inputs passed to Transcode, in order.
+func (f *FakeTranscoder) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
@@ -0,0 +1,163 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sikozonpc/ecom/types"
+)
+
+var DefaultRenditions = []types.Rendition{
+	{Name: "360p", Width: 640, Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+	{Name: "720p", Width: 1280, Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "1080p", Width: 1920, Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+}
+
+const (
+	masterPlaylist = "master.m3u8"
+	posterFile     = "poster.jpg"
+	segmentSeconds = 6
+)
+
+// inputOptions restrict how ffmpeg and ffprobe may open the source, so a
+// crafted input cannot make them read a URL or chain other protocols.
+var inputOptions = []string{"-protocol_whitelist", "file"}
+
+// FFmpegTranscoder shells out to ffmpeg and ffprobe to produce one HLS
+// rendition per entry in Renditions.
+type FFmpegTranscoder struct {
+	FFmpegPath  string
+	FFprobePath string
+	Renditions  []types.Rendition
+}
+
+func NewFFmpegTranscoder(ffmpegPath, ffprobePath string) *FFmpegTranscoder {
+	if ffmpegPath == "" {
+		ffmpegPath = "ffmpeg"
+	}
+	if ffprobePath == "" {
+		ffprobePath = "ffprobe"
+	}
+	return &FFmpegTranscoder{
+		FFmpegPath:  ffmpegPath,
+		FFprobePath: ffprobePath,
+		Renditions:  DefaultRenditions,
+	}
+}
+
+func (t *FFmpegTranscoder) Transcode(ctx context.Context, input string, outputDir string) (*types.TranscodeResult, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create output directory: %v", err)
+	}
+
+	duration, err := t.probeDuration(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.TranscodeResult{
+		Playlist:  masterPlaylist,
+		Thumbnail: posterFile,
+		Duration:  duration,
+	}
+
+	for _, r := range t.Renditions {
+		if err := os.MkdirAll(filepath.Join(outputDir, r.Name), 0755); err != nil {
+			return nil, fmt.Errorf("could not create rendition directory: %v", err)
+		}
+
+		playlist := filepath.Join(r.Name, "index.m3u8")
+		args := append([]string{"-y"}, inputOptions...)
+		args = append(args,
+			"-i", input,
+			"-vf", fmt.Sprintf("scale=w=%d:h=%d:force_original_aspect_ratio=decrease,pad=ceil(iw/2)*2:ceil(ih/2)*2", r.Width, r.Height),
+			"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main",
+			"-b:v", fmt.Sprintf("%dk", r.VideoBitrate),
+			"-maxrate", fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+			"-bufsize", fmt.Sprintf("%dk", r.VideoBitrate*3/2),
+			"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", r.AudioBitrate),
+			"-hls_time", strconv.Itoa(segmentSeconds),
+			"-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(outputDir, r.Name, "segment_%03d.ts"),
+			filepath.Join(outputDir, playlist),
+		)
+		if _, err := t.run(ctx, t.FFmpegPath, args...); err != nil {
+			return nil, fmt.Errorf("could not transcode %s rendition: %v", r.Name, err)
+		}
+
+		r.Playlist = filepath.ToSlash(playlist)
+		result.Renditions = append(result.Renditions, r)
+	}
+
+	// Grab the poster a little way in so it is not a black first frame.
+	offset := math.Min(1, float64(duration)/2)
+	args := append([]string{"-y", "-ss", strconv.FormatFloat(offset, 'f', 2, 64)}, inputOptions...)
+	args = append(args,
+		"-i", input,
+		"-frames:v", "1", "-vf", "scale=1280:-2",
+		filepath.Join(outputDir, posterFile),
+	)
+	if _, err := t.run(ctx, t.FFmpegPath, args...); err != nil {
+		return nil, fmt.Errorf("could not extract thumbnail: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(outputDir, masterPlaylist), MasterPlaylist(result.Renditions), 0644); err != nil {
+		return nil, fmt.Errorf("could not write master playlist: %v", err)
+	}
+
+	return result, nil
+}
+
+// MasterPlaylist builds the HLS master playlist that points players at each
+// rendition's media playlist.
+func MasterPlaylist(renditions []types.Rendition) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, r := range renditions {
+		bandwidth := (r.VideoBitrate + r.AudioBitrate) * 1000
+		fmt.Fprintf(&buf, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,NAME=\"%s\"\n%s\n", bandwidth, r.Width, r.Height, r.Name, r.Playlist)
+	}
+	return buf.Bytes()
+}
+
+func (t *FFmpegTranscoder) probeDuration(ctx context.Context, input string) (int, error) {
+	args := append([]string{"-v", "error"}, inputOptions...)
+	args = append(args,
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		input,
+	)
+	out, err := t.run(ctx, t.FFprobePath, args...)
+	if err != nil {
+		return 0, fmt.Errorf("could not probe duration: %v", err)
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %v", strings.TrimSpace(out), err)
+	}
+	return int(math.Ceil(seconds)), nil
+}
+
+func (t *FFmpegTranscoder) run(ctx context.Context, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 500 {
+			msg = msg[len(msg)-500:]
+		}
+		return "", fmt.Errorf("%s: %v: %s", filepath.Base(name), err, msg)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,254 @@
+package transcode
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sikozonpc/ecom/types"
+	"github.com/sikozonpc/ecom/utils"
+)
+
+var ErrQueueFull = errors.New("transcode queue is full")
+
+// retryInterval is how often videos left queued, e.g. because the queue was
+// full when they were saved, are handed to the workers again.
+const retryInterval = time.Minute
+
+// Pipeline runs transcode jobs on a fixed pool of workers and records their
+// progress on the video row.
+type Pipeline struct {
+	transcoder types.Transcoder
+	store      types.TranscodeStore
+	mediaRoot  string
+	uploadRoot string
+	workers    int
+	retry      time.Duration
+	jobs       chan types.TranscodeJob
+	wg         sync.WaitGroup
+	cancel     context.CancelFunc
+
+	mu sync.Mutex
+	// Jobs waiting in the channel or running, so retries do not run them twice
+	pending map[types.TranscodeJob]bool
+}
+
+func NewPipeline(transcoder types.Transcoder, store types.TranscodeStore, mediaRoot string, uploadRoot string, workers int) *Pipeline {
+	if mediaRoot == "" {
+		mediaRoot = "media"
+	}
+	if uploadRoot == "" {
+		uploadRoot = "uploads"
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pipeline{
+		transcoder: transcoder,
+		store:      store,
+		mediaRoot:  mediaRoot,
+		uploadRoot: uploadRoot,
+		workers:    workers,
+		retry:      retryInterval,
+		jobs:       make(chan types.TranscodeJob, 100),
+		pending:    make(map[types.TranscodeJob]bool),
+	}
+}
+
+// Start launches the workers and requeues any videos left queued or
+// processing by a previous run. Videos still queued later on are retried
+// every retryInterval.
+func (p *Pipeline) Start(ctx context.Context) error {
+	ctx, p.cancel = context.WithCancel(ctx)
+
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+
+	pending, err := p.store.GetPendingTranscodeJobs(types.VideoQueued, types.VideoProcessing)
+	if err != nil {
+		return fmt.Errorf("could not load pending transcode jobs: %v", err)
+	}
+
+	go func() {
+		p.requeue(ctx, pending)
+
+		ticker := time.NewTicker(p.retry)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				queued, err := p.store.GetPendingTranscodeJobs(types.VideoQueued)
+				if err != nil {
+					log.Printf("transcode: %v", err)
+					continue
+				}
+				p.requeue(ctx, queued)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// requeue hands jobs to the workers, waiting for room in the queue, and
+// skips those already waiting or running.
+func (p *Pipeline) requeue(ctx context.Context, jobs []types.TranscodeJob) {
+	for _, job := range jobs {
+		p.mu.Lock()
+		if p.pending[job] {
+			p.mu.Unlock()
+			continue
+		}
+		p.pending[job] = true
+		p.mu.Unlock()
+
+		select {
+		case p.jobs <- job:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop cancels running jobs and waits for the workers to exit.
+func (p *Pipeline) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+// Enqueue hands a job to the workers without waiting. On ErrQueueFull the
+// video stays queued and is retried within retryInterval.
+func (p *Pipeline) Enqueue(job types.TranscodeJob) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pending[job] {
+		return nil
+	}
+	select {
+	case p.jobs <- job:
+		p.pending[job] = true
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (p *Pipeline) work(ctx context.Context) {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-p.jobs:
+			p.process(ctx, job)
+		}
+	}
+}
+
+// process transcodes one job. Status updates only apply while the video
+// still has the job's source file, so a stale job cannot overwrite the
+// state of a replacement upload.
+func (p *Pipeline) process(ctx context.Context, job types.TranscodeJob) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, job)
+		p.mu.Unlock()
+	}()
+
+	current, err := p.store.SetTranscodeStatus(job.VideoID, job.VideoFile, types.VideoProcessing, "")
+	if err != nil {
+		log.Printf("transcode: video %d: %v", job.VideoID, err)
+		return
+	}
+	if !current {
+		return
+	}
+
+	input, err := p.source(job.VideoFile)
+	if err != nil {
+		p.fail(job, err)
+		return
+	}
+
+	// Each run writes to its own directory so a stale run and the run for a
+	// replacement upload never share segments or posters.
+	runID, err := newRunID()
+	if err != nil {
+		log.Printf("transcode: video %d: %v", job.VideoID, err)
+		return
+	}
+	relDir := filepath.Join("videos", fmt.Sprint(job.VideoID), runID)
+	outputDir := filepath.Join(p.mediaRoot, relDir)
+
+	result, err := p.transcoder.Transcode(ctx, input, outputDir)
+	if err != nil {
+		os.RemoveAll(outputDir)
+		if ctx.Err() != nil {
+			// Shutting down; the video stays in processing and is picked up on restart.
+			return
+		}
+		p.fail(job, err)
+		return
+	}
+
+	result.Playlist = filepath.ToSlash(filepath.Join(relDir, result.Playlist))
+	result.Thumbnail = filepath.ToSlash(filepath.Join(relDir, result.Thumbnail))
+	for i := range result.Renditions {
+		result.Renditions[i].Playlist = filepath.ToSlash(filepath.Join(relDir, result.Renditions[i].Playlist))
+	}
+
+	if err := p.store.SaveTranscodeResult(job.VideoID, job.VideoFile, result); err != nil {
+		log.Printf("transcode: video %d: %v", job.VideoID, err)
+		return
+	}
+	log.Printf("transcode: video %d ready (%ds)", job.VideoID, result.Duration)
+}
+
+func (p *Pipeline) fail(job types.TranscodeJob, cause error) {
+	log.Printf("transcode: video %d failed: %v", job.VideoID, cause)
+	if _, err := p.store.SetTranscodeStatus(job.VideoID, job.VideoFile, types.VideoFailed, cause.Error()); err != nil {
+		log.Printf("transcode: video %d: %v", job.VideoID, err)
+	}
+}
+
+// source resolves a video file to a path inside the upload root. Files are
+// validated when saved; this guards against rows written some other way.
+func (p *Pipeline) source(videoFile string) (string, error) {
+	if err := utils.ValidateVideoFile(videoFile); err != nil {
+		return "", err
+	}
+
+	root, err := filepath.Abs(p.uploadRoot)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve upload root: %v", err)
+	}
+	input := filepath.Join(root, filepath.FromSlash(videoFile))
+	if !strings.HasPrefix(input, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("video file %q is outside the upload directory", videoFile)
+	}
+	return input, nil
+}
+
+func newRunID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate run ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
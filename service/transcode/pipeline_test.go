@@ -0,0 +1,223 @@
+package transcode
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sikozonpc/ecom/types"
+)
+
+// fakeStore records the status updates the pipeline makes. Videos listed in
+// replaced have a new source file, so updates for their jobs are refused.
+type fakeStore struct {
+	mu       sync.Mutex
+	statuses map[int][]types.VideoStatus
+	errors   map[int]string
+	results  map[int]*types.TranscodeResult
+	queued   []types.TranscodeJob
+	replaced map[int]bool
+}
+
+func newFakeStore(queued ...types.TranscodeJob) *fakeStore {
+	return &fakeStore{
+		statuses: map[int][]types.VideoStatus{},
+		errors:   map[int]string{},
+		results:  map[int]*types.TranscodeResult{},
+		queued:   queued,
+		replaced: map[int]bool{},
+	}
+}
+
+func (s *fakeStore) SetTranscodeStatus(videoID int, videoFile string, status types.VideoStatus, errMsg string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.replaced[videoID] {
+		return false, nil
+	}
+	s.statuses[videoID] = append(s.statuses[videoID], status)
+	s.errors[videoID] = errMsg
+	for i, job := range s.queued {
+		if job.VideoID == videoID {
+			s.queued = append(s.queued[:i], s.queued[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+func (s *fakeStore) SaveTranscodeResult(videoID int, videoFile string, result *types.TranscodeResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statuses[videoID] = append(s.statuses[videoID], types.VideoReady)
+	s.results[videoID] = result
+	return nil
+}
+
+func (s *fakeStore) GetPendingTranscodeJobs(statuses ...types.VideoStatus) ([]types.TranscodeJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]types.TranscodeJob(nil), s.queued...), nil
+}
+
+func (s *fakeStore) history(videoID int) []types.VideoStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]types.VideoStatus(nil), s.statuses[videoID]...)
+}
+
+// finished reports whether the video reached ready or failed.
+func (s *fakeStore) finished(videoID int) bool {
+	history := s.history(videoID)
+	if len(history) == 0 {
+		return false
+	}
+	last := history[len(history)-1]
+	return last == types.VideoReady || last == types.VideoFailed
+}
+
+
+func startPipeline(t *testing.T, transcoder types.Transcoder, store *fakeStore, retry time.Duration) *Pipeline {
+	t.Helper()
+	pipeline := NewPipeline(transcoder, store, t.TempDir(), t.TempDir(), 1)
+	if retry > 0 {
+		pipeline.retry = retry
+	}
+	if err := pipeline.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(pipeline.Stop)
+	return pipeline
+}
+
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+
+func TestPipelineReady(t *testing.T) {
+	store := newFakeStore()
+	pipeline := startPipeline(t, NewFakeTranscoder(95), store, 0)
+
+	if err := pipeline.Enqueue(types.TranscodeJob{VideoID: 7, VideoFile: "lectures/intro.mp4"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	waitFor(t, "video 7", func() bool { return store.finished(7) })
+
+	if got, want := store.history(7), []types.VideoStatus{types.VideoProcessing, types.VideoReady}; !reflect.DeepEqual(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+
+	store.mu.Lock()
+	result := store.results[7]
+	store.mu.Unlock()
+	if result.Duration != 95 {
+		t.Errorf("duration = %d, want 95", result.Duration)
+	}
+	// Paths are rewritten relative to the media root, under the run's own directory
+	if !strings.HasPrefix(result.Playlist, "videos/7/") || !strings.HasSuffix(result.Playlist, "/"+masterPlaylist) {
+		t.Errorf("playlist = %q, want videos/7/<run>/%s", result.Playlist, masterPlaylist)
+	}
+	if len(result.Renditions) != len(DefaultRenditions) {
+		t.Errorf("%d renditions, want %d", len(result.Renditions), len(DefaultRenditions))
+	}
+}
+
+
+func TestPipelineFailed(t *testing.T) {
+	transcoder := NewFakeTranscoder(0)
+	transcoder.Err = errors.New("unsupported codec")
+	store := newFakeStore()
+	pipeline := startPipeline(t, transcoder, store, 0)
+
+	if err := pipeline.Enqueue(types.TranscodeJob{VideoID: 3, VideoFile: "broken.avi"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	waitFor(t, "video 3", func() bool { return store.finished(3) })
+
+	if got, want := store.history(3), []types.VideoStatus{types.VideoProcessing, types.VideoFailed}; !reflect.DeepEqual(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.errors[3] != "unsupported codec" {
+		t.Errorf("error message = %q, want the transcoder's error", store.errors[3])
+	}
+}
+
+
+func TestPipelineRejectsSourceOutsideUploads(t *testing.T) {
+	transcoder := NewFakeTranscoder(10)
+	store := newFakeStore()
+	pipeline := startPipeline(t, transcoder, store, 0)
+
+	if err := pipeline.Enqueue(types.TranscodeJob{VideoID: 4, VideoFile: "../../etc/passwd"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	waitFor(t, "video 4", func() bool { return store.finished(4) })
+
+	if got := store.history(4); got[len(got)-1] != types.VideoFailed {
+		t.Errorf("statuses = %v, want the video to fail", got)
+	}
+	if calls := transcoder.Calls(); len(calls) != 0 {
+		t.Errorf("transcoder was called with %v", calls)
+	}
+}
+
+
+func TestPipelineSkipsReplacedSource(t *testing.T) {
+	transcoder := NewFakeTranscoder(10)
+	store := newFakeStore()
+	store.replaced[5] = true
+	pipeline := startPipeline(t, transcoder, store, 0)
+
+	if err := pipeline.Enqueue(types.TranscodeJob{VideoID: 5, VideoFile: "old.mp4"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := pipeline.Enqueue(types.TranscodeJob{VideoID: 6, VideoFile: "next.mp4"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	// One worker runs jobs in order, so video 5 was handled once 6 is done
+	waitFor(t, "video 6", func() bool { return store.finished(6) })
+
+	if got := store.history(5); len(got) != 0 {
+		t.Errorf("stale job updated the video: %v", got)
+	}
+	if calls := transcoder.Calls(); len(calls) != 1 || !strings.HasSuffix(calls[0], "next.mp4") {
+		t.Errorf("transcoder calls = %v, want only next.mp4", calls)
+	}
+}
+
+
+func TestPipelineRetriesQueuedVideos(t *testing.T) {
+	// Video 1 was left queued by an earlier run
+	store := newFakeStore(types.TranscodeJob{VideoID: 1, VideoFile: "a.mp4"})
+	startPipeline(t, NewFakeTranscoder(30), store, 10*time.Millisecond)
+	waitFor(t, "video 1", func() bool { return store.finished(1) })
+
+	// Video 2 is saved as queued later on, e.g. after the queue was full
+	store.mu.Lock()
+	store.queued = append(store.queued, types.TranscodeJob{VideoID: 2, VideoFile: "b.mp4"})
+	store.mu.Unlock()
+	waitFor(t, "video 2", func() bool { return store.finished(2) })
+
+	for _, videoID := range []int{1, 2} {
+		if got, want := store.history(videoID), []types.VideoStatus{types.VideoProcessing, types.VideoReady}; !reflect.DeepEqual(got, want) {
+			t.Errorf("video %d statuses = %v, want %v", videoID, got, want)
+		}
+	}
+}
@@ -19,14 +19,16 @@ import (
 type Handler struct {
 	store types.UserStore
 	teacher types.TeacherStore
+	indexer types.SearchIndexer
 	db *sql.DB
 }
 
 
-func NewHandler(store types.UserStore, db *sql.DB, teacher types.TeacherStore) *Handler {
+func NewHandler(store types.UserStore, db *sql.DB, teacher types.TeacherStore, indexer types.SearchIndexer) *Handler {
 	return &Handler{
 		store: store,
 		teacher: teacher,
+		indexer: indexer,
 		db: db,
 	}
 }
@@ -782,6 +784,13 @@ func (h *Handler) updateProfileHandler(writer http.ResponseWriter, request *http
 			utils.WriteError(writer, http.StatusInternalServerError, fmt.Errorf("failed to update teacher profile: %v", err))
 			return
 		}
+
+		// Course search results show the teacher's name
+		if payload.FirstName != nil || payload.LastName != nil {
+			if err := h.indexer.IndexTeacher(teacher.ID); err != nil {
+				log.Printf("could not index the courses of teacher %d: %v", teacher.ID, err)
+			}
+		}
 	}
 
 	// Prepare and return the response
@@ -0,0 +1,77 @@
+package types
+
+import "time"
+
+// CourseArchiveVersion is the archive format written by exports. Imports
+// accept any version up to and including it.
+const CourseArchiveVersion = 1
+
+// CourseArchive is the portable form of a course used to move content
+// between environments. Media is referenced by path or URL, not embedded.
+type CourseArchive struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Course     ArchivedCourse    `json:"course"`
+	Category   *ArchivedCategory `json:"category,omitempty"`
+	Sections   []ArchivedSection `json:"sections"`
+	Media      []string          `json:"media"`
+}
+
+type ArchivedCourse struct {
+	Name        string      `json:"name"`
+	Slug        string      `json:"slug"`
+	Description string      `json:"description"`
+	ForWho      string      `json:"for_who"`
+	Reason      string      `json:"reason"`
+	IntroVideo  string      `json:"intro_video"`
+	Image       string      `json:"image"`
+	Price       float64     `json:"price"`
+	Language    string      `json:"language,omitempty"`
+	Level       CourseLevel `json:"level,omitempty"`
+	Tags        []CourseTag `json:"tags,omitempty"`
+}
+
+type ArchivedCategory struct {
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+}
+
+type ArchivedSection struct {
+	Title  string          `json:"title"`
+	Order  int             `json:"order"`
+	Videos []ArchivedVideo `json:"videos"`
+}
+
+type ArchivedVideo struct {
+	Title     string `json:"title"`
+	VideoFile string `json:"video_file"`
+	Order     int    `json:"order"`
+}
+
+// SlugConflict decides what an import does when the archived course slug is
+// already taken in the target database.
+type SlugConflict string
+
+const (
+	SlugConflictRename SlugConflict = "rename"
+	SlugConflictFail   SlugConflict = "fail"
+)
+
+// CategoryConflict decides what happens when the archived category is not
+// in the target taxonomy. Both strategies reuse a category with the same
+// slug or name; "match" fails when there is none, "create" adds it as a
+// top-level category.
+type CategoryConflict string
+
+const (
+	CategoryConflictMatch  CategoryConflict = "match"
+	CategoryConflictCreate CategoryConflict = "create"
+)
+
+type ImportOptions struct {
+	TeacherID  int
+	CategoryID int // when set, overrides the archived category
+	Slugs      SlugConflict
+	Categories CategoryConflict
+}
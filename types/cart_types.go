@@ -1,6 +1,10 @@
 package types
 
-import "time"
+import (
+	"time"
+
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
 
 
 type CartStore interface {
@@ -8,7 +12,9 @@ type CartStore interface {
 	DeleteFromCart(cartID, userID int) error
 	CheckIfCourseInCart(userID, courseID int) (bool, error)
 	GetCartItemsByUserID(userID int) ([]Cart, error)
+	GetCartPage(userID int, params pagination.Params) (pagination.Page[Cart], error)
 	DeleteCartItems(userID int) error
+	GetMissingPrerequisites(userID, courseID int) (PrerequisitePolicy, []CoursePrerequisite, error)
 }
 
 
@@ -0,0 +1,47 @@
+package types
+
+import "time"
+
+// CatalogStore serves the public catalog feeds. The feeds read aggregates
+// that RefreshStats rebuilds on a schedule, so they can lag behind by one
+// refresh.
+type CatalogStore interface {
+	GetTrending(days int, limit int) ([]FeedCourse, error)
+	GetBestsellers(categoryID int, limit int) ([]FeedCourse, error)
+	GetBestsellersByCategory(perCategory int) ([]CategoryBestsellers, error)
+	GetNewReleases(days int, minRating float64, limit int) ([]FeedCourse, error)
+	GetTopRated(minRatings int, limit int) ([]FeedCourse, error)
+	GetFeatured(limit int) ([]FeedCourse, error)
+	SetFeatured(courseIDs []int, adminID int) error
+	RefreshStats() error
+}
+
+// FeedCourse is a course as listed in a catalog feed. RecentEnrollments
+// and EnrollmentsPerDay are only set by the trending feed.
+type FeedCourse struct {
+	ID                int       `json:"id"`
+	Name              string    `json:"name"`
+	Slug              string    `json:"slug"`
+	Image             string    `json:"image_url"`
+	Price             float64   `json:"price"`
+	CategoryID        int       `json:"category_id"`
+	Instructor        string    `json:"instructor"`
+	Rating            float64   `json:"rating"`
+	RatingCount       int       `json:"rating_count"`
+	EnrollmentCount   int       `json:"enrollment_count"`
+	SalesCount        int       `json:"sales_count"`
+	PublishedAt       time.Time `json:"published_at"`
+	RecentEnrollments int       `json:"recent_enrollments,omitempty"`
+	EnrollmentsPerDay float64   `json:"enrollments_per_day,omitempty"`
+}
+
+type CategoryBestsellers struct {
+	CategoryID   int          `json:"category_id"`
+	CategoryName string       `json:"category_name"`
+	CategorySlug string       `json:"category_slug"`
+	Courses      []FeedCourse `json:"courses"`
+}
+
+type SetFeaturedPayload struct {
+	CourseIDs []int `json:"course_ids" validate:"max=50"`
+}
@@ -1,8 +1,10 @@
 package types
 
 import (
+	"encoding/json"
 	"time"
 
+	"github.com/sikozonpc/ecom/utils/pagination"
 )
 
 type TeacherStore interface {
@@ -14,17 +16,17 @@ type TeacherStore interface {
 	// category CRUD operations
 	CreateCategory(category *Category) error
 	GetCategory() ([]Category, error)
-	GetCategoriesByTeacher(teacherID int) ([]Category, error)
 	GetCategoryByID(id int) (*Category, error)
 	UpdateCategory(category *Category) error
 	DeleteCategory(id int) error
+	MergeCategory(sourceID int, targetID int) (int, error)
 
 	// course CRUD operations
-	CreateCourse(course *Course) error
-	GetCourses(limit, offset int) ([]Course, error)
+	CreateCourse(course *Course, tags []CourseTag) error
+	GetCourses(params pagination.Params) (pagination.Page[Course], error)
 	CountCourses() (int, error)
 	GetCourseByID(id int) (*Course, error)
-	UpdateCourse(course *Course) error
+	UpdateCourse(course *Course, tags []CourseTag) error
 	DeleteCourse(id int) error
 	CheckDuplicateCourse(teacherID int, courseName string) (bool, error)
 
@@ -39,15 +41,58 @@ type TeacherStore interface {
 	GetVideoByID(id int) (*Video, error)
 	UpdateVideo(video *Video) error
 	DeleteVideo(id int) error
+	UpdateVideoStatus(videoID int, status VideoStatus, errMsg string) error
+
+	// Course content stats
+	RefreshCourseStats(courseID int) error
+
+	// Course publishing workflow
+	UpdateCourseStatus(courseID int, from, to CourseStatus, reason string, reviewerID int) error
+	GetCoursesByStatus(status CourseStatus, params pagination.Params) (pagination.Page[Course], error)
+	CountEmptySections(courseID int) (int, error)
+
+	// Course revisions
+	GetCourseSnapshot(courseID int) (*CourseSnapshot, error)
+	GetDraftRevision(courseID int) (*CourseRevision, error)
+	EditDraftRevision(courseID int, authorID int, edit func(snapshot *CourseSnapshot) error) (*CourseRevision, error)
+	DeleteDraftRevision(courseID int) error
+	GetRevision(courseID int, number int) (*CourseRevision, error)
+	GetRevisions(courseID int, params pagination.Params) (pagination.Page[CourseRevision], error)
+	RecordRevision(courseID int, authorID int, message string) (*CourseRevision, error)
+	PublishDraftRevision(courseID int, authorID int, message string) (*CourseRevision, []TranscodeJob, error)
+	RollbackRevision(courseID int, number int, authorID int, message string) (*CourseRevision, []TranscodeJob, error)
+
+	// Bulk reordering
+	ReorderSections(courseID int, sectionIDs []int) error
+	ReorderVideos(courseID int, sections []SectionVideoOrder) error
+
+	// Cloning and templates
+	CloneCourse(sourceID int, teacherID int, name string, categoryID int) (*Course, []TranscodeJob, error)
+	CreateTemplate(template *CourseTemplate) error
+	GetTemplates(params pagination.Params) (pagination.Page[CourseTemplate], error)
+	GetTemplateByID(id int) (*CourseTemplate, error)
+	UpdateTemplate(template *CourseTemplate) error
+	DeleteTemplate(id int) error
+
+	// Course tags
+	GetCourseTags(courseID int) ([]CourseTag, error)
+
+	// Prerequisites
+	GetPrerequisites(courseID int) (*CoursePrerequisites, error)
+	SetPrerequisites(courseID int, prerequisiteIDs []int, policy PrerequisitePolicy) error
+
+	// Import and export
+	ExportCourse(courseID int) (*CourseArchive, error)
+	ImportCourse(archive *CourseArchive, opts ImportOptions) (*Course, []TranscodeJob, error)
 
 	// Course by Category
-	GetCoursesByCategory(categoryID int, teacherID int) ([]Course, error)
+	GetCoursesByCategory(categoryID int, teacherID int, params pagination.Params) (pagination.Page[Course], error)
 
 	// Section by Course
-	GetSectionsByCourse(courseID int, teacherID int) ([]Section, error)
+	GetSectionsByCourse(courseID int, teacherID int, params pagination.Params) (pagination.Page[Section], error)
 
 	// VIdeo by Section
-	GetVideosBySection(sectionID int, teacherID int) ([]Video, error)
+	GetVideosBySection(sectionID int, teacherID int, params pagination.Params) (pagination.Page[Video], error)
 
 
 	CountEnrolledStudents(teacherID int) (int, error)
@@ -56,12 +101,40 @@ type TeacherStore interface {
 	CountRatingsAndReviewsForTeacher(teacherID int) (int, int, error)
 }
 
+type CourseStatus string
+
+const (
+	CourseDraft     CourseStatus = "draft"
+	CourseSubmitted CourseStatus = "submitted"
+	CourseApproved  CourseStatus = "approved"
+	CourseRejected  CourseStatus = "rejected"
+	CoursePublished CourseStatus = "published"
+	CourseArchived  CourseStatus = "archived"
+)
+
+// CourseLevel is the experience a course expects from its students.
+type CourseLevel string
+
+const (
+	LevelBeginner     CourseLevel = "beginner"
+	LevelIntermediate CourseLevel = "intermediate"
+	LevelAdvanced     CourseLevel = "advanced"
+	LevelAllLevels    CourseLevel = "all_levels"
+)
+
+// DefaultCourseLanguage is used when a course is created without one.
+const DefaultCourseLanguage = "en"
+
+// Category is a node in the global, admin-managed taxonomy. Top-level
+// categories have no ParentID.
 type Category struct {
 	ID          int    `json:"id"`
-	TeacherID   int    `json:"teacher_id"`
+	ParentID    *int   `json:"parent_id"`
 	Name        string `json:"name"`
 	Slug        string `json:"slug"`
 	Description string `json:"description"`
+	CourseCount int    `json:"course_count"`
+	Children    []Category `json:"children,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	ModifiedAt 	time.Time `json:"modified_at"`
 }
@@ -81,6 +154,21 @@ type Course struct {
 	IntroVideo  	  string    `json:"intro_video,omitempty"`
 	Image             string `json:"image"`
 	Price             float64 `json:"price"`
+	Language          string `json:"language,omitempty"`
+	Level             CourseLevel `json:"level,omitempty"`
+	TotalDuration     int    `json:"total_duration"`
+	SectionCount      int    `json:"section_count"`
+	LectureCount      int    `json:"lecture_count"`
+	ContentUpdatedAt  time.Time `json:"content_updated_at"`
+	RatingAverage     float64 `json:"rating_average"`
+	RatingCount       int    `json:"rating_count"`
+	ReviewCount       int    `json:"review_count"`
+	RatingHistogram   []int64 `json:"rating_histogram,omitempty"`
+	Status            CourseStatus `json:"status"`
+	RejectionReason   string `json:"rejection_reason,omitempty"`
+	SubmittedAt       *time.Time `json:"submitted_at,omitempty"`
+	PublishedAt       *time.Time `json:"published_at,omitempty"`
+	Tags              []CourseTag `json:"tags,omitempty"`
 	CreatedAt 		  time.Time `json:"created_at"`
 	ModifiedAt 		  time.Time `json:"modified_at"`
 }
@@ -103,6 +191,11 @@ type Video struct {
 	Title             string  `json:"title"`
 	VideoFile 		  string `json:"video_file"`
 	Order 			  int 	 `json:"order"`
+	Status            VideoStatus `json:"status"`
+	HLSPlaylist       string `json:"hls_playlist,omitempty"`
+	Thumbnail         string `json:"thumbnail,omitempty"`
+	Duration          int    `json:"duration"`
+	TranscodeError    string `json:"transcode_error,omitempty"`
 	CreatedAt 		  time.Time `json:"created_at"`
 	ModifiedAt 		  time.Time `json:"modified_at"`
 }
@@ -110,16 +203,24 @@ type Video struct {
 
 // Payloads
 type CreateCategoryPayload struct {
+	ParentID    *int   `json:"parent_id"`
 	Name        string `json:"name" validate:"required"`
 	Description string `json:"description"`
 }
 
 
+// UpdateCategoryPayload keeps parent_id raw so an omitted field can be told
+// apart from an explicit null, which moves the category to the top level.
 type UpdateCategoryPayload struct {
+	ParentID    json.RawMessage `json:"parent_id"`
 	Name        string `json:"name" validate:"required"`
 	Description string `json:"description"`
 }
 
+type MergeCategoryPayload struct {
+	TargetID int `json:"target_id" validate:"required"`
+}
+
 type CreateCoursePayload struct {
 	CategoryID  int     `json:"category_id" validate:"required"`
 	Name        string  `json:"name" validate:"required"`
@@ -129,18 +230,30 @@ type CreateCoursePayload struct {
 	IntroVideo  string  `json:"intro_video"`
 	Image       string  `json:"image"`
 	Price       float64 `json:"price" validate:"required,min=0"`
+	Language    string  `json:"language" validate:"omitempty,max=10,bcp47_language_tag"`
+	Level       CourseLevel `json:"level" validate:"omitempty,oneof=beginner intermediate advanced all_levels"`
+	Tags        []string `json:"tags" validate:"omitempty,max=20,dive,required,max=50"`
+	Skills      []string `json:"skills" validate:"omitempty,max=20,dive,required,max=50"`
 }
 
 
 type UpdateCoursePayload struct {
 	CategoryID  int     `json:"category_id" validate:"required"`
 	Name        string  `json:"name" validate:"required"`
-	Description string  `json:"description"`
-	ForWho      string  `json:"for_who"`
-	Reason      string  `json:"reason"`
-	IntroVideo  string  `json:"intro_video"`
-	Image       string  `json:"image"`
+	Description *string `json:"description"` // nil keeps the current value, as for the other optional texts
+	ForWho      *string `json:"for_who"`
+	Reason      *string `json:"reason"`
+	IntroVideo  *string `json:"intro_video"`
+	Image       *string `json:"image"`
 	Price       float64 `json:"price" validate:"min=0"`
+	Language    string  `json:"language" validate:"omitempty,max=10,bcp47_language_tag"` // empty keeps the current language
+	Level       CourseLevel `json:"level" validate:"omitempty,oneof=beginner intermediate advanced all_levels"` // empty keeps the current level
+	Tags        []string `json:"tags" validate:"omitempty,max=20,dive,required,max=50"`
+	Skills      []string `json:"skills" validate:"omitempty,max=20,dive,required,max=50"`
+}
+
+type RejectCoursePayload struct {
+	Reason string `json:"reason" validate:"required"`
 }
 
 type CreateSectionPayload struct {
@@ -166,3 +279,18 @@ type UpdateVideoPayload struct {
     VideoFile string `json:"video_file" validate:"required"`
     Order     int    `json:"order"`
 }
+
+type ReorderSectionsPayload struct {
+	SectionIDs []int `json:"section_ids" validate:"required,min=1"`
+}
+
+// SectionVideoOrder is the complete ordered list of videos for one section.
+// A video listed under a different section than its current one is moved.
+type SectionVideoOrder struct {
+	SectionID int   `json:"section_id" validate:"required"`
+	VideoIDs  []int `json:"video_ids"`
+}
+
+type ReorderVideosPayload struct {
+	Sections []SectionVideoOrder `json:"sections" validate:"required,min=1,dive"`
+}
@@ -0,0 +1,78 @@
+package types
+
+import (
+	"time"
+
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+type LearningPathStore interface {
+	CreatePath(path *LearningPath) error
+	GetPaths(params pagination.Params) (pagination.Page[LearningPath], error)
+	GetPathByID(id int) (*LearningPath, error)
+	GetPathBySlug(slug string) (*LearningPath, error)
+	UpdatePath(path *LearningPath) error
+	DeletePath(id int) error
+	SetPathCourses(pathID int, courseIDs []int) error
+}
+
+// LearningPath is an admin-assembled, ordered sequence of courses.
+type LearningPath struct {
+	ID          int                  `json:"id"`
+	Title       string               `json:"title"`
+	Slug        string               `json:"slug"`
+	Description string               `json:"description"`
+	CreatedBy   int                  `json:"created_by"`
+	Courses     []LearningPathCourse `json:"courses"`
+	CreatedAt   time.Time            `json:"created_at"`
+	ModifiedAt  time.Time            `json:"modified_at"`
+}
+
+type LearningPathCourse struct {
+	Position      int     `json:"position"`
+	CourseID      int     `json:"course_id"`
+	Name          string  `json:"name"`
+	Slug          string  `json:"slug"`
+	Image         string  `json:"image"`
+	Price         float64 `json:"price"`
+	LectureCount  int     `json:"lecture_count"`
+	TotalDuration int     `json:"total_duration"`
+}
+
+// PathCourseProgress is how far a student got in one course of a path.
+type PathCourseProgress struct {
+	LearningPathCourse
+	Enrolled          bool    `json:"enrolled"`
+	CompletedLectures int     `json:"completed_lectures"`
+	Percent           float64 `json:"percent"`
+	Completed         bool    `json:"completed"`
+}
+
+type PathProgress struct {
+	PathID            int                  `json:"path_id"`
+	Title             string               `json:"title"`
+	Slug              string               `json:"slug"`
+	Courses           []PathCourseProgress `json:"courses"`
+	CompletedCourses  int                  `json:"completed_courses"`
+	TotalCourses      int                  `json:"total_courses"`
+	CompletedLectures int                  `json:"completed_lectures"`
+	TotalLectures     int                  `json:"total_lectures"`
+	Percent           float64              `json:"percent"`
+	// NextCourse is the first course of the path not completed yet
+	NextCourse *LearningPathCourse `json:"next_course,omitempty"`
+}
+
+type CreateLearningPathPayload struct {
+	Title       string `json:"title" validate:"required,max=255"`
+	Description string `json:"description"`
+	CourseIDs   []int  `json:"course_ids"`
+}
+
+type UpdateLearningPathPayload struct {
+	Title       string `json:"title" validate:"required,max=255"`
+	Description string `json:"description"`
+}
+
+type SetPathCoursesPayload struct {
+	CourseIDs []int `json:"course_ids" validate:"required"`
+}
@@ -0,0 +1,37 @@
+package types
+
+import (
+	"time"
+
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+type NotificationStore interface {
+	GetNotifications(userID int, unreadOnly bool, params pagination.Params) (pagination.Page[Notification], error)
+	CountUnread(userID int) (int, error)
+	MarkRead(userID int, notificationID int) error
+	MarkAllRead(userID int) error
+}
+
+
+type NotificationKind string
+
+const (
+	// Sent once a student may review a course they have not rated yet
+	NotificationReviewPrompt NotificationKind = "review_prompt"
+	// Sent to a course's teacher when a student asks a question
+	NotificationNewQuestion NotificationKind = "new_question"
+)
+
+
+type Notification struct {
+	ID        int              `json:"id"`
+	UserID    int              `json:"user_id"`
+	Kind      NotificationKind `json:"kind"`
+	Title     string           `json:"title"`
+	Body      string           `json:"body"`
+	Link      string           `json:"link"`
+	CourseID  *int             `json:"course_id,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	ReadAt    *time.Time       `json:"read_at,omitempty"`
+}
@@ -6,4 +6,7 @@ package types
 type PageStore interface {
 	GetCourseDetailBySlug(slug string) (map[string]interface{}, error)
 	GetCourseSectionsAndVideos(courseID int) ([]map[string]interface{}, error)
+	SearchTags(prefix string, limit int) ([]Tag, error)
+	GetTagBySlug(slug string) (*Tag, error)
+	GetTopCoursesByTag(tagID, limit int) ([]map[string]interface{}, error)
 }
\ No newline at end of file
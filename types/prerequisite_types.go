@@ -0,0 +1,28 @@
+package types
+
+// PrerequisitePolicy decides what happens when a student adds a course to
+// the cart without owning its prerequisites.
+type PrerequisitePolicy string
+
+const (
+	PrerequisiteWarn  PrerequisitePolicy = "warn"
+	PrerequisiteBlock PrerequisitePolicy = "block"
+)
+
+// CoursePrerequisite is a course that should be taken before another one.
+type CoursePrerequisite struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type CoursePrerequisites struct {
+	CourseID      int                  `json:"course_id"`
+	Policy        PrerequisitePolicy   `json:"policy"`
+	Prerequisites []CoursePrerequisite `json:"prerequisites"`
+}
+
+type SetPrerequisitesPayload struct {
+	CourseIDs []int              `json:"course_ids" validate:"max=20"`
+	Policy    PrerequisitePolicy `json:"policy" validate:"omitempty,oneof=warn block"`
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"time"
+
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
+// QAStore serves the Q&A board of each course. Every call takes the slug
+// of the course and the asking user, and fails unless the user is enrolled
+// in the course or teaches it.
+type QAStore interface {
+	GetQuestions(slug string, userID int, filter QuestionFilter, params pagination.Params) (pagination.Page[Question], error)
+	GetQuestion(slug string, userID int, questionID int) (*Question, error)
+	CreateQuestion(slug string, userID int, payload CreateQuestionPayload) (*Question, error)
+	CreateAnswer(slug string, userID int, questionID int, payload CreateAnswerPayload) (*Answer, error)
+	VoteQuestion(slug string, userID int, questionID int, up bool) (int, error)
+	VoteAnswer(slug string, userID int, answerID int, up bool) (int, error)
+}
+
+
+type QuestionSort string
+
+const (
+	QuestionSortNewest QuestionSort = "newest"
+	QuestionSortTop    QuestionSort = "top"
+)
+
+// QuestionStatus narrows the questions listed by their answers.
+type QuestionStatus string
+
+const (
+	QuestionUnanswered QuestionStatus = "unanswered"
+	// Answered by the course's teacher
+	QuestionInstructor QuestionStatus = "instructor"
+)
+
+// QuestionFilter narrows the questions of a course. Query searches their
+// titles and bodies; VideoID keeps the questions about one lecture.
+type QuestionFilter struct {
+	Query   string
+	VideoID int
+	Status  QuestionStatus
+	Sort    QuestionSort
+}
+
+
+type Question struct {
+	ID                   int       `json:"id"`
+	CourseID             int       `json:"course_id"`
+	VideoID              *int      `json:"video_id,omitempty"`
+	VideoTitle           *string   `json:"video_title,omitempty"`
+	AuthorID             int       `json:"author_id"`
+	AuthorName           string    `json:"author_name"`
+	Title                string    `json:"title"`
+	Body                 string    `json:"body"`
+	Upvotes              int       `json:"upvotes"`
+	AnswerCount          int       `json:"answer_count"`
+	AnsweredByInstructor bool      `json:"answered_by_instructor"`
+	Upvoted              bool      `json:"upvoted"`
+	CreatedAt            time.Time `json:"created_at"`
+	// Only set when a single question is fetched, as a thread
+	Answers []*Answer `json:"answers,omitempty"`
+}
+
+type Answer struct {
+	ID           int       `json:"id"`
+	QuestionID   int       `json:"question_id"`
+	ParentID     *int      `json:"parent_id,omitempty"`
+	AuthorID     int       `json:"author_id"`
+	AuthorName   string    `json:"author_name"`
+	Body         string    `json:"body"`
+	ByInstructor bool      `json:"by_instructor"`
+	Upvotes      int       `json:"upvotes"`
+	Upvoted      bool      `json:"upvoted"`
+	CreatedAt    time.Time `json:"created_at"`
+	Replies      []*Answer `json:"replies"`
+}
+
+
+type CreateQuestionPayload struct {
+	Title   string `json:"title" validate:"required,max=200"`
+	Body    string `json:"body" validate:"max=5000"`
+	VideoID *int   `json:"video_id,omitempty"`
+}
+
+type CreateAnswerPayload struct {
+	Body     string `json:"body" validate:"required,max=5000"`
+	ParentID *int   `json:"parent_id,omitempty"`
+}
@@ -1,21 +1,83 @@
 package types
 
-import "time"
+import (
+	"time"
+
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
 
 type RatingStore interface {
-	CreateRating(rating *Rating) (int, error)
+	// UpsertRating saves the student's only rating of a course, creating it
+	// or replacing the one they gave before, and reports which it did
+	UpsertRating(rating *Rating) (bool, error)
     UpdateRating(ratingID int, updatedRating *Rating) error
     GetRating(ratingID int) (*Rating, error)
-    GetRatingsForCourse(slug string, page int, limit int) ([]Rating, int, error)
-    GetRatingsByStudent(studentID int) ([]Rating, error)
+    GetRatingsForCourse(slug string, sort RatingSort, params pagination.Params) (pagination.Page[Rating], error)
+    GetRatingsByStudent(studentID int, params pagination.Params) (pagination.Page[Rating], error)
 	GetRatingByStudentID(ratingID int, studentID int) (*Rating, error)
     DeleteRating(ratingID int) error
     GetAverageRating(courseID int) (float32, error)
     CountRatingsAndReviews(courseID int) (int, int, error)
+	GetRatingSummary(slug string) (*RatingSummary, error)
 	IsStudentEnrolledInCourse(studentID int, courseID int) (bool, error)
+
+	// Eligibility to review
+	GetCourseProgress(studentID int, courseID int) (*CourseProgress, error)
+	PromptReviews(rules ReviewRules) (int, error)
+
+	// Moderation
+	ReportReview(report *ReviewReport) error
+	GetModerationQueue(filter ModerationQueue, params pagination.Params) (pagination.Page[ModerationQueueItem], error)
+	ModerateReview(ratingID int, action ModerationAction, reason string, moderatorID int) error
+
+	// Teacher responses and helpfulness votes
+	CreateResponse(ratingID int, teacherUserID int, body string) (*ReviewResponse, error)
+	UpdateResponse(ratingID int, teacherUserID int, body string) (*ReviewResponse, error)
+	DeleteResponse(ratingID int, teacherUserID int) error
+	VoteReview(ratingID int, userID int, helpful bool) (int, int, error)
 }
 
 
+// RatingSort orders the ratings listed for a course.
+type RatingSort string
+
+const (
+	RatingSortNewest  RatingSort = "newest"
+	RatingSortHelpful RatingSort = "helpful"
+	RatingSortHighest RatingSort = "highest"
+	RatingSortLowest  RatingSort = "lowest"
+)
+
+
+type RatingStatus string
+
+const (
+	RatingPublished RatingStatus = "published"
+	RatingPending   RatingStatus = "pending"
+	RatingHidden    RatingStatus = "hidden"
+)
+
+type ModerationAction string
+
+const (
+	ModerationFilter  ModerationAction = "filter"
+	ModerationReport  ModerationAction = "report"
+	ModerationApprove ModerationAction = "approve"
+	ModerationHide    ModerationAction = "hide"
+	ModerationDelete  ModerationAction = "delete"
+)
+
+// ModerationQueue narrows the moderation queue: "pending" reviews held
+// back by the filter or by reports, "reported" published reviews with open
+// reports, or both when empty.
+type ModerationQueue string
+
+const (
+	QueuePending  ModerationQueue = "pending"
+	QueueReported ModerationQueue = "reported"
+)
+
+
 type Rating struct {
 	ID        int       `json:"id"`
 	StudentID int       `json:"student_id"`
@@ -26,6 +88,39 @@ type Rating struct {
 	Rating    float32   `json:"rating"`
 	Review    *string   `json:"review,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
+	HelpfulVotes   int             `json:"helpful_votes"`
+	UnhelpfulVotes int             `json:"unhelpful_votes"`
+	Response       *ReviewResponse `json:"response,omitempty"`
+
+	// Percent of the course the reviewer had completed when they saved the
+	// rating, unknown for older ratings
+	ReviewerProgress *float64 `json:"reviewer_progress,omitempty"`
+
+	// Only set on the author's own ratings and in the moderation queue
+	Status           RatingStatus `json:"status,omitempty"`
+	ModerationReason *string      `json:"moderation_reason,omitempty"`
+}
+
+
+// RatingPriorWeight is how many ratings of the site wide average a course
+// starts with in its Bayesian average, so a course needs that many ratings
+// of its own before they outweigh the prior.
+const RatingPriorWeight = 10
+
+// RatingSummary sums up the published ratings of a course. Histogram has
+// one bucket per star, 1 to 5, with ratings rounded to whole stars.
+type RatingSummary struct {
+	Average         float64        `json:"average"`
+	BayesianAverage float64        `json:"bayesian_average"`
+	RatingCount     int            `json:"rating_count"`
+	ReviewCount     int            `json:"review_count"`
+	Histogram       []RatingBucket `json:"histogram"`
+}
+
+type RatingBucket struct {
+	Stars   int     `json:"stars"`
+	Count   int     `json:"count"`
+	Percent float64 `json:"percent"`
 }
 
 
@@ -35,3 +130,91 @@ type RatingPayload struct {
 	Review    *string   `json:"review,omitempty"`
 }
 
+
+
+type ReviewReport struct {
+	ID         int       `json:"id"`
+	RatingID   int       `json:"rating_id"`
+	ReporterID int       `json:"reporter_id"`
+	Reason     string    `json:"reason"`
+	Details    *string   `json:"details,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ReportReviewPayload struct {
+	Reason  string  `json:"reason" validate:"required,oneof=spam offensive off_topic other"`
+	Details *string `json:"details,omitempty" validate:"omitempty,max=1000"`
+}
+
+// ModerationQueueItem is a review waiting for an admin, with the reasons
+// of its open reports.
+type ModerationQueueItem struct {
+	Rating
+	OpenReports   int      `json:"open_reports"`
+	ReportReasons []string `json:"report_reasons"`
+}
+
+type ModerateReviewPayload struct {
+	Reason string `json:"reason" validate:"max=1000"`
+}
+
+
+// ReviewResponse is the public answer of a course's teacher to a review.
+type ReviewResponse struct {
+	RatingID    int       `json:"rating_id"`
+	TeacherID   int       `json:"teacher_id"`
+	TeacherName string    `json:"teacher_name"`
+	Body        string    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ReviewResponsePayload struct {
+	Body string `json:"body" validate:"required,max=2000"`
+}
+
+type ReviewVotePayload struct {
+	Helpful *bool `json:"helpful" validate:"required"`
+}
+
+
+// ReviewRules decide when an enrolled student may review a course: once
+// they completed MinProgress percent of it or were enrolled for
+// MinEnrolledFor, whichever comes first. A zero rule is off; with both off
+// students may review straight away.
+type ReviewRules struct {
+	MinProgress    float64
+	MinEnrolledFor time.Duration
+}
+
+// Allows reports whether a student with progress percent of the course done,
+// enrolled at enrolledAt, may review it at now. A nil enrolledAt never
+// meets MinEnrolledFor.
+func (r ReviewRules) Allows(progress float64, enrolledAt *time.Time, now time.Time) bool {
+	if r.MinProgress <= 0 && r.MinEnrolledFor <= 0 {
+		return true
+	}
+	if r.MinProgress > 0 && progress >= r.MinProgress {
+		return true
+	}
+	return r.MinEnrolledFor > 0 && enrolledAt != nil && !now.Before(enrolledAt.Add(r.MinEnrolledFor))
+}
+
+
+// CourseProgress is how far an enrolled student got in a course. Percent
+// weighs lectures by their duration.
+type CourseProgress struct {
+	Enrolled   bool       `json:"enrolled"`
+	EnrolledAt *time.Time `json:"enrolled_at,omitempty"`
+	Percent    float64    `json:"percent"`
+}
+
+// ReviewEligibility tells a student whether they may review a course yet,
+// and otherwise what it takes.
+type ReviewEligibility struct {
+	Eligible    bool       `json:"eligible"`
+	Progress    float64    `json:"progress"`
+	MinProgress float64    `json:"min_progress,omitempty"`
+	EligibleAt  *time.Time `json:"eligible_at,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
@@ -0,0 +1,56 @@
+package types
+
+import "time"
+
+type RecommendationKind string
+
+const (
+	RecommendForStudent RecommendationKind = "student"
+	RecommendAlsoBought RecommendationKind = "also_bought"
+	RecommendPopular    RecommendationKind = "popular"
+)
+
+// RecommendationReason tells a student why a course was picked for them.
+type RecommendationReason string
+
+const (
+	ReasonSimilarStudents RecommendationReason = "similar_students"
+	ReasonCategory        RecommendationReason = "category"
+	ReasonAlsoBought      RecommendationReason = "also_bought"
+	ReasonPopular         RecommendationReason = "popular"
+)
+
+// RecommendationStore serves the recommendations the background job
+// computed. Students without recommendations of their own get popular
+// courses instead.
+type RecommendationStore interface {
+	GetRecommendations(studentID int, limit int) ([]RecommendedCourse, error)
+	GetAlsoBought(courseID int, limit int) ([]RecommendedCourse, error)
+}
+
+// Recommendation is one precomputed row. SubjectID is the student for
+// RecommendForStudent, the course for RecommendAlsoBought and 0 for
+// RecommendPopular. Position is 1-based within the subject.
+type Recommendation struct {
+	Kind      RecommendationKind
+	SubjectID int
+	CourseID  int
+	Score     float64
+	Position  int
+	Reason    RecommendationReason
+}
+
+// RecommendedCourse is a recommendation as shown to students.
+type RecommendedCourse struct {
+	ID              int                  `json:"id"`
+	Name            string               `json:"name"`
+	Slug            string               `json:"slug"`
+	Image           string               `json:"image_url"`
+	Price           float64              `json:"price"`
+	Instructor      string               `json:"instructor"`
+	Rating          float64              `json:"rating"`
+	EnrollmentCount int                  `json:"enrollment_count"`
+	Score           float64              `json:"score"`
+	Reason          RecommendationReason `json:"reason"`
+	ComputedAt      time.Time            `json:"computed_at"`
+}
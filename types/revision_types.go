@@ -0,0 +1,82 @@
+package types
+
+import "time"
+
+type RevisionStatus string
+
+const (
+	RevisionDraft     RevisionStatus = "draft"
+	RevisionPublished RevisionStatus = "published"
+)
+
+// CourseRevision is a point-in-time copy of a course and its content.
+// Published revisions are never modified; at most one draft exists per course
+// and holds edits staged against a live course.
+type CourseRevision struct {
+	ID          int             `json:"id"`
+	CourseID    int             `json:"course_id"`
+	Number      int             `json:"number,omitempty"`
+	Status      RevisionStatus  `json:"status"`
+	AuthorID    int             `json:"author_id"`
+	Message     string          `json:"message,omitempty"`
+	Snapshot    *CourseSnapshot `json:"snapshot,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	PublishedAt *time.Time      `json:"published_at,omitempty"`
+}
+
+type CourseSnapshot struct {
+	CategoryID  int               `json:"category_id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	ForWho      string            `json:"for_who"`
+	Reason      string            `json:"reason"`
+	IntroVideo  string            `json:"intro_video"`
+	Image       string            `json:"image"`
+	Price       float64           `json:"price"`
+	Language    string            `json:"language,omitempty"` // empty, as in revisions saved before languages existed, leaves it untouched
+	Level       CourseLevel       `json:"level,omitempty"`
+	Tags        []CourseTag       `json:"tags"` // nil, as in revisions saved before tags existed, leaves tags untouched
+	Sections    []SectionSnapshot `json:"sections"`
+	// Live sections and videos a draft removes. Sections and videos a draft
+	// adds have negative IDs until it is published.
+	DeletedSections []int `json:"deleted_sections,omitempty"`
+	DeletedVideos   []int `json:"deleted_videos,omitempty"`
+}
+
+type SectionSnapshot struct {
+	ID     int             `json:"id"`
+	Title  string          `json:"title"`
+	Order  int             `json:"order"`
+	Videos []VideoSnapshot `json:"videos"`
+}
+
+type VideoSnapshot struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	VideoFile string `json:"video_file"`
+	Order     int    `json:"order"`
+}
+
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type ItemChange struct {
+	ID        int           `json:"id"`
+	SectionID int           `json:"section_id,omitempty"`
+	Title     string        `json:"title"`
+	Change    string        `json:"change"` // added, removed or modified
+	Fields    []FieldChange `json:"fields,omitempty"`
+}
+
+type RevisionDiff struct {
+	Course   []FieldChange `json:"course"`
+	Sections []ItemChange  `json:"sections"`
+	Videos   []ItemChange  `json:"videos"`
+}
+
+type PublishRevisionPayload struct {
+	Message string `json:"message"`
+}
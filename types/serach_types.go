@@ -1,7 +1,166 @@
 package types
 
+import (
+	"time"
+
+	"github.com/sikozonpc/ecom/utils/pagination"
+)
+
 
 type SearchResult interface {
-	GetCategoryIDByName(name string) (int, error)
-	SearchCourses(searchTerm string, categories []int, teacherID int, priceMin, priceMax float64, createdAfter, createdBefore string, page, limit int) ([]map[string]interface{}, int, error)
-}
\ No newline at end of file
+	GetCategoryIDsByName(name string) ([]int, error)
+	SearchCourses(params CourseSearchParams) (pagination.Page[map[string]interface{}], error)
+	GetSearchFacets(params CourseSearchParams) (*SearchFacets, error)
+	Suggest(term string, limit int) (*SearchSuggestions, error)
+	SuggestCorrection(term string) (string, error)
+}
+
+
+// SearchIndexer keeps a search backend in sync with course changes.
+// IndexCourse reloads a course and drops it from the index when it is no
+// longer published. IndexCategory and IndexTeacher reload the courses whose
+// category (or one of its ancestors) or teacher was renamed or moved.
+type SearchIndexer interface {
+	IndexCourse(courseID int) error
+	IndexCategory(categoryID int) error
+	IndexTeacher(teacherID int) error
+	RemoveCourse(courseID int) error
+}
+
+// SearchBackend answers catalog searches and maintains whatever index it
+// needs. Rebuild recreates that index from the database and returns the
+// number of courses it holds.
+type SearchBackend interface {
+	SearchResult
+	SearchIndexer
+	Rebuild() (int, error)
+}
+
+
+type SearchSort string
+
+const (
+	SortRelevance    SearchSort = "relevance"
+	SortNewest       SearchSort = "newest"
+	SortPriceAsc     SearchSort = "price_asc"
+	SortPriceDesc    SearchSort = "price_desc"
+	SortHighestRated SearchSort = "highest_rated"
+	SortMostEnrolled SearchSort = "most_enrolled"
+)
+
+// CourseSearchParams holds the filters, ordering and page of a catalog
+// search. Zero values leave a filter out.
+type CourseSearchParams struct {
+	Term          string
+	Categories    []int
+	Tags          []string
+	TeacherID     int
+	PriceMin      float64
+	PriceMax      float64
+	CreatedAfter  string
+	CreatedBefore string
+	MinRating     float64
+	DurationMin   int // seconds
+	DurationMax   int // seconds
+	Languages     []string
+	Levels        []CourseLevel
+	Sort          SearchSort
+	Page          pagination.Params
+}
+
+// FacetBucket is one value of a facet with the number of matching courses.
+type FacetBucket struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+type SearchFacets struct {
+	Categories []FacetBucket `json:"categories"`
+	Prices     []FacetBucket `json:"prices"`
+	Ratings    []FacetBucket `json:"ratings"`
+	Teachers   []FacetBucket `json:"teachers"`
+}
+
+// Suggestion is one completion offered while the user types.
+type Suggestion struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug,omitempty"`
+}
+
+type SearchSuggestions struct {
+	Courses    []Suggestion `json:"courses"`
+	Teachers   []Suggestion `json:"teachers"`
+	Categories []Suggestion `json:"categories"`
+	Tags       []Suggestion `json:"tags"`
+}
+
+
+// SearchAnalyticsStore records what students search for and open, and
+// reports on it. It always lives in Postgres, whatever the search backend.
+type SearchAnalyticsStore interface {
+	LogSearch(entry *SearchLogEntry) error
+	LogSearchClick(click *SearchClick) error
+	GetTopQueries(from, to time.Time, limit int) ([]QueryStats, error)
+	GetZeroResultQueries(from, to time.Time, limit int) ([]ZeroResultQuery, error)
+	GetClickThrough(from, to time.Time) (*ClickThroughReport, error)
+}
+
+// SearchLogEntry is one /search request. Filters holds the query parameters
+// other than q, sort, cursor and limit. Token is handed to the client, which
+// sends it back when a result is clicked.
+type SearchLogEntry struct {
+	ID          int               `json:"id"`
+	Token       string            `json:"-"`
+	Query       string            `json:"query"`
+	Filters     map[string]string `json:"filters"`
+	Sort        SearchSort        `json:"sort"`
+	Page        int               `json:"page"`
+	ResultCount int               `json:"result_count"`
+	LatencyMS   float64           `json:"latency_ms"`
+	UserID      int               `json:"user_id,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+type SearchClick struct {
+	SearchToken string
+	CourseID int
+	Position int
+	UserID   int
+}
+
+type SearchClickPayload struct {
+	CourseID int `json:"course_id" validate:"required"`
+	Position int `json:"position" validate:"required,min=1"`
+}
+
+// QueryStats summarises one normalised query over a period.
+type QueryStats struct {
+	Query            string  `json:"query"`
+	Searches         int     `json:"searches"`
+	AvgResults       float64 `json:"avg_results"`
+	Clicks           int     `json:"clicks"`
+	ClickThroughRate float64 `json:"click_through_rate"`
+}
+
+type ZeroResultQuery struct {
+	Query          string    `json:"query"`
+	Searches       int       `json:"searches"`
+	LastSearchedAt time.Time `json:"last_searched_at"`
+}
+
+// ClickThroughReport covers every search from From up to, but not including,
+// To. ClickThroughRate is the share of searches where at least one result
+// was opened.
+type ClickThroughReport struct {
+	From               time.Time `json:"from"`
+	To                 time.Time `json:"to"`
+	Searches           int       `json:"searches"`
+	SearchesWithClicks int       `json:"searches_with_clicks"`
+	Clicks             int       `json:"clicks"`
+	ClickThroughRate   float64   `json:"click_through_rate"`
+	ZeroResultRate     float64   `json:"zero_result_rate"`
+	AvgClickPosition   float64   `json:"avg_click_position"`
+	AvgLatencyMS       float64   `json:"avg_latency_ms"`
+}
@@ -1,10 +1,14 @@
 package types
 
-
-
+import "github.com/sikozonpc/ecom/utils/pagination"
 
 type StudentStore interface {
-	GetEnrolledCourses(studentID int) ([]map[string]interface{}, error)
+	GetEnrolledCourses(studentID int, params pagination.Params) (pagination.Page[map[string]interface{}], error)
 	GetEnrolledCoursesBySlug(studentID int, slug string) (map[string]interface{}, error)
 	GetEnrolledCourseSectionsAndVideos(courseID int) ([]map[string]interface{}, error)
+
+	// Learning progress
+	SetLectureComplete(studentID int, slug string, videoID int, done bool) error
+	GetPathsProgress(studentID int, params pagination.Params) (pagination.Page[PathProgress], error)
+	GetPathProgress(studentID int, slug string) (*PathProgress, error)
 }
\ No newline at end of file
@@ -0,0 +1,26 @@
+package types
+
+type TagKind string
+
+const (
+	TagTopic TagKind = "topic"
+	TagSkill TagKind = "skill"
+)
+
+// MaxCourseTags caps how many tags a single course can carry.
+const MaxCourseTags = 20
+
+type Tag struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	CourseCount int    `json:"course_count"`
+}
+
+// CourseTag is a tag as attached to one course.
+type CourseTag struct {
+	ID   int     `json:"id,omitempty"`
+	Name string  `json:"name"`
+	Slug string  `json:"slug,omitempty"`
+	Kind TagKind `json:"kind"`
+}
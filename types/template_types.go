@@ -0,0 +1,35 @@
+package types
+
+import "time"
+
+// CourseTemplate is an admin-curated course that teachers can clone as the
+// starting point for a new course.
+type CourseTemplate struct {
+	ID           int       `json:"id"`
+	CourseID     int       `json:"course_id"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	CreatedBy    int       `json:"created_by"`
+	SectionCount int       `json:"section_count"`
+	LectureCount int       `json:"lecture_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	ModifiedAt   time.Time `json:"modified_at"`
+}
+
+// CloneCoursePayload overrides fields of the copy. Name defaults to the
+// source name with " (Copy)" appended and CategoryID to the source category.
+type CloneCoursePayload struct {
+	Name       string `json:"name"`
+	CategoryID int    `json:"category_id"`
+}
+
+type CreateTemplatePayload struct {
+	CourseID    int    `json:"course_id" validate:"required"`
+	Title       string `json:"title" validate:"required"`
+	Description string `json:"description"`
+}
+
+type UpdateTemplatePayload struct {
+	Title       string `json:"title" validate:"required"`
+	Description string `json:"description"`
+}
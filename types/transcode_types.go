@@ -0,0 +1,52 @@
+package types
+
+import "context"
+
+type VideoStatus string
+
+const (
+	VideoQueued     VideoStatus = "queued"
+	VideoProcessing VideoStatus = "processing"
+	VideoReady      VideoStatus = "ready"
+	VideoFailed     VideoStatus = "failed"
+)
+
+type TranscodeStore interface {
+	// SetTranscodeStatus reports false when the video no longer has
+	// videoFile as its source
+	SetTranscodeStatus(videoID int, videoFile string, status VideoStatus, errMsg string) (bool, error)
+	SaveTranscodeResult(videoID int, videoFile string, result *TranscodeResult) error
+	GetPendingTranscodeJobs(statuses ...VideoStatus) ([]TranscodeJob, error)
+}
+
+// Transcoder turns a source video, a local file, into HLS renditions, a
+// poster thumbnail and a duration. Paths in the result are relative to
+// outputDir.
+type Transcoder interface {
+	Transcode(ctx context.Context, input string, outputDir string) (*TranscodeResult, error)
+}
+
+type TranscodeQueue interface {
+	Enqueue(job TranscodeJob) error
+}
+
+type TranscodeJob struct {
+	VideoID   int    `json:"video_id"`
+	VideoFile string `json:"video_file"`
+}
+
+type Rendition struct {
+	Name         string `json:"name"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	VideoBitrate int    `json:"video_bitrate"` // kbps
+	AudioBitrate int    `json:"audio_bitrate"` // kbps
+	Playlist     string `json:"playlist,omitempty"`
+}
+
+type TranscodeResult struct {
+	Playlist   string      `json:"playlist"`
+	Thumbnail  string      `json:"thumbnail"`
+	Duration   int         `json:"duration"` // seconds
+	Renditions []Rendition `json:"renditions"`
+}
@@ -0,0 +1,362 @@
+// Package pagination pages through lists with keyset cursors.
+//
+// A cursor records the sort key of the row a page ends on and the next page
+// starts strictly after it, so pages stay stable while rows are added or
+// removed, unlike offsets. Cursors are opaque to clients: they are handed
+// out in the response envelope and sent back as ?cursor=.
+package pagination
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Cursor is a position in a list. Scope ties it to the list (and ordering)
+// it was issued for; Offset counts the rows before the page it opens.
+type Cursor struct {
+	Scope    string        `json:"s"`
+	Keys     []interface{} `json:"k"`
+	Backward bool          `json:"b,omitempty"`
+	Offset   int           `json:"o,omitempty"`
+}
+
+// Params is the page a request asks for.
+type Params struct {
+	Limit  int
+	Cursor *Cursor
+	scope  string
+}
+
+// Page is the response envelope shared by every list endpoint. Total is
+// only set by lists that can count their rows cheaply.
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+	Total      *int   `json:"total,omitempty"`
+	// Offset is the number of rows before this page
+	Offset int `json:"-"`
+}
+
+
+// FromRequest reads ?limit= and ?cursor=. scope names the list and, when it
+// can be reordered, the ordering, so a cursor from one list is rejected by
+// another.
+func FromRequest(request *http.Request, scope string, defaultLimit, maxLimit int) (Params, error) {
+	params := Params{Limit: defaultLimit, scope: scope}
+	query := request.URL.Query()
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return params, fmt.Errorf("invalid limit parameter, expected 1 to %d", maxLimit)
+		}
+		params.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decode(value)
+		if err != nil || cursor.Scope != scope || len(cursor.Keys) == 0 {
+			return params, ErrInvalidCursor
+		}
+		params.Cursor = cursor
+	}
+
+	return params, nil
+}
+
+
+// QueryLimit reads ?limit= for lists that are not paged, falling back to
+// def and capping it at max.
+func QueryLimit(request *http.Request, def, max int) int {
+	limit, err := strconv.Atoi(request.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		return def
+	}
+	if limit > max {
+		return max
+	}
+	return limit
+}
+
+
+// First is the first page of a list, for callers that do not page.
+func First(scope string, limit int) Params {
+	return Params{Limit: limit, scope: scope}
+}
+
+
+func (p Params) backward() bool {
+	return p.Cursor != nil && p.Cursor.Backward
+}
+
+
+func (p Params) encode(keys []interface{}, backward bool, offset int) string {
+	if offset < 0 {
+		offset = 0
+	}
+	data, err := json.Marshal(Cursor{Scope: p.scope, Keys: keys, Backward: backward, Offset: offset})
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+
+func decode(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Numbers stay json.Number so IDs and timestamps survive exactly
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var cursor Cursor
+	if err := decoder.Decode(&cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+
+// Keyset is the ordering of a list as SQL expressions. The last expression
+// must be unique, usually the ID, none may be NULL, and all of them sort in
+// the same direction.
+type Keyset struct {
+	Columns []string
+	Desc    bool
+}
+
+
+// Where returns the condition, starting with " AND ", that selects the rows
+// on the requested side of the cursor, and appends its arguments to args.
+// Without a cursor it returns "".
+func (k Keyset) Where(p Params, args []interface{}) (string, []interface{}, error) {
+	if p.Cursor == nil {
+		return "", args, nil
+	}
+	if len(p.Cursor.Keys) != len(k.Columns) {
+		return "", args, ErrInvalidCursor
+	}
+
+	placeholders := make([]string, len(p.Cursor.Keys))
+	for i, key := range p.Cursor.Keys {
+		args = append(args, key)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+
+	op := ">"
+	if k.Desc != p.backward() {
+		op = "<"
+	}
+	return fmt.Sprintf(" AND (%s) %s (%s)", strings.Join(k.Columns, ", "), op, strings.Join(placeholders, ", ")), args, nil
+}
+
+
+// OrderBy returns the ORDER BY and LIMIT clauses for the page. One row more
+// than the limit is fetched to tell whether another page follows; NewPage
+// drops it again.
+func (k Keyset) OrderBy(p Params, args []interface{}) (string, []interface{}) {
+	direction := "ASC"
+	if k.Desc != p.backward() {
+		direction = "DESC"
+	}
+
+	columns := make([]string, len(k.Columns))
+	for i, column := range k.Columns {
+		columns[i] = column + " " + direction
+	}
+
+	args = append(args, p.Limit+1)
+	return fmt.Sprintf(" ORDER BY %s LIMIT $%d", strings.Join(columns, ", "), len(args)), args
+}
+
+
+// NewPage builds the envelope from the rows a Keyset query returned. key
+// returns the sort key of a row, in the order of the keyset columns.
+func NewPage[T any](rows []T, p Params, key func(T) []interface{}) Page[T] {
+	backward := p.backward()
+	more := len(rows) > p.Limit
+	if more {
+		rows = rows[:p.Limit]
+	}
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	page := Page[T]{Data: rows}
+	if page.Data == nil {
+		page.Data = []T{}
+	}
+
+	if p.Cursor != nil {
+		page.Offset = p.Cursor.Offset
+		if backward {
+			page.Offset -= len(rows)
+		}
+	}
+	if page.Offset < 0 || (backward && !more) {
+		page.Offset = 0
+	}
+
+	if len(rows) == 0 {
+		// Paged past either end: offer the way back
+		if p.Cursor != nil {
+			if backward {
+				page.NextCursor = p.encode(p.Cursor.Keys, false, 0)
+			} else {
+				page.PrevCursor = p.encode(p.Cursor.Keys, true, page.Offset)
+			}
+		}
+		return page
+	}
+
+	if (backward && more) || (!backward && p.Cursor != nil) {
+		page.PrevCursor = p.encode(key(rows[0]), true, page.Offset)
+	}
+	if (!backward && more) || backward {
+		page.NextCursor = p.encode(key(rows[len(rows)-1]), false, page.Offset+len(rows))
+	}
+	return page
+}
+
+
+// Slice pages through rows already sorted in memory, the way Keyset does in
+// SQL. Keys may be numbers or strings; desc tells how rows are sorted.
+func Slice[T any](sorted []T, p Params, key func(T) []interface{}, desc bool) (Page[T], error) {
+	if p.Cursor == nil {
+		end := p.Limit + 1
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+		return NewPage(sorted[:end], p, key), nil
+	}
+
+	// Index of the first row after the cursor in sort order
+	split := len(sorted)
+	for i, row := range sorted {
+		cmp, err := compareKeys(key(row), p.Cursor.Keys)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		if (desc && cmp < 0) || (!desc && cmp > 0) {
+			split = i
+			break
+		}
+	}
+
+	var rows []T
+	if p.Cursor.Backward {
+		// Rows before the cursor, nearest first, as a backward query returns them
+		end := split
+		if end > 0 {
+			if cmp, _ := compareKeys(key(sorted[end-1]), p.Cursor.Keys); cmp == 0 {
+				end--
+			}
+		}
+		for i := end - 1; i >= 0 && len(rows) <= p.Limit; i-- {
+			rows = append(rows, sorted[i])
+		}
+	} else {
+		end := split + p.Limit + 1
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+		rows = sorted[split:end]
+	}
+	return NewPage(rows, p, key), nil
+}
+
+
+func compareKeys(a, b []interface{}) (int, error) {
+	if len(a) != len(b) {
+		return 0, ErrInvalidCursor
+	}
+	for i := range a {
+		cmp, err := compareKey(a[i], b[i])
+		if err != nil || cmp != 0 {
+			return cmp, err
+		}
+	}
+	return 0, nil
+}
+
+
+func compareKey(a, b interface{}) (int, error) {
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		if !ok {
+			return 0, ErrInvalidCursor
+		}
+		return strings.Compare(x, y), nil
+	}
+
+	x, okA := number(a)
+	y, okB := number(b)
+	if !okA || !okB {
+		return 0, ErrInvalidCursor
+	}
+	switch {
+	case x < y:
+		return -1, nil
+	case x > y:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+
+// Map converts the rows of a page, keeping its cursors.
+func Map[T, U any](page Page[T], convert func(T) U) Page[U] {
+	out := Page[U]{
+		Data:       make([]U, len(page.Data)),
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+		Total:      page.Total,
+		Offset:     page.Offset,
+	}
+	for i, row := range page.Data {
+		out.Data[i] = convert(row)
+	}
+	return out
+}
+
+
+// WithTotal sets the optional total row count of the list.
+func (page Page[T]) WithTotal(total int) Page[T] {
+	page.Total = &total
+	return page
+}
@@ -0,0 +1,180 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func requestParams(t *testing.T, scope string, query string) (Params, error) {
+	t.Helper()
+	request := httptest.NewRequest("GET", "/list?"+query, nil)
+	return FromRequest(request, scope, DefaultLimit, MaxLimit)
+}
+
+
+func TestCursorRoundTrip(t *testing.T) {
+	params := First("ratings:newest", 10)
+	encoded := params.encode([]interface{}{"2024-01-02T03:04:05.123456Z", 9007199254740993}, true, 40)
+
+	decoded, err := requestParams(t, "ratings:newest", "limit=10&cursor="+encoded)
+	if err != nil {
+		t.Fatalf("FromRequest: %v", err)
+	}
+	cursor := decoded.Cursor
+	if cursor == nil || !cursor.Backward || cursor.Offset != 40 || decoded.Limit != 10 {
+		t.Fatalf("decoded %+v with cursor %+v", decoded, cursor)
+	}
+	// IDs beyond float64 precision come back exactly
+	if got, ok := cursor.Keys[1].(json.Number); !ok || got.String() != "9007199254740993" {
+		t.Errorf("id key = %#v", cursor.Keys[1])
+	}
+	if cursor.Keys[0] != "2024-01-02T03:04:05.123456Z" {
+		t.Errorf("time key = %v", cursor.Keys[0])
+	}
+}
+
+
+func TestCursorRejected(t *testing.T) {
+	other := First("ratings:newest", 10).encode([]interface{}{1}, false, 0)
+	empty := First("questions", 10).encode([]interface{}{}, false, 0)
+	notJSON := base64.RawURLEncoding.EncodeToString([]byte("not json"))
+
+	tests := map[string]string{
+		"another list's cursor": other,
+		"no keys":               empty,
+		"not base64":            "!!!",
+		"not json":              notJSON,
+		"cut short":             First("questions", 10).encode([]interface{}{1}, false, 0)[:10],
+	}
+	for name, cursor := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := requestParams(t, "questions", "cursor="+cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+
+	// A cursor with the wrong number of keys for the list is caught by Where
+	params, err := requestParams(t, "questions", "cursor="+First("questions", 10).encode([]interface{}{1}, false, 0))
+	if err != nil {
+		t.Fatalf("FromRequest: %v", err)
+	}
+	keyset := Keyset{Columns: []string{"q.created_at", "q.id"}}
+	if _, _, err := keyset.Where(params, nil); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Where with one key for two columns: got %v, want ErrInvalidCursor", err)
+	}
+}
+
+
+func TestLimit(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=101", "limit=ten"} {
+		if _, err := requestParams(t, "questions", query); err == nil {
+			t.Errorf("%s was accepted", query)
+		}
+	}
+
+	params, err := requestParams(t, "questions", "")
+	if err != nil || params.Limit != DefaultLimit {
+		t.Errorf("default limit = %d, %v", params.Limit, err)
+	}
+
+	request := httptest.NewRequest("GET", "/tags?limit=500", nil)
+	if got := QueryLimit(request, 10, 50); got != 50 {
+		t.Errorf("QueryLimit over the cap = %d, want 50", got)
+	}
+	request = httptest.NewRequest("GET", "/tags?limit=abc", nil)
+	if got := QueryLimit(request, 10, 50); got != 10 {
+		t.Errorf("QueryLimit of a bad value = %d, want 10", got)
+	}
+}
+
+
+func TestKeysetSQL(t *testing.T) {
+	newest := Keyset{Columns: []string{"r.created_at", "r.id"}, Desc: true}
+	lowest := Keyset{Columns: []string{"-r.rating", "r.created_at", "r.id"}, Desc: true}
+	oldest := Keyset{Columns: []string{"r.created_at", "r.id"}}
+
+	forward := func(keys ...interface{}) Params {
+		return Params{Limit: 20, Cursor: &Cursor{Keys: keys}}
+	}
+	backward := func(keys ...interface{}) Params {
+		return Params{Limit: 20, Cursor: &Cursor{Keys: keys, Backward: true}}
+	}
+
+	tests := []struct {
+		name   string
+		keyset Keyset
+		params Params
+		where  string
+		order  string
+	}{
+		{"first page", newest, First("ratings", 20), "", " ORDER BY r.created_at DESC, r.id DESC LIMIT $2"},
+		{"descending", newest, forward("t", 5),
+			" AND (r.created_at, r.id) < ($2, $3)", " ORDER BY r.created_at DESC, r.id DESC LIMIT $4"},
+		{"descending backward", newest, backward("t", 5),
+			" AND (r.created_at, r.id) > ($2, $3)", " ORDER BY r.created_at ASC, r.id ASC LIMIT $4"},
+		{"ascending", oldest, forward("t", 5),
+			" AND (r.created_at, r.id) > ($2, $3)", " ORDER BY r.created_at ASC, r.id ASC LIMIT $4"},
+		{"ascending backward", oldest, backward("t", 5),
+			" AND (r.created_at, r.id) < ($2, $3)", " ORDER BY r.created_at DESC, r.id DESC LIMIT $4"},
+		{"negated column", lowest, forward(-4.5, "t", 5),
+			" AND (-r.rating, r.created_at, r.id) < ($2, $3, $4)", " ORDER BY -r.rating DESC, r.created_at DESC, r.id DESC LIMIT $5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			where, args, err := test.keyset.Where(test.params, []interface{}{42})
+			if err != nil {
+				t.Fatalf("Where: %v", err)
+			}
+			order, args := test.keyset.OrderBy(test.params, args)
+			if where != test.where {
+				t.Errorf("where = %q, want %q", where, test.where)
+			}
+			if order != test.order {
+				t.Errorf("order = %q, want %q", order, test.order)
+			}
+
+			want := []interface{}{42}
+			if test.params.Cursor != nil {
+				want = append(want, test.params.Cursor.Keys...)
+			}
+			want = append(want, 21)
+			if !reflect.DeepEqual(args, want) {
+				t.Errorf("args = %v, want %v", args, want)
+			}
+		})
+	}
+}
+
+
+func TestSlicePages(t *testing.T) {
+	rows := []int{1, 2, 3, 4, 5}
+	key := func(row int) []interface{} { return []interface{}{row} }
+
+	first, err := Slice(rows, First("numbers", 2), key, false)
+	if err != nil || !reflect.DeepEqual(first.Data, []int{1, 2}) || first.PrevCursor != "" {
+		t.Fatalf("first page = %+v, %v", first, err)
+	}
+
+	next, err := requestParams(t, "numbers", "limit=2&cursor="+first.NextCursor)
+	if err != nil {
+		t.Fatalf("FromRequest: %v", err)
+	}
+	second, err := Slice(rows, next, key, false)
+	if err != nil || !reflect.DeepEqual(second.Data, []int{3, 4}) || second.Offset != 2 {
+		t.Fatalf("second page = %+v, %v", second, err)
+	}
+
+	prev, err := requestParams(t, "numbers", "limit=2&cursor="+second.PrevCursor)
+	if err != nil {
+		t.Fatalf("FromRequest: %v", err)
+	}
+	back, err := Slice(rows, prev, key, false)
+	if err != nil || !reflect.DeepEqual(back.Data, []int{1, 2}) || back.Offset != 0 {
+		t.Errorf("page before the second = %+v, %v", back, err)
+	}
+}
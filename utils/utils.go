@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/smtp"
 	"os"
+	"path"
 	"regexp"
 	"strings"
 	"time"
@@ -137,6 +138,21 @@ func Slugify(name string, id int) string {
 } 
 
 
+// FormatDuration renders a runtime in seconds the way the catalog shows it,
+// e.g. "5h 12m" or "14m".
+func FormatDuration(seconds int) string {
+	hours := seconds / 3600
+	minutes := (seconds % 3600) / 60
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	if minutes == 0 && seconds > 0 {
+		return fmt.Sprintf("%ds", seconds)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+
 func GenerateOrderNumber() string {
 	return fmt.Sprintf("ORD-%d", time.Now().UnixNano())
 }
@@ -151,4 +167,24 @@ func ValidateRating(rating float32) error {
 		return errors.New("rating must have only one decimal place")
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+
+// ValidateVideoFile checks that a video source is a plain path relative to
+// the upload directory. Schemes are rejected so the transcoder cannot be
+// pointed at a URL or one of ffmpeg's special protocols, and ".." so it
+// cannot reach files outside the upload directory.
+func ValidateVideoFile(file string) error {
+	if file == "" {
+		return errors.New("video file is required")
+	}
+	if strings.ContainsAny(file, ":\\\x00") {
+		return errors.New("video file must be a path in the upload directory")
+	}
+
+	clean := path.Clean(file)
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return errors.New("video file must be a path in the upload directory")
+	}
+	return nil
+}